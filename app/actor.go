@@ -0,0 +1,23 @@
+package app
+
+import (
+	"context"
+)
+
+type actorContextKey struct{}
+
+// ActorSystem is the actor of changes that are not made on behalf of anyone.
+const ActorSystem = "system"
+
+// ContextWithActor returns a copy of ctx carrying the actor on whose behalf changes are made.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor carried by ctx, or ActorSystem if there is none.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorContextKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return ActorSystem
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+const (
+	ScopeOrdersRead    Scope = "orders:read"
+	ScopeOrdersWrite   Scope = "orders:write"
+	ScopeProductsRead  Scope = "products:read"
+	ScopeProductsWrite Scope = "products:write"
+	ScopeCustomersRead Scope = "customers:read"
+	ScopeReviewsRead   Scope = "reviews:read"
+	// ScopeAdmin grants every other scope, and the management of webhooks and of the catalog synchronization.
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []Scope{ScopeOrdersRead, ScopeOrdersWrite, ScopeProductsRead, ScopeProductsWrite, ScopeCustomersRead,
+	ScopeReviewsRead, ScopeAdmin}
+
+// IsScope returns if the provided string is a known scope.
+func IsScope(scope string) bool {
+	for _, known := range Scopes {
+		if string(known) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey represents a key granting access to the API. Only the hash of the key is stored, the key itself is shown
+// once when it is created.
+type APIKey struct {
+	UUID      string     `json:"uuid"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"-"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope returns if the key grants the provided scope, which the admin scope always does.
+func (k *APIKey) HasScope(scope Scope) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeysRepository should be implemented to get access to the API keys data store.
+type APIKeysRepository interface {
+	AddAPIKey(ctx context.Context, key APIKey) error
+	GetAPIKeys(ctx context.Context) ([]APIKey, error)
+	// GetActiveAPIKeyByHash retrieves the key with the provided hash, unless it has been revoked.
+	GetActiveAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	// RevokeAPIKey revokes a key that has not been revoked yet.
+	RevokeAPIKey(ctx context.Context, keyUUID string, revokedAt time.Time) error
+}
@@ -5,18 +5,43 @@ import (
 )
 
 var (
-	ErrNoRecords = errors.New("no records")
+	ErrNoRecords         = NewCodedError(CodeNotFound, "no records", nil)
+	ErrInvalidTransition = NewCodedError(CodeConflict, "invalid status transition", nil)
+)
+
+// Code is the machine-readable kind of an application error, stable across releases. It tells the layers reporting
+// an error how to report it without knowing where it comes from.
+type Code string
+
+const (
+	CodeInvalid              Code = "invalid_request"       // The input is malformed or breaks a rule.
+	CodeUnauthorized         Code = "unauthorized"          // The caller could not be authenticated.
+	CodeForbidden            Code = "forbidden"             // The caller is not allowed to do this.
+	CodeNotFound             Code = "not_found"             // The resource does not exist.
+	CodeConflict             Code = "conflict"              // The state of the resource does not allow it.
+	CodePreconditionFailed   Code = "precondition_failed"   // The resource changed since the caller read it.
+	CodePreconditionRequired Code = "precondition_required" // The caller must state the version it changes.
+	CodeUnprocessable        Code = "unprocessable_request" // The input is well-formed but cannot be processed.
+	CodeRateLimited          Code = "rate_limited"          // The caller sent too many requests.
+	CodeUnavailable          Code = "unavailable"           // A dependency is unavailable, retrying may succeed.
+	CodeInternal             Code = "internal_error"        // Anything else.
 )
 
 // Error defines a standard application error.
 type Error struct {
-	Msg string // Human-readable message.
-	Err error  // Nested error.
+	Code Code   // Machine-readable code, empty if the error is classified by the errors it wraps.
+	Msg  string // Human-readable message.
+	Err  error  // Nested error.
 }
 
 // NewError returns a pointer to app.Error.
 func NewError(msg string, err error) *Error {
-	return &Error{msg, err}
+	return &Error{Msg: msg, Err: err}
+}
+
+// NewCodedError returns a pointer to app.Error classified by the provided code.
+func NewCodedError(code Code, msg string, err error) *Error {
+	return &Error{Code: code, Msg: msg, Err: err}
 }
 
 // Error returns the error string of the first wrapped error.
@@ -53,7 +78,27 @@ func ErrorMessage(err error) string {
 	return err.Error()
 }
 
+// ErrorCode returns the code of the outermost app.Error of the chain that has one, if available.
+func ErrorCode(err error) Code {
+	for err != nil {
+		var appErr *Error
+		if !errors.As(err, &appErr) || appErr == nil {
+			return ""
+		}
+		if appErr.Code != "" {
+			return appErr.Code
+		}
+		err = appErr.Err
+	}
+	return ""
+}
+
+// HasErrorCode returns if the provided error is classified by the provided code.
+func HasErrorCode(err error, code Code) bool {
+	return ErrorCode(err) == code
+}
+
 // IsNotFoundError returns if the provided error
 func IsNotFoundError(err error) bool {
-	return errors.Is(err, ErrNoRecords)
+	return HasErrorCode(err, CodeNotFound)
 }
@@ -2,6 +2,7 @@ package app_test
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"syscall"
 	"testing"
@@ -109,3 +110,83 @@ func TestNilErrorFuncWithErrorInterface(t *testing.T) {
 		t.Errorf("Expected %#v, got %#v", appError, err)
 	}
 }
+
+func TestErrorCode(t *testing.T) {
+	err := fmt.Errorf("context: %w", &app.Error{
+		Msg: "message",
+		Err: &app.Error{Code: "code", Err: errors.New("cause")},
+	})
+	if app.ErrorCode(err) != "code" {
+		t.Errorf("Expected %q error code, got %q", "code", app.ErrorCode(err))
+	}
+}
+
+func TestErrorCodeWithoutCode(t *testing.T) {
+	err := app.NewError("message", errors.New("cause"))
+	if app.ErrorCode(err) != "" {
+		t.Errorf("Expected empty error code, got %q", app.ErrorCode(err))
+	}
+}
+
+func TestNewCodedErrorFunc(t *testing.T) {
+	err := app.NewCodedError(app.CodeConflict, "message", nil)
+	if app.ErrorCode(err) != app.CodeConflict {
+		t.Errorf("Expected %q error code, got %q", app.CodeConflict, app.ErrorCode(err))
+	}
+	if app.ErrorMessage(err) != "message" {
+		t.Errorf("Expected %q, got %q", "message", app.ErrorMessage(err))
+	}
+}
+
+func TestErrorCodeOfWrappedSentinel(t *testing.T) {
+	err := app.NewError("Order not found", fmt.Errorf("getting order: %w", app.ErrNoRecords))
+	if app.ErrorCode(err) != app.CodeNotFound {
+		t.Errorf("Expected %q error code, got %q", app.CodeNotFound, app.ErrorCode(err))
+	}
+	if !errors.Is(err, app.ErrNoRecords) {
+		t.Errorf("Expected app.ErrNoRecords, got %#v", err)
+	}
+}
+
+func TestErrorCodeWithOuterCode(t *testing.T) {
+	err := app.NewCodedError(app.CodeUnavailable, "message", app.ErrNoRecords)
+	if app.ErrorCode(err) != app.CodeUnavailable {
+		t.Errorf("Expected %q error code, got %q", app.CodeUnavailable, app.ErrorCode(err))
+	}
+}
+
+func TestErrorCodeWithErrorsPackage(t *testing.T) {
+	err := errors.New("test")
+	if app.ErrorCode(err) != "" {
+		t.Errorf("Expected empty error code, got %q", app.ErrorCode(err))
+	}
+}
+
+func TestHasErrorCode(t *testing.T) {
+	err := fmt.Errorf("context: %w", app.ErrInvalidTransition)
+	if !app.HasErrorCode(err, app.CodeConflict) {
+		t.Errorf("Expected %q error code, got %q", app.CodeConflict, app.ErrorCode(err))
+	}
+	if app.HasErrorCode(err, app.CodeNotFound) {
+		t.Errorf("Expected no %q error code", app.CodeNotFound)
+	}
+}
+
+func TestIsNotFoundError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: app.ErrNoRecords, want: true},
+		{err: fmt.Errorf("context: %w", app.ErrNoRecords), want: true},
+		{err: app.NewCodedError(app.CodeNotFound, "message", nil), want: true},
+		{err: app.ErrInvalidTransition, want: false},
+		{err: errors.New("no records"), want: false},
+		{err: nil, want: false},
+	}
+	for _, tt := range tests {
+		if app.IsNotFoundError(tt.err) != tt.want {
+			t.Errorf("Expected IsNotFoundError(%v) to be %t", tt.err, tt.want)
+		}
+	}
+}
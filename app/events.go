@@ -0,0 +1,61 @@
+package app
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the domain events.
+const (
+	EventReviewCreated      = "review.created"
+	EventReviewNegative     = "review.negative"
+	EventOrderStatusChanged = "order.status_changed"
+	EventOrderReviewed      = "order.reviewed"
+)
+
+// EventTypes lists every domain event type.
+var EventTypes = []string{EventReviewCreated, EventReviewNegative, EventOrderStatusChanged, EventOrderReviewed}
+
+// Event represents something that happened in the domain, e.g. a review was created.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// ReviewEventData is the data of the review.created and review.negative events.
+type ReviewEventData struct {
+	OrderUUID        string `json:"order_uuid"`
+	OrderProductUUID string `json:"order_product_uuid"`
+	Score            int64  `json:"score"`
+}
+
+// OrderStatusEventData is the data of the order.status_changed and order.reviewed events.
+type OrderStatusEventData struct {
+	OrderUUID string      `json:"order_uuid"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Actor     string      `json:"actor"`
+}
+
+// NewEvent returns a new Event of eventType with a unique ID and data encoded to JSON.
+func NewEvent(eventType string, data any, occurredAt time.Time) (Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{ID: uuid.New().String(), Type: eventType, OccurredAt: occurredAt.UTC(), Data: encoded}, nil
+}
+
+// IsEventType returns whether eventType is a known domain event type.
+func IsEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
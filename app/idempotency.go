@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+type IdempotencyRecordStatus string
+
+const (
+	IdempotencyRecordStatusProcessing IdempotencyRecordStatus = "processing"
+	IdempotencyRecordStatusCompleted  IdempotencyRecordStatus = "completed"
+	// IdempotencyRecordStatusResponseLost marks a request that was processed but whose response could not be stored.
+	IdempotencyRecordStatusResponseLost IdempotencyRecordStatus = "response_lost"
+)
+
+// IdempotencyRecord represents the outcome of a request sent with an idempotency key. Retries of the request with the
+// same key are answered with the stored response until the record expires.
+type IdempotencyRecord struct {
+	Actor           string                  `json:"actor"`
+	Key             string                  `json:"key"`
+	Fingerprint     string                  `json:"fingerprint"`
+	Status          IdempotencyRecordStatus `json:"status"`
+	ResponseStatus  int                     `json:"response_status"`
+	ResponseHeaders map[string]string       `json:"response_headers"`
+	ResponseBody    []byte                  `json:"response_body"`
+	CreatedAt       time.Time               `json:"created_at"`
+	ExpiresAt       time.Time               `json:"expires_at"`
+}
+
+// IdempotencyRepository should be implemented to get access to the idempotency records data store.
+type IdempotencyRepository interface {
+	// AddIdempotencyRecord stores a record unless the actor already has one with the same key. It returns whether the
+	// record was stored.
+	AddIdempotencyRecord(ctx context.Context, record IdempotencyRecord) (bool, error)
+	GetIdempotencyRecord(ctx context.Context, actor string, key string) (*IdempotencyRecord, error)
+	// ClaimIdempotencyRecord replaces the stored record with the same key if it expired or if the same request is
+	// still processing since before staleBefore. It returns false if the stored record is still in use.
+	ClaimIdempotencyRecord(ctx context.Context, record IdempotencyRecord, now time.Time,
+		staleBefore time.Time) (bool, error)
+	CompleteIdempotencyRecord(ctx context.Context, actor string, key string, status int, headers map[string]string,
+		body []byte) error
+	// LoseIdempotencyResponse marks the record with the same key as processed without a stored response, so that it
+	// is not claimed again before it expires.
+	LoseIdempotencyResponse(ctx context.Context, actor string, key string) error
+	// ReleaseIdempotencyRecord deletes the record with the same key if its request is still processing, so that the
+	// request can be retried.
+	ReleaseIdempotencyRecord(ctx context.Context, actor string, key string) error
+	// DeleteExpiredIdempotencyRecords deletes the records expired before expiredBefore and returns how many were
+	// deleted.
+	DeleteExpiredIdempotencyRecords(ctx context.Context, expiredBefore time.Time) (int64, error)
+}
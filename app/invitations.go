@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+type ReviewInvitationStatus string
+
+const (
+	ReviewInvitationStatusPending ReviewInvitationStatus = "pending"
+	ReviewInvitationStatusSending ReviewInvitationStatus = "sending"
+	ReviewInvitationStatusSent    ReviewInvitationStatus = "sent"
+	ReviewInvitationStatusFailed  ReviewInvitationStatus = "failed"
+)
+
+// ReviewInvitation represents an invitation to a customer to review a completed order.
+type ReviewInvitation struct {
+	UUID         string                 `json:"uuid"`
+	OrderUUID    string                 `json:"order_uuid"`
+	CustomerUUID string                 `json:"customer_uuid"`
+	Email        string                 `json:"email"`
+	FirstName    string                 `json:"first_name"`
+	Status       ReviewInvitationStatus `json:"status"`
+	Attempts     int                    `json:"attempts"`
+	LastError    string                 `json:"last_error"`
+	CreatedAt    time.Time              `json:"created_at"`
+	SentAt       *time.Time             `json:"sent_at"`
+}
+
+// ReviewInvitationsRepository should be implemented to get access to the review invitations data store.
+type ReviewInvitationsRepository interface {
+	// AddReviewInvitation stores a pending invitation. It returns false if the order already has an invitation.
+	AddReviewInvitation(ctx context.Context, invitation ReviewInvitation) (bool, error)
+	GetPendingReviewInvitations(ctx context.Context, staleBefore time.Time, limit int) ([]ReviewInvitation, error)
+	// ClaimReviewInvitation marks a pending invitation as being sent. It returns false if another process
+	// claimed it first.
+	ClaimReviewInvitation(ctx context.Context, uuid string, staleBefore time.Time, claimedAt time.Time) (bool, error)
+	MarkReviewInvitationSent(ctx context.Context, uuid string, sentAt time.Time) error
+	MarkReviewInvitationFailed(ctx context.Context, uuid string, lastError string, status ReviewInvitationStatus) error
+	// AddReviewOptOut records that a customer does not want to be reminded to review orders.
+	AddReviewOptOut(ctx context.Context, customerUUID string, createdAt time.Time) error
+	HasReviewOptOut(ctx context.Context, customerUUID string) (bool, error)
+}
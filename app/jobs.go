@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+type ScheduledJobStatus string
+
+const (
+	ScheduledJobStatusPending   ScheduledJobStatus = "pending"
+	ScheduledJobStatusRunning   ScheduledJobStatus = "running"
+	ScheduledJobStatusDone      ScheduledJobStatus = "done"
+	ScheduledJobStatusFailed    ScheduledJobStatus = "failed"
+	ScheduledJobStatusCancelled ScheduledJobStatus = "cancelled"
+)
+
+// ScheduledJob represents a task to run once its RunAt time is reached.
+// Key identifies the job, so scheduling the same job twice has no effect, and Subject groups the jobs concerning
+// the same entity, e.g. an order, so they can be cancelled together.
+type ScheduledJob struct {
+	UUID      string             `json:"uuid"`
+	Kind      string             `json:"kind"`
+	Key       string             `json:"key"`
+	Subject   string             `json:"subject"`
+	Payload   []byte             `json:"payload"`
+	Status    ScheduledJobStatus `json:"status"`
+	Attempts  int                `json:"attempts"`
+	LastError string             `json:"last_error"`
+	RunAt     time.Time          `json:"run_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// ScheduledJobsRepository should be implemented to get access to the scheduled jobs data store.
+type ScheduledJobsRepository interface {
+	// AddScheduledJob stores a pending job. It returns false if a job with the same key already exists.
+	AddScheduledJob(ctx context.Context, job ScheduledJob) (bool, error)
+	GetDueScheduledJobs(ctx context.Context, now time.Time, staleBefore time.Time, limit int) ([]ScheduledJob, error)
+	// ClaimScheduledJob marks a due job as running. It returns false if another process claimed it first.
+	ClaimScheduledJob(ctx context.Context, uuid string, now time.Time, staleBefore time.Time) (bool, error)
+	FinishScheduledJob(ctx context.Context, uuid string, status ScheduledJobStatus, lastError string,
+		finishedAt time.Time) error
+	RescheduleScheduledJob(ctx context.Context, uuid string, runAt time.Time, lastError string) error
+	// CancelScheduledJobs cancels the pending jobs of a kind concerning subject and returns how many were cancelled.
+	CancelScheduledJobs(ctx context.Context, kind string, subject string) (int64, error)
+}
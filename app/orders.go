@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -15,6 +16,45 @@ const (
 	OrderStatusReviewed  OrderStatus = "reviewed"
 )
 
+// orderStatusTransitions holds the statuses each order status may move to.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPlaced:    {OrderStatusPreparing},
+	OrderStatusPreparing: {OrderStatusSending},
+	OrderStatusSending:   {OrderStatusCompleted},
+	OrderStatusCompleted: {OrderStatusReviewed},
+	OrderStatusReviewed:  {},
+}
+
+// IsValid returns if the status is one of the known order statuses.
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo returns if an order may move from the status to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresReviews returns if an order only moves to the status along with its reviews, which a status change
+// alone may not do.
+func (s OrderStatus) RequiresReviews() bool {
+	return s == OrderStatusReviewed
+}
+
+// ValidateTransition returns an ErrInvalidTransition error if an order may not move from the status to next.
+func (s OrderStatus) ValidateTransition(next OrderStatus) error {
+	if !s.CanTransitionTo(next) {
+		return NewError(fmt.Sprintf("Order status cannot change from %s to %s", s, next), ErrInvalidTransition)
+	}
+	return nil
+}
+
 // Customer represents a customer entity.
 type Customer struct {
 	UUID             string    `json:"uuid"`
@@ -25,12 +65,96 @@ type Customer struct {
 	RegistrationDate time.Time `json:"registration_date"`
 }
 
+// CustomerReviewStats holds how often a customer reviewed the orders they could review and how they rated them.
+// Orders can be reviewed once they are completed.
+type CustomerReviewStats struct {
+	ReviewableOrderCount int64 `json:"reviewable_order_count"`
+	ReviewedOrderCount   int64 `json:"reviewed_order_count"`
+	ReviewCount          int64 `json:"review_count"`
+	ScoreSum             int64 `json:"score_sum"`
+}
+
+// ParticipationRate returns the share of the reviewable orders the customer reviewed, 0 without reviewable orders.
+func (s CustomerReviewStats) ParticipationRate() float64 {
+	if s.ReviewableOrderCount == 0 {
+		return 0
+	}
+	return float64(s.ReviewedOrderCount) / float64(s.ReviewableOrderCount)
+}
+
+// AverageSentiment returns the mean score of the customer's reviews, 0 without reviews.
+func (s CustomerReviewStats) AverageSentiment() float64 {
+	return MeanScore(s.ScoreSum, s.ReviewCount)
+}
+
+// CustomerProfile is a customer along with their review statistics.
+type CustomerProfile struct {
+	Customer    Customer            `json:"customer"`
+	ReviewStats CustomerReviewStats `json:"review_stats"`
+}
+
 // Order represents an order entity at the Database.
 type Order struct {
 	UUID       string      `json:"uuid"`
 	Customer   Customer    `json:"customer"`
 	Status     OrderStatus `json:"status"`
 	PlacedDate time.Time   `json:"placed_date"`
+	// Version is incremented by every change of the order, starting at 1.
+	Version int `json:"version"`
+}
+
+// OrderSort is the order orders are listed in. A leading "-" sorts in descending order.
+type OrderSort string
+
+const (
+	OrderSortNewest OrderSort = "-placed_date"
+	OrderSortOldest OrderSort = "placed_date"
+)
+
+// IsValid returns if the sort is one of the known order sorts.
+func (s OrderSort) IsValid() bool {
+	return s == OrderSortNewest || s == OrderSortOldest
+}
+
+// OrderCursor is the position of an order in a listing, the listing continues after it.
+type OrderCursor struct {
+	Sort       OrderSort `json:"sort"`
+	PlacedDate time.Time `json:"placed_date"`
+	UUID       string    `json:"uuid"`
+}
+
+// OrderQuery filters, sorts and paginates a listing of orders. Orders with any of Statuses match.
+// From is inclusive and To exclusive. Zero values do not filter.
+type OrderQuery struct {
+	Statuses     []OrderStatus
+	CustomerUUID string
+	From         time.Time
+	To           time.Time
+	Sort         OrderSort
+	After        *OrderCursor
+	Limit        int
+}
+
+// OrderPage is a page of a listing of orders. NextCursor is empty on the last page.
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// OrderLine is a product and the number of its items to order.
+type OrderLine struct {
+	ProductUUID string `json:"product_uuid"`
+	Items       int    `json:"items"`
+}
+
+// OrderStatusTransition represents a change of an order's status.
+type OrderStatusTransition struct {
+	UUID      string      `json:"uuid"`
+	OrderUUID string      `json:"order_uuid"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Actor     string      `json:"actor"`
+	CreatedAt time.Time   `json:"created_at"`
 }
 
 // OrderProduct represents an order products entity.
@@ -42,26 +166,111 @@ type OrderProduct struct {
 	Product     Product `json:"product"`
 }
 
+// OrderProductReview represents the review a customer gave for an order product.
+type OrderProductReview struct {
+	OrderProductUUID string    `json:"order_product_uuid"`
+	Score            int64     `json:"score"`
+	Text             string    `json:"text"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 // Product represents a product entity.
 type Product struct {
-	UUID               string    `json:"uuid"`
-	Name               string    `json:"name"`
-	Description        string    `json:"description"`
-	Image              string    `json:"items"`
-	AvailabilityStatus string    `json:"availability_status"`
-	AvailableItems     int       `json:"available_items"`
-	CreatedAt          time.Time `json:"createdAt"`
-	Manufacturer       string    `json:"manufacturer"`
-	Vehicle            string    `json:"vehicle"`
-	ID                 string    `json:"id"`
+	UUID               string     `json:"uuid"`
+	Name               string     `json:"name"`
+	Description        string     `json:"description"`
+	Image              string     `json:"image"`
+	AvailabilityStatus string     `json:"availability_status"`
+	AvailableItems     int        `json:"available_items"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	Manufacturer       string     `json:"manufacturer"`
+	Vehicle            string     `json:"vehicle"`
+	ID                 string     `json:"id"`
+	DiscontinuedAt     *time.Time `json:"discontinued_at,omitempty"`
+}
+
+// ProductCursor is the position of a product in a listing, the listing continues after it.
+type ProductCursor struct {
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
+
+// ProductQuery filters and paginates a listing of products sorted by name. Search matches a part of the name or of
+// the manufacturer and Availability the availability status. Zero values do not filter.
+type ProductQuery struct {
+	Search       string
+	Availability string
+	After        *ProductCursor
+	Limit        int
+}
+
+// ProductPage is a page of a listing of products. NextCursor is empty on the last page.
+type ProductPage struct {
+	Products   []Product `json:"products"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// ProductSyncSummary reports the outcome of a product catalog synchronization.
+type ProductSyncSummary struct {
+	Created      int `json:"created"`
+	Updated      int `json:"updated"`
+	Unchanged    int `json:"unchanged"`
+	Discontinued int `json:"discontinued"`
+	// Skipped counts the products of the feed without a unique id.
+	Skipped int `json:"skipped"`
+	// Aborted tells why the synchronization left the catalog untouched, it is empty when the feed was applied.
+	Aborted string `json:"aborted,omitempty"`
+}
+
+// CatalogSyncRun describes a single product catalog synchronization run.
+type CatalogSyncRun struct {
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Summary    *ProductSyncSummary `json:"summary,omitempty"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// CatalogSyncStatus describes the state of the product catalog synchronization.
+type CatalogSyncStatus struct {
+	Running   bool            `json:"running"`
+	LastRun   *CatalogSyncRun `json:"last_run,omitempty"`
+	NextRunAt *time.Time      `json:"next_run_at,omitempty"`
 }
 
 // OrdersRepository should be implemented to get access to the data store.
 type OrdersRepository interface {
 	GetOrderByUUID(ctx context.Context, uuid string) (*Order, error)
+	// GetOrders gets the orders matching query, at most query.Limit of them.
+	GetOrders(ctx context.Context, query OrderQuery) ([]Order, error)
+	GetCustomerByUUID(ctx context.Context, uuid string) (*Customer, error)
+	GetCustomerByEmail(ctx context.Context, email string) (*Customer, error)
+	GetCustomerReviewStats(ctx context.Context, customerUUID string) (*CustomerReviewStats, error)
+	// UpdateOrderStatusByOrderUUID updates an order's status and increments its version.
 	UpdateOrderStatusByOrderUUID(ctx context.Context, uuid string, status string) error
+	// GetOrderStatusForUpdate gets an order's status and version and locks the order until the surrounding
+	// transaction ends.
+	GetOrderStatusForUpdate(ctx context.Context, uuid string) (OrderStatus, int, error)
+	// GetOrderByIdempotencyKey gets the order a customer created with an idempotency key.
+	GetOrderByIdempotencyKey(ctx context.Context, customerUUID string, idempotencyKey string) (*Order, error)
+	// AddOrder stores an order without products. A non-empty idempotencyKey must be unique per customer.
+	AddOrder(ctx context.Context, order Order, idempotencyKey string) error
+	AddOrderProduct(ctx context.Context, orderProduct OrderProduct) error
+	// ReserveProductItems takes items from the available items of a product. It reports false, leaving the product
+	// untouched, if fewer items are available.
+	ReserveProductItems(ctx context.Context, productUUID string, items int) (bool, error)
+	AddOrderStatusTransition(ctx context.Context, transition OrderStatusTransition) error
+	GetOrderStatusTransitionsByOrderUUID(ctx context.Context, uuid string) ([]OrderStatusTransition, error)
+	// AddOutboxEvent stores a domain event to be published once the surrounding transaction is committed.
+	AddOutboxEvent(ctx context.Context, event Event) error
 	GetOrderProductsByOrderUUID(ctx context.Context, uuid string) ([]OrderProduct, error)
-	AddOrderProductReviewByOrderProductUUID(ctx context.Context, orderProductUUID string,
-		score int64) error
+	AddOrderProductReviewByOrderProductUUID(ctx context.Context, review OrderProductReview) error
+	GetProductByUUID(ctx context.Context, uuid string) (*Product, error)
+	GetProducts(ctx context.Context, query ProductQuery) ([]Product, error)
 	AddProduct(ctx context.Context, product Product) error
+	UpdateProduct(ctx context.Context, product Product) error
+	DeleteProduct(ctx context.Context, uuid string) error
+	GetCatalogProducts(ctx context.Context) ([]Product, error)
+	// WithinTransaction runs fn atomically. All calls made through the repository passed to fn either
+	// succeed together or are rolled back together.
+	WithinTransaction(ctx context.Context, fn func(repo OrdersRepository) error) error
 }
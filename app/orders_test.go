@@ -0,0 +1,58 @@
+package app_test
+
+import (
+	"errors"
+	"testing"
+
+	"reviewbot/app"
+)
+
+func TestOrderStatusTransitions(t *testing.T) {
+	allowed := map[app.OrderStatus]app.OrderStatus{
+		app.OrderStatusPlaced:    app.OrderStatusPreparing,
+		app.OrderStatusPreparing: app.OrderStatusSending,
+		app.OrderStatusSending:   app.OrderStatusCompleted,
+		app.OrderStatusCompleted: app.OrderStatusReviewed,
+	}
+	statuses := []app.OrderStatus{app.OrderStatusPlaced, app.OrderStatusPreparing, app.OrderStatusSending,
+		app.OrderStatusCompleted, app.OrderStatusReviewed}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[from] == to
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("Expected transition from %s to %s allowed=%t, got %t", from, to, want, got)
+			}
+		}
+	}
+}
+
+func TestOrderStatusValidateTransition(t *testing.T) {
+	err := app.OrderStatusReviewed.ValidateTransition(app.OrderStatusPreparing)
+	if !errors.Is(err, app.ErrInvalidTransition) {
+		t.Errorf("Expected %v, got %v", app.ErrInvalidTransition, err)
+	}
+	if err := app.OrderStatusPlaced.ValidateTransition(app.OrderStatusPreparing); err != nil {
+		t.Errorf("Expected nil, got %v", err)
+	}
+}
+
+func TestOrderStatusIsValid(t *testing.T) {
+	if !app.OrderStatusCompleted.IsValid() {
+		t.Errorf("Expected %q to be valid", app.OrderStatusCompleted)
+	}
+	if app.OrderStatus("cancelled").IsValid() {
+		t.Errorf("Expected %q to be invalid", "cancelled")
+	}
+}
+
+// TestStarsOf tests that the review scores are spread over the 1 to 5 stars, and that out of range scores are
+// clamped.
+func TestStarsOf(t *testing.T) {
+	want := map[int64]int{-2: 1, -1: 1, 0: 3, 1: 5, 2: 5}
+	for score, stars := range want {
+		if got := app.StarsOf(score); got != stars {
+			t.Errorf("Stars mismatch for score %d: got %d, want %d", score, got, stars)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+type OutboxEventStatus string
+
+const (
+	OutboxEventStatusPending    OutboxEventStatus = "pending"
+	OutboxEventStatusPublishing OutboxEventStatus = "publishing"
+	OutboxEventStatusPublished  OutboxEventStatus = "published"
+)
+
+// OutboxEvent represents a domain event stored in the same transaction as the change it describes, waiting to be
+// published. Events are published at least once: an event may be published again if the relay fails before
+// recording it as published, so consumers must deduplicate them by Event.ID.
+type OutboxEvent struct {
+	ID            int64             `json:"id"`
+	Event         Event             `json:"event"`
+	Status        OutboxEventStatus `json:"status"`
+	Attempts      int               `json:"attempts"`
+	LastError     string            `json:"last_error"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+}
+
+// OutboxRepository should be implemented to get access to the outbox data store.
+type OutboxRepository interface {
+	// GetPendingOutboxEvents gets the events due for publication in the order they were stored.
+	// Events claimed before staleBefore are considered abandoned and are returned as well.
+	GetPendingOutboxEvents(ctx context.Context, now time.Time, staleBefore time.Time, limit int) ([]OutboxEvent,
+		error)
+	// ClaimOutboxEvent marks a pending event as publishing. It returns false if another relay claimed it first.
+	ClaimOutboxEvent(ctx context.Context, id int64, now time.Time, staleBefore time.Time) (bool, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64, publishedAt time.Time) error
+	RescheduleOutboxEvent(ctx context.Context, id int64, nextAttemptAt time.Time, lastError string) error
+	// DeletePublishedOutboxEvents deletes the events published before publishedBefore and returns how many were
+	// deleted.
+	DeletePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64, error)
+}
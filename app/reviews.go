@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// SentimentBand groups review scores by the sentiment they express.
+type SentimentBand string
+
+const (
+	SentimentPositive SentimentBand = "positive"
+	SentimentNeutral  SentimentBand = "neutral"
+	SentimentNegative SentimentBand = "negative"
+)
+
+// IsValid returns if the band is one of the known sentiment bands.
+func (b SentimentBand) IsValid() bool {
+	return b == SentimentPositive || b == SentimentNeutral || b == SentimentNegative
+}
+
+// SentimentOf returns the sentiment band of a review score.
+func SentimentOf(score int64) SentimentBand {
+	switch {
+	case score > 0:
+		return SentimentPositive
+	case score < 0:
+		return SentimentNegative
+	default:
+		return SentimentNeutral
+	}
+}
+
+// MinReviewScore and MaxReviewScore bound the review scores, which are the sentiment scores of the analyzer.
+const (
+	MinReviewScore = -1
+	MaxReviewScore = 1
+)
+
+// StarsOf returns the 1 to 5 star rating of a review score, spreading the scores evenly over the stars: 1 star for
+// MinReviewScore, 3 stars for a neutral score and 5 stars for MaxReviewScore. Scores out of range are clamped.
+func StarsOf(score int64) int {
+	score = max(MinReviewScore, min(MaxReviewScore, score))
+	return int(1 + (score-MinReviewScore)*4/(MaxReviewScore-MinReviewScore))
+}
+
+// ReviewSort is the order reviews are listed in. A leading "-" sorts in descending order.
+type ReviewSort string
+
+const (
+	ReviewSortNewest  ReviewSort = "-created_at"
+	ReviewSortOldest  ReviewSort = "created_at"
+	ReviewSortHighest ReviewSort = "-score"
+	ReviewSortLowest  ReviewSort = "score"
+)
+
+// IsValid returns if the sort is one of the known review sorts.
+func (s ReviewSort) IsValid() bool {
+	return s == ReviewSortNewest || s == ReviewSortOldest || s == ReviewSortHighest || s == ReviewSortLowest
+}
+
+// Review represents a customer's review of an order product along with what it concerns.
+type Review struct {
+	UUID             string    `json:"uuid"`
+	OrderUUID        string    `json:"order_uuid"`
+	OrderProductUUID string    `json:"order_product_uuid"`
+	ProductUUID      string    `json:"product_uuid"`
+	CustomerUUID     string    `json:"customer_uuid"`
+	Score            int64     `json:"score"`
+	Text             string    `json:"text"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ReviewCursor is the position of a review in a listing, the listing continues after it.
+type ReviewCursor struct {
+	Sort      ReviewSort `json:"sort"`
+	Score     int64      `json:"score"`
+	CreatedAt time.Time  `json:"created_at"`
+	UUID      string     `json:"uuid"`
+}
+
+// ReviewQuery filters, sorts and paginates a listing of reviews.
+// From is inclusive and To exclusive. Zero values do not filter.
+type ReviewQuery struct {
+	Sentiment SentimentBand
+	From      time.Time
+	To        time.Time
+	Sort      ReviewSort
+	After     *ReviewCursor
+	Limit     int
+}
+
+// ReviewPage is a page of a listing of reviews. NextCursor is empty on the last page.
+type ReviewPage struct {
+	Reviews    []Review `json:"reviews"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// ProductReviewStats holds the running totals of the reviews of a product.
+type ProductReviewStats struct {
+	ProductUUID   string     `json:"product_uuid"`
+	ReviewCount   int64      `json:"review_count"`
+	ScoreSum      int64      `json:"score_sum"`
+	PositiveCount int64      `json:"positive_count"`
+	NeutralCount  int64      `json:"neutral_count"`
+	NegativeCount int64      `json:"negative_count"`
+	Stars         [5]int64   `json:"stars"`
+	LastReviewAt  *time.Time `json:"last_review_at"`
+}
+
+// MeanScore returns the mean score of the reviews, 0 without reviews.
+func (s ProductReviewStats) MeanScore() float64 {
+	return MeanScore(s.ScoreSum, s.ReviewCount)
+}
+
+// DailyReviewStats holds the totals of the reviews a product got on a day.
+type DailyReviewStats struct {
+	Day         time.Time `json:"day"`
+	ReviewCount int64     `json:"review_count"`
+	ScoreSum    int64     `json:"score_sum"`
+}
+
+// MeanScore returns the mean score of the reviews of the day, 0 without reviews.
+func (s DailyReviewStats) MeanScore() float64 {
+	return MeanScore(s.ScoreSum, s.ReviewCount)
+}
+
+// ReviewTrend compares the reviews of a product during the last Days days, today included, with the Days days
+// before them.
+type ReviewTrend struct {
+	Days                int                `json:"days"`
+	ReviewCount         int64              `json:"review_count"`
+	MeanScore           float64            `json:"mean_score"`
+	PreviousReviewCount int64              `json:"previous_review_count"`
+	PreviousMeanScore   float64            `json:"previous_mean_score"`
+	Daily               []DailyReviewStats `json:"daily"`
+}
+
+// ProductReviewSummary describes how a product is perceived by its reviewers.
+type ProductReviewSummary struct {
+	Stats ProductReviewStats `json:"stats"`
+	Trend ReviewTrend        `json:"trend"`
+}
+
+// MeanScore returns the mean of count review scores adding up to sum, 0 without reviews.
+func MeanScore(sum int64, count int64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(sum) / float64(count)
+}
+
+// ReviewsRepository should be implemented to get access to the reviews data store.
+// Listings fail with ErrNoRecords if the order, product or customer does not exist.
+type ReviewsRepository interface {
+	GetReviewsByOrderUUID(ctx context.Context, orderUUID string, query ReviewQuery) ([]Review, error)
+	GetReviewsByProductUUID(ctx context.Context, productUUID string, query ReviewQuery) ([]Review, error)
+	GetReviewsByCustomerUUID(ctx context.Context, customerUUID string, query ReviewQuery) ([]Review, error)
+	// GetProductReviewStats gets the review totals of a product, all zero if it has no reviews.
+	GetProductReviewStats(ctx context.Context, productUUID string) (*ProductReviewStats, error)
+	// GetProductDailyReviewStats gets the daily review totals of a product since a day, oldest first. Days without
+	// reviews are left out.
+	GetProductDailyReviewStats(ctx context.Context, productUUID string, since time.Time) ([]DailyReviewStats, error)
+	// RebuildProductReviewStats recomputes the review totals of every product from the reviews and returns the
+	// number of products with reviews.
+	RebuildProductReviewStats(ctx context.Context) (int64, error)
+}
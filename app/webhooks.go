@@ -0,0 +1,70 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSending   WebhookDeliveryStatus = "sending"
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryStatusDead      WebhookDeliveryStatus = "dead"
+)
+
+// WebhookSubscription represents an endpoint the events of the given types are delivered to.
+type WebhookSubscription struct {
+	UUID      string    `json:"uuid"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribes returns whether the subscription wants the events of eventType.
+func (ws WebhookSubscription) Subscribes(eventType string) bool {
+	for _, event := range ws.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery represents the delivery of an event to a webhook subscription.
+// Deliveries that failed too many times are moved to the dead letters, from which they can be redelivered.
+type WebhookDelivery struct {
+	UUID             string                `json:"uuid"`
+	SubscriptionUUID string                `json:"subscription_uuid"`
+	EventID          string                `json:"event_id"`
+	EventType        string                `json:"event_type"`
+	Payload          []byte                `json:"payload"`
+	Status           WebhookDeliveryStatus `json:"status"`
+	Attempts         int                   `json:"attempts"`
+	LastError        string                `json:"last_error"`
+	NextAttemptAt    time.Time             `json:"next_attempt_at"`
+	CreatedAt        time.Time             `json:"created_at"`
+}
+
+// WebhooksRepository should be implemented to get access to the webhooks data store.
+type WebhooksRepository interface {
+	AddWebhookSubscription(ctx context.Context, subscription WebhookSubscription) error
+	GetWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	GetWebhookSubscriptionByUUID(ctx context.Context, uuid string) (*WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, uuid string) error
+	// AddWebhookDelivery stores a pending delivery. Delivering an event twice to a subscription has no effect.
+	AddWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error
+	GetDueWebhookDeliveries(ctx context.Context, now time.Time, staleBefore time.Time,
+		limit int) ([]WebhookDelivery, error)
+	// ClaimWebhookDelivery marks a due delivery as being sent. It returns false if another process claimed it first.
+	ClaimWebhookDelivery(ctx context.Context, uuid string, now time.Time, staleBefore time.Time) (bool, error)
+	MarkWebhookDeliveryDelivered(ctx context.Context, uuid string, deliveredAt time.Time) error
+	RescheduleWebhookDelivery(ctx context.Context, uuid string, nextAttemptAt time.Time, lastError string) error
+	// DeadLetterWebhookDelivery moves a delivery that will not be retried anymore to the dead letters.
+	DeadLetterWebhookDelivery(ctx context.Context, delivery WebhookDelivery, failedAt time.Time) error
+	GetWebhookDeadLetters(ctx context.Context, subscriptionUUID string) ([]WebhookDelivery, error)
+	// RedeliverWebhookDeadLetter moves a dead letter back to the pending deliveries.
+	RedeliverWebhookDeadLetter(ctx context.Context, subscriptionUUID string, uuid string, now time.Time) error
+}
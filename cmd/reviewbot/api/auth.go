@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"reviewbot/app"
+	"reviewbot/internal/apikeys"
+	"strings"
+)
+
+// ActorAnonymous is the actor recorded for changes made through requests without credentials.
+const ActorAnonymous = "anonymous"
+
+const (
+	// apiKeyActorPrefix starts the actor recorded for changes made through requests authenticated with an API key.
+	apiKeyActorPrefix = "api-key:"
+	// customerActorPrefix starts the actor recorded for changes made through requests authenticated with the token
+	// of a customer.
+	customerActorPrefix = "customer:"
+	// QueryParamAccessToken has the name of the query parameter carrying the token of a websocket request, as
+	// browsers cannot set the Authorization header of those.
+	QueryParamAccessToken = "access_token"
+)
+
+type apiKeyContextKey struct{}
+
+type customerContextKey struct{}
+
+// apiKeyFromContext returns the API key the request of ctx was authenticated with, or nil if it was not.
+func apiKeyFromContext(ctx context.Context) *app.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*app.APIKey)
+	return key
+}
+
+// customerFromContext returns the customer the request of ctx was authenticated as, or nil if it was not.
+func customerFromContext(ctx context.Context) *app.Customer {
+	customer, _ := ctx.Value(customerContextKey{}).(*app.Customer)
+	return customer
+}
+
+// requestCredentials returns the API key or the customer token sent with a request. The API key is sent as the
+// X-API-Key header or as a bearer token, the customer token as a bearer token or, for a websocket, as the
+// access_token query parameter. Bearer tokens are API keys when they look like one or when customers cannot
+// authenticate.
+func (srv *Server) requestCredentials(r *http.Request) (apiKey string, customerToken string) {
+	if key := r.Header.Get(HTTPHeaderNameAPIKey); key != "" {
+		return key, ""
+	}
+	var bearer string
+	scheme, token, ok := strings.Cut(r.Header.Get(HTTPHeaderNameAuthorization), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		bearer = strings.TrimSpace(token)
+	} else if websocket.IsWebSocketUpgrade(r) {
+		bearer = r.URL.Query().Get(QueryParamAccessToken)
+	}
+	if bearer == "" || strings.HasPrefix(bearer, apikeys.KeyPrefix) || srv.CustomerAuthenticator == nil {
+		return bearer, ""
+	}
+	return "", bearer
+}
+
+// authenticate identifies the caller of a request, by its API key or by the token of a customer, and records it as
+// the actor of the changes the request makes. A request with invalid credentials is refused with a 401. A request
+// without credentials is anonymous, authorize only lets it reach the routes requiring no scope. The credentials of
+// an IP address over its limit of failed checks are refused with a 429 without being checked, so that they cannot be
+// guessed.
+func (srv *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+		apiKey, customerToken := srv.requestCredentials(r)
+		if apiKey != "" || customerToken != "" {
+			if wait := srv.authFailuresWait(r); wait > 0 {
+				srv.refuseRateLimited(w, r, wait)
+				return
+			}
+		}
+		switch {
+		case apiKey != "" && srv.APIKeysService != nil:
+			key, err := srv.APIKeysService.Authenticate(ctx, apiKey)
+			if err != nil {
+				log.With("success", false, "err", err)
+				if app.ErrorCode(err) == app.CodeUnauthorized {
+					srv.recordAuthFailure(r)
+				}
+				w.Header().Set(HTTPHeaderNameWWWAuthenticate, "Bearer")
+				AppError(w, err)
+				return
+			}
+			ctx = context.WithValue(ctx, apiKeyContextKey{}, key)
+			ctx = app.ContextWithActor(ctx, apiKeyActorPrefix+key.UUID)
+		case customerToken != "":
+			customer, err := srv.CustomerAuthenticator.Authenticate(ctx, customerToken)
+			if err != nil {
+				log.With("success", false, "err", err)
+				if app.ErrorCode(err) == app.CodeUnauthorized {
+					srv.recordAuthFailure(r)
+				}
+				w.Header().Set(HTTPHeaderNameWWWAuthenticate, `Bearer error="invalid_token"`)
+				AppError(w, err)
+				return
+			}
+			ctx = context.WithValue(ctx, customerContextKey{}, customer)
+			ctx = app.ContextWithActor(ctx, customerActorPrefix+customer.UUID)
+		default:
+			ctx = app.ContextWithActor(ctx, ActorAnonymous)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// resourceOwner returns the UUID of the customer owning the resource a request is about.
+type resourceOwner func(r *http.Request) (string, error)
+
+// scopedHandler is a handler reserved to the requests whose API key grants scope, and to the customers owning the
+// resource of the request if owner is set. Without a scope, anonymous requests and every API key are let through.
+type scopedHandler struct {
+	scope          app.Scope
+	owner          resourceOwner
+	ownIdempotency bool
+	handler        http.HandlerFunc
+}
+
+func (sh scopedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sh.handler(w, r)
+}
+
+// orCustomerOwner also lets the customers owning the resource of a request through.
+func (sh scopedHandler) orCustomerOwner(owner resourceOwner) scopedHandler {
+	sh.owner = owner
+	return sh
+}
+
+// handlesIdempotencyKey marks a handler applying the Idempotency-Key header itself, which the idempotent middleware
+// then leaves to it.
+func (sh scopedHandler) handlesIdempotencyKey() scopedHandler {
+	sh.ownIdempotency = true
+	return sh
+}
+
+// requireScope reserves a handler to the requests whose API key grants scope. The scope is checked by authorize,
+// before the request is validated.
+func requireScope(scope app.Scope, handler http.HandlerFunc) scopedHandler {
+	return scopedHandler{scope: scope, handler: handler}
+}
+
+// customerOwned reserves a handler to the customers owning the resource of a request. Anonymous requests and API
+// keys are let through, the handler must check them itself.
+func customerOwned(owner resourceOwner, handler http.HandlerFunc) scopedHandler {
+	return scopedHandler{owner: owner, handler: handler}
+}
+
+// routeHandler returns the handler of the route of a request if it is a scopedHandler.
+func routeHandler(r *http.Request) (scopedHandler, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return scopedHandler{}, false
+	}
+	scoped, ok := route.GetHandler().(scopedHandler)
+	return scoped, ok
+}
+
+// authorize refuses the requests to the routes reserved with requireScope or customerOwned: with a 401 if they
+// are anonymous and need a scope, and with a 403 if their API key does not grant the scope of the route or if
+// their customer does not own the resource.
+func (srv *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scoped, ok := routeHandler(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if customer := customerFromContext(r.Context()); customer != nil {
+			if scoped.owner == nil {
+				AppError(w, app.NewCodedError(app.CodeForbidden, "Customers may not use this operation", nil))
+				return
+			}
+			owner, err := scoped.owner(r)
+			if err != nil {
+				srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(r.Context())).With("success", false, "err", err)
+				AppError(w, err)
+				return
+			}
+			if owner != customer.UUID {
+				AppError(w, app.NewCodedError(app.CodeForbidden, "The resource belongs to another customer", nil))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if scoped.scope == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := apiKeyFromContext(r.Context())
+		if key == nil {
+			w.Header().Set(HTTPHeaderNameWWWAuthenticate, "Bearer")
+			AppError(w, app.NewCodedError(app.CodeUnauthorized, "An API key is required", nil))
+			return
+		}
+		if !key.HasScope(scoped.scope) {
+			AppError(w, app.NewCodedError(app.CodeForbidden,
+				fmt.Sprintf("The API key does not grant the %s scope", scoped.scope), nil))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// orderOwner returns the UUID of the customer of the order of a request.
+func (srv *Server) orderOwner(r *http.Request) (string, error) {
+	order, err := srv.UserService.OrderByUUID(r.Context(), mux.Vars(r)["order_uuid"])
+	if err != nil {
+		return "", err
+	}
+	return order.Customer.UUID, nil
+}
+
+// customerOwner returns the UUID of the customer a request is about.
+func customerOwner(r *http.Request) (string, error) {
+	return mux.Vars(r)["customer_uuid"], nil
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reviewbot/app"
+	"reviewbot/internal/apikeys"
+	"reviewbot/internal/jwtauth"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	testAdminKey   = "rbk_admin"
+	testReaderKey  = "rbk_reader"
+	testRevokedKey = "rbk_revoked"
+)
+
+// stubAPIKeysRepository is an in-memory APIKeysRepository holding keys by their hash.
+type stubAPIKeysRepository map[string]*app.APIKey
+
+func (repo stubAPIKeysRepository) AddAPIKey(_ context.Context, key app.APIKey) error {
+	repo[key.Hash] = &key
+	return nil
+}
+
+func (repo stubAPIKeysRepository) GetAPIKeys(_ context.Context) ([]app.APIKey, error) {
+	keys := []app.APIKey{}
+	for _, key := range repo {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (repo stubAPIKeysRepository) GetActiveAPIKeyByHash(_ context.Context, hash string) (*app.APIKey, error) {
+	key, ok := repo[hash]
+	if !ok || key.RevokedAt != nil {
+		return nil, app.NewError("API key not found", app.ErrNoRecords)
+	}
+	return key, nil
+}
+
+func (repo stubAPIKeysRepository) RevokeAPIKey(_ context.Context, keyUUID string, revokedAt time.Time) error {
+	for _, key := range repo {
+		if key.UUID == keyUUID && key.RevokedAt == nil {
+			key.RevokedAt = &revokedAt
+			return nil
+		}
+	}
+	return app.NewError("API key not found or already revoked", app.ErrNoRecords)
+}
+
+var testAPIKeys = func() stubAPIKeysRepository {
+	revokedAt := time.Now().UTC()
+	repo := stubAPIKeysRepository{}
+	for _, key := range []app.APIKey{
+		{UUID: "key-admin", Hash: apikeys.Hash(testAdminKey), Scopes: []app.Scope{app.ScopeAdmin}},
+		{UUID: "key-reader", Hash: apikeys.Hash(testReaderKey), Scopes: []app.Scope{app.ScopeOrdersRead}},
+		{UUID: "key-revoked", Hash: apikeys.Hash(testRevokedKey), Scopes: []app.Scope{app.ScopeAdmin},
+			RevokedAt: &revokedAt},
+	} {
+		key := key
+		repo[key.Hash] = &key
+	}
+	return repo
+}()
+
+// TestAuthorizeChecksScopes tests which requests reach the routes, depending on their API key and the route scope.
+func TestAuthorizeChecksScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string
+		key        string
+		wantStatus int
+		wantActor  string
+	}{
+		{name: "public route without key", method: http.MethodGet, path: "/public", wantStatus: http.StatusOK,
+			wantActor: ActorAnonymous},
+		{name: "scoped route without key", method: http.MethodGet, path: "/orders",
+			wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", method: http.MethodGet, path: "/public", header: HTTPHeaderNameAPIKey,
+			key: "rbk_unknown", wantStatus: http.StatusUnauthorized},
+		{name: "revoked key", method: http.MethodGet, path: "/orders", header: HTTPHeaderNameAPIKey,
+			key: testRevokedKey, wantStatus: http.StatusUnauthorized},
+		{name: "key granting the scope", method: http.MethodGet, path: "/orders", header: HTTPHeaderNameAPIKey,
+			key: testReaderKey, wantStatus: http.StatusOK, wantActor: "api-key:key-reader"},
+		{name: "bearer key granting the scope", method: http.MethodGet, path: "/orders",
+			header: HTTPHeaderNameAuthorization, key: "Bearer " + testReaderKey, wantStatus: http.StatusOK,
+			wantActor: "api-key:key-reader"},
+		{name: "key missing the scope", method: http.MethodPost, path: "/orders", header: HTTPHeaderNameAPIKey,
+			key: testReaderKey, wantStatus: http.StatusForbidden},
+		{name: "admin key", method: http.MethodPost, path: "/orders", header: HTTPHeaderNameAPIKey,
+			key: testAdminKey, wantStatus: http.StatusOK, wantActor: "api-key:key-admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			srv := newTestServer()
+			var actor string
+			record := func(w http.ResponseWriter, r *http.Request) {
+				actor = app.ActorFromContext(r.Context())
+			}
+			router := mux.NewRouter()
+			router.Use(srv.authenticate)
+			router.Use(srv.authorize)
+			router.HandleFunc("/public", record).Methods(http.MethodGet)
+			router.Handle("/orders", requireScope(app.ScopeOrdersRead, record)).Methods(http.MethodGet)
+			router.Handle("/orders", requireScope(app.ScopeOrdersWrite, record)).Methods(http.MethodPost)
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			router.ServeHTTP(w, r)
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				decodeProblem(t, w)
+				return
+			}
+			if actor != tt.wantActor {
+				t.Fatalf("Actor mismatch: got %q, want %q", actor, tt.wantActor)
+			}
+		})
+	}
+}
+
+// TestUnauthorizedResponseAsksForCredentials tests that a request refused for lacking credentials is told how to
+// authenticate.
+func TestUnauthorizedResponseAsksForCredentials(t *testing.T) {
+	// Arrange
+	handler := newTestServer().routes()
+	r := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, r)
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Status mismatch: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if got := w.Header().Get(HTTPHeaderNameWWWAuthenticate); got != "Bearer" {
+		t.Fatalf("WWW-Authenticate mismatch: got %q, want %q", got, "Bearer")
+	}
+	if problem := decodeProblem(t, w); problem.Code != string(app.CodeUnauthorized) {
+		t.Fatalf("Code mismatch: got %q, want %q", problem.Code, app.CodeUnauthorized)
+	}
+}
+
+// TestRoutesRequireDocumentedScopes tests that every route requires the scope its operation documents and lets
+// customers through as documented, and that the routes documented as public are.
+func TestRoutesRequireDocumentedScopes(t *testing.T) {
+	// Arrange
+	router := newTestServer().routes().(*mux.Router)
+
+	// Act
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		handler := route.GetHandler()
+		if handler == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		var scope app.Scope
+		var customerAccess bool
+		if scoped, ok := handler.(scopedHandler); ok {
+			scope = scoped.scope
+			customerAccess = scoped.owner != nil
+		}
+		// Assert
+		for _, method := range methods {
+			documented := openAPIRoute(method, path)
+			if documented == nil {
+				continue
+			}
+			// The scope is left out of the operations any caller may use.
+			requiredScope, _ := documented.Operation.Extensions["x-required-scope"].(string)
+			if app.Scope(requiredScope) != scope {
+				t.Errorf("Scope mismatch for %s %s: got %q, want %q", method, path, scope, requiredScope)
+			}
+			documentedCustomerAccess, _ := documented.Operation.Extensions["x-customer-access"].(bool)
+			if documentedCustomerAccess != customerAccess {
+				t.Errorf("Customer access mismatch for %s %s: got %v, want %v", method, path, customerAccess,
+					documentedCustomerAccess)
+			}
+			if scope != "" && !app.IsScope(string(scope)) {
+				t.Errorf("Route %s %s requires unknown scope %q", method, path, scope)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error walking routes: %v", err)
+	}
+}
+
+// newTestCustomerAuthenticator returns an Authenticator of the customer cust1, whose tokens are verified with the
+// keys of a local JSON Web Key Set, along with a function issuing tokens.
+func newTestCustomerAuthenticator(t *testing.T) (*jwtauth.Authenticator, func(subject string) string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	jwk, err := jwkset.NewJWKFromKey(key.Public(), jwkset.JWKOptions{Metadata: jwkset.JWKMetadataOptions{KID: "key1"}})
+	if err != nil {
+		t.Fatalf("Error encoding key: %v", err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwkset.JWKSMarshal{Keys: []jwkset.JWKMarshal{jwk.Marshal()}})
+	}))
+	t.Cleanup(jwks.Close)
+
+	issue := func(subject string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": subject, "aud": "reviewbot",
+			"exp": time.Now().Add(time.Hour).Unix()})
+		token.Header["kid"] = "key1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Error signing token: %v", err)
+		}
+		return signed
+	}
+	keySet := jwtauth.NewKeySet(jwks.URL, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	customers := stubCustomersRepository{"cust1": {UUID: "cust1"}, "cust2": {UUID: "cust2"}}
+	return jwtauth.NewAuthenticator(keySet, customers, jwtauth.Config{Audience: "reviewbot"}), issue
+}
+
+// stubCustomersRepository is an in-memory jwtauth.CustomersRepository.
+type stubCustomersRepository map[string]*app.Customer
+
+func (repo stubCustomersRepository) GetCustomerByUUID(_ context.Context, uuid string) (*app.Customer, error) {
+	customer, ok := repo[uuid]
+	if !ok {
+		return nil, app.NewError("Customer does not exist", app.ErrNoRecords)
+	}
+	return customer, nil
+}
+
+// TestAuthorizeChecksCustomerOwnership tests that customers authenticated by their token only reach the routes
+// open to customers, for the resources they own.
+func TestAuthorizeChecksCustomerOwnership(t *testing.T) {
+	authenticator, issue := newTestCustomerAuthenticator(t)
+	tests := []struct {
+		name       string
+		target     string
+		token      string
+		websocket  bool
+		wantStatus int
+		wantActor  string
+	}{
+		{name: "own resource", target: "/customers/cust1", token: "Bearer " + issue("cust1"),
+			wantStatus: http.StatusOK, wantActor: "customer:cust1"},
+		{name: "resource of another customer", target: "/customers/cust2", token: "Bearer " + issue("cust1"),
+			wantStatus: http.StatusForbidden},
+		{name: "route closed to customers", target: "/products", token: "Bearer " + issue("cust1"),
+			wantStatus: http.StatusForbidden},
+		{name: "token of an unknown customer", target: "/customers/cust3", token: "Bearer " + issue("cust3"),
+			wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", target: "/customers/cust1", token: "Bearer " + issue("cust1") + "x",
+			wantStatus: http.StatusUnauthorized},
+		{name: "anonymous chat", target: "/chat/cust2", wantStatus: http.StatusOK, wantActor: ActorAnonymous},
+		{name: "own chat with token in query", target: "/chat/cust1?access_token=" + issue("cust1"),
+			websocket: true, wantStatus: http.StatusOK, wantActor: "customer:cust1"},
+		{name: "chat of another customer", target: "/chat/cust2?access_token=" + issue("cust1"),
+			websocket: true, wantStatus: http.StatusForbidden},
+		{name: "token in query of a plain request", target: "/customers/cust1?access_token=" + issue("cust1"),
+			wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			srv := newTestServer()
+			srv.CustomerAuthenticator = authenticator
+			var actor string
+			record := func(w http.ResponseWriter, r *http.Request) {
+				actor = app.ActorFromContext(r.Context())
+			}
+			router := mux.NewRouter()
+			router.Use(srv.authenticate)
+			router.Use(srv.authorize)
+			router.Handle("/customers/{customer_uuid}",
+				requireScope(app.ScopeCustomersRead, record).orCustomerOwner(customerOwner))
+			router.Handle("/products", requireScope(app.ScopeProductsRead, record))
+			router.Handle("/chat/{customer_uuid}", customerOwned(customerOwner, record))
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.token != "" {
+				r.Header.Set(HTTPHeaderNameAuthorization, tt.token)
+			}
+			if tt.websocket {
+				r.Header.Set("Connection", "Upgrade")
+				r.Header.Set("Upgrade", "websocket")
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			router.ServeHTTP(w, r)
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				decodeProblem(t, w)
+				return
+			}
+			if actor != tt.wantActor {
+				t.Fatalf("Actor mismatch: got %q, want %q", actor, tt.wantActor)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"reviewbot/app"
+	"time"
+)
+
+// CatalogSyncRunResponse represents a catalog synchronization run object entity.
+type CatalogSyncRunResponse struct {
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	DurationMs   int64     `json:"duration_ms"`
+	Created      int       `json:"created"`
+	Updated      int       `json:"updated"`
+	Unchanged    int       `json:"unchanged"`
+	Discontinued int       `json:"discontinued"`
+	Skipped      int       `json:"skipped"`
+	Aborted      string    `json:"aborted,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// CatalogSyncStatusResponse represents a catalog synchronization status object entity.
+type CatalogSyncStatusResponse struct {
+	Running   bool                    `json:"running"`
+	LastRun   *CatalogSyncRunResponse `json:"last_run"`
+	NextRunAt *time.Time              `json:"next_run_at"`
+}
+
+func (srv *Server) getCatalogSyncStatus(w http.ResponseWriter, r *http.Request) {
+	Ok(w, transformCatalogSyncStatusToResponse(srv.CatalogSyncer.Status()), http.StatusOK)
+}
+
+func (srv *Server) triggerCatalogSync(w http.ResponseWriter, r *http.Request) {
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(r.Context()))
+
+	err := srv.CatalogSyncer.Trigger()
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformCatalogSyncStatusToResponse(srv.CatalogSyncer.Status()), http.StatusAccepted)
+}
+
+func transformCatalogSyncStatusToResponse(status app.CatalogSyncStatus) CatalogSyncStatusResponse {
+	response := CatalogSyncStatusResponse{
+		Running:   status.Running,
+		NextRunAt: status.NextRunAt,
+	}
+	if status.LastRun != nil {
+		response.LastRun = &CatalogSyncRunResponse{
+			StartedAt:  status.LastRun.StartedAt,
+			FinishedAt: status.LastRun.FinishedAt,
+			DurationMs: status.LastRun.FinishedAt.Sub(status.LastRun.StartedAt).Milliseconds(),
+			Error:      status.LastRun.Error,
+		}
+		if summary := status.LastRun.Summary; summary != nil {
+			response.LastRun.Created = summary.Created
+			response.LastRun.Updated = summary.Updated
+			response.LastRun.Unchanged = summary.Unchanged
+			response.LastRun.Discontinued = summary.Discontinued
+			response.LastRun.Skipped = summary.Skipped
+			response.LastRun.Aborted = summary.Aborted
+		}
+	}
+	return response
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reviewbot/app"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsExposedHeaders are the response headers the scripts of the allowed origins may read.
+var corsExposedHeaders = strings.Join([]string{HTTPHeaderNameRequestID, HTTPHeaderNameETag, HTTPHeaderNameRetryAfter,
+	HTTPHeaderNameIdempotentReplayed}, ", ")
+
+// CORSConfig configures which cross-origin requests browsers may send. Lists are comma separated. An origin is
+// scheme://host[:port], where host may start with a *. label matching any subdomain, or * for every origin.
+type CORSConfig struct {
+	AllowedOrigins   string
+	AllowedMethods   string
+	AllowedHeaders   string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// originPattern is an allowed origin. A pattern with a wildcard matches the subdomains of its host, not the host.
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+func (p originPattern) matches(origin *url.URL) bool {
+	if !strings.EqualFold(origin.Scheme, p.scheme) || origin.Port() != p.port {
+		return false
+	}
+	host := strings.ToLower(origin.Hostname())
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// CORSPolicy answers the preflight requests of browsers and tells them which cross-origin requests they may send.
+// It also decides which origins may open the review chat websocket.
+type CORSPolicy struct {
+	anyOrigin        bool
+	origins          []originPattern
+	methods          map[string]bool
+	allowedMethods   string
+	headers          map[string]bool
+	allowedHeaders   string
+	allowCredentials bool
+	maxAge           string
+}
+
+// NewCORSPolicy returns the CORSPolicy of config, or an error if an origin is invalid or if credentials are allowed
+// from every origin.
+func NewCORSPolicy(config CORSConfig) (*CORSPolicy, error) {
+	policy := &CORSPolicy{
+		methods:          map[string]bool{},
+		headers:          map[string]bool{},
+		allowCredentials: config.AllowCredentials,
+		maxAge:           strconv.Itoa(int(config.MaxAge / time.Second)),
+	}
+	for _, origin := range splitList(config.AllowedOrigins) {
+		if origin == "*" {
+			policy.anyOrigin = true
+			continue
+		}
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		policy.origins = append(policy.origins, pattern)
+	}
+	if policy.anyOrigin && policy.allowCredentials {
+		return nil, errors.New("cors: credentials cannot be allowed from every origin")
+	}
+	methods := splitList(config.AllowedMethods)
+	for i, method := range methods {
+		methods[i] = strings.ToUpper(method)
+		policy.methods[methods[i]] = true
+	}
+	policy.allowedMethods = strings.Join(methods, ", ")
+	headers := splitList(config.AllowedHeaders)
+	for i, header := range headers {
+		headers[i] = http.CanonicalHeaderKey(header)
+		policy.headers[headers[i]] = true
+	}
+	policy.allowedHeaders = strings.Join(headers, ", ")
+	return policy, nil
+}
+
+func parseOriginPattern(origin string) (originPattern, error) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" ||
+		u.User != nil {
+		return originPattern{}, fmt.Errorf("cors: invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	pattern := originPattern{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Hostname()), port: u.Port()}
+	if strings.HasPrefix(pattern.host, "*.") {
+		pattern.host = strings.TrimPrefix(pattern.host, "*.")
+		pattern.wildcard = true
+	}
+	if pattern.host == "" || strings.Contains(pattern.host, "*") {
+		return originPattern{}, fmt.Errorf("cors: invalid origin %q, a wildcard may only start the host", origin)
+	}
+	return pattern, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// AllowsOrigin returns if the scripts of origin may send requests to the API.
+func (p *CORSPolicy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range p.origins {
+		if pattern.matches(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders returns if every header of the comma separated list of a preflight request is allowed.
+func (p *CORSPolicy) allowsHeaders(requested string) bool {
+	for _, header := range splitList(requested) {
+		if !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler answers the preflight requests, refusing them with a 403 if their origin, method or headers are not
+// allowed, and adds the CORS headers to the responses of the other requests of the allowed origins. It wraps the
+// whole router, as the router answers OPTIONS requests with a 405 before any middleware runs. Unless every origin is
+// allowed, every response varies by origin, those to requests without one included, so that a cache does not serve
+// them to the other origins.
+func (p *CORSPolicy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.anyOrigin {
+			w.Header().Add("Vary", "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed := p.AllowsOrigin(origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			switch {
+			case !allowed:
+				AppError(w, app.NewCodedError(app.CodeForbidden, "The origin is not allowed", nil))
+			case !p.methods[r.Header.Get("Access-Control-Request-Method")]:
+				AppError(w, app.NewCodedError(app.CodeForbidden, "The method is not allowed", nil))
+			case !p.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")):
+				AppError(w, app.NewCodedError(app.CodeForbidden, "The request headers are not allowed", nil))
+			default:
+				p.setAllowOrigin(w, origin)
+				w.Header().Set("Access-Control-Allow-Methods", p.allowedMethods)
+				if p.allowedHeaders != "" {
+					w.Header().Set("Access-Control-Allow-Headers", p.allowedHeaders)
+				}
+				w.Header().Set("Access-Control-Max-Age", p.maxAge)
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+		if allowed {
+			p.setAllowOrigin(w, origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setAllowOrigin allows origin to read the response. Unless every origin is allowed, the origin is echoed rather
+// than *, so that credentials may be allowed.
+func (p *CORSPolicy) setAllowOrigin(w http.ResponseWriter, origin string) {
+	if p.anyOrigin {
+		origin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if p.allowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// checkWebSocketOrigin lets a websocket be opened by clients sending no Origin, which are not browsers, from the
+// origin of the server itself, and from the origins allowed by the CORS policy, so that other sites cannot open
+// review chats with the credentials of their visitors.
+func (srv *Server) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return srv.CORSPolicy != nil && srv.CORSPolicy.AllowsOrigin(origin)
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCORSConfig = CORSConfig{
+	AllowedOrigins:   "https://shop.example.com, https://*.example.org, http://localhost:3000",
+	AllowedMethods:   "GET, POST, patch",
+	AllowedHeaders:   "Authorization, Content-Type, x-api-key",
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+func newTestCORSPolicy(t *testing.T) *CORSPolicy {
+	t.Helper()
+	policy, err := NewCORSPolicy(testCORSConfig)
+	if err != nil {
+		t.Fatalf("Error creating CORS policy: %v", err)
+	}
+	return policy
+}
+
+// TestCORSPolicyAllowsOrigin tests that exact origins and the subdomains of wildcard origins are allowed, and that
+// the scheme and the port must match.
+func TestCORSPolicyAllowsOrigin(t *testing.T) {
+	policy := newTestCORSPolicy(t)
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://shop.example.com", want: true},
+		{origin: "https://SHOP.example.com", want: true},
+		{origin: "http://shop.example.com", want: false},
+		{origin: "https://shop.example.com:8443", want: false},
+		{origin: "https://evilshop.example.com", want: false},
+		{origin: "https://a.example.org", want: true},
+		{origin: "https://a.b.example.org", want: true},
+		{origin: "https://example.org", want: false},
+		{origin: "https://evilexample.org", want: false},
+		{origin: "https://example.org.evil.com", want: false},
+		{origin: "http://localhost:3000", want: true},
+		{origin: "http://localhost:3001", want: false},
+		{origin: "null", want: false},
+		{origin: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			// Act
+			got := policy.AllowsOrigin(tt.origin)
+			// Assert
+			if got != tt.want {
+				t.Fatalf("Allowed mismatch: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNewCORSPolicyRejectsInvalidConfig tests that invalid origins, and credentials allowed from every origin, are
+// rejected.
+func TestNewCORSPolicyRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CORSConfig
+	}{
+		{name: "origin without scheme", config: CORSConfig{AllowedOrigins: "shop.example.com"}},
+		{name: "origin with path", config: CORSConfig{AllowedOrigins: "https://shop.example.com/app"}},
+		{name: "wildcard inside host", config: CORSConfig{AllowedOrigins: "https://shop.*.example.com"}},
+		{name: "credentials from every origin", config: CORSConfig{AllowedOrigins: "*", AllowCredentials: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := NewCORSPolicy(tt.config)
+			// Assert
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+		})
+	}
+}
+
+// TestCORSPolicyHandlerAnswersPreflight tests that the preflight requests are answered without reaching the router,
+// and refused unless their origin, method and headers are allowed.
+func TestCORSPolicyHandlerAnswersPreflight(t *testing.T) {
+	tests := []struct {
+		name       string
+		origin     string
+		method     string
+		headers    string
+		wantStatus int
+	}{
+		{name: "allowed", origin: "https://a.example.org", method: http.MethodPatch,
+			headers: "content-type, X-API-Key", wantStatus: http.StatusNoContent},
+		{name: "origin not allowed", origin: "https://evil.example.com", method: http.MethodGet,
+			wantStatus: http.StatusForbidden},
+		{name: "method not allowed", origin: "https://shop.example.com", method: http.MethodDelete,
+			wantStatus: http.StatusForbidden},
+		{name: "header not allowed", origin: "https://shop.example.com", method: http.MethodPost,
+			headers: "Content-Type, X-Custom", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			reached := false
+			handler := newTestCORSPolicy(t).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+			}))
+			r := httptest.NewRequest(http.MethodOptions, "/api/orders/ord1", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(w, r)
+			// Assert
+			if reached {
+				t.Fatalf("Preflight request reached the router")
+			}
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusNoContent {
+				if allowOrigin := w.Header().Get("Access-Control-Allow-Origin"); allowOrigin != "" {
+					t.Fatalf("Refused preflight allows origin %q", allowOrigin)
+				}
+				decodeProblem(t, w)
+				return
+			}
+			wantHeaders := map[string]string{
+				"Access-Control-Allow-Origin":      tt.origin,
+				"Access-Control-Allow-Methods":     "GET, POST, PATCH",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type, X-Api-Key",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			}
+			for name, want := range wantHeaders {
+				if got := w.Header().Get(name); got != want {
+					t.Fatalf("%s mismatch: got %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestCORSPolicyHandlerAllowsOrigins tests that only the responses to the allowed origins can be read by their
+// scripts, and that every response varies by origin unless every origin is allowed.
+func TestCORSPolicyHandlerAllowsOrigins(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          CORSConfig
+		origin          string
+		wantAllowOrigin string
+		wantVary        string
+	}{
+		{name: "allowed origin", config: testCORSConfig, origin: "https://shop.example.com",
+			wantAllowOrigin: "https://shop.example.com", wantVary: "Origin"},
+		{name: "other origin", config: testCORSConfig, origin: "https://evil.example.com", wantVary: "Origin"},
+		{name: "same origin", config: testCORSConfig, origin: "", wantVary: "Origin"},
+		{name: "every origin", config: CORSConfig{AllowedOrigins: "*"}, origin: "https://shop.example.com",
+			wantAllowOrigin: "*"},
+		{name: "same origin with every origin", config: CORSConfig{AllowedOrigins: "*"}, origin: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			policy, err := NewCORSPolicy(tt.config)
+			if err != nil {
+				t.Fatalf("Error creating CORS policy: %v", err)
+			}
+			handler := policy.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(w, r)
+			// Assert
+			if w.Code != http.StatusOK {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Fatalf("Access-Control-Allow-Origin mismatch: got %q, want %q", got, tt.wantAllowOrigin)
+			}
+			if exposed := w.Header().Get("Access-Control-Expose-Headers"); tt.wantAllowOrigin != "" &&
+				!strings.Contains(exposed, HTTPHeaderNameRetryAfter) {
+				t.Fatalf("Exposed headers mismatch: got %q, want %s among them", exposed, HTTPHeaderNameRetryAfter)
+			}
+			if vary := w.Header().Get("Vary"); vary != tt.wantVary {
+				t.Fatalf("Vary mismatch: got %q, want %q", vary, tt.wantVary)
+			}
+		})
+	}
+}
+
+// TestCheckWebSocketOrigin tests that review chats can only be opened from the server origin, the allowed origins,
+// or by clients which are not browsers.
+func TestCheckWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy bool
+		origin string
+		want   bool
+	}{
+		{name: "no origin", want: true},
+		{name: "server origin", origin: "https://reviewbot.example.net", want: true},
+		{name: "other origin without policy", origin: "https://shop.example.com", want: false},
+		{name: "allowed origin", policy: true, origin: "https://shop.example.com", want: true},
+		{name: "wildcard origin", policy: true, origin: "https://a.example.org", want: true},
+		{name: "other origin", policy: true, origin: "https://evil.example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			srv := newTestServer()
+			if tt.policy {
+				srv.CORSPolicy = newTestCORSPolicy(t)
+			}
+			r := httptest.NewRequest(http.MethodGet, "https://reviewbot.example.net/ws/orders/ord1", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			// Act
+			got := srv.checkWebSocketOrigin(r)
+			// Assert
+			if got != tt.want {
+				t.Fatalf("Allowed mismatch: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
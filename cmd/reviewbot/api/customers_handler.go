@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+func (srv *Server) getCustomerByUUID(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	profile, err := srv.UserService.CustomerProfile(ctx, mux.Vars(r)["customer_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformCustomerProfileToResponse(profile), http.StatusOK)
+}
+
+func (srv *Server) getCustomerByEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		err := errors.New("the email query parameter is required")
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	profile, err := srv.UserService.CustomerProfileByEmail(ctx, email)
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformCustomerProfileToResponse(profile), http.StatusOK)
+}
+
+func (srv *Server) getCustomerOrders(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	query, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	profile, page, err := srv.UserService.CustomerOrders(ctx, mux.Vars(r)["customer_uuid"], query,
+		r.URL.Query().Get("cursor"))
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	response := CustomerOrdersResponse{Customer: transformCustomerProfileToResponse(profile),
+		Orders: []OrderResponse{}, NextCursor: page.NextCursor}
+	for i := range page.Orders {
+		response.Orders = append(response.Orders, transformOrderToResponse(&page.Orders[i]))
+	}
+	Ok(w, response, http.StatusOK)
+}
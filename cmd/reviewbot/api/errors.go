@@ -1,14 +1,65 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"reviewbot/app"
 	"runtime/debug"
 	"strings"
 
 	"golang.org/x/exp/slog"
 )
 
+// ContentTypeProblemJSON is the media type of the errors the API returns.
+const ContentTypeProblemJSON = "application/problem+json"
+
+// serverErrorDetail is the detail of every 5xx problem, which must not disclose what failed.
+const serverErrorDetail = "The server encountered a problem and could not process your request"
+
+// codeStatuses maps the application error codes to the http statuses they are answered with.
+var codeStatuses = map[app.Code]int{
+	app.CodeInvalid:              http.StatusBadRequest,
+	app.CodeUnauthorized:         http.StatusUnauthorized,
+	app.CodeForbidden:            http.StatusForbidden,
+	app.CodeNotFound:             http.StatusNotFound,
+	app.CodeConflict:             http.StatusConflict,
+	app.CodePreconditionFailed:   http.StatusPreconditionFailed,
+	app.CodeUnprocessable:        http.StatusUnprocessableEntity,
+	app.CodePreconditionRequired: http.StatusPreconditionRequired,
+	app.CodeRateLimited:          http.StatusTooManyRequests,
+	app.CodeInternal:             http.StatusInternalServerError,
+	app.CodeUnavailable:          http.StatusServiceUnavailable,
+}
+
+// problemCodes are the codes of the problems whose error has no code matching their status. Besides the statuses of
+// the application error codes, they cover the statuses only the API answers with.
+var problemCodes = map[int]string{
+	http.StatusBadRequest:            string(app.CodeInvalid),
+	http.StatusUnauthorized:          string(app.CodeUnauthorized),
+	http.StatusForbidden:             string(app.CodeForbidden),
+	http.StatusNotFound:              string(app.CodeNotFound),
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              string(app.CodeConflict),
+	http.StatusPreconditionFailed:    string(app.CodePreconditionFailed),
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusUnprocessableEntity:   string(app.CodeUnprocessable),
+	http.StatusPreconditionRequired:  string(app.CodePreconditionRequired),
+	http.StatusTooManyRequests:       string(app.CodeRateLimited),
+	http.StatusInternalServerError:   string(app.CodeInternal),
+	http.StatusServiceUnavailable:    string(app.CodeUnavailable),
+}
+
+// errorStatus returns the http status an error is answered with, by its application code. An error without a code
+// is a server error.
+func errorStatus(err error) int {
+	if status, ok := codeStatuses[app.ErrorCode(err)]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
 type malformedRequestError struct {
 	status int
 	msg    string
@@ -19,15 +70,65 @@ func (mr *malformedRequestError) Error() string {
 	return mr.msg
 }
 
-// ApiError defines the standard error the API returns.
-type ApiError struct {
-	Message string  `json:"message"`
-	Errors  []error `json:"errors,omitempty"`
+// Problem defines the standard error the API returns, an RFC 7807 problem details object.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a field of a request that is invalid, as a path such as body.products[0].items or
+// query.limit.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
-// ErrorWrapper wraps an ApiError, so consumers can check for it easier.
-type ErrorWrapper struct {
-	Error ApiError `json:"error"`
+func (fe *FieldError) Error() string {
+	return fe.Field + " " + fe.Message
+}
+
+// newProblem returns the problem describing an error answered with the provided http status. The code is the one
+// of the error if it maps to the status, and otherwise depends on the status alone.
+func newProblem(err error, httpStatus int, requestID string) Problem {
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(httpStatus),
+		Status:    httpStatus,
+		Detail:    app.ErrorMessage(err),
+		Code:      problemCodes[httpStatus],
+		RequestID: requestID,
+	}
+	if code := app.ErrorCode(err); codeStatuses[code] == httpStatus {
+		problem.Code = string(code)
+	}
+	if problem.Code == "" {
+		problem.Code = strings.ReplaceAll(strings.ToLower(problem.Title), " ", "_")
+	}
+	if httpStatus >= http.StatusInternalServerError {
+		problem.Detail = serverErrorDetail
+	}
+	if problem.Detail == "" {
+		problem.Detail = problem.Title
+	}
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		problem.Errors = []FieldError{*fieldErr}
+	}
+	return problem
+}
+
+// writeProblem writes a problem as the response. The request ID is the one set on the response by httpLogger.
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	// A problem only holds strings and numbers, so it always encodes.
+	res, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", ContentTypeProblemJSON)
+	w.WriteHeader(problem.Status)
+	w.Write(res)
 }
 
 func (app *Application) reportServerError(r *http.Request, err error) {
@@ -41,32 +142,26 @@ func (app *Application) reportServerError(r *http.Request, err error) {
 	app.Logger.Error(message, requestAttrs, "trace", trace)
 }
 
-func (app *Application) errorMessage(w http.ResponseWriter, r *http.Request, status int, message string,
-	headers http.Header) {
+func (app *Application) errorMessage(w http.ResponseWriter, r *http.Request, status int, message string) {
 	message = strings.ToUpper(message[:1]) + message[1:]
-	err := JSONWithHeaders(w, status, map[string]string{"Error": message}, headers)
-	if err != nil {
-		app.reportServerError(r, err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	writeProblem(w, newProblem(errors.New(message), status, GetReqID(r.Context())))
 }
 
 func (app *Application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	app.reportServerError(r, err)
-	message := "The server encountered a problem and could not process your request"
-	app.errorMessage(w, r, http.StatusInternalServerError, message, nil)
+	app.errorMessage(w, r, http.StatusInternalServerError, serverErrorDetail)
 }
 
 func (app *Application) notFound(w http.ResponseWriter, r *http.Request) {
 	message := "The requested resource could not be found"
-	app.errorMessage(w, r, http.StatusNotFound, message, nil)
+	app.errorMessage(w, r, http.StatusNotFound, message)
 }
 
 func (app *Application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("The %s method is not supported for this resource", r.Method)
-	app.errorMessage(w, r, http.StatusMethodNotAllowed, message, nil)
+	app.errorMessage(w, r, http.StatusMethodNotAllowed, message)
 }
 
 func (app *Application) badRequest(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorMessage(w, r, http.StatusBadRequest, err.Error(), nil)
+	app.errorMessage(w, r, http.StatusBadRequest, err.Error())
 }
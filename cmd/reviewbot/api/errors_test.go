@@ -0,0 +1,372 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"reviewbot/app"
+	"strings"
+	"testing"
+)
+
+// decodeProblem checks that a response is a problem and decodes it.
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if contentType := w.Header().Get("Content-Type"); contentType != ContentTypeProblemJSON {
+		t.Fatalf("Content-Type mismatch: got %q, want %q", contentType, ContentTypeProblemJSON)
+	}
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Error decoding problem %q: %v", w.Body.String(), err)
+	}
+	if problem.Status != w.Code {
+		t.Fatalf("Problem status mismatch: got %d, want %d", problem.Status, w.Code)
+	}
+	return problem
+}
+
+// TestErrorWritesProblem tests the problem written for every error helper.
+func TestErrorWritesProblem(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w http.ResponseWriter, err error)
+		err   error
+		want  Problem
+	}{
+		{
+			name:  "bad request",
+			write: BadRequestError,
+			err:   app.NewError("The limit is invalid", errors.New("strconv.Atoi: parsing \"x\"")),
+			want: Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest,
+				Detail: "The limit is invalid", Code: "invalid_request"},
+		},
+		{
+			name:  "forbidden",
+			write: ForbiddenError,
+			err:   app.NewError("The review link is invalid or has expired", nil),
+			want: Problem{Type: "about:blank", Title: "Forbidden", Status: http.StatusForbidden,
+				Detail: "The review link is invalid or has expired", Code: "forbidden"},
+		},
+		{
+			name:  "not found",
+			write: NotFoundError,
+			err:   app.NewError("Order not found", app.ErrNoRecords),
+			want: Problem{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound,
+				Detail: "Order not found", Code: "not_found"},
+		},
+		{
+			name:  "conflict",
+			write: ConflictError,
+			err:   errors.New("invalid status transition"),
+			want: Problem{Type: "about:blank", Title: "Conflict", Status: http.StatusConflict,
+				Detail: "invalid status transition", Code: "conflict"},
+		},
+		{
+			name:  "precondition failed",
+			write: PreconditionFailedError,
+			err:   app.NewError("The order has changed", errors.New("order version mismatch")),
+			want: Problem{Type: "about:blank", Title: "Precondition Failed", Status: http.StatusPreconditionFailed,
+				Detail: "The order has changed", Code: "precondition_failed"},
+		},
+		{
+			name:  "precondition required",
+			write: PreconditionRequiredError,
+			err:   nil,
+			want: Problem{Type: "about:blank", Title: "Precondition Required",
+				Status: http.StatusPreconditionRequired, Detail: "Precondition Required", Code: "precondition_required"},
+		},
+		{
+			name:  "unprocessable entity",
+			write: UnprocessableEntityError,
+			err:   app.NewError("The idempotency key was used for a different request", nil),
+			want: Problem{Type: "about:blank", Title: "Unprocessable Entity", Status: http.StatusUnprocessableEntity,
+				Detail: "The idempotency key was used for a different request", Code: "unprocessable_request"},
+		},
+		{
+			name:  "server error",
+			write: ServerError,
+			err:   app.NewError("Failed to get order", errors.New("dial tcp 10.0.0.1:3306: connection refused")),
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError,
+				Detail: serverErrorDetail, Code: "internal_error"},
+		},
+		{
+			name:  "server error of a coded error",
+			write: ServerError,
+			err:   app.NewError("Failed to get order", app.ErrNoRecords),
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError,
+				Detail: serverErrorDetail, Code: "internal_error"},
+		},
+		{
+			name: "malformed request",
+			write: func(w http.ResponseWriter, err error) {
+				BadRequestError(w, err)
+			},
+			err: &malformedRequestError{status: http.StatusRequestEntityTooLarge, msg: "The request body is too large"},
+			want: Problem{Type: "about:blank", Title: "Request Entity Too Large",
+				Status: http.StatusRequestEntityTooLarge, Detail: "The request body is too large",
+				Code: "request_too_large"},
+		},
+		{
+			name:  "field error",
+			write: BadRequestError,
+			err: app.NewError("Invalid request: query.limit must be at most 200",
+				&FieldError{Field: "query.limit", Message: "must be at most 200"}),
+			want: Problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest,
+				Detail: "Invalid request: query.limit must be at most 200", Code: "invalid_request",
+				Errors: []FieldError{{Field: "query.limit", Message: "must be at most 200"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			w := httptest.NewRecorder()
+			w.Header().Set(HTTPHeaderNameRequestID, "req1")
+			tt.want.RequestID = "req1"
+
+			// Act
+			tt.write(w, tt.err)
+			// Assert
+			if w.Code != tt.want.Status {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.want.Status)
+			}
+			problem := decodeProblem(t, w)
+			if !reflect.DeepEqual(problem, tt.want) {
+				t.Fatalf("Problem mismatch: got %+v, want %+v", problem, tt.want)
+			}
+		})
+	}
+}
+
+// TestAppErrorMapsCodes tests that the status and the code of a problem follow the application code of its error.
+func TestAppErrorMapsCodes(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "wrapped sentinel",
+			err:        app.NewError("Order not found", fmt.Errorf("getting order: %w", app.ErrNoRecords)),
+			wantStatus: http.StatusNotFound,
+			wantCode:   "not_found",
+		},
+		{
+			name:       "invalid",
+			err:        fmt.Errorf("%w: limit must be positive", app.NewCodedError(app.CodeInvalid, "invalid query", nil)),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+		},
+		{
+			name:       "unauthorized",
+			err:        app.NewCodedError(app.CodeUnauthorized, "The API key is invalid", nil),
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "unauthorized",
+		},
+		{
+			name:       "conflict",
+			err:        app.ErrInvalidTransition,
+			wantStatus: http.StatusConflict,
+			wantCode:   "conflict",
+		},
+		{
+			name:       "rate limited",
+			err:        app.NewCodedError(app.CodeRateLimited, "Too many requests", nil),
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   "rate_limited",
+		},
+		{
+			name:       "unavailable",
+			err:        app.NewCodedError(app.CodeUnavailable, "The catalog is unavailable", nil),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "unavailable",
+		},
+		{
+			name:       "uncoded",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   "internal_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			w := httptest.NewRecorder()
+
+			// Act
+			AppError(w, tt.err)
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			problem := decodeProblem(t, w)
+			if problem.Code != tt.wantCode {
+				t.Fatalf("Code mismatch: got %q, want %q", problem.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// TestEveryCodeHasStatus tests that every application error code maps to an http status, and that the problems of
+// that status without a code get the same code.
+func TestEveryCodeHasStatus(t *testing.T) {
+	codes := []app.Code{app.CodeInvalid, app.CodeUnauthorized, app.CodeForbidden, app.CodeNotFound,
+		app.CodeConflict, app.CodePreconditionFailed, app.CodePreconditionRequired, app.CodeUnprocessable,
+		app.CodeRateLimited, app.CodeUnavailable, app.CodeInternal}
+	for _, code := range codes {
+		status, ok := codeStatuses[code]
+		if !ok {
+			t.Errorf("Code %q has no http status", code)
+			continue
+		}
+		if problemCodes[status] != string(code) {
+			t.Errorf("Problem code mismatch for status %d: got %q, want %q", status, problemCodes[status], code)
+		}
+	}
+}
+
+// TestRouterErrorsWriteProblems tests the problems written for the requests the router or a middleware refuses.
+func TestRouterErrorsWriteProblems(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{
+			name:       "unknown route",
+			method:     http.MethodGet,
+			target:     "/api/unknown",
+			wantStatus: http.StatusNotFound,
+			wantCode:   "not_found",
+			wantDetail: "The requested resource could not be found",
+		},
+		{
+			name:       "unknown path",
+			method:     http.MethodGet,
+			target:     "/unknown",
+			wantStatus: http.StatusNotFound,
+			wantCode:   "not_found",
+			wantDetail: "The requested resource could not be found",
+		},
+		{
+			name:       "invalid parameter",
+			method:     http.MethodGet,
+			target:     "/api/orders?limit=x",
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_request",
+			wantDetail: "Invalid request: query.limit is an invalid integer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			handler := newTestServer().routes()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set(HTTPHeaderNameAPIKey, testAdminKey)
+			w := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(w, r)
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			problem := decodeProblem(t, w)
+			if problem.Code != tt.wantCode {
+				t.Fatalf("Code mismatch: got %q, want %q", problem.Code, tt.wantCode)
+			}
+			if problem.Detail != tt.wantDetail {
+				t.Fatalf("Detail mismatch: got %q, want %q", problem.Detail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+// TestMethodNotAllowedWritesProblem tests the problem written for a method a resource does not support.
+func TestMethodNotAllowedWritesProblem(t *testing.T) {
+	// Arrange
+	srv := newTestServer()
+	r := httptest.NewRequest(http.MethodPut, "/api/status", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	srv.App.methodNotAllowed(w, r)
+	// Assert
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Status mismatch: got %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	problem := decodeProblem(t, w)
+	if problem.Code != "method_not_allowed" {
+		t.Fatalf("Code mismatch: got %q, want %q", problem.Code, "method_not_allowed")
+	}
+}
+
+// TestValidationErrorCarriesRequestID tests that the problem of a request refused by a middleware carries the ID of
+// the request, as its X-Request-ID header does.
+func TestValidationErrorCarriesRequestID(t *testing.T) {
+	// Arrange
+	handler := newTestServer().routes()
+	r := httptest.NewRequest(http.MethodGet, "/api/orders?limit=x", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, r)
+	// Assert
+	problem := decodeProblem(t, w)
+	requestID := w.Header().Get(HTTPHeaderNameRequestID)
+	if requestID == "" {
+		t.Fatalf("%s header is missing", HTTPHeaderNameRequestID)
+	}
+	if problem.RequestID != requestID {
+		t.Fatalf("Request ID mismatch: got %q, want %q", problem.RequestID, requestID)
+	}
+}
+
+// TestRecoverPanicWritesProblem tests that a panicking handler is answered with a 500 problem not disclosing the
+// panic.
+func TestRecoverPanicWritesProblem(t *testing.T) {
+	// Arrange
+	srv := newTestServer()
+	handler := srv.App.recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("secret state")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, r)
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Status mismatch: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	problem := decodeProblem(t, w)
+	if problem.Detail != serverErrorDetail {
+		t.Fatalf("Detail mismatch: got %q, want %q", problem.Detail, serverErrorDetail)
+	}
+	if strings.Contains(w.Body.String(), "secret state") {
+		t.Fatalf("Response discloses the panic: %s", w.Body.String())
+	}
+}
+
+// TestOkWritesProblemWhenEncodingFails tests that a response that cannot be encoded is answered with a 500 problem.
+func TestOkWritesProblemWhenEncodingFails(t *testing.T) {
+	// Arrange
+	w := httptest.NewRecorder()
+
+	// Act
+	Ok(w, map[string]any{"channel": make(chan int)}, http.StatusOK)
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Status mismatch: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	problem := decodeProblem(t, w)
+	if problem.Code != "internal_error" {
+		t.Fatalf("Code mismatch: got %q, want %q", problem.Code, "internal_error")
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errInvalidIfMatch is returned when an If-Match header is neither * nor a single strong ETag.
+var errInvalidIfMatch = errors.New("invalid If-Match header")
+
+// orderETag returns the strong ETag of the representation of an order: its version, followed by a hash of the
+// representation, which embeds the customer of the order and so may change while the version does not.
+func orderETag(version int, response OrderResponse) string {
+	encoded, _ := json.Marshal(response)
+	hash := sha256.Sum256(encoded)
+	return `"` + strconv.Itoa(version) + "-" + hex.EncodeToString(hash[:8]) + `"`
+}
+
+// parseIfMatch returns the version of the ETag of the If-Match header, or 0 for *, which matches any version.
+// Only the version is returned: a change of the customer of an order does not conflict with a change of the order.
+func parseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, nil
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+	versionPart, _, _ := strings.Cut(header[1:len(header)-1], "-")
+	version, err := strconv.Atoi(versionPart)
+	if err != nil || version < 1 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
+
+// ifNoneMatchContains reports whether the If-None-Match header lists etag. Weak ETags match their strong
+// counterpart, and * matches any ETag.
+func ifNoneMatchContains(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"testing"
+)
+
+// TestParseIfMatch tests that If-Match headers are parsed to the version of their ETag, and that only * and single
+// strong ETags are accepted.
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header      string
+		wantVersion int
+		wantErr     bool
+	}{
+		{header: "*", wantVersion: 0},
+		{header: `"3"`, wantVersion: 3},
+		{header: ` "3-0a1b2c3d4e5f6071" `, wantVersion: 3},
+		{header: "3", wantErr: true},
+		{header: `W/"3"`, wantErr: true},
+		{header: `"0"`, wantErr: true},
+		{header: `"-3"`, wantErr: true},
+		{header: `"three"`, wantErr: true},
+		{header: `"3", "4"`, wantErr: true},
+		{header: `"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			// Act
+			version, err := parseIfMatch(tt.header)
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Error mismatch: got %v, want error %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion {
+				t.Fatalf("Version mismatch: got %d, want %d", version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+// TestIfNoneMatchContains tests that If-None-Match headers match the listed ETags, their weak counterparts and *.
+func TestIfNoneMatchContains(t *testing.T) {
+	etag := `"3-0a1b2c3d4e5f6071"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{header: `"3-0a1b2c3d4e5f6071"`, want: true},
+		{header: `W/"3-0a1b2c3d4e5f6071"`, want: true},
+		{header: `"2-0a1b2c3d4e5f6071", "3-0a1b2c3d4e5f6071"`, want: true},
+		{header: "*", want: true},
+		{header: `"3"`, want: false},
+		{header: `"3-ffffffffffffffff"`, want: false},
+		{header: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			// Act
+			got := ifNoneMatchContains(tt.header, etag)
+			// Assert
+			if got != tt.want {
+				t.Fatalf("Match mismatch: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reviewbot/app"
+	"reviewbot/internal/idempotency"
+	"time"
+)
+
+// idempotencyStoreTimeout bounds the storage of the response of a request, or the release of its key, which happen
+// after the request context may have been cancelled.
+const idempotencyStoreTimeout = 5 * time.Second
+
+// idempotentResponseHeaders are the headers of a response stored along with it and replayed to the retries.
+var idempotentResponseHeaders = []string{"Content-Type", HTTPHeaderNameETag, HTTPHeaderNameLocation}
+
+// idempotent answers the retries of the mutating requests sent with an Idempotency-Key header with the response of
+// the first request instead of processing them again, along with its idempotentResponseHeaders. Reusing a key for a
+// different request is refused with a 422 and retrying a request still in progress, or whose response could not be
+// stored, with a 409. Server errors are not stored, so the request can be retried.
+// Keys are scoped by actor, so anonymous requests cannot send one, and routes marked with handlesIdempotencyKey are
+// left to apply the key themselves.
+func (srv *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HTTPHeaderNameIdempotencyKey)
+		if key == "" || srv.IdempotencyStore == nil || !isMutatingMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if scoped, ok := routeHandler(r); ok && scoped.ownIdempotency {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+		actor := app.ActorFromContext(ctx)
+		if actor == ActorAnonymous {
+			BadRequestError(w, app.NewError("The idempotency key requires credentials", nil))
+			return
+		}
+		if len(key) > idempotency.MaxKeyLength {
+			BadRequestError(w, app.NewError(fmt.Sprintf("The idempotency key must be at most %d characters long",
+				idempotency.MaxKeyLength), nil))
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				Error(w, app.NewError("The request body is too large", err), http.StatusRequestEntityTooLarge)
+				return
+			}
+			BadRequestError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := srv.IdempotencyStore.Begin(ctx, actor, key,
+			idempotency.Fingerprint(r.Method, r.URL.RequestURI(), body))
+		if err != nil {
+			log.With("success", false, "err", err)
+			AppError(w, err)
+			return
+		}
+		if stored != nil {
+			for name, value := range stored.ResponseHeaders {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set(HTTPHeaderNameIdempotentReplayed, "true")
+			w.WriteHeader(stored.ResponseStatus)
+			w.Write(stored.ResponseBody)
+			return
+		}
+
+		release := true
+		defer func() {
+			if !release {
+				return
+			}
+			// The handler failed or panicked, the key is released so that the request can be retried.
+			releaseCtx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+			defer cancel()
+			if err := srv.IdempotencyStore.Release(releaseCtx, actor, key); err != nil {
+				log.Error("could not release idempotency key", "err", err)
+			}
+		}()
+		recorder := newRecordingResponseWriter(w)
+		next.ServeHTTP(recorder, r)
+		if recorder.statusCode >= http.StatusInternalServerError {
+			return
+		}
+		// The request was processed, so its key stays claimed even if the response cannot be stored: retries are
+		// refused instead of processing it again.
+		release = false
+		headers := map[string]string{}
+		for _, name := range idempotentResponseHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		completeCtx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+		defer cancel()
+		if err := srv.IdempotencyStore.Complete(completeCtx, actor, key, recorder.statusCode, headers,
+			recorder.body.Bytes()); err != nil {
+			log.Error("could not store idempotent response", "err", err)
+		}
+	})
+}
+
+func isMutatingMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch ||
+		method == http.MethodDelete
+}
+
+// recordingResponseWriter writes a response while keeping a copy of its status and body.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newRecordingResponseWriter(w http.ResponseWriter) *recordingResponseWriter {
+	return &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+func (rrw *recordingResponseWriter) WriteHeader(code int) {
+	rrw.statusCode = code
+	rrw.ResponseWriter.WriteHeader(code)
+}
+
+func (rrw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rrw.body.Write(b)
+	return rrw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reviewbot/app"
+	"reviewbot/internal/idempotency"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+// memoryIdempotencyRepository keeps the idempotency records in memory.
+type memoryIdempotencyRepository struct {
+	records     map[string]app.IdempotencyRecord
+	completeErr error
+	released    int
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{records: map[string]app.IdempotencyRecord{}}
+}
+
+func (m *memoryIdempotencyRepository) AddIdempotencyRecord(_ context.Context, record app.IdempotencyRecord) (bool,
+	error) {
+	if _, ok := m.records[record.Actor+" "+record.Key]; ok {
+		return false, nil
+	}
+	m.records[record.Actor+" "+record.Key] = record
+	return true, nil
+}
+
+func (m *memoryIdempotencyRepository) GetIdempotencyRecord(_ context.Context, actor string,
+	key string) (*app.IdempotencyRecord, error) {
+	record, ok := m.records[actor+" "+key]
+	if !ok {
+		return nil, app.ErrNoRecords
+	}
+	return &record, nil
+}
+
+func (m *memoryIdempotencyRepository) ClaimIdempotencyRecord(context.Context, app.IdempotencyRecord, time.Time,
+	time.Time) (bool, error) {
+	return false, nil
+}
+
+func (m *memoryIdempotencyRepository) CompleteIdempotencyRecord(_ context.Context, actor string, key string,
+	status int, headers map[string]string, body []byte) error {
+	if m.completeErr != nil {
+		return m.completeErr
+	}
+	record := m.records[actor+" "+key]
+	record.Status = app.IdempotencyRecordStatusCompleted
+	record.ResponseStatus = status
+	record.ResponseHeaders = headers
+	record.ResponseBody = body
+	m.records[actor+" "+key] = record
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) LoseIdempotencyResponse(_ context.Context, actor string, key string) error {
+	record := m.records[actor+" "+key]
+	record.Status = app.IdempotencyRecordStatusResponseLost
+	m.records[actor+" "+key] = record
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) ReleaseIdempotencyRecord(_ context.Context, actor string, key string) error {
+	m.released++
+	delete(m.records, actor+" "+key)
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) DeleteExpiredIdempotencyRecords(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// TestIdempotentAppliesKeys tests that the retries of a request are answered with its first response and headers, that
+// the key stays claimed when the response cannot be stored, and that anonymous requests and the routes applying the
+// key themselves are not handled.
+func TestIdempotentAppliesKeys(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		key          string
+		completeErr  error
+		wantStatus   int
+		wantLocation string
+		wantHandled  int
+		wantReleased int
+	}{
+		{name: "retry", path: "/products", key: testAdminKey, wantStatus: http.StatusCreated,
+			wantLocation: "/products/prod1", wantHandled: 1},
+		{name: "response not stored", path: "/products", key: testAdminKey,
+			completeErr: errors.New("connection lost"), wantStatus: http.StatusConflict, wantHandled: 1},
+		{name: "anonymous", path: "/products", wantStatus: http.StatusBadRequest},
+		{name: "route applying the key", path: "/orders", key: testAdminKey, wantStatus: http.StatusCreated,
+			wantLocation: "/products/prod1", wantHandled: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			repo := newMemoryIdempotencyRepository()
+			repo.completeErr = tt.completeErr
+			srv := newTestServer()
+			srv.IdempotencyStore = idempotency.NewStore(repo, time.Hour,
+				slog.New(slog.NewTextHandler(io.Discard, nil)))
+			handled := 0
+			created := func(w http.ResponseWriter, r *http.Request) {
+				handled++
+				w.Header().Set(HTTPHeaderNameLocation, "/products/prod1")
+				w.WriteHeader(http.StatusCreated)
+			}
+			router := mux.NewRouter()
+			router.Use(srv.authenticate)
+			router.Use(srv.idempotent)
+			router.HandleFunc("/products", created).Methods(http.MethodPost)
+			router.Handle("/orders", requireScope(app.ScopeOrdersWrite, created).handlesIdempotencyKey()).
+				Methods(http.MethodPost)
+
+			// Act
+			var w *httptest.ResponseRecorder
+			for i := 0; i < 2; i++ {
+				r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"name":"Tyre"}`))
+				r.Header.Set(HTTPHeaderNameIdempotencyKey, "key1")
+				if tt.key != "" {
+					r.Header.Set(HTTPHeaderNameAPIKey, tt.key)
+				}
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+			}
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if location := w.Header().Get(HTTPHeaderNameLocation); location != tt.wantLocation {
+				t.Fatalf("Location mismatch: got %q, want %q", location, tt.wantLocation)
+			}
+			if handled != tt.wantHandled {
+				t.Fatalf("Handled requests mismatch: got %d, want %d", handled, tt.wantHandled)
+			}
+			if repo.released != tt.wantReleased {
+				t.Fatalf("Released keys mismatch: got %d, want %d", repo.released, tt.wantReleased)
+			}
+		})
+	}
+}
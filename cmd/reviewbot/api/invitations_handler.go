@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"reviewbot/app"
+	"time"
+)
+
+// ReviewOptOutResponse represents a review reminders opt-out object entity.
+type ReviewOptOutResponse struct {
+	CustomerUUID string `json:"customer_uuid"`
+	OptedOut     bool   `json:"opted_out"`
+}
+
+// optOutOfReviewReminders stops the review reminders of the customer of a signed opt-out link. Both GET, for the
+// link in the reminder emails, and POST are accepted.
+func (srv *Server) optOutOfReviewReminders(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+	customerUUID := mux.Vars(r)["customer_uuid"]
+
+	err := srv.ReviewLinkSigner.VerifyOptOut(customerUUID, r.URL.Query(), time.Now())
+	if err != nil {
+		log.With("success", false, "err", err)
+		ForbiddenError(w, app.NewError("The opt-out link is invalid or has expired", err))
+		return
+	}
+
+	err = srv.InvitationsService.OptOut(ctx, customerUUID)
+	if err != nil {
+		log.With("success", false, "err", err)
+		ServerError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, ReviewOptOutResponse{CustomerUUID: customerUUID, OptedOut: true}, http.StatusOK)
+}
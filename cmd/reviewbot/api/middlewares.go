@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"net/http"
-	"runtime/debug"
 	"time"
 )
 
@@ -13,29 +12,13 @@ func (app *Application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				if w.Header().Get("Content-Type") == "" {
-					w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-				}
-				w.WriteHeader(http.StatusInternalServerError)
-				f := "PANIC: "
-				stack := fmt.Sprint(f, err, ", stack trace:", '\n')
-				app.Logger.Error(stack)
-				fmt.Println(string(debug.Stack()))
-				stack = fmt.Sprint(stack, string(debug.Stack()))
-				w.Write([]byte(stack))
+				app.serverError(w, r, fmt.Errorf("PANIC: %v", err))
 			}
 		}()
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (app *Application) enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		next.ServeHTTP(w, r)
-	})
-}
-
 // ContextKey is
 type ContextKey string
 
@@ -46,6 +29,28 @@ const (
 	LogFieldKeyRequestID string     = string(ContextKeyReqID)
 	// HTTPHeaderNameRequestID has the name of the header for request ID
 	HTTPHeaderNameRequestID = "X-Request-ID"
+	// HTTPHeaderNameIdempotencyKey has the name of the header identifying the retries of a request
+	HTTPHeaderNameIdempotencyKey = "Idempotency-Key"
+	// HTTPHeaderNameETag has the name of the header carrying the version of a resource
+	HTTPHeaderNameETag = "ETag"
+	// HTTPHeaderNameLocation has the name of the header carrying the URL of a created resource
+	HTTPHeaderNameLocation = "Location"
+	// HTTPHeaderNameIfMatch has the name of the header carrying the version a change of a resource is based on
+	HTTPHeaderNameIfMatch = "If-Match"
+	// HTTPHeaderNameIfNoneMatch has the name of the header carrying the versions of a resource a client already has
+	HTTPHeaderNameIfNoneMatch = "If-None-Match"
+	// HTTPHeaderNameIdempotentReplayed has the name of the header set on the responses of retried requests
+	HTTPHeaderNameIdempotentReplayed = "Idempotent-Replayed"
+	// HTTPHeaderNameAPIKey has the name of the header carrying the API key of a request
+	HTTPHeaderNameAPIKey = "X-API-Key"
+	// HTTPHeaderNameAuthorization has the name of the header carrying the credentials of a request
+	HTTPHeaderNameAuthorization = "Authorization"
+	// HTTPHeaderNameWWWAuthenticate has the name of the header telling how to authenticate a refused request
+	HTTPHeaderNameWWWAuthenticate = "WWW-Authenticate"
+	// HTTPHeaderNameRetryAfter has the name of the header telling how many seconds to wait before retrying a request
+	HTTPHeaderNameRetryAfter = "Retry-After"
+	// HTTPHeaderNameForwardedFor has the name of the header in which proxies append the addresses of the clients
+	HTTPHeaderNameForwardedFor = "X-Forwarded-For"
 )
 
 // GetReqID will get reqID from a http request and return it as a string
@@ -68,6 +73,7 @@ func (app *Application) httpLogger(next http.Handler) http.Handler {
 		start := time.Now()
 		ctx := AttachReqID(r.Context())
 		r = r.WithContext(ctx)
+		w.Header().Set(HTTPHeaderNameRequestID, GetReqID(ctx))
 		app.Logger.Info(fmt.Sprintf("Request %s-start: %s %s", GetReqID(ctx), r.Method, r.URL.Path))
 		lrw := NewLoggingResponseWriter(w)
 		next.ServeHTTP(lrw, r)
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"reviewbot/app"
+	"strconv"
+)
+
+//go:embed openapi.json
+var openAPIJSON []byte
+
+// openAPI is the OpenAPI document describing the API. Requests are validated against it before reaching the
+// handlers.
+var openAPI = mustLoadOpenAPIDocument(openAPIJSON)
+
+// openAPIValidationOptions validate requests without checking their credentials, which the authentication
+// middlewares do, and without setting the default values of what they leave out, which the handlers apply.
+var openAPIValidationOptions = &openapi3filter.Options{
+	AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+	SkipSettingDefaults: true,
+}
+
+// mustLoadOpenAPIDocument loads and validates an OpenAPI document, so that a document the validator does not
+// understand stops the server from starting instead of leaving requests unchecked.
+func mustLoadOpenAPIDocument(data []byte) *openapi3.T {
+	openapi3.DefineStringFormatCallback("uuid", func(value string) error {
+		_, err := uuid.Parse(value)
+		return err
+	})
+	doc, err := openapi3.NewLoader().LoadFromData(data)
+	if err != nil {
+		panic(fmt.Sprintf("invalid OpenAPI document: %v", err))
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		panic(fmt.Sprintf("invalid OpenAPI document: %v", err))
+	}
+	return doc
+}
+
+// openAPIRoute returns the operation of a method on a path template, or nil if the document does not describe it.
+func openAPIRoute(method string, pathTemplate string) *routers.Route {
+	pathItem := openAPI.Paths[pathTemplate]
+	if pathItem == nil {
+		return nil
+	}
+	operation := pathItem.GetOperation(method)
+	if operation == nil {
+		return nil
+	}
+	return &routers.Route{Spec: openAPI, Path: pathTemplate, PathItem: pathItem, Method: method,
+		Operation: operation}
+}
+
+// requestFieldError returns the field of a request a validation error is about, as a path such as
+// body.products[0].items or query.limit, along with what is wrong with it.
+func requestFieldError(err error) error {
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return err
+	}
+	field := "body"
+	if parameter := requestErr.Parameter; parameter != nil {
+		field = parameter.In + "." + parameter.Name
+	}
+	var schemaErr *openapi3.SchemaError
+	var parseErr *openapi3filter.ParseError
+	switch {
+	case errors.As(requestErr.Err, &schemaErr):
+		for _, name := range schemaErr.JSONPointer() {
+			if _, err := strconv.Atoi(name); err == nil {
+				field += "[" + name + "]"
+			} else {
+				field += "." + name
+			}
+		}
+		return &FieldError{Field: field, Message: schemaErr.Reason}
+	case errors.As(requestErr.Err, &parseErr) && parseErr.Reason != "":
+		// The reason leaves out the value, which the client already has.
+		return &FieldError{Field: field, Message: "is " + parseErr.Reason}
+	case errors.Is(requestErr.Err, openapi3filter.ErrInvalidRequired):
+		return &FieldError{Field: field, Message: "is required"}
+	case requestErr.Err == nil:
+		return &FieldError{Field: field, Message: requestErr.Reason}
+	case requestErr.Reason == "":
+		return &FieldError{Field: field, Message: requestErr.Err.Error()}
+	default:
+		return &FieldError{Field: field, Message: requestErr.Reason + ": " + requestErr.Err.Error()}
+	}
+}
+
+// validateRequest refuses with a 400 the requests to the routes described by the OpenAPI document whose parameters
+// or body do not match it. The body is read and replaced, so the handler can read it again. Bodies sent without a
+// Content-Type are read as JSON, as the handlers do.
+func (srv *Server) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		documented := openAPIRoute(r.Method, pathTemplate)
+		if documented == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if documented.Operation.RequestBody != nil {
+			if r.Header.Get("Content-Type") == "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+		}
+		err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: mux.Vars(r),
+			Route:      documented,
+			Options:    openAPIValidationOptions,
+		})
+		if err != nil {
+			log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(r.Context()))
+			log.With("success", false, "err", err)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				Error(w, app.NewError("The request body is too large", err), http.StatusRequestEntityTooLarge)
+				return
+			}
+			fieldErr := requestFieldError(err)
+			BadRequestError(w, app.NewError("Invalid request: "+fieldErr.Error(), fieldErr))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (srv *Server) getOpenAPIDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIJSON)
+}
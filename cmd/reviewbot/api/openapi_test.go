@@ -0,0 +1,293 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"reviewbot/internal/apikeys"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+func newTestServer() *Server {
+	return &Server{
+		App:            &Application{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))},
+		APIKeysService: apikeys.NewService(testAPIKeys),
+	}
+}
+
+// TestOpenAPIDocumentsEveryRoute tests that the OpenAPI document describes exactly the routes of the server.
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	// Arrange
+	router := newTestServer().routes().(*mux.Router)
+	documented := map[string]bool{}
+	for path, pathItem := range openAPI.Paths {
+		for method := range pathItem.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	// Act
+	routed := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routed[method+" "+path] = true
+		}
+		return nil
+	})
+	// Assert
+	if err != nil {
+		t.Fatalf("Error walking routes: %v", err)
+	}
+	for route := range routed {
+		if !documented[route] {
+			t.Errorf("Route %s is missing from the OpenAPI document", route)
+		}
+	}
+	for route := range documented {
+		if !routed[route] {
+			t.Errorf("Operation %s of the OpenAPI document has no route", route)
+		}
+	}
+}
+
+// TestOpenAPISchemasMatchTypes tests that the JSON encoding of the request and response types matches their schema,
+// so that a renamed, added or removed field fails until the document follows. Which fields are required is only
+// checked for responses, as a request may leave out any field its handler does not insist on.
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	tests := []struct {
+		schema   string
+		value    any
+		response bool
+	}{
+		{schema: "Problem", value: Problem{}, response: true},
+		{schema: "FieldError", value: FieldError{}, response: true},
+		{schema: "Customer", value: CustomerResponse{}, response: true},
+		{schema: "CustomerReviewStats", value: CustomerReviewStatsResponse{}, response: true},
+		{schema: "CustomerProfile", value: CustomerProfileResponse{}, response: true},
+		{schema: "CustomerOrders", value: CustomerOrdersResponse{}, response: true},
+		{schema: "Order", value: OrderResponse{}, response: true},
+		{schema: "OrderPage", value: OrderPageResponse{}, response: true},
+		{schema: "OrderRequest", value: OrderRequest{}},
+		{schema: "OrderLineRequest", value: OrderLineRequest{}},
+		{schema: "PlacedOrder", value: PlacedOrderResponse{}, response: true},
+		{schema: "OrderStatusRequest", value: OrderStatusRequest{}},
+		{schema: "OrderStatusTransition", value: OrderStatusTransitionResponse{}, response: true},
+		{schema: "OrderProduct", value: OrderProductResponse{}, response: true},
+		{schema: "Product", value: ProductResponse{}, response: true},
+		{schema: "ProductRequest", value: ProductRequest{}},
+		{schema: "ProductPage", value: ProductPageResponse{}, response: true},
+		{schema: "Review", value: ReviewResponse{}, response: true},
+		{schema: "ReviewPage", value: ReviewPageResponse{}, response: true},
+		{schema: "ProductReviewSummary", value: ProductReviewSummaryResponse{}, response: true},
+		{schema: "ReviewTrend", value: ReviewTrendResponse{}, response: true},
+		{schema: "DailyReviewStats", value: DailyReviewStatsResponse{}, response: true},
+		{schema: "ReviewOptOut", value: ReviewOptOutResponse{}, response: true},
+		{schema: "WebhookSubscriptionRequest", value: WebhookSubscriptionRequest{}},
+		{schema: "WebhookSubscription", value: WebhookSubscriptionResponse{}, response: true},
+		{schema: "WebhookDeadLetter", value: WebhookDeadLetterResponse{}, response: true},
+		{schema: "CatalogSyncRun", value: CatalogSyncRunResponse{}, response: true},
+		{schema: "CatalogSyncStatus", value: CatalogSyncStatusResponse{}, response: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			schema, ok := openAPI.Components.Schemas[tt.schema]
+			if !ok {
+				t.Fatalf("Schema %s is missing from the OpenAPI document", tt.schema)
+			}
+			checkSchemaMatchesType(t, schema.Value, reflect.TypeOf(tt.value), tt.schema, tt.response)
+		})
+	}
+}
+
+// TestValidateRequestRejectsInvalidBody tests that a request body not matching the document is refused before
+// reaching the handler.
+func TestValidateRequestRejectsInvalidBody(t *testing.T) {
+	// Arrange
+	handler := newTestServer().routes()
+	body := `{"customer_uuid": "cus1", "products": [{"product_uuid": "prod1", "items": 0}]}`
+	r := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body))
+	r.Header.Set(HTTPHeaderNameAPIKey, testAdminKey)
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, r)
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Status mismatch: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	want := "Invalid request: body.products[0].items number must be at least 1"
+	if problem.Detail != want {
+		t.Fatalf("Detail mismatch: got %q, want %q", problem.Detail, want)
+	}
+	wantErrors := []FieldError{{Field: "body.products[0].items", Message: "number must be at least 1"}}
+	if !reflect.DeepEqual(problem.Errors, wantErrors) {
+		t.Fatalf("Errors mismatch: got %+v, want %+v", problem.Errors, wantErrors)
+	}
+}
+
+// TestStatusResponseMatchesOpenAPI tests that the response of a handler validates against its documented schema.
+func TestStatusResponseMatchesOpenAPI(t *testing.T) {
+	// Arrange
+	handler := newTestServer().routes()
+	r := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, r)
+	// Assert
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{Request: r,
+			Route: openAPIRoute(http.MethodGet, "/api/status"), Options: openAPIValidationOptions},
+		Status:  w.Code,
+		Header:  w.Header(),
+		Options: &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	err := openapi3filter.ValidateResponse(context.Background(), input.SetBodyBytes(w.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("Response does not match the OpenAPI document: %v", err)
+	}
+}
+
+// checkSchemaMatchesType fails the test if the JSON encoding of typ does not match schema: the object properties and
+// their types must agree and, for a response, so must which of them are required.
+func checkSchemaMatchesType(t *testing.T, schema *openapi3.Schema, typ reflect.Type, at string, response bool) {
+	t.Helper()
+	schema = flattenSchema(schema)
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == reflect.TypeOf(time.Time{}):
+		if schema.Type != "string" || schema.Format != "date-time" {
+			t.Errorf("%s: got type %q and format %q, want a date-time string", at, schema.Type, schema.Format)
+		}
+		return
+	case typ == reflect.TypeOf(json.RawMessage{}), typ.Kind() == reflect.Interface:
+		return
+	}
+
+	want := map[reflect.Kind]string{
+		reflect.String: "string", reflect.Bool: "boolean", reflect.Int: "integer", reflect.Int64: "integer",
+		reflect.Float64: "number", reflect.Slice: "array", reflect.Map: "object", reflect.Struct: "object",
+	}[typ.Kind()]
+	if schema.Type != want {
+		t.Errorf("%s: got type %q, want %q", at, schema.Type, want)
+		return
+	}
+	switch typ.Kind() {
+	case reflect.Slice:
+		checkSchemaMatchesType(t, schema.Items.Value, typ.Elem(), at+"[]", response)
+	case reflect.Map:
+		if schema.AdditionalProperties.Schema == nil {
+			t.Errorf("%s: additionalProperties is missing", at)
+			return
+		}
+		checkSchemaMatchesType(t, schema.AdditionalProperties.Schema.Value, typ.Elem(), at+"{}", response)
+	case reflect.Struct:
+		fields := jsonFields(typ)
+		for name := range schema.Properties {
+			if _, ok := fields[name]; !ok {
+				t.Errorf("%s.%s is documented but not encoded", at, name)
+			}
+		}
+		required := map[string]bool{}
+		for _, name := range schema.Required {
+			required[name] = true
+		}
+		for name, field := range fields {
+			property, ok := schema.Properties[name]
+			if !ok {
+				t.Errorf("%s.%s is encoded but not documented", at, name)
+				continue
+			}
+			if response && required[name] == field.omitempty {
+				t.Errorf("%s.%s: got required %t, want %t", at, name, required[name], !field.omitempty)
+			}
+			if response && field.typ.Kind() == reflect.Pointer && !field.omitempty &&
+				!flattenSchema(property.Value).Nullable {
+				t.Errorf("%s.%s is encoded as null but not nullable", at, name)
+			}
+			checkSchemaMatchesType(t, property.Value, field.typ, at+"."+name, response)
+		}
+	}
+}
+
+// flattenSchema merges the allOf parts of a schema.
+func flattenSchema(schema *openapi3.Schema) *openapi3.Schema {
+	if len(schema.AllOf) == 0 {
+		return schema
+	}
+	flat := *schema
+	flat.AllOf = nil
+	flat.Properties = openapi3.Schemas{}
+	for name, property := range schema.Properties {
+		flat.Properties[name] = property
+	}
+	for _, partRef := range schema.AllOf {
+		part := flattenSchema(partRef.Value)
+		if flat.Type == "" {
+			flat.Type = part.Type
+		}
+		flat.Required = append(flat.Required, part.Required...)
+		for name, property := range part.Properties {
+			flat.Properties[name] = property
+		}
+	}
+	sort.Strings(flat.Required)
+	return &flat
+}
+
+type jsonField struct {
+	typ       reflect.Type
+	omitempty bool
+}
+
+// jsonFields returns the fields encoding/json encodes for a struct type, by name.
+func jsonFields(typ reflect.Type) map[string]jsonField {
+	fields := map[string]jsonField{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embeddedName, embedded := range jsonFields(field.Type) {
+				fields[embeddedName] = embedded
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = jsonField{typ: field.Type, omitempty: strings.Contains(options, "omitempty")}
+	}
+	return fields
+}
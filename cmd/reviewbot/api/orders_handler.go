@@ -7,7 +7,10 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"net/http"
+	"net/url"
 	"reviewbot/app"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,6 +24,30 @@ type CustomerResponse struct {
 	RegistrationDate time.Time `json:"registration_date"`
 }
 
+// CustomerReviewStatsResponse represents how a customer takes part in reviews. The participation rate is the share
+// of the completed orders the customer reviewed and the average sentiment the mean score of their reviews.
+type CustomerReviewStatsResponse struct {
+	ReviewableOrderCount int64   `json:"reviewable_order_count"`
+	ReviewedOrderCount   int64   `json:"reviewed_order_count"`
+	ParticipationRate    float64 `json:"participation_rate"`
+	ReviewCount          int64   `json:"review_count"`
+	AverageSentiment     float64 `json:"average_sentiment"`
+}
+
+// CustomerProfileResponse represents a customer along with their review statistics.
+type CustomerProfileResponse struct {
+	CustomerResponse
+	ReviewStats CustomerReviewStatsResponse `json:"review_stats"`
+}
+
+// CustomerOrdersResponse represents a page of the orders of a customer along with the customer. The next page is
+// requested with the next_cursor as the cursor query parameter, it is omitted on the last page.
+type CustomerOrdersResponse struct {
+	Customer   CustomerProfileResponse `json:"customer"`
+	Orders     []OrderResponse         `json:"orders"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
 // OrderResponse represents an order response object entity.
 type OrderResponse struct {
 	UUID       string           `json:"uuid"`
@@ -29,11 +56,44 @@ type OrderResponse struct {
 	PlacedDate time.Time        `json:"placed_date"`
 }
 
+// OrderPageResponse represents a page of orders. The next page is requested with the next_cursor as the cursor
+// query parameter, it is omitted on the last page.
+type OrderPageResponse struct {
+	Orders     []OrderResponse `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// OrderRequest represents an order creation request object entity.
+type OrderRequest struct {
+	CustomerUUID string             `json:"customer_uuid"`
+	Products     []OrderLineRequest `json:"products"`
+}
+
+// OrderLineRequest represents a product to order and the number of its items.
+type OrderLineRequest struct {
+	ProductUUID string `json:"product_uuid"`
+	Items       int    `json:"items"`
+}
+
+// PlacedOrderResponse represents an order along with its products.
+type PlacedOrderResponse struct {
+	OrderResponse
+	Products []OrderProductResponse `json:"products"`
+}
+
 // OrderStatusRequest represents an order status update request object entity.
 type OrderStatusRequest struct {
 	Status app.OrderStatus `json:"status"`
 }
 
+// OrderStatusTransitionResponse represents an order status history object entity.
+type OrderStatusTransitionResponse struct {
+	From      app.OrderStatus `json:"from"`
+	To        app.OrderStatus `json:"to"`
+	Actor     string          `json:"actor"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
 // OrderProductResponse represents an order products object entity.
 type OrderProductResponse struct {
 	UUID        string          `json:"uuid"`
@@ -45,12 +105,86 @@ type OrderProductResponse struct {
 
 // ProductResponse represents a product object entity.
 type ProductResponse struct {
-	UUID               string `json:"uuid"`
-	Name               string `json:"name"`
-	Description        string `json:"description"`
-	Image              string `json:"items"`
-	AvailabilityStatus string `json:"availability_status"`
-	AvailableItems     int    `json:"available_items"`
+	UUID               string     `json:"uuid"`
+	Name               string     `json:"name"`
+	Description        string     `json:"description"`
+	Image              string     `json:"image"`
+	AvailabilityStatus string     `json:"availability_status"`
+	AvailableItems     int        `json:"available_items"`
+	Manufacturer       string     `json:"manufacturer"`
+	Vehicle            string     `json:"vehicle"`
+	ExternalID         string     `json:"external_id"`
+	CreatedAt          *time.Time `json:"created_at"`
+	DiscontinuedAt     *time.Time `json:"discontinued_at,omitempty"`
+}
+
+func (srv *Server) getOrders(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	query, err := parseOrderQuery(r.URL.Query())
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	page, err := srv.UserService.Orders(ctx, query, r.URL.Query().Get("cursor"))
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	response := OrderPageResponse{Orders: []OrderResponse{}, NextCursor: page.NextCursor}
+	for i := range page.Orders {
+		response.Orders = append(response.Orders, transformOrderToResponse(&page.Orders[i]))
+	}
+	Ok(w, response, http.StatusOK)
+}
+
+func (srv *Server) createOrder(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	orderRequest := OrderRequest{}
+	err := json.NewDecoder(r.Body).Decode(&orderRequest)
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+	lines := make([]app.OrderLine, 0, len(orderRequest.Products))
+	for _, line := range orderRequest.Products {
+		lines = append(lines, app.OrderLine{ProductUUID: line.ProductUUID, Items: line.Items})
+	}
+
+	order, created, err := srv.UserService.CreateOrder(ctx, orderRequest.CustomerUUID, lines,
+		r.Header.Get(HTTPHeaderNameIdempotencyKey))
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+	orderProducts, err := srv.UserService.OrderProductsByOrderUUID(ctx, order.UUID)
+	if err != nil {
+		log.With("success", false, "err", err)
+		ServerError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	response := PlacedOrderResponse{OrderResponse: transformOrderToResponse(order),
+		Products: transformOrderProductsToResponse(orderProducts)}
+	if !created {
+		w.Header().Set(HTTPHeaderNameIdempotentReplayed, "true")
+		Ok(w, response, http.StatusOK)
+		return
+	}
+	Ok(w, response, http.StatusCreated)
 }
 
 func (srv *Server) getOrderByUUID(w http.ResponseWriter, r *http.Request) {
@@ -62,16 +196,19 @@ func (srv *Server) getOrderByUUID(w http.ResponseWriter, r *http.Request) {
 	order, err := srv.UserService.OrderByUUID(ctx, orderUUID)
 	if err != nil {
 		log.With("success", false, "err", err)
-		if errors.Is(err, app.ErrNoRecords) {
-			NotFoundError(w, err)
-			return
-		}
-		ServerError(w, err)
+		AppError(w, err)
 		return
 	}
 
 	srv.App.Logger.With("success", true)
-	Ok(w, transformOrderToResponse(order), http.StatusOK)
+	response := transformOrderToResponse(order)
+	etag := orderETag(order.Version, response)
+	w.Header().Set(HTTPHeaderNameETag, etag)
+	if ifNoneMatchContains(r.Header.Get(HTTPHeaderNameIfNoneMatch), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	Ok(w, response, http.StatusOK)
 }
 
 func (srv *Server) updateOrderStatusByUUID(w http.ResponseWriter, r *http.Request) {
@@ -80,33 +217,46 @@ func (srv *Server) updateOrderStatusByUUID(w http.ResponseWriter, r *http.Reques
 	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
 
 	orderUUID := mux.Vars(r)["order_uuid"]
+	ifMatch := r.Header.Get(HTTPHeaderNameIfMatch)
+	if ifMatch == "" {
+		err := app.NewError("The If-Match header with the ETag of the order is required", nil)
+		log.With("success", false, "err", err)
+		PreconditionRequiredError(w, err)
+		return
+	}
+	version, err := parseIfMatch(ifMatch)
+	if err != nil {
+		err = app.NewError("The If-Match header must be * or the ETag of the order", err)
+		log.With("success", false, "err", err)
+		PreconditionFailedError(w, err)
+		return
+	}
 	orderStatusRequest := OrderStatusRequest{}
-	err := json.NewDecoder(r.Body).Decode(&orderStatusRequest)
+	err = json.NewDecoder(r.Body).Decode(&orderStatusRequest)
 	if err != nil {
 		log.With("success", false, "err", err)
 		BadRequestError(w, err)
 		return
 	}
-	if orderStatusRequest.Status != app.OrderStatusPreparing && orderStatusRequest.Status != app.OrderStatusPlaced &&
-		orderStatusRequest.Status != app.OrderStatusSending && orderStatusRequest.Status != app.OrderStatusCompleted &&
-		orderStatusRequest.Status != app.OrderStatusReviewed {
+	if !orderStatusRequest.Status.IsValid() {
 		err = errors.New("invalid status provided")
 		log.With("success", false, "err", err)
 		BadRequestError(w, err)
 		return
 	}
 
-	err = srv.UserService.UpdateOrderStatusByUUID(ctx, orderUUID, orderStatusRequest.Status)
+	version, err = srv.UserService.UpdateOrderStatusByUUID(ctx, orderUUID, orderStatusRequest.Status, version)
 	if err != nil {
 		log.With("success", false, "err", err)
-		if errors.Is(err, app.ErrNoRecords) {
-			NotFoundError(w, err)
-			return
-		}
-		ServerError(w, err)
+		AppError(w, err)
 		return
 	}
 	srv.App.Logger.With("success", true)
+	// The ETag also covers the customer of the order, so the order is read again. The ETag is left out if the order
+	// changed in the meantime.
+	if order, err := srv.UserService.OrderByUUID(ctx, orderUUID); err == nil && order.Version == version {
+		w.Header().Set(HTTPHeaderNameETag, orderETag(order.Version, transformOrderToResponse(order)))
+	}
 	Ok(w, nil, http.StatusNoContent)
 }
 
@@ -119,11 +269,7 @@ func (srv *Server) getOrderProductsByOrderUUID(w http.ResponseWriter, r *http.Re
 	orderProducts, err := srv.UserService.OrderProductsByOrderUUID(ctx, orderUUID)
 	if err != nil {
 		log.With("success", false, "err", err)
-		if errors.Is(err, app.ErrNoRecords) {
-			NotFoundError(w, err)
-			return
-		}
-		ServerError(w, err)
+		AppError(w, err)
 		return
 	}
 
@@ -131,22 +277,88 @@ func (srv *Server) getOrderProductsByOrderUUID(w http.ResponseWriter, r *http.Re
 	Ok(w, transformOrderProductsToResponse(orderProducts), http.StatusOK)
 }
 
+func (srv *Server) getOrderStatusHistoryByOrderUUID(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	orderUUID := mux.Vars(r)["order_uuid"]
+	transitions, err := srv.UserService.OrderStatusHistoryByUUID(ctx, orderUUID)
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformOrderStatusTransitionsToResponse(transitions), http.StatusOK)
+}
+
+// parseOrderQuery reads the status, customer, from, to, sort and limit query parameters of an order listing.
+// Several statuses are separated by commas or given as repeated parameters. Dates are RFC 3339 timestamps or
+// YYYY-MM-DD days.
+func parseOrderQuery(values url.Values) (app.OrderQuery, error) {
+	query := app.OrderQuery{
+		CustomerUUID: values.Get("customer"),
+		Sort:         app.OrderSort(values.Get("sort")),
+	}
+	for _, statuses := range values["status"] {
+		for _, status := range strings.Split(statuses, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				query.Statuses = append(query.Statuses, app.OrderStatus(status))
+			}
+		}
+	}
+	var err error
+	if query.From, err = parseQueryTime(values, "from"); err != nil {
+		return query, err
+	}
+	if query.To, err = parseQueryTime(values, "to"); err != nil {
+		return query, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit < 1 {
+			return query, app.NewError("The limit must be a positive integer", err)
+		}
+	}
+	return query, nil
+}
+
 func transformOrderToResponse(order *app.Order) OrderResponse {
 	return OrderResponse{
-		UUID: order.UUID,
-		Customer: CustomerResponse{
-			UUID:             order.Customer.UUID,
-			FirstName:        order.Customer.FirstName,
-			LastName:         order.Customer.LastName,
-			Email:            order.Customer.Email,
-			PhoneNumber:      order.Customer.PhoneNumber,
-			RegistrationDate: order.Customer.RegistrationDate,
-		},
+		UUID:       order.UUID,
+		Customer:   transformCustomerToResponse(order.Customer),
 		Status:     order.Status,
 		PlacedDate: order.PlacedDate,
 	}
 }
 
+func transformCustomerToResponse(customer app.Customer) CustomerResponse {
+	return CustomerResponse{
+		UUID:             customer.UUID,
+		FirstName:        customer.FirstName,
+		LastName:         customer.LastName,
+		Email:            customer.Email,
+		PhoneNumber:      customer.PhoneNumber,
+		RegistrationDate: customer.RegistrationDate,
+	}
+}
+
+func transformCustomerProfileToResponse(profile *app.CustomerProfile) CustomerProfileResponse {
+	stats := profile.ReviewStats
+	return CustomerProfileResponse{
+		CustomerResponse: transformCustomerToResponse(profile.Customer),
+		ReviewStats: CustomerReviewStatsResponse{
+			ReviewableOrderCount: stats.ReviewableOrderCount,
+			ReviewedOrderCount:   stats.ReviewedOrderCount,
+			ParticipationRate:    stats.ParticipationRate(),
+			ReviewCount:          stats.ReviewCount,
+			AverageSentiment:     stats.AverageSentiment(),
+		},
+	}
+}
+
 func transformOrderProductsToResponse(orderProducts []app.OrderProduct) []OrderProductResponse {
 	orderProductResponse := []OrderProductResponse{}
 	for _, orderProduct := range orderProducts {
@@ -155,25 +367,23 @@ func transformOrderProductsToResponse(orderProducts []app.OrderProduct) []OrderP
 			OrderUUID:   orderProduct.OrderUUID,
 			ProductUUID: orderProduct.ProductUUID,
 			Items:       orderProduct.Items,
-			Product: ProductResponse{
-				UUID:               orderProduct.Product.UUID,
-				Name:               orderProduct.Product.Name,
-				Description:        orderProduct.Product.Description,
-				Image:              orderProduct.Product.Image,
-				AvailabilityStatus: orderProduct.Product.AvailabilityStatus,
-				AvailableItems:     orderProduct.Product.AvailableItems,
-			},
+			Product:     transformProductToResponse(orderProduct.Product),
 		})
 	}
 	return orderProductResponse
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+func transformOrderStatusTransitionsToResponse(transitions []app.OrderStatusTransition) []OrderStatusTransitionResponse {
+	transitionsResponse := []OrderStatusTransitionResponse{}
+	for _, transition := range transitions {
+		transitionsResponse = append(transitionsResponse, OrderStatusTransitionResponse{
+			From:      transition.From,
+			To:        transition.To,
+			Actor:     transition.Actor,
+			CreatedAt: transition.CreatedAt,
+		})
+	}
+	return transitionsResponse
 }
 
 func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -182,14 +392,21 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
 
 	orderUUID := mux.Vars(r)["order_uuid"]
+	// The customers authenticated by their token were checked to own the order, they need no signed link. The other
+	// callers, API keys included, need one.
+	if customerFromContext(ctx) == nil {
+		err := srv.ReviewLinkSigner.Verify(orderUUID, r.URL.Query(), time.Now())
+		if err != nil {
+			log.With("success", false, "err", err)
+			ForbiddenError(w, app.NewError("The review link is invalid or has expired", err))
+			return
+		}
+	}
+
 	order, err := srv.UserService.OrderByUUID(ctx, orderUUID)
 	if err != nil {
 		log.With("success", false, "err", err)
-		if errors.Is(err, app.ErrNoRecords) {
-			NotFoundError(w, err)
-			return
-		}
-		ServerError(w, err)
+		AppError(w, err)
 		return
 	}
 	if order.Status != app.OrderStatusCompleted {
@@ -202,18 +419,19 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	orderProducts, err := srv.UserService.OrderProductsByOrderUUID(ctx, orderUUID)
 	if err != nil {
 		log.With("success", false, "err", err)
-		if errors.Is(err, app.ErrNoRecords) {
-			NotFoundError(w, err)
-			return
-		}
-		ServerError(w, err)
+		AppError(w, err)
 		return
 	}
 
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     srv.checkWebSocketOrigin,
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		// Upgrade already answered the request, with a 403 if its origin is not allowed.
 		log.With("success", false, "err", err)
-		ServerError(w, err)
 		return
 	}
 	defer conn.Close()
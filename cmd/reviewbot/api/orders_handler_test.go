@@ -0,0 +1,227 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"reviewbot/app"
+	"reviewbot/internal/domain/orders"
+	"reviewbot/internal/reviewlink"
+	"reviewbot/pkg/catalogsource/noopsource"
+	"reviewbot/pkg/responsegenerator/dummygenerator"
+	"reviewbot/pkg/sentimentanalyzer/dummyanalyzer"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	selectOrderQuery = regexp.QuoteMeta("SELECT `uuid`, `customer_uuid`, `status`, `placed_date`, `version` " +
+		"FROM `orders` WHERE (`uuid` = 'ord1')")
+	selectCustomerQuery = regexp.QuoteMeta("FROM `customers` WHERE (`uuid` = 'cus1')")
+	lockOrderQuery      = regexp.QuoteMeta("SELECT `status`, `version` FROM `orders` WHERE (`uuid` = 'ord1') FOR UPDATE")
+	testPlacedDate      = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+)
+
+// newTestOrdersServer returns a test server whose orders service queries a mock database.
+func newTestOrdersServer(t *testing.T) (*Server, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	srv := newTestServer()
+	srv.UserService = orders.NewService(orders.NewDatabaseRepository(sqlx.NewDb(db, "mysql")),
+		dummygenerator.NewDummyGenerator(), dummyganalyzer.NewDummyAnalyzer(), noopsource.NewNoopSource(),
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return srv, mock
+}
+
+// expectOrder expects the order ord1 of the customer cus1 at version to be read.
+func expectOrder(mock sqlmock.Sqlmock, version int, email string) {
+	mock.ExpectQuery(selectOrderQuery).WillReturnRows(sqlmock.NewRows([]string{"uuid", "customer_uuid", "status",
+		"placed_date", "version"}).AddRow("ord1", "cus1", app.OrderStatusPlaced, testPlacedDate, version))
+	mock.ExpectQuery(selectCustomerQuery).WillReturnRows(sqlmock.NewRows([]string{"uuid", "first_name",
+		"last_name", "email", "phone_number", "registration_date"}).
+		AddRow("cus1", "Jane", "Doe", email, "", testPlacedDate))
+}
+
+func getOrder(srv *Server, ifNoneMatch string) *httptest.ResponseRecorder {
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/orders/ord1", nil),
+		map[string]string{"order_uuid": "ord1"})
+	if ifNoneMatch != "" {
+		r.Header.Set(HTTPHeaderNameIfNoneMatch, ifNoneMatch)
+	}
+	w := httptest.NewRecorder()
+	srv.getOrderByUUID(w, r)
+	return w
+}
+
+// TestGetOrderETag tests that the ETag of an order changes with its version and with its customer, and that a
+// request listing the current ETag in If-None-Match is answered with a 304.
+func TestGetOrderETag(t *testing.T) {
+	// Arrange
+	srv, mock := newTestOrdersServer(t)
+	expectOrder(mock, 2, "jane@example.com")
+	expectOrder(mock, 2, "jane@example.com")
+	expectOrder(mock, 2, "jane.doe@example.com")
+	expectOrder(mock, 3, "jane.doe@example.com")
+
+	// Act
+	first := getOrder(srv, "")
+	etag := first.Header().Get(HTTPHeaderNameETag)
+	notModified := getOrder(srv, etag)
+	customerChanged := getOrder(srv, etag)
+	versionChanged := getOrder(srv, customerChanged.Header().Get(HTTPHeaderNameETag))
+	// Assert
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `"2-`) {
+		t.Fatalf("Response mismatch: got %d with ETag %s, want %d with the ETag of version 2", first.Code, etag,
+			http.StatusOK)
+	}
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Fatalf("Status mismatch: got %d with body %q, want %d", notModified.Code, notModified.Body.String(),
+			http.StatusNotModified)
+	}
+	if customerChanged.Code != http.StatusOK || customerChanged.Header().Get(HTTPHeaderNameETag) == etag {
+		t.Fatalf("Response mismatch: got %d with ETag %s, want %d with another ETag", customerChanged.Code,
+			customerChanged.Header().Get(HTTPHeaderNameETag), http.StatusOK)
+	}
+	if versionChanged.Code != http.StatusOK {
+		t.Fatalf("Status mismatch: got %d, want %d", versionChanged.Code, http.StatusOK)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestUpdateOrderStatusRequiresIfMatch tests that a status change must state the ETag it is based on, is refused if
+// the order changed since, and answers with the ETag of the new version.
+func TestUpdateOrderStatusRequiresIfMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		ifMatch    string
+		expect     func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantCode   app.Code
+		wantETag   string
+	}{
+		{name: "missing", wantStatus: http.StatusPreconditionRequired, wantCode: app.CodePreconditionRequired},
+		{name: "malformed", ifMatch: "1", wantStatus: http.StatusPreconditionFailed,
+			wantCode: app.CodePreconditionFailed},
+		{name: "stale", ifMatch: `"1-0a1b2c3d4e5f6071"`, expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockOrderQuery).WillReturnRows(sqlmock.NewRows([]string{"status", "version"}).
+				AddRow(app.OrderStatusPlaced, 2))
+			mock.ExpectRollback()
+		}, wantStatus: http.StatusPreconditionFailed, wantCode: app.CodePreconditionFailed},
+		{name: "current", ifMatch: `"1-0a1b2c3d4e5f6071"`, expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockOrderQuery).WillReturnRows(sqlmock.NewRows([]string{"status", "version"}).
+				AddRow(app.OrderStatusPlaced, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `orders` SET `status`='preparing'")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_status_history`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			expectOrder(mock, 2, "jane@example.com")
+		}, wantStatus: http.StatusNoContent, wantETag: `"2-`},
+		{name: "changed after the update", ifMatch: "*", expect: func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(lockOrderQuery).WillReturnRows(sqlmock.NewRows([]string{"status", "version"}).
+				AddRow(app.OrderStatusPlaced, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `orders`")).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_status_history`")).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `outbox_events`")).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			expectOrder(mock, 3, "jane@example.com")
+		}, wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			srv, mock := newTestOrdersServer(t)
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodPatch, "/api/orders/ord1",
+				strings.NewReader(`{"status":"preparing"}`)), map[string]string{"order_uuid": "ord1"})
+			if tt.ifMatch != "" {
+				r.Header.Set(HTTPHeaderNameIfMatch, tt.ifMatch)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			srv.updateOrderStatusByUUID(w, r)
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				if problem := decodeProblem(t, w); problem.Code != string(tt.wantCode) {
+					t.Fatalf("Code mismatch: got %q, want %q", problem.Code, tt.wantCode)
+				}
+			}
+			if etag := w.Header().Get(HTTPHeaderNameETag); !strings.HasPrefix(etag, tt.wantETag) ||
+				(tt.wantETag == "") != (etag == "") {
+				t.Fatalf("ETag mismatch: got %q, want %q followed by the hash of the order", etag, tt.wantETag)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestReviewOrderRequiresSignedLink tests that the review chat of an order is refused without a valid signed link to
+// the callers other than the customer of the order, API keys included.
+func TestReviewOrderRequiresSignedLink(t *testing.T) {
+	signer := reviewlink.NewSigner("http://reviewbot.example.net", "secret", time.Hour)
+	tests := []struct {
+		name       string
+		target     string
+		key        string
+		wantStatus int
+	}{
+		{name: "anonymous without link", target: "/ws/orders/ord1", wantStatus: http.StatusForbidden},
+		{name: "API key without link", target: "/ws/orders/ord1", key: testAdminKey,
+			wantStatus: http.StatusForbidden},
+		{name: "forged link", target: "/ws/orders/ord1?expires=4102444800&signature=forged",
+			wantStatus: http.StatusForbidden},
+		// The order is not completed, which is only checked once the link is accepted.
+		{name: "signed link", target: signer.Link("ord1", time.Now()), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			srv, mock := newTestOrdersServer(t)
+			srv.ReviewLinkSigner = signer
+			if tt.wantStatus != http.StatusForbidden {
+				expectOrder(mock, 1, "jane@example.com")
+			}
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.key != "" {
+				r.Header.Set(HTTPHeaderNameAPIKey, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			srv.routes().ServeHTTP(w, r)
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"reviewbot/app"
+	"strconv"
+)
+
+// ProductRequest represents a product create or update request object entity.
+type ProductRequest struct {
+	Name               string `json:"name"`
+	Description        string `json:"description"`
+	Image              string `json:"image"`
+	AvailabilityStatus string `json:"availability_status"`
+	AvailableItems     int    `json:"available_items"`
+	Manufacturer       string `json:"manufacturer"`
+	Vehicle            string `json:"vehicle"`
+	ExternalID         string `json:"external_id"`
+}
+
+// ProductPageResponse represents a page of products. The next page is requested with the next_cursor as the cursor
+// query parameter, it is omitted on the last page.
+type ProductPageResponse struct {
+	Products   []ProductResponse `json:"products"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+func (srv *Server) getProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	query, err := parseProductQuery(r.URL.Query())
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	page, err := srv.UserService.Products(ctx, query, r.URL.Query().Get("cursor"))
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	response := ProductPageResponse{Products: []ProductResponse{}, NextCursor: page.NextCursor}
+	for _, product := range page.Products {
+		response.Products = append(response.Products, transformProductToResponse(product))
+	}
+	Ok(w, response, http.StatusOK)
+}
+
+func (srv *Server) getProductByUUID(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	product, err := srv.UserService.ProductByUUID(ctx, mux.Vars(r)["product_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformProductToResponse(*product), http.StatusOK)
+}
+
+func (srv *Server) createProduct(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	productRequest := ProductRequest{}
+	err := json.NewDecoder(r.Body).Decode(&productRequest)
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	product, err := srv.UserService.CreateProduct(ctx, transformProductRequestToProduct(productRequest))
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformProductToResponse(*product), http.StatusCreated)
+}
+
+func (srv *Server) updateProduct(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	productRequest := ProductRequest{}
+	err := json.NewDecoder(r.Body).Decode(&productRequest)
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	product, err := srv.UserService.UpdateProduct(ctx, mux.Vars(r)["product_uuid"],
+		transformProductRequestToProduct(productRequest))
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformProductToResponse(*product), http.StatusOK)
+}
+
+func (srv *Server) deleteProduct(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	err := srv.UserService.DeleteProduct(ctx, mux.Vars(r)["product_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, nil, http.StatusNoContent)
+}
+
+// parseProductQuery reads the search, availability and limit query parameters of a product listing.
+func parseProductQuery(values url.Values) (app.ProductQuery, error) {
+	query := app.ProductQuery{
+		Search:       values.Get("search"),
+		Availability: values.Get("availability"),
+	}
+	if limit := values.Get("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit < 1 {
+			return query, app.NewError("The limit must be a positive integer", err)
+		}
+	}
+	return query, nil
+}
+
+func transformProductRequestToProduct(productRequest ProductRequest) app.Product {
+	return app.Product{
+		Name:               productRequest.Name,
+		Description:        productRequest.Description,
+		Image:              productRequest.Image,
+		AvailabilityStatus: productRequest.AvailabilityStatus,
+		AvailableItems:     productRequest.AvailableItems,
+		Manufacturer:       productRequest.Manufacturer,
+		Vehicle:            productRequest.Vehicle,
+		ID:                 productRequest.ExternalID,
+	}
+}
+
+func transformProductToResponse(product app.Product) ProductResponse {
+	response := ProductResponse{
+		UUID:               product.UUID,
+		Name:               product.Name,
+		Description:        product.Description,
+		Image:              product.Image,
+		AvailabilityStatus: product.AvailabilityStatus,
+		AvailableItems:     product.AvailableItems,
+		Manufacturer:       product.Manufacturer,
+		Vehicle:            product.Vehicle,
+		ExternalID:         product.ID,
+		DiscontinuedAt:     product.DiscontinuedAt,
+	}
+	if !product.CreatedAt.IsZero() {
+		response.CreatedAt = &product.CreatedAt
+	}
+	return response
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"reviewbot/app"
+	"reviewbot/internal/ratelimit"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimiters are the limiters of the route groups. A nil limiter limits nothing.
+type RateLimiters struct {
+	// Read limits the GET and HEAD requests of each client.
+	Read *ratelimit.Limiter
+	// Write limits the other requests of each client.
+	Write *ratelimit.Limiter
+	// Order limits the requests about each order, whoever makes them.
+	Order *ratelimit.Limiter
+	// AuthFailures limits the failed credential checks of each IP address.
+	AuthFailures *ratelimit.Limiter
+}
+
+// TrustedProxies are the networks of the reverse proxies in front of the server, whose X-Forwarded-For header tells
+// the address of the clients. Without them, the clients are told apart by the remote address of their requests.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma separated list of IP addresses and CIDR networks.
+func ParseTrustedProxies(value string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("parse trusted proxy %q: invalid IP address", item)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			item = fmt.Sprintf("%s/%d", item, bits)
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("parse trusted proxy %q: %w", item, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (tp TrustedProxies) contains(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range tp {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddress returns the IP address of the client of a request. When the request comes from a trusted proxy, it is
+// the rightmost address of the X-Forwarded-For headers which is not one of a trusted proxy, as the addresses on its
+// left are set by the client and can be forged.
+func (tp TrustedProxies) clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !tp.contains(host) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values(HTTPHeaderNameForwardedFor), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		if net.ParseIP(address) == nil {
+			// The proxies append valid addresses, a malformed one was forged: the address on its right is the client.
+			return host
+		}
+		if host = address; !tp.contains(address) {
+			return address
+		}
+	}
+	return host
+}
+
+// rateLimitClient returns the key the requests of a client are limited by: the actor for authenticated requests and
+// the IP address of the client for anonymous ones.
+func (srv *Server) rateLimitClient(r *http.Request) string {
+	if actor := app.ActorFromContext(r.Context()); actor != "" && actor != ActorAnonymous {
+		return actor
+	}
+	return "ip:" + srv.TrustedProxies.clientAddress(r)
+}
+
+// rateLimit refuses the requests over the limit of their client with a 429, telling in the Retry-After header how
+// many seconds to wait. It runs after authenticate, so that the clients sharing an address are told apart by their
+// credentials.
+func (srv *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter := srv.RateLimiters.Write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			limiter = srv.RateLimiters.Read
+		}
+		if limiter != nil {
+			if ok, retryAfter := limiter.Take(srv.rateLimitClient(r), time.Now()); !ok {
+				srv.refuseRateLimited(w, r, retryAfter)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitOrder refuses the requests over the limit of their order with a 429. It runs after authorize, so that the
+// requests of clients not allowed to access an order cannot exhaust its limit.
+func (srv *Server) rateLimitOrder(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if orderUUID := mux.Vars(r)["order_uuid"]; orderUUID != "" && srv.RateLimiters.Order != nil {
+			if ok, retryAfter := srv.RateLimiters.Order.Take("order:"+orderUUID, time.Now()); !ok {
+				srv.refuseRateLimited(w, r, retryAfter)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authFailuresWait returns how long the IP address of a request must wait before its credentials are checked again,
+// 0 unless it is over its limit of failed checks.
+func (srv *Server) authFailuresWait(r *http.Request) time.Duration {
+	if srv.RateLimiters.AuthFailures == nil {
+		return 0
+	}
+	return srv.RateLimiters.AuthFailures.Wait("ip:"+srv.TrustedProxies.clientAddress(r), time.Now())
+}
+
+// recordAuthFailure counts a failed credential check against the IP address of a request.
+func (srv *Server) recordAuthFailure(r *http.Request) {
+	if srv.RateLimiters.AuthFailures != nil {
+		srv.RateLimiters.AuthFailures.Take("ip:"+srv.TrustedProxies.clientAddress(r), time.Now())
+	}
+}
+
+// refuseRateLimited answers a request over a limit with a 429, telling in the Retry-After header how many seconds to
+// wait.
+func (srv *Server) refuseRateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := ratelimit.RetryAfterSeconds(retryAfter)
+	srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(r.Context())).
+		Info("Request rate limited", "client", srv.rateLimitClient(r), "retry_after", seconds)
+	w.Header().Set(HTTPHeaderNameRetryAfter, strconv.Itoa(seconds))
+	AppError(w, app.NewCodedError(app.CodeRateLimited,
+		fmt.Sprintf("Too many requests, retry in %d seconds", seconds), nil))
+}
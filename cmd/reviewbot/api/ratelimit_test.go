@@ -0,0 +1,223 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reviewbot/app"
+	"reviewbot/internal/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// rateLimitRequest is a request sent to the router of newRateLimitRouter.
+type rateLimitRequest struct {
+	method       string
+	path         string
+	key          string
+	remoteAddr   string
+	forwardedFor string
+}
+
+// newRateLimitRouter returns a router of srv running its authentication, authorization and rate limiting middlewares
+// in the order of the API.
+func newRateLimitRouter(srv *Server) *mux.Router {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router := mux.NewRouter()
+	router.Use(srv.authenticate)
+	router.Use(srv.rateLimit)
+	router.Use(srv.authorize)
+	router.Use(srv.rateLimitOrder)
+	router.HandleFunc("/orders", ok).Methods(http.MethodGet, http.MethodPost)
+	router.Handle("/orders/{order_uuid}", requireScope(app.ScopeOrdersRead, ok)).Methods(http.MethodGet)
+	return router
+}
+
+// serveRequests sends the requests to router and returns the response to the last one.
+func serveRequests(router *mux.Router, requests []rateLimitRequest) *httptest.ResponseRecorder {
+	var w *httptest.ResponseRecorder
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.path, nil)
+		if req.key != "" {
+			r.Header.Set(HTTPHeaderNameAPIKey, req.key)
+		}
+		if req.remoteAddr != "" {
+			r.RemoteAddr = req.remoteAddr
+		}
+		if req.forwardedFor != "" {
+			r.Header.Set(HTTPHeaderNameForwardedFor, req.forwardedFor)
+		}
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+	}
+	return w
+}
+
+// TestRateLimitRefusesRequestsOverTheLimit tests that the requests of a client, or about an order, over their limit
+// are refused with a 429 telling how long to wait, and that the other clients are not affected.
+func TestRateLimitRefusesRequestsOverTheLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		requests       []rateLimitRequest
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "reads of a key over the limit", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", key: testReaderKey},
+			{method: http.MethodGet, path: "/orders", key: testReaderKey},
+			{method: http.MethodGet, path: "/orders", key: testReaderKey},
+		}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "30"},
+		{name: "reads of several keys", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", key: testReaderKey},
+			{method: http.MethodGet, path: "/orders", key: testReaderKey},
+			{method: http.MethodGet, path: "/orders", key: testAdminKey},
+		}, wantStatus: http.StatusOK},
+		{name: "writes of a key over the limit", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", key: testAdminKey},
+			{method: http.MethodPost, path: "/orders", key: testAdminKey},
+			{method: http.MethodPost, path: "/orders", key: testAdminKey},
+		}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "60"},
+		{name: "anonymous reads from one address", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:1234"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:5678"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:9012"},
+		}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "30"},
+		{name: "anonymous reads from several addresses", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:1234"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:5678"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.2:1234"},
+		}, wantStatus: http.StatusOK},
+		{name: "reads of an order by several keys", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders/ord1", key: testReaderKey},
+			{method: http.MethodGet, path: "/orders/ord1", key: testAdminKey},
+		}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "60"},
+		{name: "reads of several orders", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders/ord1", key: testReaderKey},
+			{method: http.MethodGet, path: "/orders/ord2", key: testReaderKey},
+		}, wantStatus: http.StatusOK},
+		{name: "unauthorized reads of an order", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders/ord1", remoteAddr: "192.0.2.1:1234"},
+			{method: http.MethodGet, path: "/orders/ord1", key: testReaderKey},
+		}, wantStatus: http.StatusOK},
+		{name: "anonymous reads through a trusted proxy", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.1"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "10.0.0.2:1234", forwardedFor: "192.0.2.1"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.2"},
+		}, wantStatus: http.StatusOK},
+		{name: "forged addresses through a trusted proxy", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", remoteAddr: "10.0.0.1:1234",
+				forwardedFor: "198.51.100.1, 192.0.2.1, 10.0.0.3"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "10.0.0.1:1234",
+				forwardedFor: "198.51.100.2, 192.0.2.1"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "10.0.0.1:1234",
+				forwardedFor: "198.51.100.3, 192.0.2.1"},
+		}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "30"},
+		{name: "forwarded addresses from an untrusted client", requests: []rateLimitRequest{
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:1234", forwardedFor: "198.51.100.1"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:1234", forwardedFor: "198.51.100.2"},
+			{method: http.MethodGet, path: "/orders", remoteAddr: "192.0.2.1:1234", forwardedFor: "198.51.100.3"},
+		}, wantStatus: http.StatusTooManyRequests, wantRetryAfter: "30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			srv := newTestServer()
+			srv.RateLimiters = RateLimiters{
+				Read:  ratelimit.NewLimiter(ratelimit.Limit{Events: 2, Per: time.Minute}),
+				Write: ratelimit.NewLimiter(ratelimit.Limit{Events: 1, Per: time.Minute}),
+				Order: ratelimit.NewLimiter(ratelimit.Limit{Events: 1, Per: time.Minute}),
+			}
+			var err error
+			if srv.TrustedProxies, err = ParseTrustedProxies("10.0.0.0/8"); err != nil {
+				t.Fatalf("Error parsing trusted proxies: %v", err)
+			}
+
+			// Act
+			w := serveRequests(newRateLimitRouter(srv), tt.requests)
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if retryAfter := w.Header().Get(HTTPHeaderNameRetryAfter); retryAfter != tt.wantRetryAfter {
+				t.Fatalf("Retry-After mismatch: got %q, want %q", retryAfter, tt.wantRetryAfter)
+			}
+			if w.Code == http.StatusTooManyRequests {
+				if problem := decodeProblem(t, w); problem.Code != string(app.CodeRateLimited) {
+					t.Fatalf("Code mismatch: got %q, want %q", problem.Code, app.CodeRateLimited)
+				}
+			}
+		})
+	}
+}
+
+// TestAuthenticateLimitsFailedCredentials tests that the credentials sent from an address over its limit of failed
+// checks are refused with a 429 without being checked, and that the other addresses and the anonymous requests are
+// not affected.
+func TestAuthenticateLimitsFailedCredentials(t *testing.T) {
+	failures := []rateLimitRequest{
+		{method: http.MethodGet, path: "/orders", key: "rbk_guess1", remoteAddr: "192.0.2.1:1234"},
+		{method: http.MethodGet, path: "/orders", key: "rbk_guess2", remoteAddr: "192.0.2.1:1234"},
+	}
+	tests := []struct {
+		name       string
+		request    rateLimitRequest
+		wantStatus int
+	}{
+		{name: "valid key from the address", request: rateLimitRequest{method: http.MethodGet, path: "/orders",
+			key: testReaderKey, remoteAddr: "192.0.2.1:1234"}, wantStatus: http.StatusTooManyRequests},
+		{name: "anonymous request from the address", request: rateLimitRequest{method: http.MethodGet,
+			path: "/orders", remoteAddr: "192.0.2.1:1234"}, wantStatus: http.StatusOK},
+		{name: "valid key from another address", request: rateLimitRequest{method: http.MethodGet, path: "/orders",
+			key: testReaderKey, remoteAddr: "192.0.2.2:1234"}, wantStatus: http.StatusOK},
+		{name: "invalid key from another address", request: rateLimitRequest{method: http.MethodGet,
+			path: "/orders", key: "rbk_guess3", remoteAddr: "192.0.2.2:1234"}, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			srv := newTestServer()
+			srv.RateLimiters = RateLimiters{
+				AuthFailures: ratelimit.NewLimiter(ratelimit.Limit{Events: 2, Per: time.Minute}),
+			}
+			router := newRateLimitRouter(srv)
+			if w := serveRequests(router, failures); w.Code != http.StatusUnauthorized {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+
+			// Act
+			w := serveRequests(router, []rateLimitRequest{tt.request})
+			// Assert
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status mismatch: got %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// TestParseTrustedProxies tests that trusted proxies are IP addresses or CIDR networks.
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantCount int
+		wantErr   bool
+	}{
+		{value: "", wantCount: 0},
+		{value: "10.0.0.0/8, 192.0.2.10, 2001:db8::1, fd00::/8", wantCount: 4},
+		{value: "10.0.0.0/33", wantErr: true},
+		{value: "proxy.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			// Act
+			proxies, err := ParseTrustedProxies(tt.value)
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Error mismatch: got %v, want error %v", err, tt.wantErr)
+			}
+			if len(proxies) != tt.wantCount {
+				t.Fatalf("Proxies mismatch: got %d, want %d", len(proxies), tt.wantCount)
+			}
+		})
+	}
+}
@@ -38,8 +38,7 @@ func Ok(w http.ResponseWriter, response interface{}, httpStatus int) {
 		enc.SetEscapeHTML(false)
 		err := enc.Encode(response)
 		if err != nil {
-
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			ServerError(w, err)
 			return
 		}
 	}
@@ -51,22 +50,54 @@ func Ok(w http.ResponseWriter, response interface{}, httpStatus int) {
 	}
 }
 
+// AppError writes the provided error along with the http status its application code maps to, or a 500 http status
+// if it has none.
+func AppError(w http.ResponseWriter, err error) {
+	Error(w, err, errorStatus(err))
+}
+
 // BadRequestError writes the provided error along with a 400 http status.
 func BadRequestError(w http.ResponseWriter, err error) {
 	Error(w, err, http.StatusBadRequest)
 }
 
+// ForbiddenError writes the provided error along with a 403 http status.
+func ForbiddenError(w http.ResponseWriter, err error) {
+	Error(w, err, http.StatusForbidden)
+}
+
 // NotFoundError writes the provided error along with a 404 http status.
 func NotFoundError(w http.ResponseWriter, err error) {
 	Error(w, err, http.StatusNotFound)
 }
 
+// ConflictError writes the provided error along with a 409 http status.
+func ConflictError(w http.ResponseWriter, err error) {
+	Error(w, err, http.StatusConflict)
+}
+
+// PreconditionFailedError writes the provided error along with a 412 http status.
+func PreconditionFailedError(w http.ResponseWriter, err error) {
+	Error(w, err, http.StatusPreconditionFailed)
+}
+
+// PreconditionRequiredError writes the provided error along with a 428 http status.
+func PreconditionRequiredError(w http.ResponseWriter, err error) {
+	Error(w, err, http.StatusPreconditionRequired)
+}
+
+// UnprocessableEntityError writes the provided error along with a 422 http status.
+func UnprocessableEntityError(w http.ResponseWriter, err error) {
+	Error(w, err, http.StatusUnprocessableEntity)
+}
+
 // ServerError writes the provided error along with a 500 http status.
 func ServerError(w http.ResponseWriter, err error) {
 	Error(w, err, http.StatusInternalServerError)
 }
 
-// Error writes the provided error along with the provided http status.
+// Error writes the provided error as a problem along with the provided http status. The details of 5xx errors are
+// not disclosed.
 func Error(w http.ResponseWriter, err error, httpStatus int) {
 	// Malformed request error.
 	if e, ok := err.(*malformedRequestError); ok {
@@ -77,25 +108,5 @@ func Error(w http.ResponseWriter, err error, httpStatus int) {
 		httpStatus = e.status
 	}
 
-	// 5xx
-	if httpStatus >= http.StatusInternalServerError {
-		http.Error(w, http.StatusText(httpStatus), httpStatus)
-		return
-	}
-
-	apiError := ErrorWrapper{
-		Error: ApiError{
-			Message: app.ErrorMessage(err),
-		},
-	}
-
-	res, e := json.Marshal(apiError)
-	if e != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(httpStatus)
-	w.Write(res)
+	writeProblem(w, newProblem(err, httpStatus, w.Header().Get(HTTPHeaderNameRequestID)))
 }
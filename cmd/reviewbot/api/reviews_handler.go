@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/url"
+	"reviewbot/app"
+	"strconv"
+	"time"
+)
+
+// ReviewResponse represents a review object entity.
+type ReviewResponse struct {
+	UUID             string            `json:"uuid"`
+	OrderUUID        string            `json:"order_uuid"`
+	OrderProductUUID string            `json:"order_product_uuid"`
+	ProductUUID      string            `json:"product_uuid"`
+	CustomerUUID     string            `json:"customer_uuid"`
+	Score            int64             `json:"score"`
+	Sentiment        app.SentimentBand `json:"sentiment"`
+	Text             string            `json:"text"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+// ReviewPageResponse represents a page of reviews. The next page is requested with the next_cursor as the cursor
+// query parameter, it is omitted on the last page.
+type ReviewPageResponse struct {
+	Reviews    []ReviewResponse `json:"reviews"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// ProductReviewSummaryResponse represents the review summary of a product.
+type ProductReviewSummaryResponse struct {
+	ProductUUID  string                      `json:"product_uuid"`
+	ReviewCount  int64                       `json:"review_count"`
+	MeanScore    float64                     `json:"mean_score"`
+	Sentiment    map[app.SentimentBand]int64 `json:"sentiment"`
+	Stars        map[string]int64            `json:"stars"`
+	LastReviewAt *time.Time                  `json:"last_review_at"`
+	Trend        ReviewTrendResponse         `json:"trend"`
+}
+
+// ReviewTrendResponse represents the reviews of the last days compared with the days before them.
+type ReviewTrendResponse struct {
+	Days                int                        `json:"days"`
+	ReviewCount         int64                      `json:"review_count"`
+	MeanScore           float64                    `json:"mean_score"`
+	PreviousReviewCount int64                      `json:"previous_review_count"`
+	PreviousMeanScore   float64                    `json:"previous_mean_score"`
+	Daily               []DailyReviewStatsResponse `json:"daily"`
+}
+
+// DailyReviewStatsResponse represents the reviews of a day.
+type DailyReviewStatsResponse struct {
+	Day         string  `json:"day"`
+	ReviewCount int64   `json:"review_count"`
+	MeanScore   float64 `json:"mean_score"`
+}
+
+// reviewLister gets a page of the reviews of the entity identified by uuid.
+type reviewLister func(ctx context.Context, uuid string, query app.ReviewQuery, cursor string) (*app.ReviewPage,
+	error)
+
+func (srv *Server) getOrderReviews(w http.ResponseWriter, r *http.Request) {
+	srv.listReviews(w, r, mux.Vars(r)["order_uuid"], srv.ReviewsService.OrderReviews)
+}
+
+func (srv *Server) getProductReviews(w http.ResponseWriter, r *http.Request) {
+	srv.listReviews(w, r, mux.Vars(r)["product_uuid"], srv.ReviewsService.ProductReviews)
+}
+
+func (srv *Server) getCustomerReviews(w http.ResponseWriter, r *http.Request) {
+	srv.listReviews(w, r, mux.Vars(r)["customer_uuid"], srv.ReviewsService.CustomerReviews)
+}
+
+func (srv *Server) getProductReviewSummary(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	summary, err := srv.ReviewsService.ProductSummary(ctx, mux.Vars(r)["product_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformProductReviewSummaryToResponse(summary), http.StatusOK)
+}
+
+func (srv *Server) listReviews(w http.ResponseWriter, r *http.Request, uuid string, list reviewLister) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	query, err := parseReviewQuery(r.URL.Query())
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	page, err := list(ctx, uuid, query, r.URL.Query().Get("cursor"))
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformReviewPageToResponse(page), http.StatusOK)
+}
+
+// parseReviewQuery reads the sentiment, from, to, sort and limit query parameters of a review listing.
+// Dates are RFC 3339 timestamps or YYYY-MM-DD days.
+func parseReviewQuery(values url.Values) (app.ReviewQuery, error) {
+	query := app.ReviewQuery{
+		Sentiment: app.SentimentBand(values.Get("sentiment")),
+		Sort:      app.ReviewSort(values.Get("sort")),
+	}
+	var err error
+	if query.From, err = parseQueryTime(values, "from"); err != nil {
+		return query, err
+	}
+	if query.To, err = parseQueryTime(values, "to"); err != nil {
+		return query, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit < 1 {
+			return query, app.NewError("The limit must be a positive integer", err)
+		}
+	}
+	return query, nil
+}
+
+func parseQueryTime(values url.Values, key string) (time.Time, error) {
+	value := values.Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, app.NewError(fmt.Sprintf("The %s date must be an RFC 3339 timestamp or a YYYY-MM-DD day",
+			key), err)
+	}
+	return t, nil
+}
+
+func transformReviewPageToResponse(page *app.ReviewPage) ReviewPageResponse {
+	response := ReviewPageResponse{Reviews: []ReviewResponse{}, NextCursor: page.NextCursor}
+	for _, review := range page.Reviews {
+		response.Reviews = append(response.Reviews, ReviewResponse{
+			UUID:             review.UUID,
+			OrderUUID:        review.OrderUUID,
+			OrderProductUUID: review.OrderProductUUID,
+			ProductUUID:      review.ProductUUID,
+			CustomerUUID:     review.CustomerUUID,
+			Score:            review.Score,
+			Sentiment:        app.SentimentOf(review.Score),
+			Text:             review.Text,
+			CreatedAt:        review.CreatedAt,
+		})
+	}
+	return response
+}
+
+func transformProductReviewSummaryToResponse(summary *app.ProductReviewSummary) ProductReviewSummaryResponse {
+	stats := summary.Stats
+	response := ProductReviewSummaryResponse{
+		ProductUUID: stats.ProductUUID,
+		ReviewCount: stats.ReviewCount,
+		MeanScore:   stats.MeanScore(),
+		Sentiment: map[app.SentimentBand]int64{
+			app.SentimentPositive: stats.PositiveCount,
+			app.SentimentNeutral:  stats.NeutralCount,
+			app.SentimentNegative: stats.NegativeCount,
+		},
+		Stars:        map[string]int64{},
+		LastReviewAt: stats.LastReviewAt,
+		Trend: ReviewTrendResponse{
+			Days:                summary.Trend.Days,
+			ReviewCount:         summary.Trend.ReviewCount,
+			MeanScore:           summary.Trend.MeanScore,
+			PreviousReviewCount: summary.Trend.PreviousReviewCount,
+			PreviousMeanScore:   summary.Trend.PreviousMeanScore,
+			Daily:               []DailyReviewStatsResponse{},
+		},
+	}
+	for i, count := range stats.Stars {
+		response.Stars[strconv.Itoa(i+1)] = count
+	}
+	for _, day := range summary.Trend.Daily {
+		response.Trend.Daily = append(response.Trend.Daily, DailyReviewStatsResponse{
+			Day:         day.Day.Format(time.DateOnly),
+			ReviewCount: day.ReviewCount,
+			MeanScore:   day.MeanScore(),
+		})
+	}
+	return response
+}
@@ -3,27 +3,82 @@ package api
 import (
 	"github.com/gorilla/mux"
 	"net/http"
+	"reviewbot/app"
 )
 
 func (srv *Server) routes() http.Handler {
 	serverMux := mux.NewRouter()
+	serverMux.NotFoundHandler = http.HandlerFunc(srv.App.notFound)
 
 	apiMux := serverMux.PathPrefix("/api").Subrouter()
 	apiMux.NotFoundHandler = http.HandlerFunc(srv.App.notFound)
 	apiMux.MethodNotAllowedHandler = http.HandlerFunc(srv.App.methodNotAllowed)
 	apiMux.Use(srv.App.httpLogger)
 	apiMux.Use(srv.App.recoverPanic)
-	apiMux.Use(srv.App.enableCORS)
+	apiMux.Use(srv.authenticate)
+	apiMux.Use(srv.rateLimit)
+	apiMux.Use(srv.authorize)
+	apiMux.Use(srv.rateLimitOrder)
+	apiMux.Use(srv.validateRequest)
+	apiMux.Use(srv.idempotent)
 	apiMux.HandleFunc("/status", srv.status).Methods("GET")
+	apiMux.HandleFunc("/openapi.json", srv.getOpenAPIDocument).Methods("GET")
 
 	ordersMux := apiMux.PathPrefix("/orders").Subrouter()
-	ordersMux.HandleFunc("/{order_uuid}", srv.getOrderByUUID).Methods("GET")
-	ordersMux.HandleFunc("/{order_uuid}", srv.updateOrderStatusByUUID).Methods("PATCH")
-	ordersMux.HandleFunc("/{order_uuid}/products", srv.getOrderProductsByOrderUUID).Methods("GET")
+	ordersMux.Handle("", requireScope(app.ScopeOrdersRead, srv.getOrders)).Methods("GET")
+	ordersMux.Handle("", requireScope(app.ScopeOrdersWrite, srv.createOrder).handlesIdempotencyKey()).Methods("POST")
+	ordersMux.Handle("/{order_uuid}",
+		requireScope(app.ScopeOrdersRead, srv.getOrderByUUID).orCustomerOwner(srv.orderOwner)).Methods("GET")
+	ordersMux.Handle("/{order_uuid}", requireScope(app.ScopeOrdersWrite, srv.updateOrderStatusByUUID)).Methods("PATCH")
+	ordersMux.Handle("/{order_uuid}/products", requireScope(app.ScopeOrdersRead,
+		srv.getOrderProductsByOrderUUID).orCustomerOwner(srv.orderOwner)).Methods("GET")
+	ordersMux.Handle("/{order_uuid}/history", requireScope(app.ScopeOrdersRead,
+		srv.getOrderStatusHistoryByOrderUUID).orCustomerOwner(srv.orderOwner)).Methods("GET")
+	ordersMux.Handle("/{order_uuid}/reviews",
+		requireScope(app.ScopeReviewsRead, srv.getOrderReviews).orCustomerOwner(srv.orderOwner)).Methods("GET")
+
+	productsMux := apiMux.PathPrefix("/products").Subrouter()
+	productsMux.Handle("", requireScope(app.ScopeProductsRead, srv.getProducts)).Methods("GET")
+	productsMux.Handle("", requireScope(app.ScopeProductsWrite, srv.createProduct)).Methods("POST")
+	productsMux.Handle("/{product_uuid}", requireScope(app.ScopeProductsRead, srv.getProductByUUID)).Methods("GET")
+	productsMux.Handle("/{product_uuid}", requireScope(app.ScopeProductsWrite, srv.updateProduct)).Methods("PUT")
+	productsMux.Handle("/{product_uuid}", requireScope(app.ScopeProductsWrite, srv.deleteProduct)).Methods("DELETE")
+	productsMux.Handle("/{product_uuid}/reviews",
+		requireScope(app.ScopeReviewsRead, srv.getProductReviews)).Methods("GET")
+	productsMux.Handle("/{product_uuid}/summary",
+		requireScope(app.ScopeReviewsRead, srv.getProductReviewSummary)).Methods("GET")
+
+	customersMux := apiMux.PathPrefix("/customers").Subrouter()
+	customersMux.Handle("", requireScope(app.ScopeCustomersRead, srv.getCustomerByEmail)).Methods("GET")
+	customersMux.Handle("/{customer_uuid}",
+		requireScope(app.ScopeCustomersRead, srv.getCustomerByUUID).orCustomerOwner(customerOwner)).Methods("GET")
+	customersMux.Handle("/{customer_uuid}/orders",
+		requireScope(app.ScopeCustomersRead, srv.getCustomerOrders).orCustomerOwner(customerOwner)).Methods("GET")
+	customersMux.HandleFunc("/{customer_uuid}/review-opt-out", srv.optOutOfReviewReminders).Methods("GET", "POST")
+	customersMux.Handle("/{customer_uuid}/reviews",
+		requireScope(app.ScopeReviewsRead, srv.getCustomerReviews).orCustomerOwner(customerOwner)).Methods("GET")
+
+	webhooksMux := apiMux.PathPrefix("/webhooks").Subrouter()
+	webhooksMux.Handle("", requireScope(app.ScopeAdmin, srv.getWebhookSubscriptions)).Methods("GET")
+	webhooksMux.Handle("", requireScope(app.ScopeAdmin, srv.createWebhookSubscription)).Methods("POST")
+	webhooksMux.Handle("/{webhook_uuid}", requireScope(app.ScopeAdmin, srv.getWebhookSubscriptionByUUID)).Methods("GET")
+	webhooksMux.Handle("/{webhook_uuid}", requireScope(app.ScopeAdmin, srv.deleteWebhookSubscription)).Methods("DELETE")
+	webhooksMux.Handle("/{webhook_uuid}/dead-letters",
+		requireScope(app.ScopeAdmin, srv.getWebhookDeadLetters)).Methods("GET")
+	webhooksMux.Handle("/{webhook_uuid}/dead-letters/{delivery_uuid}/redeliver",
+		requireScope(app.ScopeAdmin, srv.redeliverWebhookDeadLetter)).Methods("POST")
+
+	catalogMux := apiMux.PathPrefix("/catalog").Subrouter()
+	catalogMux.Handle("/sync", requireScope(app.ScopeAdmin, srv.getCatalogSyncStatus)).Methods("GET")
+	catalogMux.Handle("/sync", requireScope(app.ScopeAdmin, srv.triggerCatalogSync)).Methods("POST")
 
 	wsMux := serverMux.PathPrefix("/ws").Subrouter()
+	wsMux.Use(srv.authenticate)
+	wsMux.Use(srv.rateLimit)
+	wsMux.Use(srv.authorize)
+	wsMux.Use(srv.rateLimitOrder)
 	ordersWSMux := wsMux.PathPrefix("/orders").Subrouter()
-	ordersWSMux.Handle("/{order_uuid}", srv)
+	ordersWSMux.Handle("/{order_uuid}", customerOwned(srv.orderOwner, srv.ServeHTTP)).Methods("GET")
 
 	return serverMux
 }
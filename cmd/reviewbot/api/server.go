@@ -9,8 +9,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"reviewbot/internal/apikeys"
 	"reviewbot/internal/database"
+	"reviewbot/internal/domain/invitations"
 	"reviewbot/internal/domain/orders"
+	"reviewbot/internal/domain/reviews"
+	"reviewbot/internal/domain/webhooks"
+	"reviewbot/internal/idempotency"
+	"reviewbot/internal/jwtauth"
+	"reviewbot/internal/reviewlink"
 	"strconv"
 	"sync"
 	"syscall"
@@ -23,6 +30,8 @@ const (
 	defaultWriteTimeout   = 10 * time.Second
 	defaultShutdownPeriod = 30 * time.Second
 	handlerDefaultTimeout = 20 * time.Second
+	// maxRequestBodySize is the size of the largest request body read before the handlers.
+	maxRequestBodySize = 1 << 20
 )
 
 type Application struct {
@@ -39,51 +48,156 @@ type ApplicationConfig struct {
 		DSN         string
 		Automigrate bool
 	}
+	Catalog struct {
+		Source       string
+		URL          string
+		File         string
+		ItemsPath    string
+		FieldMapping string
+		SyncInterval time.Duration
+		SyncJitter   time.Duration
+		// MaxDiscontinuedPercent is the largest percentage of the catalog a synchronization may discontinue.
+		MaxDiscontinuedPercent int
+	}
+	ReviewLink struct {
+		BaseURL string
+		Secret  string
+		TTL     time.Duration
+	}
+	Notifier struct {
+		Kind    string
+		LogFile string
+		SMTP    struct {
+			Host     string
+			Port     int
+			Username string
+			Password string
+			From     string
+		}
+	}
+	Invitations struct {
+		DispatchInterval time.Duration
+		ReminderCount    int
+		ReminderInterval time.Duration
+	}
+	Scheduler struct {
+		PollInterval time.Duration
+	}
+	Webhooks struct {
+		DeliveryInterval    time.Duration
+		AllowPrivateTargets bool
+	}
+	Outbox struct {
+		RelayInterval time.Duration
+	}
+	Idempotency struct {
+		TTL time.Duration
+	}
+	CustomerAuth struct {
+		JWKSURL             string
+		JWKSRefreshInterval time.Duration
+		Issuer              string
+		Audience            string
+	}
+	RateLimit struct {
+		Read               string
+		Write              string
+		Order              string
+		AuthFailures       string
+		ReviewChatMessages string
+		TrustedProxies     string
+	}
+	CORS      CORSConfig
+	EventSink struct {
+		Kind              string
+		File              string
+		NATSURL           string
+		NATSSubjectPrefix string
+	}
+}
+
+// BackgroundWorker is a long-running task started along with the server. Run must return once ctx is cancelled.
+type BackgroundWorker interface {
+	Run(ctx context.Context)
 }
 
 // The Server is used as a container for the most important dependencies.
 type Server struct {
-	Router      *mux.Router
-	UserService *orders.Service
-	App         *Application
+	Router             *mux.Router
+	UserService        *orders.Service
+	CatalogSyncer      *orders.CatalogSyncer
+	InvitationsService *invitations.Service
+	WebhooksService    *webhooks.Service
+	ReviewsService     *reviews.Service
+	ReviewLinkSigner   *reviewlink.Signer
+	IdempotencyStore   *idempotency.Store
+	APIKeysService     *apikeys.Service
+	// CustomerAuthenticator authenticates customers by their bearer token. Customers cannot authenticate if nil.
+	CustomerAuthenticator *jwtauth.Authenticator
+	RateLimiters          RateLimiters
+	// TrustedProxies are the proxies whose X-Forwarded-For header tells the address of the rate limited clients.
+	TrustedProxies TrustedProxies
+	// CORSPolicy tells which other origins may call the API and open review chats. None may if nil.
+	CORSPolicy *CORSPolicy
+	App        *Application
+	workers    []BackgroundWorker
 }
 
 // NewServer returns a pointer to a new Server.
-func NewServer(userService *orders.Service, config *Application) *Server {
+func NewServer(userService *orders.Service, catalogSyncer *orders.CatalogSyncer, config *Application) *Server {
 	server := &Server{
-		Router:      mux.NewRouter().StrictSlash(true),
-		UserService: userService,
-		App:         config,
+		Router:        mux.NewRouter().StrictSlash(true),
+		UserService:   userService,
+		CatalogSyncer: catalogSyncer,
+		App:           config,
 	}
 	return server
 }
 
+// AddBackgroundWorker registers a worker to run while the server is serving.
+func (mySrv *Server) AddBackgroundWorker(worker BackgroundWorker) {
+	mySrv.workers = append(mySrv.workers, worker)
+}
+
 func (mySrv *Server) Serve() error {
+	handler := mySrv.routes()
+	if mySrv.CORSPolicy != nil {
+		handler = mySrv.CORSPolicy.Handler(handler)
+	}
 	srv := &http.Server{
 		Addr:         net.JoinHostPort(mySrv.App.Config.BaseURL, strconv.Itoa(mySrv.App.Config.HttpPort)),
-		Handler:      mySrv.routes(),
+		Handler:      handler,
 		ErrorLog:     slog.NewLogLogger(mySrv.App.Logger.Handler(), slog.LevelWarn),
 		IdleTimeout:  defaultIdleTimeout,
 		ReadTimeout:  defaultReadTimeout,
 		WriteTimeout: defaultWriteTimeout,
 	}
 	shutdownErrorChan := make(chan error)
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
 
 	go func() {
 		quitChan := make(chan os.Signal, 1)
 		signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM)
 		<-quitChan
+		stopBackground()
 		ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownPeriod)
 		defer cancel()
 		shutdownErrorChan <- srv.Shutdown(ctx)
 	}()
-	err := mySrv.UserService.PopulateProducts(context.Background())
-	if err != nil {
-		return err
+
+	// The catalog is synchronized in the background, so an unreachable catalog source does not keep the API down.
+	workers := append([]BackgroundWorker{mySrv.CatalogSyncer}, mySrv.workers...)
+	for _, worker := range workers {
+		mySrv.App.wg.Add(1)
+		go func(worker BackgroundWorker) {
+			defer mySrv.App.wg.Done()
+			worker.Run(backgroundCtx)
+		}(worker)
 	}
 
 	mySrv.App.Logger.Info("starting server", slog.Group("server", "addr", srv.Addr))
-	err = srv.ListenAndServe()
+	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"reviewbot/app"
+	"time"
+)
+
+// WebhookSubscriptionRequest represents a webhook subscription request object entity.
+type WebhookSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// WebhookSubscriptionResponse represents a webhook subscription object entity.
+// The secret is only returned when the subscription is created.
+type WebhookSubscriptionResponse struct {
+	UUID      string    `json:"uuid"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDeadLetterResponse represents a webhook delivery that failed too many times.
+type WebhookDeadLetterResponse struct {
+	UUID      string          `json:"uuid"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	CreatedAt time.Time       `json:"created_at"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+func (srv *Server) createWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	subscriptionRequest := WebhookSubscriptionRequest{}
+	err := json.NewDecoder(r.Body).Decode(&subscriptionRequest)
+	if err != nil {
+		log.With("success", false, "err", err)
+		BadRequestError(w, err)
+		return
+	}
+
+	subscription, err := srv.WebhooksService.Subscribe(ctx, subscriptionRequest.URL, subscriptionRequest.Events,
+		subscriptionRequest.Secret)
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	response := transformWebhookSubscriptionToResponse(subscription)
+	response.Secret = subscription.Secret
+	Ok(w, response, http.StatusCreated)
+}
+
+func (srv *Server) getWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	subscriptions, err := srv.WebhooksService.Subscriptions(ctx)
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	response := make([]WebhookSubscriptionResponse, 0, len(subscriptions))
+	for i := range subscriptions {
+		response = append(response, transformWebhookSubscriptionToResponse(&subscriptions[i]))
+	}
+	Ok(w, response, http.StatusOK)
+}
+
+func (srv *Server) getWebhookSubscriptionByUUID(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	subscription, err := srv.WebhooksService.SubscriptionByUUID(ctx, mux.Vars(r)["webhook_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, transformWebhookSubscriptionToResponse(subscription), http.StatusOK)
+}
+
+func (srv *Server) deleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	err := srv.WebhooksService.Unsubscribe(ctx, mux.Vars(r)["webhook_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, nil, http.StatusNoContent)
+}
+
+func (srv *Server) getWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	deadLetters, err := srv.WebhooksService.DeadLetters(ctx, mux.Vars(r)["webhook_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	response := make([]WebhookDeadLetterResponse, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		response = append(response, transformWebhookDeadLetterToResponse(deadLetter))
+	}
+	Ok(w, response, http.StatusOK)
+}
+
+func (srv *Server) redeliverWebhookDeadLetter(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), handlerDefaultTimeout)
+	defer cancel()
+	log := srv.App.Logger.With(LogFieldKeyRequestID, GetReqID(ctx))
+
+	vars := mux.Vars(r)
+	err := srv.WebhooksService.Redeliver(ctx, vars["webhook_uuid"], vars["delivery_uuid"])
+	if err != nil {
+		log.With("success", false, "err", err)
+		AppError(w, err)
+		return
+	}
+
+	srv.App.Logger.With("success", true)
+	Ok(w, nil, http.StatusAccepted)
+}
+
+func transformWebhookSubscriptionToResponse(subscription *app.WebhookSubscription) WebhookSubscriptionResponse {
+	return WebhookSubscriptionResponse{
+		UUID:      subscription.UUID,
+		URL:       subscription.URL,
+		Events:    subscription.Events,
+		CreatedAt: subscription.CreatedAt,
+	}
+}
+
+func transformWebhookDeadLetterToResponse(deadLetter app.WebhookDelivery) WebhookDeadLetterResponse {
+	return WebhookDeadLetterResponse{
+		UUID:      deadLetter.UUID,
+		EventID:   deadLetter.EventID,
+		EventType: deadLetter.EventType,
+		Payload:   deadLetter.Payload,
+		Attempts:  deadLetter.Attempts,
+		LastError: deadLetter.LastError,
+		CreatedAt: deadLetter.CreatedAt,
+		FailedAt:  deadLetter.NextAttemptAt,
+	}
+}
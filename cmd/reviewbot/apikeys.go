@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reviewbot/app"
+	"reviewbot/internal/apikeys"
+	"reviewbot/internal/database"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runAPIKeys executes the api-keys subcommand given in args.
+func runAPIKeys(db *database.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("api-keys: expected one of create, list or revoke")
+	}
+
+	ctx := context.Background()
+	service := apikeys.NewService(apikeys.NewDatabaseRepository(db.DB))
+	switch args[0] {
+	case "create":
+		if len(args) < 3 {
+			return errors.New("api-keys create: expected a name and at least one scope")
+		}
+		scopes := make([]app.Scope, 0, len(args)-2)
+		for _, scope := range args[2:] {
+			scopes = append(scopes, app.Scope(scope))
+		}
+		key, secret, err := service.Create(ctx, args[1], scopes)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created API key %s, store it now as it will not be shown again:\n%s\n", key.UUID, secret)
+	case "list":
+		keys, err := service.Keys(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "UUID\tNAME\tPREFIX\tSCOPES\tCREATED AT\tREVOKED AT")
+		for _, key := range keys {
+			scopes := make([]string, 0, len(key.Scopes))
+			for _, scope := range key.Scopes {
+				scopes = append(scopes, string(scope))
+			}
+			revokedAt := "-"
+			if key.RevokedAt != nil {
+				revokedAt = key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.UUID, key.Name, key.Prefix, strings.Join(scopes, ","),
+				key.CreatedAt.Format(time.RFC3339), revokedAt)
+		}
+		return w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("api-keys revoke: expected the UUID of the key")
+		}
+		if err := service.Revoke(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked API key %s\n", args[1])
+	default:
+		return fmt.Errorf("api-keys: unknown command %q", args[0])
+	}
+	return nil
+}
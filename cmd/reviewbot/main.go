@@ -1,19 +1,42 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"golang.org/x/exp/slog"
 	"os"
 	"reviewbot/cmd/reviewbot/api"
+	"reviewbot/internal/apikeys"
 	"reviewbot/internal/database"
+	"reviewbot/internal/domain/invitations"
 	"reviewbot/internal/domain/orders"
+	"reviewbot/internal/domain/reviews"
+	"reviewbot/internal/domain/webhooks"
 	"reviewbot/internal/env"
+	"reviewbot/internal/idempotency"
+	"reviewbot/internal/jwtauth"
+	"reviewbot/internal/outbox"
+	"reviewbot/internal/ratelimit"
+	"reviewbot/internal/reviewlink"
+	"reviewbot/internal/scheduler"
 	"reviewbot/internal/version"
+	"reviewbot/pkg/catalogsource"
+	"reviewbot/pkg/catalogsource/filesource"
+	"reviewbot/pkg/catalogsource/httpsource"
+	"reviewbot/pkg/catalogsource/noopsource"
+	"reviewbot/pkg/eventsink"
+	"reviewbot/pkg/eventsink/filesink"
+	"reviewbot/pkg/eventsink/inprocesssink"
+	"reviewbot/pkg/eventsink/natssink"
+	"reviewbot/pkg/notifier"
+	"reviewbot/pkg/notifier/lognotifier"
+	"reviewbot/pkg/notifier/smtpnotifier"
 	"reviewbot/pkg/responsegenerator/dummygenerator"
 	"reviewbot/pkg/sentimentanalyzer/dummyanalyzer"
 	"runtime/debug"
+	"time"
 )
 
 func main() {
@@ -39,9 +62,56 @@ func run(logger *slog.Logger) error {
 	cfg.HttpPort = env.GetInt("HTTP_PORT", 4444)
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=true", dbUser, dbPass, dbHost, dbPort, dbName)
 	cfg.DB.DSN = env.GetString("DB_DSN", dsn)
-	cfg.DB.Automigrate = env.GetBool("DB_AUTOMIGRATE", true)
+	cfg.DB.Automigrate = env.GetBool("DB_AUTOMIGRATE", false)
+	cfg.Catalog.Source = env.GetString("CATALOG_SOURCE", "http")
+	cfg.Catalog.URL = env.GetString("CATALOG_URL", "https://62daf70dd1d97b9e0c49ca5d.mockapi.io/v1/products")
+	cfg.Catalog.File = env.GetString("CATALOG_FILE", "")
+	cfg.Catalog.ItemsPath = env.GetString("CATALOG_ITEMS_PATH", "")
+	cfg.Catalog.FieldMapping = env.GetString("CATALOG_FIELD_MAPPING", "")
+	cfg.Catalog.SyncInterval = env.GetDuration("CATALOG_SYNC_INTERVAL", time.Hour)
+	cfg.Catalog.SyncJitter = env.GetDuration("CATALOG_SYNC_JITTER", 5*time.Minute)
+	cfg.Catalog.MaxDiscontinuedPercent = env.GetInt("CATALOG_SYNC_MAX_DISCONTINUED", 20)
+	cfg.ReviewLink.BaseURL = env.GetString("REVIEW_LINK_BASE_URL", "ws://localhost:4444")
+	cfg.ReviewLink.Secret = env.GetString("REVIEW_LINK_SECRET", "")
+	cfg.ReviewLink.TTL = env.GetDuration("REVIEW_LINK_TTL", 7*24*time.Hour)
+	cfg.Notifier.Kind = env.GetString("NOTIFIER", "log")
+	cfg.Notifier.LogFile = env.GetString("NOTIFIER_LOG_FILE", "")
+	cfg.Notifier.SMTP.Host = env.GetString("SMTP_HOST", "localhost")
+	cfg.Notifier.SMTP.Port = env.GetInt("SMTP_PORT", 25)
+	cfg.Notifier.SMTP.Username = env.GetString("SMTP_USERNAME", "")
+	cfg.Notifier.SMTP.Password = env.GetString("SMTP_PASSWORD", "")
+	cfg.Notifier.SMTP.From = env.GetString("SMTP_FROM", "reviewbot@localhost")
+	cfg.Invitations.DispatchInterval = env.GetDuration("INVITATIONS_DISPATCH_INTERVAL", 30*time.Second)
+	cfg.Invitations.ReminderCount = env.GetInt("REVIEW_REMINDERS_COUNT", 2)
+	cfg.Invitations.ReminderInterval = env.GetDuration("REVIEW_REMINDERS_INTERVAL", 72*time.Hour)
+	cfg.Scheduler.PollInterval = env.GetDuration("SCHEDULER_POLL_INTERVAL", 30*time.Second)
+	cfg.Webhooks.DeliveryInterval = env.GetDuration("WEBHOOKS_DELIVERY_INTERVAL", 10*time.Second)
+	cfg.Webhooks.AllowPrivateTargets = env.GetBool("WEBHOOKS_ALLOW_PRIVATE_TARGETS", false)
+	cfg.Outbox.RelayInterval = env.GetDuration("OUTBOX_RELAY_INTERVAL", 2*time.Second)
+	cfg.Idempotency.TTL = env.GetDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	cfg.CustomerAuth.JWKSURL = env.GetString("CUSTOMER_AUTH_JWKS_URL", "")
+	cfg.CustomerAuth.JWKSRefreshInterval = env.GetDuration("CUSTOMER_AUTH_JWKS_REFRESH_INTERVAL", time.Hour)
+	cfg.CustomerAuth.Issuer = env.GetString("CUSTOMER_AUTH_ISSUER", "")
+	cfg.CustomerAuth.Audience = env.GetString("CUSTOMER_AUTH_AUDIENCE", "")
+	cfg.RateLimit.Read = env.GetString("RATE_LIMIT_READ", "300/1m")
+	cfg.RateLimit.Write = env.GetString("RATE_LIMIT_WRITE", "60/1m")
+	cfg.RateLimit.Order = env.GetString("RATE_LIMIT_ORDER", "120/1m")
+	cfg.RateLimit.AuthFailures = env.GetString("RATE_LIMIT_AUTH_FAILURES", "10/1m")
+	cfg.RateLimit.ReviewChatMessages = env.GetString("RATE_LIMIT_REVIEW_CHAT_MESSAGES", "10/1m")
+	cfg.RateLimit.TrustedProxies = env.GetString("RATE_LIMIT_TRUSTED_PROXIES", "")
+	cfg.CORS.AllowedOrigins = env.GetString("CORS_ALLOWED_ORIGINS", "")
+	cfg.CORS.AllowedMethods = env.GetString("CORS_ALLOWED_METHODS", "GET, POST, PUT, PATCH, DELETE")
+	cfg.CORS.AllowedHeaders = env.GetString("CORS_ALLOWED_HEADERS",
+		"Authorization, Content-Type, Idempotency-Key, If-Match, If-None-Match, X-API-Key, X-Request-ID")
+	cfg.CORS.AllowCredentials = env.GetBool("CORS_ALLOW_CREDENTIALS", false)
+	cfg.CORS.MaxAge = env.GetDuration("CORS_MAX_AGE", 10*time.Minute)
+	cfg.EventSink.Kind = env.GetString("EVENT_SINK", "none")
+	cfg.EventSink.File = env.GetString("EVENT_SINK_FILE", "")
+	cfg.EventSink.NATSURL = env.GetString("EVENT_SINK_NATS_URL", "nats://localhost:4222")
+	cfg.EventSink.NATSSubjectPrefix = env.GetString("EVENT_SINK_NATS_SUBJECT_PREFIX", "reviewbot")
 
 	showVersion := flag.Bool("version", false, "display version and exit")
+	flag.Usage = usage
 	flag.Parse()
 
 	if *showVersion {
@@ -49,13 +119,39 @@ func run(logger *slog.Logger) error {
 		return nil
 	}
 
-	db, err := database.New(cfg.DB.DSN, cfg.DB.Automigrate)
+	command := flag.Arg(0)
+	if command != "" && command != "serve" && command != "migrate" && command != "seed" &&
+		command != "rebuild-review-stats" && command != "api-keys" {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	if command == "" || command == "serve" {
+		if err := validateServerConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	// Only the server migrates implicitly, the other commands manage the schema themselves.
+	automigrate := cfg.DB.Automigrate && (command == "" || command == "serve")
+	db, err := database.New(cfg.DB.DSN, automigrate)
 	if err != nil {
 		logger.Error("Could not connect to DB " + dbName + " at host: " + dbHost + ":" + dbPort + ". Error: " + err.Error())
 		return err
 	}
 	defer db.Close()
 
+	switch command {
+	case "migrate":
+		return runMigrate(db, flag.Args()[1:])
+	case "seed":
+		return runSeed(db)
+	case "rebuild-review-stats":
+		return runRebuildReviewStats(db)
+	case "api-keys":
+		return runAPIKeys(db, flag.Args()[1:])
+	}
+
 	logger.Info("version: " + version.Get())
 
 	app := api.Application{
@@ -66,9 +162,233 @@ func run(logger *slog.Logger) error {
 	logger.Info("Starting...")
 	ordersRepo := orders.NewDatabaseRepository(db.DB)
 
+	catalogSource, err := newCatalogSource(cfg)
+	if err != nil {
+		return err
+	}
+
 	ordersService := orders.NewService(ordersRepo, dummygenerator.NewDummyGenerator(),
-		dummyganalyzer.NewDummyAnalyzer(), logger)
-	srv := api.NewServer(ordersService, &app)
+		dummyganalyzer.NewDummyAnalyzer(), catalogSource, logger)
+	reviewMessageLimit, err := ratelimit.ParseLimit(cfg.RateLimit.ReviewChatMessages)
+	if err != nil {
+		return err
+	}
+	ordersService.LimitReviewMessages(reviewMessageLimit)
+	ordersService.LimitCatalogDiscontinuations(cfg.Catalog.MaxDiscontinuedPercent)
+	catalogSyncer := orders.NewCatalogSyncer(ordersService, cfg.Catalog.SyncInterval, cfg.Catalog.SyncJitter, logger)
+
+	notifier, closeNotifier, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeNotifier()
+	reviewLinkSigner := reviewlink.NewSigner(cfg.ReviewLink.BaseURL, cfg.ReviewLink.Secret, cfg.ReviewLink.TTL)
+	invitationsService := invitations.NewService(invitations.NewDatabaseRepository(db.DB), ordersRepo, notifier,
+		reviewLinkSigner, logger)
+	jobScheduler := scheduler.NewScheduler(scheduler.NewDatabaseRepository(db.DB), cfg.Scheduler.PollInterval, logger)
+	invitationsService.EnableReminders(jobScheduler, invitations.ReminderConfig{
+		Count:    cfg.Invitations.ReminderCount,
+		Interval: cfg.Invitations.ReminderInterval,
+	})
+
+	webhooksService := webhooks.NewService(webhooks.NewDatabaseRepository(db.DB), logger)
+	if cfg.Webhooks.AllowPrivateTargets {
+		webhooksService.AllowPrivateTargets()
+	}
+	eventSink, closeEventSink, err := newEventSink(cfg, inprocesssink.NewInProcessSink(invitationsService.HandleEvent,
+		webhooksService.HandleEvent))
+	if err != nil {
+		return err
+	}
+	defer closeEventSink()
+
+	srv := api.NewServer(ordersService, catalogSyncer, &app)
+	srv.InvitationsService = invitationsService
+	srv.WebhooksService = webhooksService
+	srv.ReviewsService = reviews.NewService(reviews.NewDatabaseRepository(db.DB))
+	srv.ReviewLinkSigner = reviewLinkSigner
+	srv.APIKeysService = apikeys.NewService(apikeys.NewDatabaseRepository(db.DB))
+	if cfg.CustomerAuth.JWKSURL != "" {
+		keySet := jwtauth.NewKeySet(cfg.CustomerAuth.JWKSURL, cfg.CustomerAuth.JWKSRefreshInterval, logger)
+		srv.CustomerAuthenticator = jwtauth.NewAuthenticator(keySet, ordersRepo, jwtauth.Config{
+			Issuer:   cfg.CustomerAuth.Issuer,
+			Audience: cfg.CustomerAuth.Audience,
+		})
+	}
+	if srv.RateLimiters, err = newRateLimiters(cfg); err != nil {
+		return err
+	}
+	if srv.TrustedProxies, err = api.ParseTrustedProxies(cfg.RateLimit.TrustedProxies); err != nil {
+		return err
+	}
+	if srv.CORSPolicy, err = api.NewCORSPolicy(cfg.CORS); err != nil {
+		return err
+	}
+	srv.IdempotencyStore = idempotency.NewStore(idempotency.NewDatabaseRepository(db.DB), cfg.Idempotency.TTL, logger)
+	srv.AddBackgroundWorker(invitations.NewDispatcher(invitationsService, cfg.Invitations.DispatchInterval, logger))
+	srv.AddBackgroundWorker(jobScheduler)
+	srv.AddBackgroundWorker(webhooks.NewDeliverer(webhooksService, cfg.Webhooks.DeliveryInterval, logger))
+	srv.AddBackgroundWorker(outbox.NewRelay(outbox.NewDatabaseRepository(db.DB), eventSink, cfg.Outbox.RelayInterval,
+		logger))
+	srv.AddBackgroundWorker(srv.IdempotencyStore)
+	for _, limiter := range []*ratelimit.Limiter{srv.RateLimiters.Read, srv.RateLimiters.Write, srv.RateLimiters.Order,
+		srv.RateLimiters.AuthFailures} {
+		if limiter != nil {
+			srv.AddBackgroundWorker(limiter)
+		}
+	}
 	logger.Info("Running...")
 	return srv.Serve()
 }
+
+// validateServerConfig checks the configuration values the server cannot run with.
+func validateServerConfig(cfg api.ApplicationConfig) error {
+	intervals := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"INVITATIONS_DISPATCH_INTERVAL", cfg.Invitations.DispatchInterval},
+		{"SCHEDULER_POLL_INTERVAL", cfg.Scheduler.PollInterval},
+		{"WEBHOOKS_DELIVERY_INTERVAL", cfg.Webhooks.DeliveryInterval},
+		{"OUTBOX_RELAY_INTERVAL", cfg.Outbox.RelayInterval},
+	}
+	for _, interval := range intervals {
+		if interval.value <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %s", interval.name, interval.value)
+		}
+	}
+	if cfg.Catalog.MaxDiscontinuedPercent < 0 || cfg.Catalog.MaxDiscontinuedPercent > 100 {
+		return fmt.Errorf("CATALOG_SYNC_MAX_DISCONTINUED must be between 0 and 100, got %d",
+			cfg.Catalog.MaxDiscontinuedPercent)
+	}
+	// The review chats opened without a customer token need a signed link, which a random secret would invalidate on a
+	// restart, or on another replica.
+	if cfg.ReviewLink.Secret == "" {
+		return fmt.Errorf("REVIEW_LINK_SECRET is required")
+	}
+	// Without them, the tokens the identity provider issues for other applications would authenticate customers.
+	if cfg.CustomerAuth.JWKSURL != "" && (cfg.CustomerAuth.Issuer == "" || cfg.CustomerAuth.Audience == "") {
+		return fmt.Errorf("CUSTOMER_AUTH_ISSUER and CUSTOMER_AUTH_AUDIENCE are required with CUSTOMER_AUTH_JWKS_URL")
+	}
+	return nil
+}
+
+// newRateLimiters returns the rate limiters of the route groups. A group without a limit has no limiter.
+func newRateLimiters(cfg api.ApplicationConfig) (api.RateLimiters, error) {
+	var limiters api.RateLimiters
+	groups := []struct {
+		value   string
+		limiter **ratelimit.Limiter
+	}{
+		{cfg.RateLimit.Read, &limiters.Read},
+		{cfg.RateLimit.Write, &limiters.Write},
+		{cfg.RateLimit.Order, &limiters.Order},
+		{cfg.RateLimit.AuthFailures, &limiters.AuthFailures},
+	}
+	for _, group := range groups {
+		limit, err := ratelimit.ParseLimit(group.value)
+		if err != nil {
+			return api.RateLimiters{}, err
+		}
+		if !limit.IsZero() {
+			*group.limiter = ratelimit.NewLimiter(limit)
+		}
+	}
+	return limiters, nil
+}
+
+// newCatalogSource returns the product catalog source selected by the configuration.
+func newCatalogSource(cfg api.ApplicationConfig) (catalogsource.CatalogSource, error) {
+	mapping, err := catalogsource.ParseFieldMapping(cfg.Catalog.FieldMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Catalog.Source {
+	case "http":
+		return httpsource.NewHTTPSource(httpsource.Config{
+			URL:       cfg.Catalog.URL,
+			ItemsPath: cfg.Catalog.ItemsPath,
+			Mapping:   mapping,
+		}), nil
+	case "file":
+		if cfg.Catalog.File == "" {
+			return nil, errors.New("CATALOG_FILE is required for the file catalog source")
+		}
+		return filesource.NewFileSource(cfg.Catalog.File, mapping), nil
+	case "none":
+		return noopsource.NewNoopSource(), nil
+	default:
+		return nil, fmt.Errorf("unknown catalog source %q", cfg.Catalog.Source)
+	}
+}
+
+// newNotifier returns the notifier selected by the configuration along with a function releasing its resources.
+func newNotifier(cfg api.ApplicationConfig) (notifier.Notifier, func(), error) {
+	switch cfg.Notifier.Kind {
+	case "log":
+		if cfg.Notifier.LogFile == "" {
+			return lognotifier.NewLogNotifier(os.Stdout), func() {}, nil
+		}
+		file, err := os.OpenFile(cfg.Notifier.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lognotifier.NewLogNotifier(file), func() { file.Close() }, nil
+	case "smtp":
+		return smtpnotifier.NewSMTPNotifier(smtpnotifier.Config{
+			Host:     cfg.Notifier.SMTP.Host,
+			Port:     cfg.Notifier.SMTP.Port,
+			Username: cfg.Notifier.SMTP.Username,
+			Password: cfg.Notifier.SMTP.Password,
+			From:     cfg.Notifier.SMTP.From,
+		}), func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown notifier %q", cfg.Notifier.Kind)
+	}
+}
+
+// newEventSink returns the sink of the domain events relayed from the outbox along with a function releasing its
+// resources. Events always reach inProcess, and also the external sink selected by the configuration, if any.
+func newEventSink(cfg api.ApplicationConfig, inProcess eventsink.EventSink) (eventsink.EventSink, func(), error) {
+	switch cfg.EventSink.Kind {
+	case "none":
+		return inProcess, func() {}, nil
+	case "file":
+		if cfg.EventSink.File == "" {
+			return nil, nil, errors.New("EVENT_SINK_FILE is required for the file event sink")
+		}
+		file, err := os.OpenFile(cfg.EventSink.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		return eventsink.NewMultiSink(inProcess, filesink.NewFileSink(file)), func() { file.Close() }, nil
+	case "nats":
+		client, err := natssink.NewClient(cfg.EventSink.NATSURL, 5*time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		sink := natssink.NewNATSSink(client, cfg.EventSink.NATSSubjectPrefix)
+		return eventsink.NewMultiSink(inProcess, sink), func() { client.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown event sink %q", cfg.EventSink.Kind)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] [command]
+
+Commands:
+  serve                           start the API server (default)
+  migrate up|down|status|redo     manage the database schema
+  seed                            populate the database with demo data
+  rebuild-review-stats            recompute the product review stats from the reviews
+  api-keys create <name> <scope>...
+                                  create an API key granting the scopes and print it
+  api-keys list                   list the API keys
+  api-keys revoke <uuid>          revoke an API key
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
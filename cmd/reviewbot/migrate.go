@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	migrate "github.com/rubenv/sql-migrate"
+	"os"
+	"reviewbot/internal/database"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrate executes the migrate subcommand given in args.
+func runMigrate(db *database.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("migrate: expected exactly one of up, down, status or redo")
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := db.Migrate(migrate.Up, 0)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", n)
+	case "down":
+		n, err := db.Migrate(migrate.Down, 1)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migration(s)\n", n)
+	case "redo":
+		id, err := db.Redo()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reapplied migration %s\n", id)
+	case "status":
+		statuses, err := db.MigrationsStatus()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", status.ID, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("migrate: unknown command %q", args[0])
+	}
+	return nil
+}
+
+// runSeed executes the seed subcommand.
+func runSeed(db *database.DB) error {
+	n, err := db.Seed()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Applied %d seed(s)\n", n)
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reviewbot/internal/database"
+	"reviewbot/internal/domain/reviews"
+)
+
+// runRebuildReviewStats recomputes the review totals of every product from the stored reviews.
+func runRebuildReviewStats(db *database.DB) error {
+	products, err := reviews.NewService(reviews.NewDatabaseRepository(db.DB)).RebuildStats(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rebuilt the review stats of %d product(s)\n", products)
+	return nil
+}
@@ -0,0 +1,149 @@
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+	"strings"
+	"time"
+)
+
+// APIKeyStore represents an API key entity at the Database.
+type APIKeyStore struct {
+	UUID      string
+	Name      string
+	Prefix    string
+	Hash      string
+	Scopes    string
+	CreatedAt time.Time
+	RevokedAt sql.NullTime
+}
+
+// DatabaseRepository implements the APIKeysRepository interface.
+type DatabaseRepository struct {
+	db *sqlx.DB
+}
+
+// NewDatabaseRepository returns a new DatabaseRepository.
+func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
+	return &DatabaseRepository{
+		db: db,
+	}
+}
+
+// APIKeyStoreToAPIKey converts an APIKeyStore object to an app.APIKey
+func (ds *DatabaseRepository) APIKeyStoreToAPIKey(keyStore APIKeyStore) app.APIKey {
+	key := app.APIKey{
+		UUID:      keyStore.UUID,
+		Name:      keyStore.Name,
+		Prefix:    keyStore.Prefix,
+		Hash:      keyStore.Hash,
+		Scopes:    []app.Scope{},
+		CreatedAt: keyStore.CreatedAt,
+	}
+	for _, scope := range strings.Split(keyStore.Scopes, ",") {
+		if scope != "" {
+			key.Scopes = append(key.Scopes, app.Scope(scope))
+		}
+	}
+	if keyStore.RevokedAt.Valid {
+		key.RevokedAt = &keyStore.RevokedAt.Time
+	}
+	return key
+}
+
+// AddAPIKey stores an API key.
+func (ds *DatabaseRepository) AddAPIKey(ctx context.Context, key app.APIKey) error {
+	scopes := make([]string, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("api_keys").Cols("uuid", "name", "prefix", "hash", "scopes", "created_at").
+		Vals(goqu.Vals{key.UUID, key.Name, key.Prefix, key.Hash, strings.Join(scopes, ","), key.CreatedAt}).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for API key", fmt.Errorf("insert api key: %w", err))
+	}
+	if _, err := ds.db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while inserting API key", fmt.Errorf("insert api key: %w", err))
+	}
+
+	return nil
+}
+
+// GetAPIKeys retrieves from storage every API key, the oldest first.
+func (ds *DatabaseRepository) GetAPIKeys(ctx context.Context) ([]app.APIKey, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "name", "prefix", "hash", "scopes", "created_at", "revoked_at").
+		From("api_keys").Order(goqu.C("created_at").Asc()).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for API keys", fmt.Errorf("get api keys: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting API keys", fmt.Errorf("get api keys: %w", err))
+	}
+	defer rows.Close()
+	keys := []app.APIKey{}
+	for rows.Next() {
+		var keyStore APIKeyStore
+		if err := rows.Scan(&keyStore.UUID, &keyStore.Name, &keyStore.Prefix, &keyStore.Hash, &keyStore.Scopes,
+			&keyStore.CreatedAt, &keyStore.RevokedAt); err != nil {
+			return nil, app.NewError("Error while reading API keys", fmt.Errorf("get api keys: %w", err))
+		}
+		keys = append(keys, ds.APIKeyStoreToAPIKey(keyStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading API keys", fmt.Errorf("get api keys: %w", err))
+	}
+
+	return keys, nil
+}
+
+// GetActiveAPIKeyByHash retrieves from storage the API key with the provided hash, unless it has been revoked.
+func (ds *DatabaseRepository) GetActiveAPIKeyByHash(ctx context.Context, hash string) (*app.APIKey, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "name", "prefix", "hash", "scopes", "created_at", "revoked_at").
+		From("api_keys").Where(goqu.C("hash").Eq(hash), goqu.C("revoked_at").IsNull()).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for API key", fmt.Errorf("get api key: %w", err))
+	}
+
+	var keyStore APIKeyStore
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&keyStore.UUID, &keyStore.Name, &keyStore.Prefix,
+		&keyStore.Hash, &keyStore.Scopes, &keyStore.CreatedAt, &keyStore.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, app.NewError("API key not found", app.ErrNoRecords)
+	}
+	if err != nil {
+		return nil, app.NewError("Error while getting API key", fmt.Errorf("get api key: %w", err))
+	}
+
+	key := ds.APIKeyStoreToAPIKey(keyStore)
+	return &key, nil
+}
+
+// RevokeAPIKey marks an API key as revoked, unless it already is.
+func (ds *DatabaseRepository) RevokeAPIKey(ctx context.Context, keyUUID string, revokedAt time.Time) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("api_keys").Set(goqu.Record{"revoked_at": revokedAt}).
+		Where(goqu.C("uuid").Eq(keyUUID), goqu.C("revoked_at").IsNull()).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for API key", fmt.Errorf("revoke api key: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while revoking API key", fmt.Errorf("revoke api key: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("API key not found or already revoked", app.ErrNoRecords)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reviewbot/app"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// KeyPrefix starts every API key, so that leaked keys are easy to recognize.
+	KeyPrefix = "rbk_"
+	// keyRandomBytes is the number of random bytes of a key, which makes a fast hash safe to store it.
+	keyRandomBytes = 32
+	// displayedPrefixLength is the length of the start of a key kept in clear to tell keys apart.
+	displayedPrefixLength = len(KeyPrefix) + 8
+)
+
+var (
+	// ErrInvalidKey is returned when a request is made with an unknown or revoked API key.
+	ErrInvalidKey = app.NewCodedError(app.CodeUnauthorized, "invalid API key", nil)
+	// ErrInvalidAPIKeyRequest is returned when an API key to create is not valid.
+	ErrInvalidAPIKeyRequest = app.NewCodedError(app.CodeInvalid, "invalid API key request", nil)
+)
+
+// Service wraps the API keys repository.
+type Service struct {
+	repo app.APIKeysRepository
+}
+
+// NewService returns a new Service.
+func NewService(repo app.APIKeysRepository) *Service {
+	return &Service{repo: repo}
+}
+
+// Create generates and stores an API key granting the provided scopes. The key is returned along with its record and
+// cannot be retrieved afterwards.
+func (s *Service) Create(ctx context.Context, name string, scopes []app.Scope) (*app.APIKey, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", app.NewError("The API key must have a name", ErrInvalidAPIKeyRequest)
+	}
+	if len(scopes) == 0 {
+		return nil, "", app.NewError("The API key must grant at least one scope", ErrInvalidAPIKeyRequest)
+	}
+	for _, scope := range scopes {
+		if !app.IsScope(string(scope)) {
+			return nil, "", app.NewError(fmt.Sprintf("Unknown scope %q", scope), ErrInvalidAPIKeyRequest)
+		}
+	}
+
+	random := make([]byte, keyRandomBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", app.NewError("Error while generating API key", fmt.Errorf("generate api key: %w", err))
+	}
+	secret := KeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+	key := app.APIKey{
+		UUID:      uuid.New().String(),
+		Name:      name,
+		Prefix:    secret[:displayedPrefixLength],
+		Hash:      Hash(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.repo.AddAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return &key, secret, nil
+}
+
+// Keys gets every API key, revoked ones included.
+func (s *Service) Keys(ctx context.Context) ([]app.APIKey, error) {
+	return s.repo.GetAPIKeys(ctx)
+}
+
+// Revoke revokes an API key by its UUID. Requests made with it are refused from then on.
+func (s *Service) Revoke(ctx context.Context, keyUUID string) error {
+	return s.repo.RevokeAPIKey(ctx, keyUUID, time.Now().UTC())
+}
+
+// Authenticate returns the API key a request was made with, or ErrInvalidKey if it is unknown or revoked.
+func (s *Service) Authenticate(ctx context.Context, secret string) (*app.APIKey, error) {
+	if !strings.HasPrefix(secret, KeyPrefix) {
+		return nil, ErrInvalidKey
+	}
+	key, err := s.repo.GetActiveAPIKeyByHash(ctx, Hash(secret))
+	if app.IsNotFoundError(err) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Hash returns the hex encoded SHA-256 of an API key, as it is stored.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,169 @@
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"reviewbot/app"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestService(t *testing.T) (*sql.DB, *Service, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	return db, NewService(NewDatabaseRepository(sqlx.NewDb(db, "mysql"))), mock
+}
+
+var keyColumns = []string{"uuid", "name", "prefix", "hash", "scopes", "created_at", "revoked_at"}
+
+// TestCreateStoresHashOnly tests that a created key is stored by its hash, the key itself never reaching the database.
+func TestCreateStoresHashOnly(t *testing.T) {
+	// Arrange
+	var inserted string
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(func(_, actual string) error {
+		inserted = actual
+		return nil
+	})))
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	defer db.Close()
+	service := NewService(NewDatabaseRepository(sqlx.NewDb(db, "mysql")))
+	mock.ExpectExec("INSERT INTO `api_keys`").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Act
+	key, secret, err := service.Create(context.Background(), "ops", []app.Scope{app.ScopeOrdersRead, app.ScopeAdmin})
+	// Assert
+	if err != nil {
+		t.Fatalf("Error creating API key: %v", err)
+	}
+	if !strings.HasPrefix(secret, KeyPrefix) || len(secret) < displayedPrefixLength+32 {
+		t.Fatalf("Key mismatch: got %q, want a random key starting with %q", secret, KeyPrefix)
+	}
+	if key.Hash != Hash(secret) || key.Prefix != secret[:displayedPrefixLength] {
+		t.Fatalf("Stored key mismatch: got %+v, want the hash and the prefix of %q", key, secret)
+	}
+	if !strings.Contains(inserted, key.Hash) || strings.Contains(inserted, secret) {
+		t.Fatalf("Inserted key mismatch: got %q, want the hash of the key and not the key", inserted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCreateRejectsInvalidKeys tests that keys without a name or with unknown scopes are not created.
+func TestCreateRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyName string
+		scopes  []app.Scope
+	}{
+		{name: "missing name", keyName: " ", scopes: []app.Scope{app.ScopeAdmin}},
+		{name: "missing scopes", keyName: "ops"},
+		{name: "unknown scope", keyName: "ops", scopes: []app.Scope{"orders:delete"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, service, mock := newTestService(t)
+			defer db.Close()
+
+			// Act
+			_, _, err := service.Create(context.Background(), tt.keyName, tt.scopes)
+			// Assert
+			if !errors.Is(err, ErrInvalidAPIKeyRequest) {
+				t.Fatalf("Expected ErrInvalidAPIKeyRequest, got %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestAuthenticateFindsKeyByHash tests that a key is looked up by its hash among the keys not revoked.
+func TestAuthenticateFindsKeyByHash(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	secret := KeyPrefix + "0123456789abcdef"
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `api_keys` WHERE ((`hash` = '" + Hash(secret) +
+		"') AND (`revoked_at` IS NULL))")).
+		WillReturnRows(sqlmock.NewRows(keyColumns).AddRow("key1", "ops", secret[:displayedPrefixLength],
+			Hash(secret), "orders:read,reviews:read", time.Now().UTC(), nil))
+
+	// Act
+	key, err := service.Authenticate(context.Background(), secret)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error authenticating: %v", err)
+	}
+	if !key.HasScope(app.ScopeReviewsRead) || key.HasScope(app.ScopeOrdersWrite) {
+		t.Fatalf("Scopes mismatch: got %v, want [orders:read reviews:read]", key.Scopes)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestAuthenticateRejectsUnknownKeys tests that unknown or revoked keys, and strings that are no keys, are rejected.
+func TestAuthenticateRejectsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		stored bool
+	}{
+		{name: "unknown or revoked key", secret: KeyPrefix + "revoked", stored: true},
+		{name: "not a key", secret: "token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, service, mock := newTestService(t)
+			defer db.Close()
+
+			if tt.stored {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM `api_keys`")).WillReturnRows(sqlmock.NewRows(keyColumns))
+			}
+
+			// Act
+			_, err := service.Authenticate(context.Background(), tt.secret)
+			// Assert
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("Expected ErrInvalidKey, got %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestRevokeMissingKey tests that revoking a key that does not exist or is already revoked reports it is not found.
+func TestRevokeMissingKey(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `api_keys` SET `revoked_at`=")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Act
+	err := service.Revoke(context.Background(), "key1")
+	// Assert
+	if !app.IsNotFoundError(err) {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -31,19 +31,13 @@ func New(dsn string, automigrate bool) (*DB, error) {
 	db.SetConnMaxIdleTime(5 * time.Minute)
 	db.SetConnMaxLifetime(2 * time.Hour)
 
+	dbConn := &DB{db}
 	if automigrate {
-		// Use the MySQL driver specific migration configuration
-		migrate.SetTable("migrations")
-		source := migrate.FileMigrationSource{
-			Dir: "./internal/database/migrations",
-		}
-
-		// Run the migrations
-		_, err := migrate.Exec(db.DB, "mysql", source, migrate.Up)
+		_, err := dbConn.Migrate(migrate.Up, 0)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return &DB{db}, nil
+	return dbConn, nil
 }
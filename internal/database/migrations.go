@@ -0,0 +1,97 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	migrate "github.com/rubenv/sql-migrate"
+	"time"
+)
+
+const (
+	dialect             = "mysql"
+	migrationsTableName = "migrations"
+	seedsTableName      = "seed_migrations"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+//go:embed seeds/*.sql
+var seedsFS embed.FS
+
+var (
+	migrationSet     = migrate.MigrationSet{TableName: migrationsTableName}
+	migrationsSource = migrate.EmbedFileSystemMigrationSource{FileSystem: migrationsFS, Root: "migrations"}
+
+	// Seeds are tracked in their own table, so they can be applied and reverted independently of the schema.
+	seedSet     = migrate.MigrationSet{TableName: seedsTableName}
+	seedsSource = migrate.EmbedFileSystemMigrationSource{FileSystem: seedsFS, Root: "seeds"}
+)
+
+// MigrationStatus describes whether a schema migration has been applied.
+type MigrationStatus struct {
+	ID        string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrate applies (up) or reverts (down) at most max schema migrations. A max of 0 means no limit.
+// It returns the number of migrations executed.
+func (db *DB) Migrate(direction migrate.MigrationDirection, max int) (int, error) {
+	n, err := migrationSet.ExecMax(db.DB.DB, dialect, migrationsSource, direction, max)
+	if err != nil {
+		return n, fmt.Errorf("migrate: %w", err)
+	}
+	return n, nil
+}
+
+// Redo reverts the last applied schema migration and applies it again.
+func (db *DB) Redo() (string, error) {
+	records, err := migrationSet.GetMigrationRecords(db.DB.DB, dialect)
+	if err != nil {
+		return "", fmt.Errorf("redo: %w", err)
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("redo: no migration has been applied")
+	}
+	if _, err := db.Migrate(migrate.Down, 1); err != nil {
+		return "", fmt.Errorf("redo: %w", err)
+	}
+	if _, err := db.Migrate(migrate.Up, 1); err != nil {
+		return "", fmt.Errorf("redo: %w", err)
+	}
+	return records[len(records)-1].Id, nil
+}
+
+// MigrationsStatus returns every known schema migration along with whether it has been applied.
+func (db *DB) MigrationsStatus() ([]MigrationStatus, error) {
+	migrations, err := migrationsSource.FindMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("migrations status: %w", err)
+	}
+	records, err := migrationSet.GetMigrationRecords(db.DB.DB, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("migrations status: %w", err)
+	}
+
+	appliedAt := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		appliedAt[record.Id] = record.AppliedAt
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		at, applied := appliedAt[migration.Id]
+		statuses = append(statuses, MigrationStatus{ID: migration.Id, Applied: applied, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// Seed populates the database with the demo data. Already applied seeds are skipped.
+// It returns the number of seed files executed.
+func (db *DB) Seed() (int, error) {
+	n, err := seedSet.Exec(db.DB.DB, dialect, seedsSource, migrate.Up)
+	if err != nil {
+		return n, fmt.Errorf("seed: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE `products` ADD COLUMN `discontinued_at` datetime DEFAULT NULL;
+
+-- +migrate Down
+ALTER TABLE `products` DROP COLUMN `discontinued_at`;
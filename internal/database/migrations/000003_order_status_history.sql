@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE `order_status_history` (
+    `uuid` varchar(255) NOT NULL,
+    `order_uuid` varchar(255) NOT NULL,
+    `from_status` varchar(255) NOT NULL,
+    `to_status` varchar(255) NOT NULL,
+    `actor` varchar(255) NOT NULL,
+    `created_at` datetime NOT NULL,
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (order_uuid) REFERENCES orders(uuid),
+    KEY `order_status_history_order_uuid_idx` (`order_uuid`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `order_status_history`;
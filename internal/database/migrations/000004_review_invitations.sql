@@ -0,0 +1,22 @@
+-- +migrate Up
+CREATE TABLE `review_invitations` (
+    `uuid` varchar(255) NOT NULL,
+    `order_uuid` varchar(255) NOT NULL,
+    `customer_uuid` varchar(255) NOT NULL,
+    `email` varchar(300) NOT NULL,
+    `first_name` varchar(255) NOT NULL,
+    `status` varchar(255) NOT NULL,
+    `attempts` int NOT NULL DEFAULT 0,
+    `last_error` text DEFAULT NULL,
+    `created_at` datetime NOT NULL,
+    `claimed_at` datetime DEFAULT NULL,
+    `sent_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`uuid`),
+    UNIQUE KEY `review_invitations_order_uuid_idx` (`order_uuid`),
+    KEY `review_invitations_status_idx` (`status`, `created_at`),
+    FOREIGN KEY (order_uuid) REFERENCES orders(uuid),
+    FOREIGN KEY (customer_uuid) REFERENCES customers(uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `review_invitations`;
@@ -0,0 +1,22 @@
+-- +migrate Up
+CREATE TABLE `scheduled_jobs` (
+    `uuid` varchar(255) NOT NULL,
+    `kind` varchar(255) NOT NULL,
+    `job_key` varchar(255) NOT NULL,
+    `subject` varchar(255) NOT NULL,
+    `payload` blob DEFAULT NULL,
+    `status` varchar(255) NOT NULL,
+    `attempts` int NOT NULL DEFAULT 0,
+    `last_error` text DEFAULT NULL,
+    `run_at` datetime NOT NULL,
+    `created_at` datetime NOT NULL,
+    `claimed_at` datetime DEFAULT NULL,
+    `finished_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`uuid`),
+    UNIQUE KEY `scheduled_jobs_job_key_idx` (`job_key`),
+    KEY `scheduled_jobs_status_idx` (`status`, `run_at`),
+    KEY `scheduled_jobs_subject_idx` (`kind`, `subject`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `scheduled_jobs`;
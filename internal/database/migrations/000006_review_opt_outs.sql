@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE `review_opt_outs` (
+    `customer_uuid` varchar(255) NOT NULL,
+    `created_at` datetime NOT NULL,
+    PRIMARY KEY (`customer_uuid`),
+    FOREIGN KEY (customer_uuid) REFERENCES customers(uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `review_opt_outs`;
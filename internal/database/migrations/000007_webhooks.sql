@@ -0,0 +1,48 @@
+-- +migrate Up
+CREATE TABLE `webhook_subscriptions` (
+    `uuid` varchar(255) NOT NULL,
+    `url` varchar(2048) NOT NULL,
+    `secret` varchar(255) NOT NULL,
+    `events` varchar(1024) NOT NULL,
+    `created_at` datetime NOT NULL,
+    PRIMARY KEY (`uuid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `webhook_deliveries` (
+    `uuid` varchar(255) NOT NULL,
+    `subscription_uuid` varchar(255) NOT NULL,
+    `event_id` varchar(255) NOT NULL,
+    `event_type` varchar(255) NOT NULL,
+    `payload` mediumblob NOT NULL,
+    `status` varchar(255) NOT NULL,
+    `attempts` int NOT NULL DEFAULT 0,
+    `last_error` text DEFAULT NULL,
+    `next_attempt_at` datetime NOT NULL,
+    `claimed_at` datetime DEFAULT NULL,
+    `created_at` datetime NOT NULL,
+    `delivered_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`uuid`),
+    UNIQUE KEY `webhook_deliveries_event_idx` (`subscription_uuid`, `event_id`),
+    KEY `webhook_deliveries_status_idx` (`status`, `next_attempt_at`),
+    FOREIGN KEY (subscription_uuid) REFERENCES webhook_subscriptions(uuid) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `webhook_dead_letters` (
+    `uuid` varchar(255) NOT NULL,
+    `subscription_uuid` varchar(255) NOT NULL,
+    `event_id` varchar(255) NOT NULL,
+    `event_type` varchar(255) NOT NULL,
+    `payload` mediumblob NOT NULL,
+    `attempts` int NOT NULL,
+    `last_error` text DEFAULT NULL,
+    `created_at` datetime NOT NULL,
+    `failed_at` datetime NOT NULL,
+    PRIMARY KEY (`uuid`),
+    KEY `webhook_dead_letters_subscription_idx` (`subscription_uuid`, `failed_at`),
+    FOREIGN KEY (subscription_uuid) REFERENCES webhook_subscriptions(uuid) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `webhook_dead_letters`;
+DROP TABLE IF EXISTS `webhook_deliveries`;
+DROP TABLE IF EXISTS `webhook_subscriptions`;
@@ -0,0 +1,21 @@
+-- +migrate Up
+CREATE TABLE `outbox_events` (
+    `id` bigint NOT NULL AUTO_INCREMENT,
+    `event_id` varchar(255) NOT NULL,
+    `event_type` varchar(255) NOT NULL,
+    `payload` mediumblob NOT NULL,
+    `occurred_at` datetime NOT NULL,
+    `status` varchar(255) NOT NULL,
+    `attempts` int NOT NULL DEFAULT 0,
+    `last_error` text DEFAULT NULL,
+    `next_attempt_at` datetime NOT NULL,
+    `claimed_at` datetime DEFAULT NULL,
+    `published_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `outbox_events_event_idx` (`event_id`),
+    KEY `outbox_events_status_idx` (`status`, `next_attempt_at`),
+    KEY `outbox_events_published_idx` (`published_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `outbox_events`;
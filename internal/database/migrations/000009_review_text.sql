@@ -0,0 +1,13 @@
+-- +migrate Up
+ALTER TABLE `order_product_reviews`
+    ADD COLUMN `text` text DEFAULT NULL,
+    ADD COLUMN `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD KEY `order_product_reviews_created_at_idx` (`created_at`, `uuid`),
+    ADD KEY `order_product_reviews_score_idx` (`score`, `uuid`);
+
+-- +migrate Down
+ALTER TABLE `order_product_reviews`
+    DROP KEY `order_product_reviews_score_idx`,
+    DROP KEY `order_product_reviews_created_at_idx`,
+    DROP COLUMN `created_at`,
+    DROP COLUMN `text`;
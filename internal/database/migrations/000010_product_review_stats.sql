@@ -0,0 +1,48 @@
+-- +migrate Up
+CREATE TABLE `product_review_stats` (
+    `product_uuid` varchar(255) NOT NULL,
+    `review_count` bigint NOT NULL DEFAULT 0,
+    `score_sum` bigint NOT NULL DEFAULT 0,
+    `positive_count` bigint NOT NULL DEFAULT 0,
+    `neutral_count` bigint NOT NULL DEFAULT 0,
+    `negative_count` bigint NOT NULL DEFAULT 0,
+    `star_1` bigint NOT NULL DEFAULT 0,
+    `star_2` bigint NOT NULL DEFAULT 0,
+    `star_3` bigint NOT NULL DEFAULT 0,
+    `star_4` bigint NOT NULL DEFAULT 0,
+    `star_5` bigint NOT NULL DEFAULT 0,
+    `last_review_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`product_uuid`),
+    FOREIGN KEY (product_uuid) REFERENCES products(uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE `product_review_daily_stats` (
+    `product_uuid` varchar(255) NOT NULL,
+    `day` date NOT NULL,
+    `review_count` bigint NOT NULL DEFAULT 0,
+    `score_sum` bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (`product_uuid`, `day`),
+    FOREIGN KEY (product_uuid) REFERENCES products(uuid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- Counts the reviews stored before the stats were maintained. The stars are computed as app.StarsOf does.
+INSERT INTO `product_review_daily_stats` (`product_uuid`, `day`, `review_count`, `score_sum`)
+SELECT `op`.`product_uuid`, DATE(`r`.`created_at`), COUNT(*), SUM(COALESCE(`r`.`score`, 0))
+FROM `order_product_reviews` AS `r`
+INNER JOIN `order_products` AS `op` ON (`op`.`uuid` = `r`.`order_product_uuid`)
+GROUP BY `op`.`product_uuid`, DATE(`r`.`created_at`);
+
+INSERT INTO `product_review_stats` (`product_uuid`, `review_count`, `score_sum`, `positive_count`, `neutral_count`,
+    `negative_count`, `star_1`, `star_2`, `star_3`, `star_4`, `star_5`, `last_review_at`)
+SELECT `op`.`product_uuid`, COUNT(*), SUM(COALESCE(`r`.`score`, 0)),
+    SUM(COALESCE(`r`.`score`, 0) > 0), SUM(COALESCE(`r`.`score`, 0) = 0), SUM(COALESCE(`r`.`score`, 0) < 0),
+    SUM(LEAST(1, GREATEST(-1, COALESCE(`r`.`score`, 0))) = -1), 0,
+    SUM(LEAST(1, GREATEST(-1, COALESCE(`r`.`score`, 0))) = 0), 0,
+    SUM(LEAST(1, GREATEST(-1, COALESCE(`r`.`score`, 0))) = 1), MAX(`r`.`created_at`)
+FROM `order_product_reviews` AS `r`
+INNER JOIN `order_products` AS `op` ON (`op`.`uuid` = `r`.`order_product_uuid`)
+GROUP BY `op`.`product_uuid`;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `product_review_daily_stats`;
+DROP TABLE IF EXISTS `product_review_stats`;
@@ -0,0 +1,14 @@
+-- +migrate Up
+ALTER TABLE `orders`
+    ADD KEY `orders_placed_date_idx` (`placed_date`, `uuid`),
+    ADD KEY `orders_status_placed_date_idx` (`status`, `placed_date`, `uuid`),
+    ADD KEY `orders_customer_uuid_placed_date_idx` (`customer_uuid`, `placed_date`, `uuid`);
+
+-- +migrate Down
+-- MySQL may have dropped the index it created for the customer foreign key in favour of the customer index added
+-- above, so another one backs the foreign key before that index is dropped.
+ALTER TABLE `orders`
+    ADD KEY `orders_customer_uuid_idx` (`customer_uuid`),
+    DROP KEY `orders_customer_uuid_placed_date_idx`,
+    DROP KEY `orders_status_placed_date_idx`,
+    DROP KEY `orders_placed_date_idx`;
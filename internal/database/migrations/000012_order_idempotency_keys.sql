@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE `orders`
+    ADD COLUMN `idempotency_key` varchar(255) DEFAULT NULL,
+    ADD UNIQUE KEY `orders_idempotency_key_idx` (`customer_uuid`, `idempotency_key`);
+
+-- +migrate Down
+ALTER TABLE `orders`
+    DROP KEY `orders_idempotency_key_idx`,
+    DROP COLUMN `idempotency_key`;
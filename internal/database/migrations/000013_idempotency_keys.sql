@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE `idempotency_keys` (
+    `actor` varchar(255) NOT NULL,
+    `idempotency_key` varchar(255) NOT NULL,
+    `fingerprint` char(64) NOT NULL,
+    `status` varchar(255) NOT NULL,
+    `response_status` int DEFAULT NULL,
+    `response_headers` text DEFAULT NULL,
+    `response_body` mediumblob DEFAULT NULL,
+    `created_at` datetime NOT NULL,
+    `expires_at` datetime NOT NULL,
+    PRIMARY KEY (`actor`, `idempotency_key`),
+    KEY `idempotency_keys_expires_at_idx` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `idempotency_keys`;
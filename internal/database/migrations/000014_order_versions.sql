@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE `orders`
+    ADD COLUMN `version` int NOT NULL DEFAULT 1;
+
+-- +migrate Down
+ALTER TABLE `orders`
+    DROP COLUMN `version`;
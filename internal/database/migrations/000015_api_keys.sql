@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE `api_keys` (
+    `uuid` varchar(255) NOT NULL,
+    `name` varchar(255) NOT NULL,
+    `prefix` varchar(255) NOT NULL,
+    `hash` char(64) NOT NULL,
+    `scopes` varchar(1024) NOT NULL,
+    `created_at` datetime NOT NULL,
+    `revoked_at` datetime DEFAULT NULL,
+    PRIMARY KEY (`uuid`),
+    UNIQUE KEY `api_keys_hash_idx` (`hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+-- +migrate Down
+DROP TABLE IF EXISTS `api_keys`;
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"testing"
+)
+
+// TestEmbeddedMigrations tests that the embedded migrations and seeds are found and parse.
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := migrationsSource.FindMigrations()
+	if err != nil {
+		t.Fatalf("Error finding migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatalf("No migrations found")
+	}
+
+	seeds, err := seedsSource.FindMigrations()
+	if err != nil {
+		t.Fatalf("Error finding seeds: %v", err)
+	}
+	if len(seeds) == 0 {
+		t.Fatalf("No seeds found")
+	}
+	for _, seed := range seeds {
+		if len(seed.Up) == 0 || len(seed.Down) == 0 {
+			t.Fatalf("Seed %s should have both up and down statements", seed.Id)
+		}
+	}
+}
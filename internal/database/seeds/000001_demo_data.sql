@@ -0,0 +1,32 @@
+-- Demo data for local development and testing. Never apply it to a production database.
+-- +migrate Up
+INSERT IGNORE INTO `customers` (`uuid`, `first_name`, `last_name`, `email`, `phone_number`, `registration_date`)
+VALUES
+    ('cus1','fnam','lname','email@mail.com','1234567890','2023-12-12 12:12:51'),
+    ('cus2','Name1','Name2','mail@mail.gr','0987654321','2022-11-10 12:12:51');
+
+INSERT IGNORE INTO `products` (`uuid`, `name`, `description`, `image`, `availability_status`, `available_items`)
+VALUES
+    ('prod1','iPhone 23','some descript','An image URL','available',129),
+    ('prod2','iSpoon','Desc','img','available',973),
+    ('prod3','iTable','A new kind of table','Some_image','available',2);
+
+INSERT IGNORE INTO `orders` (`uuid`, `customer_uuid`, `status`, `placed_date`)
+VALUES
+    ('ord1','cus1','placed','2023-12-12 12:12:51'),
+    ('ord2','cus2','completed','2022-12-12 12:12:51'),
+    ('ord3','cus2','sending','2023-12-12 13:12:51');
+
+INSERT IGNORE INTO `order_products` (`uuid`, `order_uuid`, `product_uuid`, `items`)
+VALUES
+    ('op1','ord1','prod1',2),
+    ('op2','ord1','prod2',12),
+    ('op3','ord2','prod3',1),
+    ('op4','ord3','prod1',1);
+
+-- +migrate Down
+DELETE FROM `order_product_reviews` WHERE `order_product_uuid` IN ('op1', 'op2', 'op3', 'op4');
+DELETE FROM `order_products` WHERE `uuid` IN ('op1', 'op2', 'op3', 'op4');
+DELETE FROM `orders` WHERE `uuid` IN ('ord1', 'ord2', 'ord3');
+DELETE FROM `products` WHERE `uuid` IN ('prod1', 'prod2', 'prod3');
+DELETE FROM `customers` WHERE `uuid` IN ('cus1', 'cus2');
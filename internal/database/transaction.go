@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+)
+
+// WithinTransaction runs fn inside a single transaction of db, which is committed if fn returns nil and rolled back
+// otherwise.
+func WithinTransaction(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return app.NewError("Error while starting transaction", fmt.Errorf("begin transaction: %w", err))
+	}
+
+	if err = fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return app.NewError("Error while rolling back transaction",
+				fmt.Errorf("rollback transaction: %w", errors.Join(err, rbErr)))
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return app.NewError("Error while committing transaction", fmt.Errorf("commit transaction: %w", err))
+	}
+	return nil
+}
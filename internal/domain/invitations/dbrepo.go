@@ -0,0 +1,241 @@
+package invitations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+	"time"
+)
+
+// ReviewInvitationStore represents a review invitation entity at the Database.
+type ReviewInvitationStore struct {
+	UUID         string
+	OrderUUID    string
+	CustomerUUID string
+	Email        string
+	FirstName    string
+	Status       string
+	Attempts     int
+	LastError    sql.NullString
+	CreatedAt    time.Time
+	SentAt       sql.NullTime
+}
+
+// DatabaseRepository implements the ReviewInvitationsRepository interface.
+type DatabaseRepository struct {
+	db *sqlx.DB
+}
+
+// NewDatabaseRepository returns a new DatabaseRepository.
+func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
+	return &DatabaseRepository{
+		db: db,
+	}
+}
+
+// ReviewInvitationStoreToReviewInvitation converts a ReviewInvitationStore object to an app.ReviewInvitation
+func (ds *DatabaseRepository) ReviewInvitationStoreToReviewInvitation(
+	invitationStore ReviewInvitationStore) app.ReviewInvitation {
+	invitation := app.ReviewInvitation{
+		UUID:         invitationStore.UUID,
+		OrderUUID:    invitationStore.OrderUUID,
+		CustomerUUID: invitationStore.CustomerUUID,
+		Email:        invitationStore.Email,
+		FirstName:    invitationStore.FirstName,
+		Status:       app.ReviewInvitationStatus(invitationStore.Status),
+		Attempts:     invitationStore.Attempts,
+		LastError:    invitationStore.LastError.String,
+		CreatedAt:    invitationStore.CreatedAt,
+	}
+	if invitationStore.SentAt.Valid {
+		invitation.SentAt = &invitationStore.SentAt.Time
+	}
+	return invitation
+}
+
+// AddReviewInvitation stores a pending review invitation, unless the order already has one.
+func (ds *DatabaseRepository) AddReviewInvitation(ctx context.Context, invitation app.ReviewInvitation) (bool,
+	error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("review_invitations").Cols("uuid", "order_uuid", "customer_uuid", "email",
+		"first_name", "status", "attempts", "created_at").Vals(goqu.Vals{uuid.New().String(), invitation.OrderUUID,
+		invitation.CustomerUUID, invitation.Email, invitation.FirstName, string(app.ReviewInvitationStatusPending), 0,
+		invitation.CreatedAt}).OnConflict(goqu.DoNothing()).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing insert for review invitation",
+			fmt.Errorf("insert review invitation: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while inserting review invitation",
+			fmt.Errorf("insert review invitation: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while inserting review invitation",
+			fmt.Errorf("insert review invitation: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// GetPendingReviewInvitations retrieves from storage the invitations waiting to be sent, oldest first.
+// Invitations claimed before staleBefore are considered abandoned and are returned as well.
+func (ds *DatabaseRepository) GetPendingReviewInvitations(ctx context.Context, staleBefore time.Time,
+	limit int) ([]app.ReviewInvitation, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "order_uuid", "customer_uuid", "email", "first_name", "status",
+		"attempts", "last_error", "created_at", "sent_at").From("review_invitations").
+		Where(claimableInvitation(staleBefore)).Order(goqu.C("created_at").Asc()).Limit(uint(limit)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for review invitations",
+			fmt.Errorf("get pending review invitations: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting review invitations",
+			fmt.Errorf("get pending review invitations: %w", err))
+	}
+	defer rows.Close()
+	invitations := []app.ReviewInvitation{}
+	for rows.Next() {
+		var invitationStore ReviewInvitationStore
+		if err := rows.Scan(&invitationStore.UUID, &invitationStore.OrderUUID, &invitationStore.CustomerUUID,
+			&invitationStore.Email, &invitationStore.FirstName, &invitationStore.Status, &invitationStore.Attempts,
+			&invitationStore.LastError, &invitationStore.CreatedAt, &invitationStore.SentAt); err != nil {
+			return nil, app.NewError("Error while reading review invitations",
+				fmt.Errorf("get pending review invitations: %w", err))
+		}
+		invitations = append(invitations, ds.ReviewInvitationStoreToReviewInvitation(invitationStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading review invitations",
+			fmt.Errorf("get pending review invitations: %w", err))
+	}
+
+	return invitations, nil
+}
+
+// ClaimReviewInvitation marks a pending invitation as being sent and counts the attempt.
+// The conditional update lets only one of several concurrent dispatchers claim an invitation.
+func (ds *DatabaseRepository) ClaimReviewInvitation(ctx context.Context, invitationUUID string,
+	staleBefore time.Time, claimedAt time.Time) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("review_invitations").Set(goqu.Record{
+		"status":     string(app.ReviewInvitationStatusSending),
+		"claimed_at": claimedAt,
+		"attempts":   goqu.L("`attempts` + 1"),
+	}).Where(goqu.C("uuid").Eq(invitationUUID), claimableInvitation(staleBefore)).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing update for review invitation",
+			fmt.Errorf("claim review invitation: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while updating review invitation",
+			fmt.Errorf("claim review invitation: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while updating review invitation",
+			fmt.Errorf("claim review invitation: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// MarkReviewInvitationSent marks an invitation as sent.
+func (ds *DatabaseRepository) MarkReviewInvitationSent(ctx context.Context, invitationUUID string,
+	sentAt time.Time) error {
+	return ds.updateReviewInvitation(ctx, invitationUUID, goqu.Record{
+		"status":     string(app.ReviewInvitationStatusSent),
+		"sent_at":    sentAt,
+		"last_error": nil,
+	})
+}
+
+// MarkReviewInvitationFailed records a failed delivery attempt. The status is pending if the invitation will be
+// retried and failed otherwise.
+func (ds *DatabaseRepository) MarkReviewInvitationFailed(ctx context.Context, invitationUUID string,
+	lastError string, status app.ReviewInvitationStatus) error {
+	return ds.updateReviewInvitation(ctx, invitationUUID, goqu.Record{
+		"status":     string(status),
+		"last_error": lastError,
+		"claimed_at": nil,
+	})
+}
+
+// AddReviewOptOut records that a customer opted out of the review reminders. Opting out twice has no effect.
+func (ds *DatabaseRepository) AddReviewOptOut(ctx context.Context, customerUUID string, createdAt time.Time) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("review_opt_outs").Cols("customer_uuid", "created_at").
+		Vals(goqu.Vals{customerUUID, createdAt}).OnConflict(goqu.DoNothing()).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for review opt-out",
+			fmt.Errorf("insert review opt-out: %w", err))
+	}
+	if _, err := ds.db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while inserting review opt-out", fmt.Errorf("insert review opt-out: %w", err))
+	}
+
+	return nil
+}
+
+// HasReviewOptOut returns whether a customer opted out of the review reminders.
+func (ds *DatabaseRepository) HasReviewOptOut(ctx context.Context, customerUUID string) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("customer_uuid").From("review_opt_outs").
+		Where(goqu.C("customer_uuid").Eq(customerUUID)).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing querying for review opt-out",
+			fmt.Errorf("get review opt-out: %w", err))
+	}
+
+	var optedOutUUID string
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&optedOutUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, app.NewError("Error while getting review opt-out", fmt.Errorf("get review opt-out: %w", err))
+	}
+
+	return true, nil
+}
+
+func (ds *DatabaseRepository) updateReviewInvitation(ctx context.Context, invitationUUID string,
+	record goqu.Record) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("review_invitations").Set(record).
+		Where(goqu.C("uuid").Eq(invitationUUID)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for review invitation",
+			fmt.Errorf("update review invitation: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while updating review invitation", fmt.Errorf("update review invitation: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while updating review invitation", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+func claimableInvitation(staleBefore time.Time) goqu.Expression {
+	return goqu.Or(
+		goqu.C("status").Eq(string(app.ReviewInvitationStatusPending)),
+		goqu.And(
+			goqu.C("status").Eq(string(app.ReviewInvitationStatusSending)),
+			goqu.C("claimed_at").Lt(staleBefore),
+		),
+	)
+}
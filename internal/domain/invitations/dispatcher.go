@@ -0,0 +1,40 @@
+package invitations
+
+import (
+	"context"
+	"golang.org/x/exp/slog"
+	"time"
+)
+
+// Dispatcher sends the pending review invitations periodically.
+type Dispatcher struct {
+	service  *Service
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewDispatcher returns a new Dispatcher polling for pending invitations every interval.
+func NewDispatcher(service *Service, interval time.Duration, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{service: service, interval: interval, logger: logger}
+}
+
+// Run sends the pending invitations every interval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		sent, err := d.service.DispatchPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Error("could not dispatch review invitations", "err", err)
+		}
+		if sent > 0 {
+			d.logger.Info("sent review invitations", "count", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reviewbot/app"
+	"reviewbot/internal/scheduler"
+	"reviewbot/pkg/notifier/notifiertypes"
+	"time"
+)
+
+// ReminderJobKind is the kind of the scheduled jobs reminding customers to review their orders.
+const ReminderJobKind = "review_reminder"
+
+// ReminderConfig configures the reminders sent to customers who have not reviewed their completed orders.
+type ReminderConfig struct {
+	// Count is the maximum number of reminders sent for an order. 0 disables the reminders.
+	Count int
+	// Interval is the delay between the invitation and the first reminder, and between two reminders.
+	Interval time.Duration
+}
+
+type reminderPayload struct {
+	OrderUUID string `json:"order_uuid"`
+	Reminder  int    `json:"reminder"`
+}
+
+// EnableReminders makes the service schedule reminders with jobs after each invitation it sends.
+// The reminders of an order stop once it is reviewed or its customer opts out.
+func (s *Service) EnableReminders(jobs *scheduler.Scheduler, config ReminderConfig) {
+	if config.Count <= 0 {
+		return
+	}
+	s.jobs = jobs
+	s.reminders = config
+	jobs.Handle(ReminderJobKind, s.sendReminder)
+}
+
+// OptOut stops the review reminders of a customer.
+func (s *Service) OptOut(ctx context.Context, customerUUID string) error {
+	return s.repo.AddReviewOptOut(ctx, customerUUID, time.Now().UTC())
+}
+
+// scheduleReminder schedules the given reminder of an order an interval after now, unless the reminders are
+// disabled or all of them were sent. Every reminder is scheduled at most once.
+func (s *Service) scheduleReminder(ctx context.Context, orderUUID string, reminder int, now time.Time) error {
+	if s.jobs == nil || reminder > s.reminders.Count {
+		return nil
+	}
+	payload, err := json.Marshal(reminderPayload{OrderUUID: orderUUID, Reminder: reminder})
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s:%s:%d", ReminderJobKind, orderUUID, reminder)
+	_, err = s.jobs.Schedule(ctx, ReminderJobKind, key, orderUUID, payload, now.Add(s.reminders.Interval))
+	return err
+}
+
+func (s *Service) cancelReminders(ctx context.Context, orderUUID string) error {
+	if s.jobs == nil {
+		return nil
+	}
+	_, err := s.jobs.Cancel(ctx, ReminderJobKind, orderUUID)
+	return err
+}
+
+// sendReminder is the handler of the reminder jobs.
+func (s *Service) sendReminder(ctx context.Context, job app.ScheduledJob) error {
+	var payload reminderPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("decode review reminder: %w", err)
+	}
+	logger := s.logger.With("order_uuid", payload.OrderUUID, "reminder", payload.Reminder)
+
+	order, err := s.ordersRepo.GetOrderByUUID(ctx, payload.OrderUUID)
+	if errors.Is(err, app.ErrNoRecords) {
+		logger.Warn("order of review reminder not found")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if order.Status != app.OrderStatusCompleted {
+		logger.Info("order is not awaiting a review anymore, skipping reminder", "status", order.Status)
+		return nil
+	}
+	optedOut, err := s.repo.HasReviewOptOut(ctx, order.Customer.UUID)
+	if err != nil {
+		return err
+	}
+	if optedOut {
+		logger.Info("customer opted out of review reminders, skipping reminder")
+		return nil
+	}
+	if order.Customer.Email == "" {
+		return errors.New("customer has no email address")
+	}
+
+	// The next reminder is scheduled first, so that a failure of the notifier retrying this job does not lose it.
+	now := time.Now().UTC()
+	if err := s.scheduleReminder(ctx, order.UUID, payload.Reminder+1, now); err != nil {
+		return err
+	}
+	err = s.notifier.Notify(ctx, notifiertypes.Message{
+		To:      order.Customer.Email,
+		Subject: "Tell us about your order",
+		Body: fmt.Sprintf("Hi %s,\n\nYou have not told us yet what you think about your order %s. It only takes a "+
+			"minute with our review assistant:\n\n%s\n\nIf you would rather not receive these reminders, follow this "+
+			"link:\n\n%s\n\nThank you!\n", order.Customer.FirstName, order.UUID, s.linkSigner.Link(order.UUID, now),
+			s.linkSigner.OptOutLink(order.Customer.UUID, now)),
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("sent review reminder")
+	return nil
+}
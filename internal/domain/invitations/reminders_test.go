@@ -0,0 +1,208 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"reviewbot/app"
+	"reviewbot/internal/scheduler"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/exp/slog"
+)
+
+// stubOrdersRepository returns order from GetOrderByUUID.
+type stubOrdersRepository struct {
+	app.OrdersRepository
+	order *app.Order
+}
+
+func (sr *stubOrdersRepository) GetOrderByUUID(ctx context.Context, orderUUID string) (*app.Order, error) {
+	return sr.order, nil
+}
+
+func newTestReminders(service *Service, db *sqlx.DB, order *app.Order) *scheduler.Scheduler {
+	jobs := scheduler.NewScheduler(scheduler.NewDatabaseRepository(db), time.Minute,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	service.ordersRepo = &stubOrdersRepository{order: order}
+	service.EnableReminders(jobs, ReminderConfig{Count: 2, Interval: time.Hour})
+	return jobs
+}
+
+func reminderJobRow(t *testing.T, reminder int) *sqlmock.Rows {
+	payload, err := json.Marshal(reminderPayload{OrderUUID: "ord1", Reminder: reminder})
+	if err != nil {
+		t.Fatalf("Error encoding payload: %v", err)
+	}
+	return sqlmock.NewRows([]string{"uuid", "kind", "job_key", "subject", "payload", "status", "attempts",
+		"last_error", "run_at", "created_at"}).
+		AddRow("job1", ReminderJobKind, "key", "ord1", payload, "pending", 0, nil, time.Now(), time.Now())
+}
+
+// TestDispatchPendingSchedulesFirstReminder tests that sending an invitation schedules the first reminder.
+func TestDispatchPendingSchedulesFirstReminder(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t, &recordingNotifier{})
+	defer db.Close()
+	newTestReminders(service, sqlx.NewDb(db, "mysql"), testOrder)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `review_invitations`")).WillReturnRows(sqlmock.NewRows(invitationColumns).
+		AddRow("inv1", "ord1", "cus1", "jane@example.com", "Jane", "pending", 0, nil, time.Now(), nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") + ".*`status`='sending'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `scheduled_jobs`") +
+		".*'review_reminder', 'review_reminder:ord1:1', 'ord1'").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") + ".*`status`='sent'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	_, err := service.DispatchPending(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error dispatching invitations: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestReminderSentAndNextScheduled tests that a reminder is sent with an opt-out link and schedules the next one.
+func TestReminderSentAndNextScheduled(t *testing.T) {
+	// Arrange
+	notifier := &recordingNotifier{}
+	db, service, mock := newTestService(t, notifier)
+	defer db.Close()
+	jobs := newTestReminders(service, sqlx.NewDb(db, "mysql"), testOrder)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `scheduled_jobs`")).WillReturnRows(reminderJobRow(t, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='running'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `review_opt_outs`")).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_uuid"}))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `scheduled_jobs`") + ".*'review_reminder:ord1:2'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='done'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	ran, err := jobs.RunDue(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error running reminders: %v", err)
+	}
+	if ran != 1 || len(notifier.messages) != 1 {
+		t.Fatalf("Sent count mismatch: got %d (%d messages), want %d", ran, len(notifier.messages), 1)
+	}
+	if !strings.Contains(notifier.messages[0].Body, "https://reviews.example.com/api/customers/cus1/review-opt-out?") {
+		t.Fatalf("Expected an opt-out link in %q", notifier.messages[0].Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestLastReminderSchedulesNothing tests that no reminder is scheduled after the last one.
+func TestLastReminderSchedulesNothing(t *testing.T) {
+	// Arrange
+	notifier := &recordingNotifier{}
+	db, service, mock := newTestService(t, notifier)
+	defer db.Close()
+	jobs := newTestReminders(service, sqlx.NewDb(db, "mysql"), testOrder)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `scheduled_jobs`")).WillReturnRows(reminderJobRow(t, 2))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `review_opt_outs`")).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_uuid"}))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='done'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	_, err := jobs.RunDue(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error running reminders: %v", err)
+	}
+	if len(notifier.messages) != 1 {
+		t.Fatalf("Sent count mismatch: got %d, want %d", len(notifier.messages), 1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestReminderSkipped tests that reminders stop once the order is reviewed or the customer opted out.
+func TestReminderSkipped(t *testing.T) {
+	reviewedOrder := *testOrder
+	reviewedOrder.Status = app.OrderStatusReviewed
+
+	tests := []struct {
+		name     string
+		order    *app.Order
+		optedOut bool
+	}{
+		{name: "reviewed", order: &reviewedOrder},
+		{name: "opted out", order: testOrder, optedOut: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			notifier := &recordingNotifier{}
+			db, service, mock := newTestService(t, notifier)
+			defer db.Close()
+			jobs := newTestReminders(service, sqlx.NewDb(db, "mysql"), tt.order)
+
+			mock.ExpectQuery(regexp.QuoteMeta("FROM `scheduled_jobs`")).WillReturnRows(reminderJobRow(t, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET")).WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.order.Status == app.OrderStatusCompleted {
+				rows := sqlmock.NewRows([]string{"customer_uuid"})
+				if tt.optedOut {
+					rows.AddRow("cus1")
+				}
+				mock.ExpectQuery(regexp.QuoteMeta("FROM `review_opt_outs`")).WillReturnRows(rows)
+			}
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='done'").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			// Act
+			_, err := jobs.RunDue(context.Background())
+			// Assert
+			if err != nil {
+				t.Fatalf("Error running reminders: %v", err)
+			}
+			if len(notifier.messages) != 0 {
+				t.Fatalf("Sent count mismatch: got %d, want %d", len(notifier.messages), 0)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestOrderReviewedCancelsReminders tests that reviewing an order cancels its pending reminders.
+func TestOrderReviewedCancelsReminders(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t, &recordingNotifier{})
+	defer db.Close()
+	newTestReminders(service, sqlx.NewDb(db, "mysql"), testOrder)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET `status`='cancelled'") +
+		".*`kind` = 'review_reminder'.*`subject` = 'ord1'.*`status` = 'pending'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	err := service.HandleEvent(context.Background(),
+		statusChangedEvent(t, app.OrderStatusCompleted, app.OrderStatusReviewed))
+	// Assert
+	if err != nil {
+		t.Fatalf("Error handling status change: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
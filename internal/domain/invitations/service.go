@@ -0,0 +1,149 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"reviewbot/app"
+	"reviewbot/internal/reviewlink"
+	"reviewbot/internal/scheduler"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"reviewbot/pkg/notifier"
+	"reviewbot/pkg/notifier/notifiertypes"
+	"time"
+)
+
+const (
+	// maxAttempts is the number of delivery attempts after which an invitation is marked as failed.
+	maxAttempts = 5
+	// claimTimeout is the time after which an invitation claimed by a dispatcher that never finished is retried.
+	claimTimeout      = 10 * time.Minute
+	dispatchBatchSize = 50
+)
+
+// Service wraps the review invitations repository.
+type Service struct {
+	repo       app.ReviewInvitationsRepository
+	ordersRepo app.OrdersRepository
+	notifier   notifier.Notifier
+	linkSigner *reviewlink.Signer
+	logger     *slog.Logger
+
+	jobs      *scheduler.Scheduler
+	reminders ReminderConfig
+}
+
+// NewService returns a new Service.
+func NewService(repo app.ReviewInvitationsRepository, ordersRepo app.OrdersRepository, notifier notifier.Notifier,
+	linkSigner *reviewlink.Signer, logger *slog.Logger) *Service {
+	return &Service{repo: repo, ordersRepo: ordersRepo, notifier: notifier, linkSigner: linkSigner, logger: logger}
+}
+
+// HandleEvent enqueues a review invitation when an order.status_changed event tells that an order became completed,
+// and cancels its pending reminders once it is reviewed. It subscribes to the events of the outbox, so the
+// invitations follow the committed status changes even if the process stops right after them, and a failure is
+// retried until it succeeds.
+// Every order is invited at most once, however many times it is reported as completed.
+func (s *Service) HandleEvent(ctx context.Context, event eventsinktypes.Event) error {
+	if event.Type != app.EventOrderStatusChanged {
+		return nil
+	}
+	var data app.OrderStatusEventData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return fmt.Errorf("decode %s event %s: %w", event.Type, event.ID, err)
+	}
+
+	switch data.To {
+	case app.OrderStatusReviewed:
+		return s.cancelReminders(ctx, data.OrderUUID)
+	case app.OrderStatusCompleted:
+		order, err := s.ordersRepo.GetOrderByUUID(ctx, data.OrderUUID)
+		if errors.Is(err, app.ErrNoRecords) {
+			s.logger.Warn("completed order not found, skipping review invitation", "order_uuid", data.OrderUUID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.invite(ctx, order)
+	default:
+		return nil
+	}
+}
+
+// invite enqueues the review invitation of a completed order, unless it was already invited.
+func (s *Service) invite(ctx context.Context, order *app.Order) error {
+	added, err := s.repo.AddReviewInvitation(ctx, app.ReviewInvitation{
+		OrderUUID:    order.UUID,
+		CustomerUUID: order.Customer.UUID,
+		Email:        order.Customer.Email,
+		FirstName:    order.Customer.FirstName,
+		CreatedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if !added {
+		s.logger.Info("review invitation already exists", "order_uuid", order.UUID)
+	}
+	return nil
+}
+
+// DispatchPending sends the pending review invitations and returns how many were sent.
+func (s *Service) DispatchPending(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	invitations, err := s.repo.GetPendingReviewInvitations(ctx, now.Add(-claimTimeout), dispatchBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, invitation := range invitations {
+		claimed, err := s.repo.ClaimReviewInvitation(ctx, invitation.UUID, now.Add(-claimTimeout), now)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		// The first reminder is scheduled before the invitation is marked as sent, so that it is not lost if the
+		// process stops in between. Scheduling it again when the invitation is resent has no effect.
+		if err := s.scheduleReminder(ctx, invitation.OrderUUID, 1, now); err != nil {
+			s.logger.Error("could not schedule review reminder", "order_uuid", invitation.OrderUUID, "err", err)
+		}
+		if err := s.send(ctx, invitation); err != nil {
+			status := app.ReviewInvitationStatusPending
+			if invitation.Attempts+1 >= maxAttempts {
+				status = app.ReviewInvitationStatusFailed
+			}
+			s.logger.Error("could not send review invitation", "order_uuid", invitation.OrderUUID,
+				"attempt", invitation.Attempts+1, "err", err)
+			if err := s.repo.MarkReviewInvitationFailed(ctx, invitation.UUID, err.Error(), status); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := s.repo.MarkReviewInvitationSent(ctx, invitation.UUID, time.Now().UTC()); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func (s *Service) send(ctx context.Context, invitation app.ReviewInvitation) error {
+	if invitation.Email == "" {
+		return errors.New("customer has no email address")
+	}
+	link := s.linkSigner.Link(invitation.OrderUUID, time.Now())
+	return s.notifier.Notify(ctx, notifiertypes.Message{
+		To:      invitation.Email,
+		Subject: "How was your order?",
+		Body: fmt.Sprintf("Hi %s,\n\nYour order %s has been delivered. We would love to hear what you think "+
+			"about the products you received. Share your experience with our review assistant:\n\n%s\n\nThank you!\n",
+			invitation.FirstName, invitation.OrderUUID, link),
+	})
+}
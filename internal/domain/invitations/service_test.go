@@ -0,0 +1,175 @@
+package invitations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"reviewbot/app"
+	"reviewbot/internal/reviewlink"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"reviewbot/pkg/notifier/notifiertypes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/exp/slog"
+)
+
+// recordingNotifier records the delivered messages and fails with err if set.
+type recordingNotifier struct {
+	messages []notifiertypes.Message
+	err      error
+}
+
+func (rn *recordingNotifier) Notify(ctx context.Context, message notifiertypes.Message) error {
+	if rn.err != nil {
+		return rn.err
+	}
+	rn.messages = append(rn.messages, message)
+	return nil
+}
+
+func newTestService(t *testing.T, notifier *recordingNotifier) (*sql.DB, *Service, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	repo := NewDatabaseRepository(sqlx.NewDb(db, "mysql"))
+	signer := reviewlink.NewSigner("wss://reviews.example.com", "secret", time.Hour)
+	return db, NewService(repo, &stubOrdersRepository{order: testOrder}, notifier, signer,
+		slog.New(slog.NewTextHandler(io.Discard, nil))), mock
+}
+
+// statusChangedEvent returns the order.status_changed event of ord1 moving from one status to another.
+func statusChangedEvent(t *testing.T, from, to app.OrderStatus) eventsinktypes.Event {
+	data, err := json.Marshal(app.OrderStatusEventData{OrderUUID: "ord1", From: from, To: to, Actor: "backoffice"})
+	if err != nil {
+		t.Fatalf("Error encoding event data: %v", err)
+	}
+	return eventsinktypes.Event{ID: "evt1", Type: app.EventOrderStatusChanged, OccurredAt: time.Now(), Data: data}
+}
+
+var testOrder = &app.Order{
+	UUID:     "ord1",
+	Customer: app.Customer{UUID: "cus1", FirstName: "Jane", Email: "jane@example.com"},
+	Status:   app.OrderStatusCompleted,
+}
+
+var invitationColumns = []string{"uuid", "order_uuid", "customer_uuid", "email", "first_name", "status", "attempts",
+	"last_error", "created_at", "sent_at"}
+
+// TestHandleEventEnqueuesInvitation tests that a completed order gets a deduplicated invitation.
+func TestHandleEventEnqueuesInvitation(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t, &recordingNotifier{})
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `review_invitations`") + ".*'ord1', 'cus1', " +
+		"'jane@example.com', 'Jane', 'pending'").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	err := service.HandleEvent(context.Background(),
+		statusChangedEvent(t, app.OrderStatusSending, app.OrderStatusCompleted))
+	// Assert
+	if err != nil {
+		t.Fatalf("Error enqueueing invitation: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestHandleEventIgnoresOtherStatuses tests that only completed orders are invited.
+func TestHandleEventIgnoresOtherStatuses(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t, &recordingNotifier{})
+	defer db.Close()
+
+	// Act
+	err := service.HandleEvent(context.Background(),
+		statusChangedEvent(t, app.OrderStatusPlaced, app.OrderStatusPreparing))
+	// Assert
+	if err != nil {
+		t.Fatalf("Error handling status change: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestDispatchPendingSendsInvitations tests that claimed invitations are sent with a signed link.
+func TestDispatchPendingSendsInvitations(t *testing.T) {
+	// Arrange
+	notifier := &recordingNotifier{}
+	db, service, mock := newTestService(t, notifier)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `review_invitations`")).WillReturnRows(sqlmock.NewRows(invitationColumns).
+		AddRow("inv1", "ord1", "cus1", "jane@example.com", "Jane", "pending", 0, nil, time.Now(), nil).
+		AddRow("inv2", "ord2", "cus2", "john@example.com", "John", "pending", 0, nil, time.Now(), nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") + ".*`status`='sending'.*'inv1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") + ".*`status`='sent'.*'inv1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Another dispatcher claimed the second invitation first.
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") + ".*`status`='sending'.*'inv2'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Act
+	sent, err := service.DispatchPending(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error dispatching invitations: %v", err)
+	}
+	if sent != 1 || len(notifier.messages) != 1 {
+		t.Fatalf("Sent count mismatch: got %d (%d messages), want %d", sent, len(notifier.messages), 1)
+	}
+	message := notifier.messages[0]
+	if message.To != "jane@example.com" {
+		t.Fatalf("Recipient mismatch: got %s, want %s", message.To, "jane@example.com")
+	}
+	if !strings.Contains(message.Body, "wss://reviews.example.com/ws/orders/ord1?expires=") ||
+		!strings.Contains(message.Body, "signature=") {
+		t.Fatalf("Expected a signed review link in %q", message.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestDispatchPendingRecordsFailures tests that failed deliveries are retried until the attempts run out.
+func TestDispatchPendingRecordsFailures(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t, &recordingNotifier{err: errors.New("mailbox unavailable")})
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `review_invitations`")).WillReturnRows(sqlmock.NewRows(invitationColumns).
+		AddRow("inv1", "ord1", "cus1", "jane@example.com", "Jane", "pending", 0, nil, time.Now(), nil).
+		AddRow("inv2", "ord2", "cus2", "john@example.com", "John", "pending", maxAttempts-1, nil, time.Now(), nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") + ".*'inv1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") +
+		".*`last_error`='mailbox unavailable',`status`='pending'.*'inv1'").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") + ".*'inv2'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `review_invitations` SET") +
+		".*`last_error`='mailbox unavailable',`status`='failed'.*'inv2'").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	sent, err := service.DispatchPending(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error dispatching invitations: %v", err)
+	}
+	if sent != 0 {
+		t.Fatalf("Sent count mismatch: got %d, want %d", sent, 0)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reviewbot/app"
+	"reviewbot/pkg/catalogsource"
+	"reviewbot/pkg/catalogsource/catalogsourcetypes"
+	"time"
+)
+
+// ErrCatalogSyncAborted is returned when a synchronization is aborted because the feed looks broken, leaving the
+// catalog untouched.
+var ErrCatalogSyncAborted = app.NewCodedError(app.CodeUnprocessable, "catalog synchronization aborted", nil)
+
+// SyncProducts synchronizes the stored products with the catalog source, keyed on the remote id.
+// New products are created, changed products are updated and products missing from the source are marked as
+// discontinued. Running it again against an unchanged source leaves the catalog untouched.
+// It returns catalogsource.ErrDisabled without touching the catalog when no source is configured, and
+// ErrCatalogSyncAborted along with a summary telling why when the feed has no usable id or would discontinue more of
+// the catalog than allowed by LimitCatalogDiscontinuations.
+func (s *Service) SyncProducts(ctx context.Context) (*app.ProductSyncSummary, error) {
+	remoteProducts, err := s.catalogSource.Fetch(ctx)
+	if err != nil {
+		if errors.Is(err, catalogsource.ErrDisabled) {
+			return nil, err
+		}
+		return nil, app.NewError("Error while fetching the product catalog", err)
+	}
+	return s.syncProducts(ctx, remoteProducts, time.Now().UTC())
+}
+
+func (s *Service) syncProducts(ctx context.Context, remoteProducts []catalogsourcetypes.CatalogProduct,
+	now time.Time) (*app.ProductSyncSummary, error) {
+	summary := &app.ProductSyncSummary{}
+	err := s.repo.WithinTransaction(ctx, func(repo app.OrdersRepository) error {
+		storedProducts, err := repo.GetCatalogProducts(ctx)
+		if err != nil {
+			return err
+		}
+		// Earlier versions inserted the whole feed on every start, so a remote id may be stored more than once.
+		// Only the first product is kept in sync, the duplicates are discontinued below.
+		productsByID := make(map[string]app.Product, len(storedProducts))
+		for _, product := range storedProducts {
+			if _, ok := productsByID[product.ID]; !ok {
+				productsByID[product.ID] = product
+			}
+		}
+
+		seenIDs := make(map[string]bool, len(remoteProducts))
+		var usableProducts []catalogsourcetypes.CatalogProduct
+		for _, remoteProduct := range remoteProducts {
+			if remoteProduct.ID == "" || seenIDs[remoteProduct.ID] {
+				s.logger.Warn("skipping catalog product without a unique id", "id", remoteProduct.ID)
+				summary.Skipped++
+				continue
+			}
+			seenIDs[remoteProduct.ID] = true
+			usableProducts = append(usableProducts, remoteProduct)
+		}
+		if reason := s.checkCatalogFeed(storedProducts, seenIDs); reason != "" {
+			summary.Aborted = reason
+			return app.NewError(reason, ErrCatalogSyncAborted)
+		}
+
+		syncedUUIDs := make(map[string]bool, len(storedProducts))
+		for _, remoteProduct := range usableProducts {
+			stored, ok := productsByID[remoteProduct.ID]
+			if !ok {
+				if err := repo.AddProduct(ctx, applyRemoteProduct(app.Product{}, remoteProduct)); err != nil {
+					return err
+				}
+				summary.Created++
+				continue
+			}
+
+			syncedUUIDs[stored.UUID] = true
+			product := applyRemoteProduct(stored, remoteProduct)
+			if catalogFieldsEqual(stored, product) {
+				summary.Unchanged++
+				continue
+			}
+			if err := repo.UpdateProduct(ctx, product); err != nil {
+				return err
+			}
+			summary.Updated++
+		}
+
+		for _, product := range storedProducts {
+			if syncedUUIDs[product.UUID] || product.DiscontinuedAt != nil {
+				continue
+			}
+			product.DiscontinuedAt = &now
+			if err := repo.UpdateProduct(ctx, product); err != nil {
+				return err
+			}
+			summary.Discontinued++
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrCatalogSyncAborted) {
+			return summary, err
+		}
+		return nil, err
+	}
+	return summary, nil
+}
+
+// checkCatalogFeed returns why the feed, whose usable ids are remoteIDs, must not be applied to the stored products,
+// or an empty string when it may. An empty feed, or a field mapping losing the ids, would otherwise discontinue the
+// whole catalog.
+func (s *Service) checkCatalogFeed(storedProducts []app.Product, remoteIDs map[string]bool) string {
+	if len(remoteIDs) == 0 {
+		return "the catalog feed has no product with an id"
+	}
+	activeIDs := make(map[string]bool, len(storedProducts))
+	missing := 0
+	for _, product := range storedProducts {
+		if product.DiscontinuedAt != nil || activeIDs[product.ID] {
+			continue
+		}
+		activeIDs[product.ID] = true
+		if !remoteIDs[product.ID] {
+			missing++
+		}
+	}
+	if missing*100 > s.maxDiscontinuedPercent*len(activeIDs) {
+		return fmt.Sprintf("the catalog feed would discontinue %d of %d products, more than %d%%", missing,
+			len(activeIDs), s.maxDiscontinuedPercent)
+	}
+	return ""
+}
+
+// applyRemoteProduct returns product with the fields owned by the remote feed overwritten by remoteProduct.
+// A product present in the source is never discontinued.
+func applyRemoteProduct(product app.Product, remoteProduct catalogsourcetypes.CatalogProduct) app.Product {
+	product.Name = remoteProduct.Name
+	product.Image = remoteProduct.Image
+	product.CreatedAt = remoteProduct.CreatedAt
+	product.Manufacturer = remoteProduct.Manufacturer
+	product.Vehicle = remoteProduct.Vehicle
+	product.ID = remoteProduct.ID
+	product.DiscontinuedAt = nil
+	return product
+}
+
+// catalogFieldsEqual reports whether the fields owned by the remote feed are equal in both products.
+// Timestamps are compared at second precision, as that is what the database stores.
+func catalogFieldsEqual(a, b app.Product) bool {
+	return a.Name == b.Name &&
+		a.Image == b.Image &&
+		a.CreatedAt.Truncate(time.Second).Equal(b.CreatedAt.Truncate(time.Second)) &&
+		a.Manufacturer == b.Manufacturer &&
+		a.Vehicle == b.Vehicle &&
+		a.ID == b.ID &&
+		(a.DiscontinuedAt == nil) == (b.DiscontinuedAt == nil)
+}
@@ -0,0 +1,128 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"reviewbot/pkg/catalogsource/catalogsourcetypes"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// TestSyncProducts tests that products are created, updated, left unchanged and discontinued by remote id.
+func TestSyncProducts(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+
+	createdAt := time.Date(2023, 12, 12, 12, 12, 51, 0, time.UTC)
+	discontinuedAt := time.Date(2023, 12, 13, 12, 12, 51, 0, time.UTC)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"uuid", "name", "description", "image", "availability_status", "available_items",
+		"created_at", "manufacturer", "vehicle", "id", "discontinued_at"}
+	rows := sqlmock.NewRows(columns).
+		AddRow("prod1", "Tyre", "", "img1", "", 0, createdAt, "Acme", "Car", "1", nil).
+		AddRow("prod2", "Old name", "", "img2", "", 0, createdAt, "Acme", "Car", "2", nil).
+		AddRow("prod3", "Removed", "", "img3", "", 0, createdAt, "Acme", "Car", "3", nil).
+		AddRow("prod4", "Tyre", "", "img1", "", 0, createdAt, "Acme", "Car", "1", nil).
+		AddRow("prod5", "Gone", "", "img5", "", 0, createdAt, "Acme", "Car", "5", discontinuedAt)
+	remoteProducts := []catalogsourcetypes.CatalogProduct{
+		{ID: "1", Name: "Tyre", Image: "img1", Manufacturer: "Acme", Vehicle: "Car",
+			CreatedAt: createdAt.Add(300 * time.Millisecond)},
+		{ID: "2", Name: "New name", Image: "img2", Manufacturer: "Acme", Vehicle: "Car",
+			CreatedAt: createdAt},
+		{ID: "6", Name: "Brand new", Image: "img6", Manufacturer: "Acme", Vehicle: "Car",
+			CreatedAt: createdAt},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE ((`id` IS NOT NULL) AND (`id` != '')) " +
+		"ORDER BY `uuid` ASC")).WillReturnRows(rows)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `products` SET") + ".*`name`='New name'.*" +
+		regexp.QuoteMeta("WHERE (`uuid` = 'prod2')")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `products`") + ".*'Brand new'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `products` SET") + ".*`discontinued_at`='2024-01-01.*" +
+		regexp.QuoteMeta("WHERE (`uuid` = 'prod3')")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `products` SET") + ".*`discontinued_at`='2024-01-01.*" +
+		regexp.QuoteMeta("WHERE (`uuid` = 'prod4')")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Act
+	summary, err := newTestService(repo).syncProducts(context.Background(), remoteProducts, now)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error synchronizing products: %v", err)
+	}
+	if summary.Created != 1 {
+		t.Fatalf("Created count mismatch: got %d, want %d", summary.Created, 1)
+	}
+	if summary.Updated != 1 {
+		t.Fatalf("Updated count mismatch: got %d, want %d", summary.Updated, 1)
+	}
+	if summary.Unchanged != 1 {
+		t.Fatalf("Unchanged count mismatch: got %d, want %d", summary.Unchanged, 1)
+	}
+	if summary.Discontinued != 2 {
+		t.Fatalf("Discontinued count mismatch: got %d, want %d", summary.Discontinued, 2)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestSyncProductsAbortsOnBrokenFeeds tests that a feed without ids, or discontinuing more of the catalog than
+// allowed, leaves the catalog untouched and is reported in the summary.
+func TestSyncProductsAbortsOnBrokenFeeds(t *testing.T) {
+	createdAt := time.Date(2023, 12, 12, 12, 12, 51, 0, time.UTC)
+	tests := []struct {
+		name           string
+		remoteProducts []catalogsourcetypes.CatalogProduct
+		wantSkipped    int
+	}{
+		{name: "empty feed"},
+		{name: "feed without ids", remoteProducts: []catalogsourcetypes.CatalogProduct{
+			{Name: "Tyre", CreatedAt: createdAt},
+			{Name: "Wheel", CreatedAt: createdAt},
+		}, wantSkipped: 2},
+		{name: "feed missing most products", remoteProducts: []catalogsourcetypes.CatalogProduct{
+			{ID: "1", Name: "Tyre", Image: "img1", Manufacturer: "Acme", Vehicle: "Car", CreatedAt: createdAt},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, repo, mock := newTestDatabase(t)
+			defer db.Close()
+			columns := []string{"uuid", "name", "description", "image", "availability_status", "available_items",
+				"created_at", "manufacturer", "vehicle", "id", "discontinued_at"}
+			rows := sqlmock.NewRows(columns).
+				AddRow("prod1", "Tyre", "", "img1", "", 0, createdAt, "Acme", "Car", "1", nil).
+				AddRow("prod2", "Wheel", "", "img2", "", 0, createdAt, "Acme", "Car", "2", nil).
+				AddRow("prod3", "Rim", "", "img3", "", 0, createdAt, "Acme", "Car", "3", nil)
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("FROM `products`")).WillReturnRows(rows)
+			mock.ExpectRollback()
+			service := newTestService(repo)
+			service.LimitCatalogDiscontinuations(50)
+
+			// Act
+			summary, err := service.syncProducts(context.Background(), tt.remoteProducts, time.Now())
+			// Assert
+			if !errors.Is(err, ErrCatalogSyncAborted) {
+				t.Fatalf("Error mismatch: got %v, want %v", err, ErrCatalogSyncAborted)
+			}
+			if summary == nil || summary.Aborted == "" {
+				t.Fatalf("Expected the summary to tell why the synchronization was aborted, got %+v", summary)
+			}
+			if summary.Skipped != tt.wantSkipped {
+				t.Fatalf("Skipped count mismatch: got %d, want %d", summary.Skipped, tt.wantSkipped)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
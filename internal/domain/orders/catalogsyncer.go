@@ -0,0 +1,156 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/exp/slog"
+	"math/rand"
+	"reviewbot/app"
+	"reviewbot/pkg/catalogsource"
+	"sync"
+	"time"
+)
+
+// ErrCatalogSyncInProgress is returned when a synchronization is requested while another one is running.
+var ErrCatalogSyncInProgress = app.NewCodedError(app.CodeConflict, "catalog synchronization in progress", nil)
+
+// errCatalogSyncStopped is returned when a synchronization is requested while the server shuts down.
+var errCatalogSyncStopped = app.NewCodedError(app.CodeUnavailable, "catalog synchronization stopped", nil)
+
+// CatalogSyncer synchronizes the product catalog in the background, periodically and on demand.
+// At most one synchronization runs at any time.
+type CatalogSyncer struct {
+	service  *Service
+	interval time.Duration
+	jitter   time.Duration
+	logger   *slog.Logger
+
+	running sync.Mutex
+	wg      sync.WaitGroup
+
+	mu        sync.RWMutex
+	ctx       context.Context
+	stopped   bool
+	isRunning bool
+	lastRun   *app.CatalogSyncRun
+	nextRunAt *time.Time
+}
+
+// NewCatalogSyncer returns a new CatalogSyncer. Runs are scheduled every interval plus a random duration up to
+// jitter, so that replicas started together do not hit the catalog source at the same time.
+// An interval of 0 disables the periodic runs.
+func NewCatalogSyncer(service *Service, interval, jitter time.Duration, logger *slog.Logger) *CatalogSyncer {
+	return &CatalogSyncer{service: service, interval: interval, jitter: jitter, logger: logger,
+		ctx: context.Background()}
+}
+
+// Run synchronizes the catalog immediately and then periodically until ctx is cancelled.
+// It returns once ctx is cancelled and every run, including the triggered ones, has finished.
+func (cs *CatalogSyncer) Run(ctx context.Context) {
+	cs.mu.Lock()
+	cs.ctx = ctx
+	cs.mu.Unlock()
+	defer func() {
+		cs.mu.Lock()
+		cs.stopped = true
+		cs.nextRunAt = nil
+		cs.mu.Unlock()
+		cs.wg.Wait()
+	}()
+
+	cs.sync(ctx)
+	if cs.interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+
+	for {
+		delay := cs.interval
+		if cs.jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(cs.jitter)))
+		}
+		nextRunAt := time.Now().UTC().Add(delay)
+		cs.mu.Lock()
+		cs.nextRunAt = &nextRunAt
+		cs.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			cs.sync(ctx)
+		}
+	}
+}
+
+// Trigger starts a synchronization in the background.
+// It returns ErrCatalogSyncInProgress if a synchronization is already running.
+func (cs *CatalogSyncer) Trigger() error {
+	if !cs.running.TryLock() {
+		return app.NewError("A catalog synchronization is already running", ErrCatalogSyncInProgress)
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.stopped {
+		cs.running.Unlock()
+		return app.NewError("The catalog synchronization has been stopped", errCatalogSyncStopped)
+	}
+	ctx := cs.ctx
+	cs.isRunning = true
+	cs.wg.Add(1)
+
+	go func() {
+		defer cs.wg.Done()
+		defer cs.running.Unlock()
+		cs.run(ctx)
+	}()
+	return nil
+}
+
+// Status returns the state of the synchronization.
+func (cs *CatalogSyncer) Status() app.CatalogSyncStatus {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return app.CatalogSyncStatus{Running: cs.isRunning, LastRun: cs.lastRun, NextRunAt: cs.nextRunAt}
+}
+
+// sync runs a scheduled synchronization, unless a triggered one is still running.
+func (cs *CatalogSyncer) sync(ctx context.Context) {
+	if !cs.running.TryLock() {
+		cs.logger.Info("skipping scheduled catalog synchronization, another one is running")
+		return
+	}
+	defer cs.running.Unlock()
+	cs.mu.Lock()
+	cs.isRunning = true
+	cs.mu.Unlock()
+	cs.run(ctx)
+}
+
+// run synchronizes the catalog and records the outcome. The caller must hold the running lock.
+func (cs *CatalogSyncer) run(ctx context.Context) {
+	syncRun := &app.CatalogSyncRun{StartedAt: time.Now().UTC()}
+	summary, err := cs.service.SyncProducts(ctx)
+	syncRun.FinishedAt = time.Now().UTC()
+	syncRun.Summary = summary
+
+	logger := cs.logger.With("duration", syncRun.FinishedAt.Sub(syncRun.StartedAt))
+	switch {
+	case errors.Is(err, catalogsource.ErrDisabled):
+		syncRun.Error = err.Error()
+		logger.Info("product catalog source disabled, skipping synchronization")
+	case err != nil:
+		syncRun.Error = err.Error()
+		logger.Error("could not synchronize products", "err", err)
+	default:
+		logger.Info("synchronized products", "created", summary.Created, "updated", summary.Updated,
+			"unchanged", summary.Unchanged, "discontinued", summary.Discontinued, "skipped", summary.Skipped)
+	}
+
+	cs.mu.Lock()
+	cs.isRunning = false
+	cs.lastRun = syncRun
+	cs.mu.Unlock()
+}
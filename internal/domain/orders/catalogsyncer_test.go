@@ -0,0 +1,101 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reviewbot/app"
+	"reviewbot/pkg/catalogsource"
+	"reviewbot/pkg/catalogsource/catalogsourcetypes"
+	"reviewbot/pkg/responsegenerator/dummygenerator"
+	"reviewbot/pkg/sentimentanalyzer/dummyanalyzer"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// blockingSource blocks every fetch until released and then reports the source as disabled.
+type blockingSource struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingSource) Fetch(ctx context.Context) ([]catalogsourcetypes.CatalogProduct, error) {
+	bs.started <- struct{}{}
+	select {
+	case <-bs.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return nil, catalogsource.ErrDisabled
+}
+
+func newTestCatalogSyncer(interval time.Duration) (*CatalogSyncer, *blockingSource) {
+	source := &blockingSource{started: make(chan struct{}, 1), release: make(chan struct{})}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewService(nil, dummygenerator.NewDummyGenerator(), dummyganalyzer.NewDummyAnalyzer(), source, logger)
+	return NewCatalogSyncer(service, interval, 0, logger), source
+}
+
+// TestCatalogSyncerPreventsOverlap tests that a synchronization cannot start while another one is running.
+func TestCatalogSyncerPreventsOverlap(t *testing.T) {
+	// Arrange
+	syncer, source := newTestCatalogSyncer(0)
+
+	// Act
+	if err := syncer.Trigger(); err != nil {
+		t.Fatalf("Error triggering synchronization: %v", err)
+	}
+	<-source.started
+	err := syncer.Trigger()
+	running := syncer.Status().Running
+	close(source.release)
+	syncer.wg.Wait()
+
+	// Assert
+	if !errors.Is(err, ErrCatalogSyncInProgress) {
+		t.Fatalf("Expected ErrCatalogSyncInProgress, got %v", err)
+	}
+	if !running {
+		t.Fatalf("Expected synchronization to be reported as running")
+	}
+	status := syncer.Status()
+	if status.Running {
+		t.Fatalf("Expected synchronization to be reported as finished")
+	}
+	if status.LastRun == nil || status.LastRun.Error != catalogsource.ErrDisabled.Error() {
+		t.Fatalf("Unexpected last run: %+v", status.LastRun)
+	}
+}
+
+// TestCatalogSyncerStopsOnCancel tests that Run returns once its context is cancelled.
+func TestCatalogSyncerStopsOnCancel(t *testing.T) {
+	// Arrange
+	syncer, source := newTestCatalogSyncer(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	// Act
+	go func() {
+		syncer.Run(ctx)
+		close(done)
+	}()
+	<-source.started
+	close(source.release)
+	cancel()
+
+	// Assert
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return after cancellation")
+	}
+	err := syncer.Trigger()
+	if err == nil {
+		t.Fatalf("Expected error triggering a stopped synchronization, got nil")
+	}
+	if code := app.ErrorCode(err); code != app.CodeUnavailable {
+		t.Fatalf("Code mismatch: got %q, want %q", code, app.CodeUnavailable)
+	}
+}
@@ -0,0 +1,183 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reviewbot/app"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxIdempotencyKeyLength is the length of the longest idempotency key accepted when creating an order.
+const MaxIdempotencyKeyLength = 255
+
+var (
+	// ErrInvalidOrder is returned when an order to create is not valid.
+	ErrInvalidOrder = app.NewCodedError(app.CodeInvalid, "invalid order", nil)
+	// ErrInsufficientStock is returned when an order asks for more items of a product than are available.
+	ErrInsufficientStock = app.NewCodedError(app.CodeConflict, "insufficient stock", nil)
+	// ErrIdempotencyKeyReused is returned when an idempotency key is reused for an order with other lines.
+	ErrIdempotencyKeyReused = app.NewCodedError(app.CodeUnprocessable, "idempotency key reused", nil)
+)
+
+// CreateOrder places an order of a customer for the given lines and takes the ordered items from the available
+// items of the products. Either the whole order is placed or nothing changes.
+// Retrying with the same non-empty idempotencyKey returns the order created by the first attempt instead of placing
+// another one, created reports whether the order was placed by this call. Reusing the key for other lines fails with
+// ErrIdempotencyKeyReused.
+func (s *Service) CreateOrder(ctx context.Context, customerUUID string, lines []app.OrderLine,
+	idempotencyKey string) (order *app.Order, created bool, err error) {
+	lines, err = validateOrderLines(customerUUID, lines, idempotencyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if idempotencyKey != "" {
+		order, err := s.orderByIdempotencyKey(ctx, customerUUID, idempotencyKey, lines)
+		if err == nil {
+			return order, false, nil
+		}
+		if !errors.Is(err, app.ErrNoRecords) {
+			return nil, false, err
+		}
+	}
+
+	err = s.repo.WithinTransaction(ctx, func(repo app.OrdersRepository) error {
+		customer, err := repo.GetCustomerByUUID(ctx, customerUUID)
+		if err != nil {
+			if errors.Is(err, app.ErrNoRecords) {
+				return app.NewError("The customer does not exist", ErrInvalidOrder)
+			}
+			return err
+		}
+		order = &app.Order{
+			UUID:       uuid.New().String(),
+			Customer:   *customer,
+			Status:     app.OrderStatusPlaced,
+			PlacedDate: time.Now().UTC().Truncate(time.Second),
+		}
+		if err := repo.AddOrder(ctx, *order, idempotencyKey); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if err := addOrderLine(ctx, repo, order.UUID, line); err != nil {
+				return err
+			}
+		}
+		// The placement is the first transition of the order, from no status to placed.
+		transition := app.OrderStatusTransition{
+			OrderUUID: order.UUID,
+			To:        app.OrderStatusPlaced,
+			Actor:     app.ActorFromContext(ctx),
+			CreatedAt: order.PlacedDate,
+		}
+		if err := repo.AddOrderStatusTransition(ctx, transition); err != nil {
+			return err
+		}
+		return addEvents(ctx, repo, statusChangeEvents(transition))
+	})
+	if errors.Is(err, errDuplicateIdempotencyKey) {
+		// A concurrent request with the same key placed the order first.
+		order, err := s.orderByIdempotencyKey(ctx, customerUUID, idempotencyKey, lines)
+		if err != nil {
+			return nil, false, err
+		}
+		return order, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return order, true, nil
+}
+
+// orderByIdempotencyKey gets the order a customer created with an idempotency key, or ErrIdempotencyKeyReused if
+// its lines differ from lines, which are validated.
+func (s *Service) orderByIdempotencyKey(ctx context.Context, customerUUID string, idempotencyKey string,
+	lines []app.OrderLine) (*app.Order, error) {
+	order, err := s.repo.GetOrderByIdempotencyKey(ctx, customerUUID, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	orderProducts, err := s.repo.GetOrderProductsByOrderUUID(ctx, order.UUID)
+	if err != nil {
+		return nil, err
+	}
+	itemsByProduct := make(map[string]int, len(orderProducts))
+	for _, orderProduct := range orderProducts {
+		itemsByProduct[orderProduct.ProductUUID] += orderProduct.Items
+	}
+	if len(itemsByProduct) != len(lines) {
+		return nil, app.NewError("The idempotency key was already used for an order of other products",
+			ErrIdempotencyKeyReused)
+	}
+	for _, line := range lines {
+		if itemsByProduct[line.ProductUUID] != line.Items {
+			return nil, app.NewError("The idempotency key was already used for an order of other products",
+				ErrIdempotencyKeyReused)
+		}
+	}
+	return order, nil
+}
+
+// addOrderLine reserves the items of a line and adds them to an order.
+func addOrderLine(ctx context.Context, repo app.OrdersRepository, orderUUID string, line app.OrderLine) error {
+	product, err := repo.GetProductByUUID(ctx, line.ProductUUID)
+	if err != nil {
+		if errors.Is(err, app.ErrNoRecords) {
+			return app.NewError(fmt.Sprintf("The product %s does not exist", line.ProductUUID), ErrInvalidOrder)
+		}
+		return err
+	}
+	if product.DiscontinuedAt != nil {
+		return app.NewError(fmt.Sprintf("The product %s is discontinued", line.ProductUUID), ErrInvalidOrder)
+	}
+	reserved, err := repo.ReserveProductItems(ctx, line.ProductUUID, line.Items)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return app.NewError(fmt.Sprintf("Only %d items of the product %s are available, %d were ordered",
+			product.AvailableItems, line.ProductUUID, line.Items), ErrInsufficientStock)
+	}
+	return repo.AddOrderProduct(ctx, app.OrderProduct{
+		UUID:        uuid.New().String(),
+		OrderUUID:   orderUUID,
+		ProductUUID: line.ProductUUID,
+		Items:       line.Items,
+	})
+}
+
+// validateOrderLines validates an order to create and returns its lines with one line per product, sorted by
+// product UUID so that concurrent orders reserve the items of their products in the same order.
+func validateOrderLines(customerUUID string, lines []app.OrderLine, idempotencyKey string) ([]app.OrderLine,
+	error) {
+	if customerUUID == "" {
+		return nil, app.NewError("The customer is required", ErrInvalidOrder)
+	}
+	if len(idempotencyKey) > MaxIdempotencyKeyLength {
+		return nil, app.NewError(fmt.Sprintf("The idempotency key must be at most %d characters long",
+			MaxIdempotencyKeyLength), ErrInvalidOrder)
+	}
+	if len(lines) == 0 {
+		return nil, app.NewError("The order must contain at least one product", ErrInvalidOrder)
+	}
+	itemsByProduct := make(map[string]int, len(lines))
+	for _, line := range lines {
+		if line.ProductUUID == "" {
+			return nil, app.NewError("Every ordered product needs a product uuid", ErrInvalidOrder)
+		}
+		if line.Items < 1 {
+			return nil, app.NewError(fmt.Sprintf("The items of the product %s must be a positive number",
+				line.ProductUUID), ErrInvalidOrder)
+		}
+		itemsByProduct[line.ProductUUID] += line.Items
+	}
+	merged := make([]app.OrderLine, 0, len(itemsByProduct))
+	for productUUID, items := range itemsByProduct {
+		merged = append(merged, app.OrderLine{ProductUUID: productUUID, Items: items})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ProductUUID < merged[j].ProductUUID })
+	return merged, nil
+}
@@ -0,0 +1,175 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"reviewbot/app"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var (
+	lookupKeyQuery = regexp.QuoteMeta("WHERE ((`o`.`customer_uuid` = 'cus1') AND (`o`.`idempotency_key` = 'key1'))")
+	customerQuery  = regexp.QuoteMeta("FROM `customers` WHERE (`uuid` = 'cus1') LIMIT 1")
+	insertOrder    = regexp.QuoteMeta("INSERT INTO `orders` (`uuid`, `customer_uuid`, `status`, `placed_date`, " +
+		"`idempotency_key`)")
+	orderProductsQuery = regexp.QuoteMeta("FROM `order_products` WHERE (`order_uuid` = 'ord1')")
+)
+
+var orderProductColumns = []string{"uuid", "order_uuid", "product_uuid", "items"}
+
+func customerRows() *sqlmock.Rows {
+	return sqlmock.NewRows(customerColumns).AddRow("cus1", "Jane", "Doe", "jane@example.com", "", time.Now())
+}
+
+func productRows(productUUID string, availableItems int) *sqlmock.Rows {
+	return sqlmock.NewRows(productColumnNames).
+		AddRow(productUUID, "Tyre", "", "", "available", availableItems, nil, "", "", "", nil)
+}
+
+// TestCreateOrderReservesStock tests that an order is stored with one line per product, takes the ordered items from
+// the stock, and records its placement in the status history and the outbox, all in one transaction.
+func TestCreateOrderReservesStock(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	mock.ExpectQuery(lookupKeyQuery).WillReturnRows(sqlmock.NewRows(orderColumns))
+	mock.ExpectBegin()
+	mock.ExpectQuery(customerQuery).WillReturnRows(customerRows())
+	mock.ExpectExec(insertOrder + ".*'cus1', 'placed', .*'key1'").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE (`uuid` = 'prod1')")).
+		WillReturnRows(productRows("prod1", 10))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `products` SET `available_items`=`available_items` - 3 " +
+		"WHERE ((`uuid` = 'prod1') AND (`available_items` >= 3))")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_products`") + ".*'prod1', 3\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE (`uuid` = 'prod2')")).
+		WillReturnRows(productRows("prod2", 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `products` SET `available_items`=`available_items` - 1 " +
+		"WHERE ((`uuid` = 'prod2') AND (`available_items` >= 1))")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_products`") + ".*'prod2', 1\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_status_history`") + ".*'', 'placed'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertOutboxQuery + ".*'order.status_changed'").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Act
+	order, created, err := service.CreateOrder(context.Background(), "cus1", []app.OrderLine{
+		{ProductUUID: "prod2", Items: 1}, {ProductUUID: "prod1", Items: 2}, {ProductUUID: "prod1", Items: 1},
+	}, "key1")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error creating order: %v", err)
+	}
+	if !created || order.Status != app.OrderStatusPlaced {
+		t.Fatalf("Order mismatch: got created %v with status %s, want created with status %s", created,
+			order.Status, app.OrderStatusPlaced)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCreateOrderInsufficientStock tests that nothing is stored when a product lacks the ordered items.
+func TestCreateOrderInsufficientStock(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(customerQuery).WillReturnRows(customerRows())
+	mock.ExpectExec(insertOrder).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE (`uuid` = 'prod1')")).
+		WillReturnRows(productRows("prod1", 2))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `products` SET")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	// Act
+	_, _, err := service.CreateOrder(context.Background(), "cus1",
+		[]app.OrderLine{{ProductUUID: "prod1", Items: 3}}, "")
+	// Assert
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCreateOrderReplaysIdempotencyKey tests that retrying with the same idempotency key returns the first order.
+func TestCreateOrderReplaysIdempotencyKey(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	mock.ExpectQuery(lookupKeyQuery).WillReturnRows(sqlmock.NewRows(orderColumns).
+		AddRow("ord1", "placed", time.Now(), "cus1", "Jane", "Doe", "jane@example.com", "", time.Now()))
+	mock.ExpectQuery(orderProductsQuery).WillReturnRows(sqlmock.NewRows(orderProductColumns).
+		AddRow("op1", "ord1", "prod1", 3))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE (`uuid` = 'prod1')")).
+		WillReturnRows(productRows("prod1", 10))
+
+	// Act
+	order, created, err := service.CreateOrder(context.Background(), "cus1",
+		[]app.OrderLine{{ProductUUID: "prod1", Items: 2}, {ProductUUID: "prod1", Items: 1}}, "key1")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error creating order: %v", err)
+	}
+	if created || order.UUID != "ord1" {
+		t.Fatalf("Order mismatch: got %s created %v, want the existing %s", order.UUID, created, "ord1")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCreateOrderRejectsReusedIdempotencyKey tests that an idempotency key used for an order cannot place an order
+// of other products or items.
+func TestCreateOrderRejectsReusedIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []app.OrderLine
+	}{
+		{name: "other items", lines: []app.OrderLine{{ProductUUID: "prod1", Items: 2}}},
+		{name: "other product", lines: []app.OrderLine{{ProductUUID: "prod2", Items: 3}}},
+		{name: "more products", lines: []app.OrderLine{{ProductUUID: "prod1", Items: 3},
+			{ProductUUID: "prod2", Items: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, repo, mock := newTestDatabase(t)
+			defer db.Close()
+			service := newTestService(repo)
+
+			mock.ExpectQuery(lookupKeyQuery).WillReturnRows(sqlmock.NewRows(orderColumns).
+				AddRow("ord1", "placed", time.Now(), "cus1", "Jane", "Doe", "jane@example.com", "", time.Now()))
+			mock.ExpectQuery(orderProductsQuery).WillReturnRows(sqlmock.NewRows(orderProductColumns).
+				AddRow("op1", "ord1", "prod1", 3))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE (`uuid` = 'prod1')")).
+				WillReturnRows(productRows("prod1", 10))
+
+			// Act
+			_, _, err := service.CreateOrder(context.Background(), "cus1", tt.lines, "key1")
+			// Assert
+			if !errors.Is(err, ErrIdempotencyKeyReused) {
+				t.Fatalf("Expected ErrIdempotencyKeyReused, got %v", err)
+			}
+			if app.ErrorCode(err) != app.CodeUnprocessable {
+				t.Fatalf("Code mismatch: got %s, want %s", app.ErrorCode(err), app.CodeUnprocessable)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package orders
+
+import (
+	"context"
+	"reviewbot/app"
+	"strings"
+)
+
+// CustomerProfile gets a customer by its UUID along with their review statistics.
+func (s *Service) CustomerProfile(ctx context.Context, customerUUID string) (*app.CustomerProfile, error) {
+	customer, err := s.repo.GetCustomerByUUID(ctx, customerUUID)
+	if err != nil {
+		return nil, err
+	}
+	return s.customerProfile(ctx, customer)
+}
+
+// CustomerProfileByEmail gets a customer by their email address along with their review statistics.
+// Addresses are matched regardless of surrounding spaces.
+func (s *Service) CustomerProfileByEmail(ctx context.Context, email string) (*app.CustomerProfile, error) {
+	customer, err := s.repo.GetCustomerByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		return nil, err
+	}
+	return s.customerProfile(ctx, customer)
+}
+
+// CustomerOrders gets a customer by its UUID along with their review statistics and a page of their orders matching
+// query, listed as by Orders. cursor is the NextCursor of the previous page, empty for the first page.
+func (s *Service) CustomerOrders(ctx context.Context, customerUUID string, query app.OrderQuery,
+	cursor string) (*app.CustomerProfile, *app.OrderPage, error) {
+	profile, err := s.CustomerProfile(ctx, customerUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	query.CustomerUUID = customerUUID
+	page, err := s.Orders(ctx, query, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	return profile, page, nil
+}
+
+func (s *Service) customerProfile(ctx context.Context, customer *app.Customer) (*app.CustomerProfile, error) {
+	stats, err := s.repo.GetCustomerReviewStats(ctx, customer.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return &app.CustomerProfile{Customer: *customer, ReviewStats: *stats}, nil
+}
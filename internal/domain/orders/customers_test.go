@@ -0,0 +1,115 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"reviewbot/app"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var customerColumns = []string{"uuid", "first_name", "last_name", "email", "phone_number", "registration_date"}
+
+// TestCustomerProfileByEmail tests that a customer found by email comes with their review participation and
+// average sentiment.
+func TestCustomerProfileByEmail(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `customers` WHERE (`email` = 'jane@example.com') LIMIT 1")).
+		WillReturnRows(sqlmock.NewRows(customerColumns).
+			AddRow("cus1", "Jane", "Doe", "jane@example.com", "+1234567890", time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(SUM((`status` IN ('completed', 'reviewed'))), 0), " +
+		"COALESCE(SUM((`status` = 'reviewed')), 0) FROM `orders` WHERE (`customer_uuid` = 'cus1')")).
+		WillReturnRows(sqlmock.NewRows([]string{"reviewable", "reviewed"}).AddRow(4, 3))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `order_product_reviews` AS `r`") + ".*" +
+		regexp.QuoteMeta("WHERE (`o`.`customer_uuid` = 'cus1')")).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "sum"}).AddRow(5, -2))
+
+	// Act
+	profile, err := service.CustomerProfileByEmail(context.Background(), " jane@example.com ")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error getting customer: %v", err)
+	}
+	if profile.Customer.UUID != "cus1" {
+		t.Fatalf("Customer UUID mismatch: got %s, want %s", profile.Customer.UUID, "cus1")
+	}
+	if rate := profile.ReviewStats.ParticipationRate(); rate != 0.75 {
+		t.Fatalf("Participation rate mismatch: got %v, want %v", rate, 0.75)
+	}
+	if sentiment := profile.ReviewStats.AverageSentiment(); sentiment != -0.4 {
+		t.Fatalf("Average sentiment mismatch: got %v, want %v", sentiment, -0.4)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCustomerOrdersUnknownCustomer tests that listing the orders of a missing customer is reported as not found.
+func TestCustomerOrdersUnknownCustomer(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `customers` WHERE (`uuid` = 'cus1') LIMIT 1")).
+		WillReturnRows(sqlmock.NewRows(customerColumns))
+
+	// Act
+	_, _, err := service.CustomerOrders(context.Background(), "cus1", app.OrderQuery{}, "")
+	// Assert
+	if !errors.Is(err, app.ErrNoRecords) {
+		t.Fatalf("Expected app.ErrNoRecords, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCustomerOrdersPaginates tests that the orders of a customer are listed a page at a time, as the listing of all
+// orders restricted to the customer.
+func TestCustomerOrdersPaginates(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	placedDate := time.Date(2023, 12, 12, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `customers` WHERE (`uuid` = 'cus1') LIMIT 1")).
+		WillReturnRows(sqlmock.NewRows(customerColumns).
+			AddRow("cus1", "Jane", "Doe", "jane@example.com", "+1234567890", placedDate))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `orders` WHERE (`customer_uuid` = 'cus1')")).
+		WillReturnRows(sqlmock.NewRows([]string{"reviewable", "reviewed"}).AddRow(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `order_product_reviews` AS `r`")).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "sum"}).AddRow(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `orders` AS `o` INNER JOIN `customers` AS `c`") + ".*" +
+		regexp.QuoteMeta("WHERE (`o`.`customer_uuid` = 'cus1') ORDER BY `o`.`placed_date` DESC, `o`.`uuid` DESC "+
+			"LIMIT 2")).
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow("ord2", "sending", placedDate, "cus1", "Jane", "Doe", "jane@example.com", "", placedDate).
+			AddRow("ord1", "sending", placedDate, "cus1", "Jane", "Doe", "jane@example.com", "", placedDate))
+
+	// Act
+	profile, page, err := service.CustomerOrders(context.Background(), "cus1",
+		app.OrderQuery{CustomerUUID: "cus2", Limit: 1}, "")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error listing customer orders: %v", err)
+	}
+	if profile.Customer.UUID != "cus1" {
+		t.Fatalf("Customer UUID mismatch: got %s, want %s", profile.Customer.UUID, "cus1")
+	}
+	if len(page.Orders) != 1 || page.NextCursor == "" {
+		t.Fatalf("Page mismatch: got %d orders and cursor %q, want %d and a cursor", len(page.Orders),
+			page.NextCursor, 1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -7,13 +7,36 @@ import (
 	"fmt"
 	"github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"reviewbot/app"
+	"reviewbot/internal/database"
+	"strings"
 	"time"
 )
 
+const (
+	// mysqlErrDuplicateEntry is the MySQL error raised when an insert violates a unique key.
+	mysqlErrDuplicateEntry = 1062
+	// mysqlErrRowIsReferenced is the MySQL error raised when deleting a row a foreign key still references.
+	mysqlErrRowIsReferenced = 1451
+)
+
+// errDuplicateIdempotencyKey is returned by AddOrder when the customer already created an order with the key.
+var errDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+
+// productColumns are the columns a ProductStore is scanned from by scanProductStore. The nullable ones are read
+// as their zero value.
+var productColumns = []any{"uuid", "name", goqu.COALESCE(goqu.C("description"), ""),
+	goqu.COALESCE(goqu.C("image"), ""), goqu.COALESCE(goqu.C("availability_status"), ""),
+	goqu.COALESCE(goqu.C("available_items"), 0), "created_at", goqu.COALESCE(goqu.C("manufacturer"), ""),
+	goqu.COALESCE(goqu.C("vehicle"), ""), goqu.COALESCE(goqu.C("id"), ""), "discontinued_at"}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // CustomerStore represents a customer entity at the Database.
 type CustomerStore struct {
 	UUID             string
@@ -31,6 +54,17 @@ type OrderStore struct {
 	CustomerUUID string
 	Status       string
 	PlacedDate   time.Time
+	Version      int
+}
+
+// OrderStatusTransitionStore represents an order status transition entity at the Database.
+type OrderStatusTransitionStore struct {
+	UUID       string
+	OrderUUID  string
+	FromStatus string
+	ToStatus   string
+	Actor      string
+	CreatedAt  time.Time
 }
 
 // OrderProductStore represents an order product entity at the Database.
@@ -50,22 +84,59 @@ type ProductStore struct {
 	Image              string
 	AvailabilityStatus string
 	AvailableItems     int
-	CreatedAt          time.Time `json:"createdAt"`
-	Manufacturer       string    `json:"manufacturer"`
-	Vehicle            string    `json:"vehicle"`
-	ID                 string    `json:"id"`
+	CreatedAt          sql.NullTime `json:"createdAt"`
+	Manufacturer       string       `json:"manufacturer"`
+	Vehicle            string       `json:"vehicle"`
+	ID                 string       `json:"id"`
+	DiscontinuedAt     sql.NullTime
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanProductStore reads a row selected with productColumns into productStore.
+func scanProductStore(row rowScanner, productStore *ProductStore) error {
+	return row.Scan(&productStore.UUID, &productStore.Name, &productStore.Description, &productStore.Image,
+		&productStore.AvailabilityStatus, &productStore.AvailableItems, &productStore.CreatedAt,
+		&productStore.Manufacturer, &productStore.Vehicle, &productStore.ID, &productStore.DiscontinuedAt)
+}
+
+// dbExecutor is the subset of database methods shared by *sqlx.DB and *sqlx.Tx, so the repository queries
+// can run either directly on the connection pool or inside a transaction.
+type dbExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 // DatabaseRepository implements the OrdersRepository interface.
 type DatabaseRepository struct {
-	db *sqlx.DB
+	conn *sqlx.DB
+	db   dbExecutor
+	inTx bool
 }
 
 // NewDatabaseRepository returns a new DatabaseRepository.
 func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
 	return &DatabaseRepository{
-		db: db,
+		conn: db,
+		db:   db,
+	}
+}
+
+// WithinTransaction runs fn inside a single database transaction. The repository passed to fn executes all of its
+// queries in that transaction, which is committed if fn returns nil and rolled back otherwise.
+// Calling WithinTransaction on a repository that is already bound to a transaction reuses it.
+func (ds *DatabaseRepository) WithinTransaction(ctx context.Context, fn func(repo app.OrdersRepository) error) error {
+	if ds.inTx {
+		return fn(ds)
 	}
+
+	return database.WithinTransaction(ctx, ds.conn, func(tx *sqlx.Tx) error {
+		return fn(&DatabaseRepository{conn: ds.conn, db: tx, inTx: true})
+	})
 }
 
 // OrderStoreToOrder converts an OrderStore object to an app.Order
@@ -75,6 +146,21 @@ func (ds *DatabaseRepository) OrderStoreToOrder(orderStore OrderStore, customerS
 		Customer:   ds.CustomerStoreToCustomer(customerStore),
 		Status:     app.OrderStatus(orderStore.Status),
 		PlacedDate: orderStore.PlacedDate,
+		Version:    orderStore.Version,
+	}
+}
+
+// OrderStatusTransitionStoreToOrderStatusTransition converts an OrderStatusTransitionStore object to an
+// app.OrderStatusTransition
+func (ds *DatabaseRepository) OrderStatusTransitionStoreToOrderStatusTransition(
+	transitionStore OrderStatusTransitionStore) app.OrderStatusTransition {
+	return app.OrderStatusTransition{
+		UUID:      transitionStore.UUID,
+		OrderUUID: transitionStore.OrderUUID,
+		From:      app.OrderStatus(transitionStore.FromStatus),
+		To:        app.OrderStatus(transitionStore.ToStatus),
+		Actor:     transitionStore.Actor,
+		CreatedAt: transitionStore.CreatedAt,
 	}
 }
 
@@ -96,7 +182,7 @@ func (ds *DatabaseRepository) OrderProductStoreToOrderProduct(orderProductStore
 	return app.OrderProduct{
 		UUID:        orderProductStore.UUID,
 		OrderUUID:   orderProductStore.OrderUUID,
-		ProductUUID: orderProductStore.CustomerUUID,
+		ProductUUID: orderProductStore.ProductUUID,
 		Items:       orderProductStore.Items,
 		Product:     ds.ProductStoreToProduct(productStore),
 	}
@@ -104,20 +190,28 @@ func (ds *DatabaseRepository) OrderProductStoreToOrderProduct(orderProductStore
 
 // ProductStoreToProduct converts ProductStore object to an app.Product
 func (ds *DatabaseRepository) ProductStoreToProduct(productStore ProductStore) app.Product {
-	return app.Product{
+	product := app.Product{
 		UUID:               productStore.UUID,
 		Name:               productStore.Name,
 		Description:        productStore.Description,
 		Image:              productStore.Image,
 		AvailabilityStatus: productStore.AvailabilityStatus,
 		AvailableItems:     productStore.AvailableItems,
+		CreatedAt:          productStore.CreatedAt.Time,
+		Manufacturer:       productStore.Manufacturer,
+		Vehicle:            productStore.Vehicle,
+		ID:                 productStore.ID,
+	}
+	if productStore.DiscontinuedAt.Valid {
+		product.DiscontinuedAt = &productStore.DiscontinuedAt.Time
 	}
+	return product
 }
 
 // GetOrderByUUID retrieves from storage an order by its UUID.
 func (ds *DatabaseRepository) GetOrderByUUID(ctx context.Context, orderUUID string) (*app.Order, error) {
 	dialect := goqu.Dialect("mysql")
-	sqlQuery, _, err := dialect.Select("uuid", "customer_uuid", "status", "placed_date").
+	sqlQuery, _, err := dialect.Select("uuid", "customer_uuid", "status", "placed_date", "version").
 		From("orders").Where(goqu.C("uuid").Eq(orderUUID)).ToSQL()
 	if err != nil {
 		return nil, app.NewError("Error while preparing querying for order",
@@ -126,7 +220,7 @@ func (ds *DatabaseRepository) GetOrderByUUID(ctx context.Context, orderUUID stri
 
 	orderStore := new(OrderStore)
 	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&orderStore.UUID, &orderStore.CustomerUUID,
-		&orderStore.Status, &orderStore.PlacedDate)
+		&orderStore.Status, &orderStore.PlacedDate, &orderStore.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, app.NewError("Order does not exist", app.ErrNoRecords)
@@ -155,13 +249,244 @@ func (ds *DatabaseRepository) GetOrderByUUID(ctx context.Context, orderUUID stri
 	return &order, nil
 }
 
-// UpdateOrderStatusByOrderUUID updates an order's status by its UUID.
+// GetOrders retrieves from storage the orders matching query. The listing continues after query.After, if set.
+func (ds *DatabaseRepository) GetOrders(ctx context.Context, query app.OrderQuery) ([]app.Order, error) {
+	orders := selectOrders().Limit(uint(query.Limit))
+	if len(query.Statuses) > 0 {
+		orders = orders.Where(goqu.I("o.status").In(query.Statuses))
+	}
+	if query.CustomerUUID != "" {
+		orders = orders.Where(goqu.I("o.customer_uuid").Eq(query.CustomerUUID))
+	}
+	if !query.From.IsZero() {
+		orders = orders.Where(goqu.I("o.placed_date").Gte(query.From))
+	}
+	if !query.To.IsZero() {
+		orders = orders.Where(goqu.I("o.placed_date").Lt(query.To))
+	}
+
+	placedDate, uuidColumn := goqu.I("o.placed_date"), goqu.I("o.uuid")
+	if query.Sort == app.OrderSortOldest {
+		orders = orders.Order(placedDate.Asc(), uuidColumn.Asc())
+		if after := query.After; after != nil {
+			orders = orders.Where(goqu.Or(placedDate.Gt(after.PlacedDate),
+				goqu.And(placedDate.Eq(after.PlacedDate), uuidColumn.Gt(after.UUID))))
+		}
+	} else {
+		orders = orders.Order(placedDate.Desc(), uuidColumn.Desc())
+		if after := query.After; after != nil {
+			orders = orders.Where(goqu.Or(placedDate.Lt(after.PlacedDate),
+				goqu.And(placedDate.Eq(after.PlacedDate), uuidColumn.Lt(after.UUID))))
+		}
+	}
+	return ds.getOrders(ctx, orders)
+}
+
+// selectOrders selects the orders along with their customer, as read by getOrders.
+func selectOrders() *goqu.SelectDataset {
+	return goqu.Dialect("mysql").Select("o.uuid", "o.status", "o.placed_date", "c.uuid", "c.first_name",
+		"c.last_name", "c.email", "c.phone_number", "c.registration_date").
+		From(goqu.T("orders").As("o")).
+		Join(goqu.T("customers").As("c"), goqu.On(goqu.I("c.uuid").Eq(goqu.I("o.customer_uuid"))))
+}
+
+func (ds *DatabaseRepository) getOrders(ctx context.Context, orders *goqu.SelectDataset) ([]app.Order, error) {
+	sqlQuery, _, err := orders.ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for orders", fmt.Errorf("get orders: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting orders", fmt.Errorf("get orders: %w", err))
+	}
+	defer rows.Close()
+	result := []app.Order{}
+	for rows.Next() {
+		var orderStore OrderStore
+		var customerStore CustomerStore
+		if err := rows.Scan(&orderStore.UUID, &orderStore.Status, &orderStore.PlacedDate, &customerStore.UUID,
+			&customerStore.FirstName, &customerStore.LastName, &customerStore.Email, &customerStore.PhoneNumber,
+			&customerStore.RegistrationDate); err != nil {
+			return nil, app.NewError("Error while reading orders", fmt.Errorf("get orders: %w", err))
+		}
+		result = append(result, ds.OrderStoreToOrder(orderStore, customerStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading orders", fmt.Errorf("get orders: %w", err))
+	}
+
+	return result, nil
+}
+
+// GetCustomerByUUID retrieves from storage a customer by its UUID.
+func (ds *DatabaseRepository) GetCustomerByUUID(ctx context.Context, customerUUID string) (*app.Customer, error) {
+	return ds.getCustomer(ctx, goqu.C("uuid").Eq(customerUUID))
+}
+
+// GetCustomerByEmail retrieves from storage a customer by their email address.
+func (ds *DatabaseRepository) GetCustomerByEmail(ctx context.Context, email string) (*app.Customer, error) {
+	return ds.getCustomer(ctx, goqu.C("email").Eq(email))
+}
+
+func (ds *DatabaseRepository) getCustomer(ctx context.Context, where exp.Expression) (*app.Customer, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "first_name", "last_name", "email", "phone_number", "registration_date").
+		From("customers").Where(where).Limit(1).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for customer", fmt.Errorf("get customer: %w", err))
+	}
+
+	customerStore := new(CustomerStore)
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&customerStore.UUID, &customerStore.FirstName,
+		&customerStore.LastName, &customerStore.Email, &customerStore.PhoneNumber, &customerStore.RegistrationDate)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, app.NewError("Customer does not exist", app.ErrNoRecords)
+		}
+		return nil, app.NewError("Error while getting customer", fmt.Errorf("get customer: %w", err))
+	}
+
+	customer := ds.CustomerStoreToCustomer(*customerStore)
+	return &customer, nil
+}
+
+// GetCustomerReviewStats retrieves from storage how many orders a customer could review and reviewed, and the
+// number and total score of their reviews.
+func (ds *DatabaseRepository) GetCustomerReviewStats(ctx context.Context,
+	customerUUID string) (*app.CustomerReviewStats, error) {
+	dialect := goqu.Dialect("mysql")
+	ordersQuery, _, err := dialect.Select(
+		goqu.COALESCE(goqu.SUM(goqu.C("status").In(app.OrderStatusCompleted, app.OrderStatusReviewed)), 0),
+		goqu.COALESCE(goqu.SUM(goqu.C("status").Eq(app.OrderStatusReviewed)), 0)).
+		From("orders").Where(goqu.C("customer_uuid").Eq(customerUUID)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for customer review stats",
+			fmt.Errorf("get customer review stats: %w", err))
+	}
+	reviewsQuery, _, err := dialect.Select(goqu.COUNT(goqu.Star()),
+		goqu.COALESCE(goqu.SUM(goqu.I("r.score")), 0)).
+		From(goqu.T("order_product_reviews").As("r")).
+		Join(goqu.T("order_products").As("op"), goqu.On(goqu.I("op.uuid").Eq(goqu.I("r.order_product_uuid")))).
+		Join(goqu.T("orders").As("o"), goqu.On(goqu.I("o.uuid").Eq(goqu.I("op.order_uuid")))).
+		Where(goqu.I("o.customer_uuid").Eq(customerUUID)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for customer review stats",
+			fmt.Errorf("get customer review stats: %w", err))
+	}
+
+	stats := app.CustomerReviewStats{}
+	err = ds.db.QueryRowContext(ctx, ordersQuery).Scan(&stats.ReviewableOrderCount, &stats.ReviewedOrderCount)
+	if err != nil {
+		return nil, app.NewError("Error while getting customer review stats",
+			fmt.Errorf("get customer review stats: %w", err))
+	}
+	err = ds.db.QueryRowContext(ctx, reviewsQuery).Scan(&stats.ReviewCount, &stats.ScoreSum)
+	if err != nil {
+		return nil, app.NewError("Error while getting customer review stats",
+			fmt.Errorf("get customer review stats: %w", err))
+	}
+
+	return &stats, nil
+}
+
+// GetOrderByIdempotencyKey retrieves from storage the order a customer created with an idempotency key.
+func (ds *DatabaseRepository) GetOrderByIdempotencyKey(ctx context.Context, customerUUID string,
+	idempotencyKey string) (*app.Order, error) {
+	orders, err := ds.getOrders(ctx, selectOrders().Where(goqu.I("o.customer_uuid").Eq(customerUUID),
+		goqu.I("o.idempotency_key").Eq(idempotencyKey)))
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, app.NewError("Order does not exist", app.ErrNoRecords)
+	}
+	return &orders[0], nil
+}
+
+// AddOrder stores an order of order.Customer. A non-empty idempotencyKey must not have been used by the customer
+// for another order.
+func (ds *DatabaseRepository) AddOrder(ctx context.Context, order app.Order, idempotencyKey string) error {
+	var key any
+	if idempotencyKey != "" {
+		key = idempotencyKey
+	}
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("orders").Cols("uuid", "customer_uuid", "status", "placed_date",
+		"idempotency_key").Vals(goqu.Vals{order.UUID, order.Customer.UUID, string(order.Status), order.PlacedDate,
+		key}).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for order", fmt.Errorf("insert order: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+			return app.NewError("An order was already created with this idempotency key", errDuplicateIdempotencyKey)
+		}
+		return app.NewError("Error while inserting order", fmt.Errorf("insert order: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while inserting order", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// AddOrderProduct stores a product of an order.
+func (ds *DatabaseRepository) AddOrderProduct(ctx context.Context, orderProduct app.OrderProduct) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("order_products").Cols("uuid", "order_uuid", "product_uuid", "items").
+		Vals(goqu.Vals{orderProduct.UUID, orderProduct.OrderUUID, orderProduct.ProductUUID, orderProduct.Items}).
+		ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for order product",
+			fmt.Errorf("insert order product: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while inserting order product", fmt.Errorf("insert order product: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while inserting order product", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// ReserveProductItems takes items from the available items of a product in a single conditional update, so
+// concurrent orders cannot take more items than available. It reports false if fewer items are available or the
+// product does not exist.
+func (ds *DatabaseRepository) ReserveProductItems(ctx context.Context, productUUID string, items int) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("products").
+		Set(goqu.Record{"available_items": goqu.L("`available_items` - ?", items)}).
+		Where(goqu.C("uuid").Eq(productUUID), goqu.C("available_items").Gte(items)).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing update for product stock",
+			fmt.Errorf("reserve product items: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while updating product stock", fmt.Errorf("reserve product items: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while updating product stock", fmt.Errorf("reserve product items: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// UpdateOrderStatusByOrderUUID updates an order's status by its UUID and increments its version.
 func (ds *DatabaseRepository) UpdateOrderStatusByOrderUUID(ctx context.Context, orderUUID string,
 	orderStatus string) error {
 	dialect := goqu.Dialect("mysql")
 
-	sqlQuery, _, err := dialect.Update("orders").Set(goqu.Record{"status": orderStatus}).
-		Where(goqu.C("uuid").Eq(orderUUID)).ToSQL()
+	sqlQuery, _, err := dialect.Update("orders").Set(goqu.Record{
+		"status":  orderStatus,
+		"version": goqu.L("`version` + 1"),
+	}).Where(goqu.C("uuid").Eq(orderUUID)).ToSQL()
 	if err != nil {
 		return app.NewError("Error while preparing update for order",
 			fmt.Errorf("update order by uuid: %w", err))
@@ -177,14 +502,121 @@ func (ds *DatabaseRepository) UpdateOrderStatusByOrderUUID(ctx context.Context,
 	return nil
 }
 
-// AddOrderProductReviewByOrderProductUUID adds an order's product review by its UUID.
-func (ds *DatabaseRepository) AddOrderProductReviewByOrderProductUUID(ctx context.Context, orderProductUUID string,
-	reviewScore int64) error {
+// GetOrderStatusForUpdate retrieves from storage an order's status and version by its UUID and locks the order's row
+// until the surrounding transaction ends. Outside a transaction the lock is released immediately.
+func (ds *DatabaseRepository) GetOrderStatusForUpdate(ctx context.Context, orderUUID string) (app.OrderStatus, int,
+	error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("status", "version").From("orders").Where(goqu.C("uuid").Eq(orderUUID)).
+		ForUpdate(exp.Wait).ToSQL()
+	if err != nil {
+		return "", 0, app.NewError("Error while preparing querying for order status",
+			fmt.Errorf("get status by uuid: %w", err))
+	}
+
+	var status string
+	var version int
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&status, &version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", 0, app.NewError("Order does not exist", app.ErrNoRecords)
+		}
+		return "", 0, app.NewError("Error while getting order status", fmt.Errorf("get status by uuid: %w", err))
+	}
+
+	return app.OrderStatus(status), version, nil
+}
+
+// AddOrderStatusTransition stores an order status transition.
+func (ds *DatabaseRepository) AddOrderStatusTransition(ctx context.Context,
+	transition app.OrderStatusTransition) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("order_status_history").Cols("uuid", "order_uuid", "from_status",
+		"to_status", "actor", "created_at").Vals(goqu.Vals{uuid.New().String(), transition.OrderUUID,
+		string(transition.From), string(transition.To), transition.Actor, transition.CreatedAt}).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for order status transition",
+			fmt.Errorf("insert status transition: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while inserting order status transition",
+			fmt.Errorf("insert status transition: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while inserting order status transition", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// AddOutboxEvent stores a domain event in the outbox, to be published by the outbox relay. Called within a
+// transaction, the event is only stored if the change it describes is committed.
+func (ds *DatabaseRepository) AddOutboxEvent(ctx context.Context, event app.Event) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("outbox_events").Cols("event_id", "event_type", "payload", "occurred_at",
+		"status", "attempts", "next_attempt_at").Vals(goqu.Vals{event.ID, event.Type, []byte(event.Data),
+		event.OccurredAt, string(app.OutboxEventStatusPending), 0, event.OccurredAt}).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for outbox event",
+			fmt.Errorf("insert outbox event: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while inserting outbox event", fmt.Errorf("insert outbox event: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while inserting outbox event", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// GetOrderStatusTransitionsByOrderUUID retrieves from storage an order's status transitions, oldest first.
+func (ds *DatabaseRepository) GetOrderStatusTransitionsByOrderUUID(ctx context.Context,
+	orderUUID string) ([]app.OrderStatusTransition, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "order_uuid", "from_status", "to_status", "actor", "created_at").
+		From("order_status_history").Where(goqu.C("order_uuid").Eq(orderUUID)).
+		Order(goqu.C("created_at").Asc(), goqu.C("uuid").Asc()).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for order status history",
+			fmt.Errorf("get status history by uuid: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting order status history",
+			fmt.Errorf("get status history by uuid: %w", err))
+	}
+	defer rows.Close()
+	transitions := []app.OrderStatusTransition{}
+	for rows.Next() {
+		var transitionStore OrderStatusTransitionStore
+		if err := rows.Scan(&transitionStore.UUID, &transitionStore.OrderUUID, &transitionStore.FromStatus,
+			&transitionStore.ToStatus, &transitionStore.Actor, &transitionStore.CreatedAt); err != nil {
+			return nil, app.NewError("Error while reading order status history",
+				fmt.Errorf("get status history by uuid: %w", err))
+		}
+		transitions = append(transitions, ds.OrderStatusTransitionStoreToOrderStatusTransition(transitionStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading order status history",
+			fmt.Errorf("get status history by uuid: %w", err))
+	}
+
+	return transitions, nil
+}
+
+// AddOrderProductReviewByOrderProductUUID adds an order's product review by its UUID and adds it to the review
+// totals of the product. Called within a transaction, the totals only change if the review is committed.
+func (ds *DatabaseRepository) AddOrderProductReviewByOrderProductUUID(ctx context.Context,
+	review app.OrderProductReview) error {
 	dialect := goqu.Dialect("mysql")
 
 	sqlQuery, _, err := dialect.Insert("order_product_reviews").Cols("uuid", "order_product_uuid",
-		"score").Vals(goqu.Vals{uuid.New().String(), orderProductUUID, reviewScore}).ToSQL()
-	fmt.Println(sqlQuery)
+		"score", "text", "created_at").Vals(goqu.Vals{uuid.New().String(), review.OrderProductUUID, review.Score,
+		review.Text, review.CreatedAt}).ToSQL()
 	if err != nil {
 		return app.NewError("Error while preparing insert for review",
 			fmt.Errorf("insert review by uuid: %w", err))
@@ -197,6 +629,62 @@ func (ds *DatabaseRepository) AddOrderProductReviewByOrderProductUUID(ctx contex
 		return app.NewError("Error while inserting order product review", app.ErrNoRecords)
 	}
 
+	return ds.addReviewToProductStats(ctx, review)
+}
+
+// addReviewToProductStats adds a review to the overall and daily review totals of the reviewed product.
+// The upserts increment the totals atomically, so concurrent reviews of a product are all counted.
+func (ds *DatabaseRepository) addReviewToProductStats(ctx context.Context, review app.OrderProductReview) error {
+	dialect := goqu.Dialect("mysql")
+	product := goqu.C("uuid").Eq(review.OrderProductUUID)
+	sentiment := app.SentimentOf(review.Score)
+	counts := map[string]int{"positive_count": 0, "neutral_count": 0, "negative_count": 0}
+	counts[string(sentiment)+"_count"] = 1
+	stars := fmt.Sprintf("star_%d", app.StarsOf(review.Score))
+
+	cols := []any{"product_uuid", "review_count", "score_sum", "positive_count", "neutral_count", "negative_count",
+		stars, "last_review_at"}
+	vals := []any{goqu.C("product_uuid"), goqu.V(1), goqu.V(review.Score), goqu.V(counts["positive_count"]),
+		goqu.V(counts["neutral_count"]), goqu.V(counts["negative_count"]), goqu.V(1), goqu.V(review.CreatedAt)}
+	sqlQuery, _, err := dialect.Insert("product_review_stats").Cols(cols...).
+		FromQuery(dialect.Select(vals...).From("order_products").Where(product)).
+		OnConflict(goqu.DoUpdate("product_uuid", goqu.Record{
+			"review_count":   goqu.L("`review_count` + 1"),
+			"score_sum":      goqu.L("`score_sum` + ?", review.Score),
+			"positive_count": goqu.L("`positive_count` + ?", counts["positive_count"]),
+			"neutral_count":  goqu.L("`neutral_count` + ?", counts["neutral_count"]),
+			"negative_count": goqu.L("`negative_count` + ?", counts["negative_count"]),
+			stars:            goqu.L("? + 1", goqu.C(stars)),
+			"last_review_at": goqu.L("GREATEST(COALESCE(`last_review_at`, ?), ?)", review.CreatedAt,
+				review.CreatedAt),
+		})).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for product review stats",
+			fmt.Errorf("add review to product stats: %w", err))
+	}
+	if _, err := ds.db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while updating product review stats",
+			fmt.Errorf("add review to product stats: %w", err))
+	}
+
+	day := review.CreatedAt.UTC().Truncate(24 * time.Hour)
+	sqlQuery, _, err = dialect.Insert("product_review_daily_stats").
+		Cols("product_uuid", "day", "review_count", "score_sum").
+		FromQuery(dialect.Select(goqu.C("product_uuid"), goqu.V(day), goqu.V(1), goqu.V(review.Score)).From("order_products").
+			Where(product)).
+		OnConflict(goqu.DoUpdate("product_uuid, day", goqu.Record{
+			"review_count": goqu.L("`review_count` + 1"),
+			"score_sum":    goqu.L("`score_sum` + ?", review.Score),
+		})).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for product review stats",
+			fmt.Errorf("add review to product daily stats: %w", err))
+	}
+	if _, err := ds.db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while updating product review stats",
+			fmt.Errorf("add review to product daily stats: %w", err))
+	}
+
 	return nil
 }
 
@@ -227,7 +715,7 @@ func (ds *DatabaseRepository) GetOrderProductsByOrderUUID(ctx context.Context, o
 		}
 
 		// Fetch ProductStore item
-		sqlQuery, _, err := dialect.Select("uuid", "name", "description", "image", "availability_status", "available_items").
+		sqlQuery, _, err := dialect.Select(productColumns...).
 			From("products").Where(goqu.C("uuid").Eq(orderProduct.ProductUUID)).ToSQL()
 		if err != nil {
 			return nil, app.NewError("Error while preparing querying for product",
@@ -235,8 +723,7 @@ func (ds *DatabaseRepository) GetOrderProductsByOrderUUID(ctx context.Context, o
 		}
 
 		productStore := new(ProductStore)
-		err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&productStore.UUID, &productStore.Name,
-			&productStore.Description, &productStore.Image, &productStore.AvailabilityStatus, &productStore.AvailableItems)
+		err = scanProductStore(ds.db.QueryRowContext(ctx, sqlQuery), productStore)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return nil, app.NewError("Product does not exist", app.ErrNoRecords)
@@ -253,7 +740,7 @@ func (ds *DatabaseRepository) GetOrderProductsByOrderUUID(ctx context.Context, o
 // GetProductByUUID retrieves from storage a product by its UUID.
 func (ds *DatabaseRepository) GetProductByUUID(ctx context.Context, productUUID string) (*app.Product, error) {
 	dialect := goqu.Dialect("mysql")
-	sqlQuery, _, err := dialect.Select("uuid", "name", "status", "description", "image", "availability_status", "available_items").
+	sqlQuery, _, err := dialect.Select(productColumns...).
 		From("products").Where(goqu.C("uuid").Eq(productUUID)).ToSQL()
 	if err != nil {
 		return nil, app.NewError("Error while preparing querying for product",
@@ -261,8 +748,7 @@ func (ds *DatabaseRepository) GetProductByUUID(ctx context.Context, productUUID
 	}
 
 	productStore := new(ProductStore)
-	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&productStore.UUID, &productStore.Name,
-		&productStore.Description, &productStore.Image, &productStore.AvailabilityStatus, &productStore.AvailableItems)
+	err = scanProductStore(ds.db.QueryRowContext(ctx, sqlQuery), productStore)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, app.NewError("Product does not exist", app.ErrNoRecords)
@@ -274,14 +760,58 @@ func (ds *DatabaseRepository) GetProductByUUID(ctx context.Context, productUUID
 	return &product, nil
 }
 
+// GetProducts retrieves from storage the products matching query, sorted by name.
+func (ds *DatabaseRepository) GetProducts(ctx context.Context, query app.ProductQuery) ([]app.Product, error) {
+	dialect := goqu.Dialect("mysql")
+	productsQuery := dialect.Select(productColumns...).From("products").
+		Order(goqu.C("name").Asc(), goqu.C("uuid").Asc()).Limit(uint(query.Limit))
+	if query.Search != "" {
+		pattern := "%" + likeEscaper.Replace(query.Search) + "%"
+		productsQuery = productsQuery.Where(goqu.Or(goqu.C("name").ILike(pattern), goqu.C("manufacturer").ILike(pattern)))
+	}
+	if query.Availability != "" {
+		productsQuery = productsQuery.Where(goqu.C("availability_status").Eq(query.Availability))
+	}
+	if after := query.After; after != nil {
+		productsQuery = productsQuery.Where(goqu.Or(goqu.C("name").Gt(after.Name),
+			goqu.And(goqu.C("name").Eq(after.Name), goqu.C("uuid").Gt(after.UUID))))
+	}
+	sqlQuery, _, err := productsQuery.ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for products", fmt.Errorf("get products: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting products", fmt.Errorf("get products: %w", err))
+	}
+	defer rows.Close()
+	products := []app.Product{}
+	for rows.Next() {
+		var productStore ProductStore
+		if err := scanProductStore(rows, &productStore); err != nil {
+			return nil, app.NewError("Error while reading products", fmt.Errorf("get products: %w", err))
+		}
+		products = append(products, ds.ProductStoreToProduct(productStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading products", fmt.Errorf("get products: %w", err))
+	}
+
+	return products, nil
+}
+
+// AddProduct stores a product. A UUID is generated if the product has none.
 func (ds *DatabaseRepository) AddProduct(ctx context.Context, product app.Product) error {
+	if product.UUID == "" {
+		product.UUID = uuid.New().String()
+	}
 	dialect := goqu.Dialect("mysql")
 	sqlQuery, _, err := dialect.Insert("products").Cols("uuid", "name", "description", "image",
 		"availability_status", "created_at", "manufacturer", "vehicle", "id",
-		"available_items").Vals(goqu.Vals{uuid.New().String(), product.Name, product.Description, product.Image,
+		"available_items").Vals(goqu.Vals{product.UUID, product.Name, product.Description, product.Image,
 		product.AvailabilityStatus, product.CreatedAt, product.Manufacturer, product.Vehicle, product.ID,
 		product.AvailableItems}).ToSQL()
-	fmt.Println(sqlQuery)
 	if err != nil {
 		return app.NewError("Error while preparing insert for products",
 			fmt.Errorf("insert review by uuid: %w", err))
@@ -296,3 +826,87 @@ func (ds *DatabaseRepository) AddProduct(ctx context.Context, product app.Produc
 
 	return nil
 }
+
+// UpdateProduct updates all the stored fields of a product by its UUID.
+func (ds *DatabaseRepository) UpdateProduct(ctx context.Context, product app.Product) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("products").Set(goqu.Record{
+		"name":                product.Name,
+		"description":         product.Description,
+		"image":               product.Image,
+		"availability_status": product.AvailabilityStatus,
+		"available_items":     product.AvailableItems,
+		"created_at":          product.CreatedAt,
+		"manufacturer":        product.Manufacturer,
+		"vehicle":             product.Vehicle,
+		"id":                  product.ID,
+		"discontinued_at":     product.DiscontinuedAt,
+	}).Where(goqu.C("uuid").Eq(product.UUID)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for product",
+			fmt.Errorf("update product by uuid: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while updating product", fmt.Errorf("update by uuid: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while updating product", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// DeleteProduct deletes a product by its UUID. Products that have been ordered cannot be deleted.
+func (ds *DatabaseRepository) DeleteProduct(ctx context.Context, productUUID string) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Delete("products").Where(goqu.C("uuid").Eq(productUUID)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing delete for product", fmt.Errorf("delete product: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrRowIsReferenced {
+			return app.NewError("The product has been ordered and cannot be deleted", ErrProductOrdered)
+		}
+		return app.NewError("Error while deleting product", fmt.Errorf("delete product: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Product does not exist", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// GetCatalogProducts retrieves from storage all products that originate from the remote catalog,
+// including the discontinued ones.
+func (ds *DatabaseRepository) GetCatalogProducts(ctx context.Context) ([]app.Product, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select(productColumns...).
+		From("products").Where(goqu.C("id").IsNotNull(), goqu.C("id").Neq("")).
+		Order(goqu.C("uuid").Asc()).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for catalog products",
+			fmt.Errorf("get catalog products: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting catalog products", fmt.Errorf("get catalog products: %w", err))
+	}
+	defer rows.Close()
+	products := []app.Product{}
+	for rows.Next() {
+		var productStore ProductStore
+		if err := scanProductStore(rows, &productStore); err != nil {
+			return nil, app.NewError("Error while reading catalog products", fmt.Errorf("get catalog products: %w", err))
+		}
+		products = append(products, ds.ProductStoreToProduct(productStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading catalog products", fmt.Errorf("get catalog products: %w", err))
+	}
+
+	return products, nil
+}
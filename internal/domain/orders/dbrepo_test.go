@@ -29,11 +29,11 @@ func TestGetOrderByUUID(t *testing.T) {
 
 	orderUUID := uuid.New().String()
 	customerUUID := uuid.New().String()
-	rows := sqlmock.NewRows([]string{"uuid", "customer_uuid", "status", "placed_date"}).
-		AddRow(orderUUID, customerUUID, app.OrderStatusPreparing, time.Now())
+	rows := sqlmock.NewRows([]string{"uuid", "customer_uuid", "status", "placed_date", "version"}).
+		AddRow(orderUUID, customerUUID, app.OrderStatusPreparing, time.Now(), 1)
 	// Add an expected query and its result to the mock database.
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT `uuid`, `customer_uuid`, `status`, " +
-		"`placed_date` FROM `orders` WHERE (`uuid` = '" + orderUUID + "')")).
+		"`placed_date`, `version` FROM `orders` WHERE (`uuid` = '" + orderUUID + "')")).
 		WillReturnRows(rows)
 
 	customerRows := sqlmock.NewRows([]string{"uuid", "first_name", "last_name", "email", "phone_number", "registration_date"}).
@@ -0,0 +1,59 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+	"reviewbot/app"
+	"reviewbot/internal/pagination"
+)
+
+const (
+	// DefaultOrderLimit is the number of orders of a page when the query sets no limit.
+	DefaultOrderLimit = 50
+	// MaxOrderLimit is the largest number of orders of a page.
+	MaxOrderLimit = 200
+)
+
+// ErrInvalidOrderQuery is returned when an order listing query is not valid.
+var ErrInvalidOrderQuery = app.NewCodedError(app.CodeInvalid, "invalid order query", nil)
+
+// Orders gets a page of the orders matching query, the most recently placed first unless query sorts otherwise.
+// cursor is the NextCursor of the previous page, empty for the first page.
+func (s *Service) Orders(ctx context.Context, query app.OrderQuery, cursor string) (*app.OrderPage, error) {
+	if query.Sort == "" {
+		query.Sort = app.OrderSortNewest
+	}
+	if !query.Sort.IsValid() {
+		return nil, app.NewError(fmt.Sprintf("Unknown order sort %q", query.Sort), ErrInvalidOrderQuery)
+	}
+	for _, status := range query.Statuses {
+		if !status.IsValid() {
+			return nil, app.NewError(fmt.Sprintf("Unknown order status %q", status), ErrInvalidOrderQuery)
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return nil, app.NewError("The from date must be before the to date", ErrInvalidOrderQuery)
+	}
+	limit, err := pagination.Limit(query.Limit, DefaultOrderLimit, MaxOrderLimit, ErrInvalidOrderQuery)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != "" {
+		var after app.OrderCursor
+		if err := pagination.DecodeCursor(cursor, &after); err != nil || after.UUID == "" || after.Sort != query.Sort {
+			return nil, app.NewError("The cursor is invalid or belongs to another sort", ErrInvalidOrderQuery)
+		}
+		query.After = &after
+	}
+
+	orders, next, err := pagination.Fetch(limit, func(limit int) ([]app.Order, error) {
+		query.Limit = limit
+		return s.repo.GetOrders(ctx, query)
+	}, func(last app.Order) any {
+		return app.OrderCursor{Sort: query.Sort, PlacedDate: last.PlacedDate, UUID: last.UUID}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &app.OrderPage{Orders: orders, NextCursor: next}, nil
+}
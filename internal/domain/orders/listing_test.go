@@ -0,0 +1,98 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"reviewbot/app"
+	"reviewbot/internal/pagination"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var orderColumns = []string{"uuid", "status", "placed_date", "customer_uuid", "first_name", "last_name", "email",
+	"phone_number", "registration_date"}
+
+// TestOrdersPaginates tests that a full page returns a cursor that continues the listing after its last order.
+func TestOrdersPaginates(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	placedDate := time.Date(2023, 12, 12, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `orders` AS `o` INNER JOIN `customers` AS `c`") + ".*" +
+		regexp.QuoteMeta("WHERE ((`o`.`status` IN ('sending', 'completed')) AND "+
+			"(`o`.`placed_date` >= '2023-12-01 00:00:00')) ORDER BY `o`.`placed_date` DESC, `o`.`uuid` DESC LIMIT 3")).
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow("ord3", "sending", placedDate, "cus1", "Jane", "Doe", "jane@example.com", "", placedDate).
+			AddRow("ord2", "completed", placedDate, "cus1", "Jane", "Doe", "jane@example.com", "", placedDate).
+			AddRow("ord1", "sending", placedDate.Add(-time.Hour), "cus1", "Jane", "Doe", "jane@example.com", "",
+				placedDate))
+	mock.ExpectQuery(regexp.QuoteMeta("AND ((`o`.`placed_date` < '2023-12-12 12:00:00') OR " +
+		"((`o`.`placed_date` = '2023-12-12 12:00:00') AND (`o`.`uuid` < 'ord2')))) " +
+		"ORDER BY `o`.`placed_date` DESC, `o`.`uuid` DESC LIMIT 3")).
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow("ord1", "sending", placedDate.Add(-time.Hour), "cus1", "Jane", "Doe", "jane@example.com", "",
+				placedDate))
+	query := app.OrderQuery{Statuses: []app.OrderStatus{app.OrderStatusSending, app.OrderStatusCompleted},
+		From: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), Limit: 2}
+
+	// Act
+	first, err := service.Orders(context.Background(), query, "")
+	if err != nil {
+		t.Fatalf("Error listing orders: %v", err)
+	}
+	second, err := service.Orders(context.Background(), query, first.NextCursor)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error listing orders: %v", err)
+	}
+	if len(first.Orders) != 2 || first.NextCursor == "" {
+		t.Fatalf("First page mismatch: got %d orders and cursor %q, want %d and a cursor", len(first.Orders),
+			first.NextCursor, 2)
+	}
+	if first.Orders[0].Customer.Email != "jane@example.com" {
+		t.Fatalf("Customer email mismatch: got %s, want %s", first.Orders[0].Customer.Email, "jane@example.com")
+	}
+	if len(second.Orders) != 1 || second.NextCursor != "" {
+		t.Fatalf("Second page mismatch: got %d orders and cursor %q, want %d and none", len(second.Orders),
+			second.NextCursor, 1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestOrdersValidatesQuery tests that invalid listing queries are rejected before reaching the database.
+func TestOrdersValidatesQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  app.OrderQuery
+		cursor string
+	}{
+		{name: "unknown status", query: app.OrderQuery{Statuses: []app.OrderStatus{"lost"}}},
+		{name: "unknown sort", query: app.OrderQuery{Sort: "status"}},
+		{name: "limit too large", query: app.OrderQuery{Limit: MaxOrderLimit + 1}},
+		{name: "empty date range", query: app.OrderQuery{From: time.Now(), To: time.Now().Add(-time.Hour)}},
+		{name: "malformed cursor", cursor: "not a cursor"},
+		{name: "cursor of another sort", query: app.OrderQuery{Sort: app.OrderSortOldest},
+			cursor: pagination.EncodeCursor(app.OrderCursor{Sort: app.OrderSortNewest, UUID: "ord1"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, repo, _ := newTestDatabase(t)
+			defer db.Close()
+
+			// Act
+			_, err := newTestService(repo).Orders(context.Background(), tt.query, tt.cursor)
+			// Assert
+			if !errors.Is(err, ErrInvalidOrderQuery) {
+				t.Fatalf("Expected ErrInvalidOrderQuery, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package orders
+
+import (
+	"context"
+	"reviewbot/app"
+	"reviewbot/internal/pagination"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultProductLimit is the number of products of a page when the query sets no limit.
+	DefaultProductLimit = 20
+	// MaxProductLimit is the largest number of products of a page.
+	MaxProductLimit = 100
+)
+
+var (
+	// ErrInvalidProduct is returned when a product to create or update is not valid.
+	ErrInvalidProduct = app.NewCodedError(app.CodeInvalid, "invalid product", nil)
+	// ErrInvalidProductQuery is returned when a product listing query is not valid.
+	ErrInvalidProductQuery = app.NewCodedError(app.CodeInvalid, "invalid product query", nil)
+	// ErrProductOrdered is returned when deleting a product that has been ordered.
+	ErrProductOrdered = app.NewCodedError(app.CodeConflict, "product has been ordered", nil)
+)
+
+// Products gets a page of the products matching query, sorted by name. cursor is the NextCursor of the previous
+// page, empty for the first page.
+func (s *Service) Products(ctx context.Context, query app.ProductQuery, cursor string) (*app.ProductPage, error) {
+	limit, err := pagination.Limit(query.Limit, DefaultProductLimit, MaxProductLimit, ErrInvalidProductQuery)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != "" {
+		var after app.ProductCursor
+		if err := pagination.DecodeCursor(cursor, &after); err != nil || after.UUID == "" {
+			return nil, app.NewError("The cursor is invalid", ErrInvalidProductQuery)
+		}
+		query.After = &after
+	}
+
+	products, next, err := pagination.Fetch(limit, func(limit int) ([]app.Product, error) {
+		query.Limit = limit
+		return s.repo.GetProducts(ctx, query)
+	}, func(last app.Product) any {
+		return app.ProductCursor{Name: last.Name, UUID: last.UUID}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &app.ProductPage{Products: products, NextCursor: next}, nil
+}
+
+// ProductByUUID gets a product by its UUID.
+func (s *Service) ProductByUUID(ctx context.Context, productUUID string) (*app.Product, error) {
+	return s.repo.GetProductByUUID(ctx, productUUID)
+}
+
+// CreateProduct stores a new product and returns it with its UUID.
+func (s *Service) CreateProduct(ctx context.Context, product app.Product) (*app.Product, error) {
+	if err := validateProduct(product); err != nil {
+		return nil, err
+	}
+	product.UUID = uuid.New().String()
+	product.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	product.DiscontinuedAt = nil
+	if err := s.repo.AddProduct(ctx, product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// UpdateProduct replaces the editable fields of a product by its UUID and returns the updated product.
+// The creation and discontinuation dates are kept.
+func (s *Service) UpdateProduct(ctx context.Context, productUUID string, fields app.Product) (*app.Product, error) {
+	if err := validateProduct(fields); err != nil {
+		return nil, err
+	}
+	var product app.Product
+	err := s.repo.WithinTransaction(ctx, func(repo app.OrdersRepository) error {
+		stored, err := repo.GetProductByUUID(ctx, productUUID)
+		if err != nil {
+			return err
+		}
+		product = *stored
+		product.Name = fields.Name
+		product.Description = fields.Description
+		product.Image = fields.Image
+		product.AvailabilityStatus = fields.AvailabilityStatus
+		product.AvailableItems = fields.AvailableItems
+		product.Manufacturer = fields.Manufacturer
+		product.Vehicle = fields.Vehicle
+		product.ID = fields.ID
+		// MySQL reports no affected rows for an update that changes nothing, which reads as a missing product.
+		if product == *stored {
+			return nil
+		}
+		return repo.UpdateProduct(ctx, product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// DeleteProduct deletes a product by its UUID. It returns ErrProductOrdered if the product has been ordered, as
+// the orders and their reviews keep referencing it.
+func (s *Service) DeleteProduct(ctx context.Context, productUUID string) error {
+	return s.repo.DeleteProduct(ctx, productUUID)
+}
+
+func validateProduct(product app.Product) error {
+	if strings.TrimSpace(product.Name) == "" {
+		return app.NewError("The product name is required", ErrInvalidProduct)
+	}
+	if product.AvailableItems < 0 {
+		return app.NewError("The available items cannot be negative", ErrInvalidProduct)
+	}
+	return nil
+}
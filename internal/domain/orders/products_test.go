@@ -0,0 +1,113 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"reviewbot/app"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+var productColumnNames = []string{"uuid", "name", "description", "image", "availability_status", "available_items",
+	"created_at", "manufacturer", "vehicle", "id", "discontinued_at"}
+
+// TestProductsPaginates tests that a full page returns a cursor that continues the listing after its last product
+// and that the search is matched literally.
+func TestProductsPaginates(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE (((`name` LIKE '%100\\\\%%') OR " +
+		"(`manufacturer` LIKE '%100\\\\%%')) AND (`availability_status` = 'available')) " +
+		"ORDER BY `name` ASC, `uuid` ASC LIMIT 3")).
+		WillReturnRows(sqlmock.NewRows(productColumnNames).
+			AddRow("prod1", "Tyre", "", "", "available", 4, nil, "100% Rubber", "", "", nil).
+			AddRow("prod2", "Wheel", "", "", "available", 2, nil, "100% Rubber", "", "", nil).
+			AddRow("prod3", "Wheel", "", "", "available", 1, nil, "100% Rubber", "", "", nil))
+	mock.ExpectQuery(regexp.QuoteMeta("((`name` > 'Wheel') OR ((`name` = 'Wheel') AND (`uuid` > 'prod2')))) " +
+		"ORDER BY `name` ASC, `uuid` ASC LIMIT 3")).
+		WillReturnRows(sqlmock.NewRows(productColumnNames).
+			AddRow("prod3", "Wheel", "", "", "available", 1, nil, "100% Rubber", "", "", nil))
+	query := app.ProductQuery{Search: "100%", Availability: "available", Limit: 2}
+
+	// Act
+	first, err := service.Products(context.Background(), query, "")
+	if err != nil {
+		t.Fatalf("Error listing products: %v", err)
+	}
+	second, err := service.Products(context.Background(), query, first.NextCursor)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error listing products: %v", err)
+	}
+	if len(first.Products) != 2 || first.NextCursor == "" {
+		t.Fatalf("First page mismatch: got %d products and cursor %q, want %d and a cursor", len(first.Products),
+			first.NextCursor, 2)
+	}
+	if len(second.Products) != 1 || second.NextCursor != "" {
+		t.Fatalf("Second page mismatch: got %d products and cursor %q, want %d and none", len(second.Products),
+			second.NextCursor, 1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestUpdateProductKeepsDates tests that updating a product keeps its creation and discontinuation dates.
+func TestUpdateProductKeepsDates(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	createdAt := time.Date(2023, 12, 12, 12, 12, 51, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `products` WHERE (`uuid` = 'prod1')")).
+		WillReturnRows(sqlmock.NewRows(productColumnNames).
+			AddRow("prod1", "Tyre", "", "img", "available", 4, createdAt, "Acme", "Car", "42", nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `products` SET `availability_status`='sold out',`available_items`=0,"+
+		"`created_at`='2023-12-12 12:12:51'") + ".*" + regexp.QuoteMeta("`name`='Winter tyre'")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Act
+	product, err := service.UpdateProduct(context.Background(), "prod1", app.Product{Name: "Winter tyre",
+		Image: "img", AvailabilityStatus: "sold out", Manufacturer: "Acme", Vehicle: "Car", ID: "42"})
+	// Assert
+	if err != nil {
+		t.Fatalf("Error updating product: %v", err)
+	}
+	if !product.CreatedAt.Equal(createdAt) {
+		t.Fatalf("Created at mismatch: got %v, want %v", product.CreatedAt, createdAt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestDeleteOrderedProduct tests that a product referenced by orders is not deleted.
+func TestDeleteOrderedProduct(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+	service := newTestService(repo)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE `products` FROM `products` WHERE (`uuid` = 'prod1')")).
+		WillReturnError(&mysql.MySQLError{Number: mysqlErrRowIsReferenced, Message: "foreign key constraint fails"})
+
+	// Act
+	err := service.DeleteProduct(context.Background(), "prod1")
+	// Assert
+	if !errors.Is(err, ErrProductOrdered) {
+		t.Fatalf("Expected ErrProductOrdered, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -2,31 +2,51 @@ package orders
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"golang.org/x/exp/slog"
-	"net/http"
 	"reviewbot/app"
+	"reviewbot/internal/ratelimit"
+	"reviewbot/pkg/catalogsource"
 	"reviewbot/pkg/responsegenerator"
 	"reviewbot/pkg/sentimentanalyzer"
 	"time"
 )
 
+// ErrOrderVersionMismatch is returned when an order changed since the version a change of the order is based on.
+var ErrOrderVersionMismatch = app.NewCodedError(app.CodePreconditionFailed, "order version mismatch", nil)
+
 // Service wraps the user repository.
 type Service struct {
 	repo              app.OrdersRepository
 	responseGenerator responsegenerator.ResponseGenerator
 	sentimentAnalyzer sentimentanalyzer.SentimentAnalyze
-	logger            *slog.Logger
+	catalogSource     catalogsource.CatalogSource
+	// reviewMessageLimit limits the messages a customer sends in a review conversation.
+	reviewMessageLimit ratelimit.Limit
+	// maxDiscontinuedPercent is the largest percentage of the catalog a synchronization may discontinue.
+	maxDiscontinuedPercent int
+	logger                 *slog.Logger
 }
 
 // NewService returns a new Service.
 func NewService(repo app.OrdersRepository, responseGenerator responsegenerator.ResponseGenerator,
-	sentimentAnalyzer sentimentanalyzer.SentimentAnalyze,
+	sentimentAnalyzer sentimentanalyzer.SentimentAnalyze, catalogSource catalogsource.CatalogSource,
 	logger *slog.Logger) *Service {
 	return &Service{repo: repo, responseGenerator: responseGenerator, sentimentAnalyzer: sentimentAnalyzer,
-		logger: logger}
+		catalogSource: catalogSource, maxDiscontinuedPercent: 100, logger: logger}
+}
+
+// LimitReviewMessages limits the messages a customer may send in each review conversation. The messages over the
+// limit are answered with how long to wait, and ignored.
+func (s *Service) LimitReviewMessages(limit ratelimit.Limit) {
+	s.reviewMessageLimit = limit
+}
+
+// LimitCatalogDiscontinuations aborts the catalog synchronizations which would discontinue more than percent of the
+// products, so that a broken feed does not empty the catalog. It is 100, no limit, by default.
+func (s *Service) LimitCatalogDiscontinuations(percent int) {
+	s.maxDiscontinuedPercent = percent
 }
 
 // OrderByUUID gets an order by its UUID.
@@ -34,69 +54,140 @@ func (s *Service) OrderByUUID(ctx context.Context, orderUUID string) (*app.Order
 	return s.repo.GetOrderByUUID(ctx, orderUUID)
 }
 
-// UpdateOrderStatusByUUID updates an order status by its UUID.
-func (s *Service) UpdateOrderStatusByUUID(ctx context.Context, orderUUID string,
-	orderStatus app.OrderStatus) error {
-	return s.repo.UpdateOrderStatusByOrderUUID(ctx, orderUUID, string(orderStatus))
-}
-
-// OrderProductsByOrderUUID gets an order by its UUID.
-func (s *Service) OrderProductsByOrderUUID(ctx context.Context, orderUUID string) ([]app.OrderProduct, error) {
-	return s.repo.GetOrderProductsByOrderUUID(ctx, orderUUID)
+// UpdateOrderStatusByUUID updates an order status by its UUID and returns the new version of the order.
+// A non-zero version is the version of the order the change is based on, the order is left untouched with an
+// ErrOrderVersionMismatch error if it changed since.
+// It returns an app.ErrInvalidTransition error if the order may not move from its current status to orderStatus, or
+// if orderStatus requires reviews, which only SubmitOrderReviews stores.
+// The actor carried by ctx is recorded in the order's status history. The order.status_changed event stored along
+// with the change drives its consequences, such as the review invitations.
+func (s *Service) UpdateOrderStatusByUUID(ctx context.Context, orderUUID string, orderStatus app.OrderStatus,
+	version int) (int, error) {
+	var newVersion int
+	err := s.repo.WithinTransaction(ctx, func(repo app.OrdersRepository) error {
+		transition, updatedVersion, err := transitionOrderStatus(ctx, repo, orderUUID, orderStatus, version, false)
+		if err != nil {
+			return err
+		}
+		newVersion = updatedVersion
+		return addEvents(ctx, repo, statusChangeEvents(transition))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return newVersion, nil
 }
 
-type RemoteProduct struct {
-	CreatedAt    time.Time `json:"createdAt"`
-	ProductName  string    `json:"productName"`
-	Manufacturer string    `json:"manufacturer"`
-	Vehicle      string    `json:"vehicle"`
-	ImageURL     string    `json:"image"`
-	ID           string    `json:"id"`
+// OrderStatusHistoryByUUID gets the status transitions of an order by its UUID, oldest first.
+func (s *Service) OrderStatusHistoryByUUID(ctx context.Context, orderUUID string) ([]app.OrderStatusTransition,
+	error) {
+	if _, err := s.repo.GetOrderByUUID(ctx, orderUUID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetOrderStatusTransitionsByOrderUUID(ctx, orderUUID)
 }
 
-func (s *Service) PopulateProducts(ctx context.Context) error {
-	client := http.Client{}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://62daf70dd1d97b9e0c49ca5d.mockapi."+
-		"io/v1/products", nil)
+// transitionOrderStatus moves an order to status, records the transition and returns the new version of the order.
+// A non-zero version must be the current version of the order. withReviews tells whether the reviews of the order
+// are stored along with the transition, as the statuses requiring reviews may not be reached otherwise. It must run
+// within a transaction, so the order cannot change between reading its current status and updating it.
+func transitionOrderStatus(ctx context.Context, repo app.OrdersRepository, orderUUID string,
+	status app.OrderStatus, version int, withReviews bool) (app.OrderStatusTransition, int, error) {
+	current, currentVersion, err := repo.GetOrderStatusForUpdate(ctx, orderUUID)
 	if err != nil {
-		return err
+		return app.OrderStatusTransition{}, 0, err
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	if version != 0 && version != currentVersion {
+		return app.OrderStatusTransition{}, 0, app.NewError(fmt.Sprintf(
+			"The order is at version %d, the change is based on version %d", currentVersion, version),
+			ErrOrderVersionMismatch)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= http.StatusBadRequest {
-		return errors.New("received error from remote server")
+	if err := current.ValidateTransition(status); err != nil {
+		return app.OrderStatusTransition{}, 0, err
 	}
-
-	remoteProducts := []RemoteProduct{}
-	err = json.NewDecoder(resp.Body).Decode(&remoteProducts)
-	if err != nil {
-		return err
+	if status.RequiresReviews() && !withReviews {
+		return app.OrderStatusTransition{}, 0, app.NewError(
+			fmt.Sprintf("Order status cannot change to %s without reviews", status), app.ErrInvalidTransition)
+	}
+	if err := repo.UpdateOrderStatusByOrderUUID(ctx, orderUUID, string(status)); err != nil {
+		return app.OrderStatusTransition{}, 0, err
+	}
+	transition := app.OrderStatusTransition{
+		OrderUUID: orderUUID,
+		From:      current,
+		To:        status,
+		Actor:     app.ActorFromContext(ctx),
+		CreatedAt: time.Now().UTC(),
 	}
+	return transition, currentVersion + 1, repo.AddOrderStatusTransition(ctx, transition)
+}
 
-	for _, remoteProduct := range remoteProducts {
-		product := app.Product{
-			Name:               remoteProduct.ProductName,
-			Description:        "",
-			Image:              remoteProduct.ImageURL,
-			AvailabilityStatus: "",
-			AvailableItems:     0,
-			CreatedAt:          remoteProduct.CreatedAt,
-			Manufacturer:       remoteProduct.Manufacturer,
-			Vehicle:            remoteProduct.Vehicle,
-			ID:                 remoteProduct.ID,
-		}
-		err := s.repo.AddProduct(ctx, product)
+// OrderProductsByOrderUUID gets an order by its UUID.
+func (s *Service) OrderProductsByOrderUUID(ctx context.Context, orderUUID string) ([]app.OrderProduct, error) {
+	return s.repo.GetOrderProductsByOrderUUID(ctx, orderUUID)
+}
 
+// SubmitOrderReviews stores the reviews of an order's products and marks the order as reviewed.
+// It fails with an app.ErrInvalidTransition error unless the order is completed.
+// Both steps run in a single transaction, so an order is never left with only part of its reviews stored
+// or with all of its reviews stored but a status other than reviewed.
+func (s *Service) SubmitOrderReviews(ctx context.Context, orderUUID string, reviews []app.OrderProductReview) error {
+	return s.repo.WithinTransaction(ctx, func(repo app.OrdersRepository) error {
+		var events []eventSpec
+		now := time.Now().UTC()
+		for _, review := range reviews {
+			if review.CreatedAt.IsZero() {
+				review.CreatedAt = now
+			}
+			err := repo.AddOrderProductReviewByOrderProductUUID(ctx, review)
+			if err != nil {
+				return err
+			}
+			data := app.ReviewEventData{OrderUUID: orderUUID, OrderProductUUID: review.OrderProductUUID,
+				Score: review.Score}
+			events = append(events, eventSpec{app.EventReviewCreated, data})
+			if review.Score < 0 {
+				events = append(events, eventSpec{app.EventReviewNegative, data})
+			}
+		}
+		transition, _, err := transitionOrderStatus(ctx, repo, orderUUID, app.OrderStatusReviewed, 0, true)
 		if err != nil {
-			s.logger.Error(err.Error())
-			continue
+			return err
 		}
+		return addEvents(ctx, repo, append(events, statusChangeEvents(transition)...))
+	})
+}
+
+// eventSpec describes a domain event to store in the outbox.
+type eventSpec struct {
+	eventType string
+	data      any
+}
+
+// statusChangeEvents returns the events describing a status transition.
+func statusChangeEvents(transition app.OrderStatusTransition) []eventSpec {
+	data := app.OrderStatusEventData{OrderUUID: transition.OrderUUID, From: transition.From, To: transition.To,
+		Actor: transition.Actor}
+	events := []eventSpec{{app.EventOrderStatusChanged, data}}
+	if transition.To == app.OrderStatusReviewed {
+		events = append(events, eventSpec{app.EventOrderReviewed, data})
 	}
+	return events
+}
 
+// addEvents stores the events in the outbox. It must run within the transaction making the changes they describe,
+// so the events are published if and only if the changes are committed.
+func addEvents(ctx context.Context, repo app.OrdersRepository, specs []eventSpec) error {
+	now := time.Now().UTC()
+	for _, spec := range specs {
+		event, err := app.NewEvent(spec.eventType, spec.data, now)
+		if err != nil {
+			return app.NewError("Error while creating event", fmt.Errorf("create %s event: %w", spec.eventType, err))
+		}
+		if err := repo.AddOutboxEvent(ctx, event); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -113,6 +204,8 @@ func (s *Service) ReviewOrderProducts(ctx context.Context, conn *websocket.Conn,
 		return err
 	}
 
+	messages := ratelimit.NewBucket(s.reviewMessageLimit, time.Now())
+	reviews := make([]app.OrderProductReview, 0, len(orderProducts))
 	for _, orderProduct := range orderProducts {
 		askForProductReviewMessage := "Could you please share your experience with your purchase of " + orderProduct.
 			Product.Name + "?"
@@ -121,7 +214,7 @@ func (s *Service) ReviewOrderProducts(ctx context.Context, conn *websocket.Conn,
 			return err
 		}
 
-		messageType, p, err := conn.ReadMessage()
+		messageType, p, err := s.readReviewMessage(conn, messages)
 		if err != nil {
 			s.logger.With("success", false, "err", err)
 			return err
@@ -132,11 +225,12 @@ func (s *Service) ReviewOrderProducts(ctx context.Context, conn *websocket.Conn,
 			return err
 		}
 
-		if err = s.repo.AddOrderProductReviewByOrderProductUUID(ctx, orderProduct.UUID,
-			analysisScore.SentimentScore); err != nil {
-			s.logger.With("success", false, "err", err)
-			return err
-		}
+		reviews = append(reviews, app.OrderProductReview{
+			OrderProductUUID: orderProduct.UUID,
+			Score:            analysisScore.SentimentScore,
+			Text:             string(p),
+			CreatedAt:        time.Now().UTC(),
+		})
 
 		generatedResponse, err := s.responseGenerator.Generate(ctx, analysisScore, orderProduct.Product.Name)
 		if err != nil {
@@ -148,7 +242,7 @@ func (s *Service) ReviewOrderProducts(ctx context.Context, conn *websocket.Conn,
 			return err
 		}
 	}
-	err := s.repo.UpdateOrderStatusByOrderUUID(ctx, order.UUID, string(app.OrderStatusReviewed))
+	err := s.SubmitOrderReviews(app.ContextWithActor(ctx, "customer:"+order.Customer.UUID), order.UUID, reviews)
 	if err != nil {
 		s.logger.With("success", false, "err", err)
 		return err
@@ -164,3 +258,23 @@ func (s *Service) ReviewOrderProducts(ctx context.Context, conn *websocket.Conn,
 
 	return nil
 }
+
+// readReviewMessage reads the next message of a review conversation allowed by the message limit of the
+// conversation. The messages over the limit are answered with how long to wait.
+func (s *Service) readReviewMessage(conn *websocket.Conn, messages *ratelimit.Bucket) (int, []byte, error) {
+	for {
+		messageType, p, err := conn.ReadMessage()
+		if err != nil {
+			return 0, nil, err
+		}
+		ok, retryAfter := messages.Take(time.Now())
+		if ok {
+			return messageType, p, nil
+		}
+		waitMessage := fmt.Sprintf("You are sending messages too quickly, please try again in %ds.",
+			ratelimit.RetryAfterSeconds(retryAfter))
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(waitMessage)); err != nil {
+			return 0, nil, err
+		}
+	}
+}
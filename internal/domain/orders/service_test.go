@@ -0,0 +1,420 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"reviewbot/app"
+	"reviewbot/internal/ratelimit"
+	"reviewbot/pkg/catalogsource/noopsource"
+	"reviewbot/pkg/responsegenerator/dummygenerator"
+	"reviewbot/pkg/sentimentanalyzer/dummyanalyzer"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+	"golang.org/x/exp/slog"
+)
+
+func newTestService(repo app.OrdersRepository) *Service {
+	return NewService(repo, dummygenerator.NewDummyGenerator(), dummyganalyzer.NewDummyAnalyzer(),
+		noopsource.NewNoopSource(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+var (
+	insertReviewQuery  = regexp.QuoteMeta("INSERT INTO `order_product_reviews` (`uuid`, `order_product_uuid`, `score`")
+	lockStatusQuery    = regexp.QuoteMeta("SELECT `status`, `version` FROM `orders` WHERE (`uuid` = 'ord1') FOR UPDATE")
+	updateStatusQuery  = regexp.QuoteMeta("UPDATE `orders` SET `status`='reviewed',`version`=`version` + 1 WHERE (`uuid` = 'ord1')")
+	insertHistoryQuery = regexp.QuoteMeta("INSERT INTO `order_status_history`") + ".*'ord1', 'completed', 'reviewed'"
+	insertOutboxQuery  = regexp.QuoteMeta("INSERT INTO `outbox_events`")
+	errInjected        = errors.New("injected failure")
+)
+
+func statusRows(status app.OrderStatus) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"status", "version"}).AddRow(status, 3)
+}
+
+// expectReviewInsert expects a review to be stored and added to the review totals of its product.
+func expectReviewInsert(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(insertReviewQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `product_review_stats`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `product_review_daily_stats`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectOutboxEvents expects the events of eventTypes to be stored in the outbox, in that order.
+func expectOutboxEvents(mock sqlmock.Sqlmock, eventTypes ...string) {
+	for _, eventType := range eventTypes {
+		mock.ExpectExec(insertOutboxQuery + ".*'" + regexp.QuoteMeta(eventType) + "'").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+}
+
+// reviewedOrderEvents are the events stored when testReviews are submitted.
+var reviewedOrderEvents = []string{app.EventReviewCreated, app.EventReviewCreated, app.EventReviewNegative,
+	app.EventOrderStatusChanged, app.EventOrderReviewed}
+
+var testReviews = []app.OrderProductReview{
+	{OrderProductUUID: "op1", Score: 1},
+	{OrderProductUUID: "op2", Score: -1},
+}
+
+// TestSubmitOrderReviews tests that all reviews and the status update are committed together.
+func TestSubmitOrderReviews(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectReviewInsert(mock)
+	expectReviewInsert(mock)
+	mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+	mock.ExpectExec(updateStatusQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertHistoryQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectOutboxEvents(mock, reviewedOrderEvents...)
+	mock.ExpectCommit()
+
+	// Act
+	err := newTestService(repo).SubmitOrderReviews(context.Background(), "ord1", testReviews)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error submitting order reviews: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestSubmitOrderReviewsRollback tests that a failure at any step rolls back everything done before it.
+func TestSubmitOrderReviewsRollback(t *testing.T) {
+	tests := []struct {
+		name    string
+		arrange func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "first review insert fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(insertReviewQuery).WillReturnError(errInjected)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "second review insert fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				mock.ExpectExec(insertReviewQuery).WillReturnError(errInjected)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "product review stats update fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(insertReviewQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `product_review_stats`")).
+					WillReturnError(errInjected)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "order status lock fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				expectReviewInsert(mock)
+				mock.ExpectQuery(lockStatusQuery).WillReturnError(errInjected)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "order already reviewed",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				expectReviewInsert(mock)
+				mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusReviewed))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "status update fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				expectReviewInsert(mock)
+				mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+				mock.ExpectExec(updateStatusQuery).WillReturnError(errInjected)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "status update affects no order",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				expectReviewInsert(mock)
+				mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+				mock.ExpectExec(updateStatusQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "status history insert fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				expectReviewInsert(mock)
+				mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+				mock.ExpectExec(updateStatusQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertHistoryQuery).WillReturnError(errInjected)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "outbox insert fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				expectReviewInsert(mock)
+				mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+				mock.ExpectExec(updateStatusQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertHistoryQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectOutboxEvents(mock, app.EventReviewCreated)
+				mock.ExpectExec(insertOutboxQuery).WillReturnError(errInjected)
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "commit fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectReviewInsert(mock)
+				expectReviewInsert(mock)
+				mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+				mock.ExpectExec(updateStatusQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertHistoryQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectOutboxEvents(mock, reviewedOrderEvents...)
+				mock.ExpectCommit().WillReturnError(errInjected)
+			},
+		},
+		{
+			name: "begin fails",
+			arrange: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin().WillReturnError(errInjected)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, repo, mock := newTestDatabase(t)
+			defer db.Close()
+			tt.arrange(mock)
+
+			// Act
+			err := newTestService(repo).SubmitOrderReviews(context.Background(), "ord1", testReviews)
+			// Assert
+			if err == nil {
+				t.Fatalf("Expected error, got nil")
+			}
+			var appError *app.Error
+			if !errors.As(err, &appError) {
+				t.Fatalf("Expected app.Error, got %#v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestUpdateOrderStatusByUUID tests that a valid transition updates the order and records the actor.
+func TestUpdateOrderStatusByUUID(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusPlaced))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `orders` SET `status`='preparing',`version`=`version` + 1 WHERE (`uuid` = 'ord1')")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `order_status_history`") +
+		".*'ord1', 'placed', 'preparing', 'backoffice'").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectOutboxEvents(mock, app.EventOrderStatusChanged)
+	mock.ExpectCommit()
+
+	// Act
+	ctx := app.ContextWithActor(context.Background(), "backoffice")
+	version, err := newTestService(repo).UpdateOrderStatusByUUID(ctx, "ord1", app.OrderStatusPreparing, 3)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error updating order status: %v", err)
+	}
+	if version != 4 {
+		t.Fatalf("Version mismatch: got %d, want %d", version, 4)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestUpdateOrderStatusByUUIDInvalidTransition tests that an invalid transition is rejected without any update.
+func TestUpdateOrderStatusByUUIDInvalidTransition(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusPlaced))
+	mock.ExpectRollback()
+
+	// Act
+	_, err := newTestService(repo).UpdateOrderStatusByUUID(context.Background(), "ord1", app.OrderStatusReviewed, 0)
+	// Assert
+	if !errors.Is(err, app.ErrInvalidTransition) {
+		t.Fatalf("Expected app.ErrInvalidTransition, got %v", err)
+	}
+	if app.ErrorMessage(err) != "Order status cannot change from placed to reviewed" {
+		t.Fatalf("Unexpected error message: %q", app.ErrorMessage(err))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestUpdateOrderStatusByUUIDRequiresReviews tests that a completed order is not marked as reviewed by a status
+// change, as only storing its reviews may do it.
+func TestUpdateOrderStatusByUUIDRequiresReviews(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+	mock.ExpectRollback()
+
+	// Act
+	_, err := newTestService(repo).UpdateOrderStatusByUUID(context.Background(), "ord1", app.OrderStatusReviewed, 0)
+	// Assert
+	if !errors.Is(err, app.ErrInvalidTransition) {
+		t.Fatalf("Expected app.ErrInvalidTransition, got %v", err)
+	}
+	if app.ErrorMessage(err) != "Order status cannot change to reviewed without reviews" {
+		t.Fatalf("Unexpected error message: %q", app.ErrorMessage(err))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestUpdateOrderStatusByUUIDVersionMismatch tests that a change based on an outdated version is rejected without
+// any update.
+func TestUpdateOrderStatusByUUIDVersionMismatch(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusPlaced))
+	mock.ExpectRollback()
+
+	// Act
+	_, err := newTestService(repo).UpdateOrderStatusByUUID(context.Background(), "ord1", app.OrderStatusPreparing, 2)
+	// Assert
+	if !errors.Is(err, ErrOrderVersionMismatch) {
+		t.Fatalf("Expected ErrOrderVersionMismatch, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestSubmitOrderReviewsStoresEvents tests that the review and order events are stored in the outbox within the
+// transaction storing the reviews.
+func TestSubmitOrderReviewsStoresEvents(t *testing.T) {
+	// Arrange
+	db, repo, mock := newTestDatabase(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectReviewInsert(mock)
+	expectReviewInsert(mock)
+	mock.ExpectQuery(lockStatusQuery).WillReturnRows(statusRows(app.OrderStatusCompleted))
+	mock.ExpectExec(updateStatusQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertHistoryQuery).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectOutboxEvents(mock, app.EventReviewCreated, app.EventReviewCreated)
+	mock.ExpectExec(insertOutboxQuery + `.*'review.negative', '.*order_product_uuid.*op2.*score.*:-1`).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(insertOutboxQuery + `.*'order.status_changed', '.*completed.*reviewed.*customer:cus1`).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	expectOutboxEvents(mock, app.EventOrderReviewed)
+	mock.ExpectCommit()
+
+	// Act
+	ctx := app.ContextWithActor(context.Background(), "customer:cus1")
+	err := newTestService(repo).SubmitOrderReviews(ctx, "ord1", testReviews)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error submitting order reviews: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestReadReviewMessageLimitsMessages tests that the messages over the limit of a review conversation are answered
+// with how long to wait and ignored.
+func TestReadReviewMessageLimitsMessages(t *testing.T) {
+	// Arrange
+	service := newTestService(nil)
+	read := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		messages := ratelimit.NewBucket(ratelimit.Limit{Events: 1, Per: 200 * time.Millisecond}, time.Now())
+		for i := 0; i < 2; i++ {
+			_, p, err := service.readReviewMessage(conn, messages)
+			if err != nil {
+				return
+			}
+			read <- string(p)
+		}
+	}))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Error dialing: %v", err)
+	}
+	defer conn.Close()
+
+	// Act
+	conn.WriteMessage(websocket.TextMessage, []byte("first"))
+	conn.WriteMessage(websocket.TextMessage, []byte("second"))
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Error reading reply: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	conn.WriteMessage(websocket.TextMessage, []byte("third"))
+	// Assert
+	if !strings.Contains(string(reply), "please try again in 1s") {
+		t.Fatalf("Reply mismatch: got %q, want a request to wait", reply)
+	}
+	for _, want := range []string{"first", "third"} {
+		if got := <-read; got != want {
+			t.Fatalf("Message mismatch: got %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package reviews
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+	"reviewbot/internal/database"
+	"time"
+)
+
+// ReviewStore represents a review entity at the Database, joined with its order product and order.
+type ReviewStore struct {
+	UUID             string
+	OrderUUID        string
+	OrderProductUUID string
+	ProductUUID      string
+	CustomerUUID     string
+	Score            sql.NullInt64
+	Text             sql.NullString
+	CreatedAt        time.Time
+}
+
+// DatabaseRepository implements the ReviewsRepository interface.
+type DatabaseRepository struct {
+	db *sqlx.DB
+}
+
+// NewDatabaseRepository returns a new DatabaseRepository.
+func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
+	return &DatabaseRepository{
+		db: db,
+	}
+}
+
+// ReviewStoreToReview converts a ReviewStore object to an app.Review
+func (ds *DatabaseRepository) ReviewStoreToReview(reviewStore ReviewStore) app.Review {
+	return app.Review{
+		UUID:             reviewStore.UUID,
+		OrderUUID:        reviewStore.OrderUUID,
+		OrderProductUUID: reviewStore.OrderProductUUID,
+		ProductUUID:      reviewStore.ProductUUID,
+		CustomerUUID:     reviewStore.CustomerUUID,
+		Score:            reviewStore.Score.Int64,
+		Text:             reviewStore.Text.String,
+		CreatedAt:        reviewStore.CreatedAt,
+	}
+}
+
+// GetReviewsByOrderUUID retrieves from storage the reviews of an order's products.
+func (ds *DatabaseRepository) GetReviewsByOrderUUID(ctx context.Context, orderUUID string,
+	query app.ReviewQuery) ([]app.Review, error) {
+	if err := ds.ensureExists(ctx, "orders", orderUUID, "Order does not exist"); err != nil {
+		return nil, err
+	}
+	return ds.getReviews(ctx, goqu.I("op.order_uuid").Eq(orderUUID), query)
+}
+
+// GetReviewsByProductUUID retrieves from storage the reviews of a product.
+func (ds *DatabaseRepository) GetReviewsByProductUUID(ctx context.Context, productUUID string,
+	query app.ReviewQuery) ([]app.Review, error) {
+	if err := ds.ensureExists(ctx, "products", productUUID, "Product does not exist"); err != nil {
+		return nil, err
+	}
+	return ds.getReviews(ctx, goqu.I("op.product_uuid").Eq(productUUID), query)
+}
+
+// GetReviewsByCustomerUUID retrieves from storage the reviews a customer gave.
+func (ds *DatabaseRepository) GetReviewsByCustomerUUID(ctx context.Context, customerUUID string,
+	query app.ReviewQuery) ([]app.Review, error) {
+	if err := ds.ensureExists(ctx, "customers", customerUUID, "Customer does not exist"); err != nil {
+		return nil, err
+	}
+	return ds.getReviews(ctx, goqu.I("o.customer_uuid").Eq(customerUUID), query)
+}
+
+// GetProductReviewStats retrieves from storage the review totals of a product.
+func (ds *DatabaseRepository) GetProductReviewStats(ctx context.Context, productUUID string) (*app.ProductReviewStats,
+	error) {
+	if err := ds.ensureExists(ctx, "products", productUUID, "Product does not exist"); err != nil {
+		return nil, err
+	}
+
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("review_count", "score_sum", "positive_count", "neutral_count",
+		"negative_count", "star_1", "star_2", "star_3", "star_4", "star_5", "last_review_at").
+		From("product_review_stats").Where(goqu.C("product_uuid").Eq(productUUID)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for product review stats",
+			fmt.Errorf("get product review stats: %w", err))
+	}
+
+	stats := app.ProductReviewStats{ProductUUID: productUUID}
+	var lastReviewAt sql.NullTime
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&stats.ReviewCount, &stats.ScoreSum, &stats.PositiveCount,
+		&stats.NeutralCount, &stats.NegativeCount, &stats.Stars[0], &stats.Stars[1], &stats.Stars[2], &stats.Stars[3],
+		&stats.Stars[4], &lastReviewAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &stats, nil
+		}
+		return nil, app.NewError("Error while getting product review stats",
+			fmt.Errorf("get product review stats: %w", err))
+	}
+	if lastReviewAt.Valid {
+		stats.LastReviewAt = &lastReviewAt.Time
+	}
+
+	return &stats, nil
+}
+
+// GetProductDailyReviewStats retrieves from storage the daily review totals of a product since a day.
+func (ds *DatabaseRepository) GetProductDailyReviewStats(ctx context.Context, productUUID string,
+	since time.Time) ([]app.DailyReviewStats, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("day", "review_count", "score_sum").From("product_review_daily_stats").
+		Where(goqu.C("product_uuid").Eq(productUUID), goqu.C("day").Gte(since)).Order(goqu.C("day").Asc()).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for product review stats",
+			fmt.Errorf("get product daily review stats: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting product review stats",
+			fmt.Errorf("get product daily review stats: %w", err))
+	}
+	defer rows.Close()
+	days := []app.DailyReviewStats{}
+	for rows.Next() {
+		var day app.DailyReviewStats
+		if err := rows.Scan(&day.Day, &day.ReviewCount, &day.ScoreSum); err != nil {
+			return nil, app.NewError("Error while reading product review stats",
+				fmt.Errorf("get product daily review stats: %w", err))
+		}
+		days = append(days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading product review stats",
+			fmt.Errorf("get product daily review stats: %w", err))
+	}
+
+	return days, nil
+}
+
+// RebuildProductReviewStats replaces the review totals of every product with totals computed from the reviews, in
+// a single transaction. Reviews committed while it runs are counted once, either by the rebuild or on top of it.
+func (ds *DatabaseRepository) RebuildProductReviewStats(ctx context.Context) (int64, error) {
+	dialect := goqu.Dialect("mysql")
+	score := "COALESCE(`r`.`score`, 0)"
+	// stars is app.StarsOf in SQL.
+	stars := fmt.Sprintf("1 + (LEAST(%d, GREATEST(%d, %s)) - (%d)) * 4 DIV %d", app.MaxReviewScore,
+		app.MinReviewScore, score, app.MinReviewScore, app.MaxReviewScore-app.MinReviewScore)
+	reviews := dialect.From(goqu.T("order_product_reviews").As("r")).
+		Join(goqu.T("order_products").As("op"), goqu.On(goqu.I("op.uuid").Eq(goqu.I("r.order_product_uuid")))).
+		GroupBy(goqu.I("op.product_uuid"))
+
+	statsQuery, _, err := dialect.Insert("product_review_stats").Cols("product_uuid", "review_count", "score_sum",
+		"positive_count", "neutral_count", "negative_count", "star_1", "star_2", "star_3", "star_4", "star_5",
+		"last_review_at").FromQuery(reviews.Select(goqu.I("op.product_uuid"), goqu.COUNT(goqu.Star()),
+		goqu.L("SUM("+score+")"), goqu.L("SUM("+score+" > 0)"), goqu.L("SUM("+score+" = 0)"),
+		goqu.L("SUM("+score+" < 0)"), goqu.L("SUM("+stars+" = 1)"), goqu.L("SUM("+stars+" = 2)"),
+		goqu.L("SUM("+stars+" = 3)"), goqu.L("SUM("+stars+" = 4)"), goqu.L("SUM("+stars+" = 5)"),
+		goqu.MAX(goqu.I("r.created_at")))).ToSQL()
+	if err != nil {
+		return 0, app.NewError("Error while preparing rebuild of product review stats",
+			fmt.Errorf("rebuild product review stats: %w", err))
+	}
+	dailyQuery, _, err := dialect.Insert("product_review_daily_stats").Cols("product_uuid", "day", "review_count",
+		"score_sum").FromQuery(reviews.GroupBy(goqu.I("op.product_uuid"), goqu.L("DATE(`r`.`created_at`)")).
+		Select(goqu.I("op.product_uuid"), goqu.L("DATE(`r`.`created_at`)"), goqu.COUNT(goqu.Star()),
+			goqu.L("SUM("+score+")"))).ToSQL()
+	if err != nil {
+		return 0, app.NewError("Error while preparing rebuild of product review stats",
+			fmt.Errorf("rebuild product daily review stats: %w", err))
+	}
+	deleteStatsQuery, _, err := dialect.Delete("product_review_stats").ToSQL()
+	if err != nil {
+		return 0, app.NewError("Error while preparing rebuild of product review stats",
+			fmt.Errorf("delete product review stats: %w", err))
+	}
+	deleteDailyQuery, _, err := dialect.Delete("product_review_daily_stats").ToSQL()
+	if err != nil {
+		return 0, app.NewError("Error while preparing rebuild of product review stats",
+			fmt.Errorf("delete product daily review stats: %w", err))
+	}
+
+	var products int64
+	err = database.WithinTransaction(ctx, ds.db, func(tx *sqlx.Tx) error {
+		for _, sqlQuery := range []string{deleteDailyQuery, deleteStatsQuery, dailyQuery} {
+			if _, err := tx.ExecContext(ctx, sqlQuery); err != nil {
+				return app.NewError("Error while rebuilding product review stats",
+					fmt.Errorf("rebuild product review stats: %w", err))
+			}
+		}
+		res, err := tx.ExecContext(ctx, statsQuery)
+		if err != nil {
+			return app.NewError("Error while rebuilding product review stats",
+				fmt.Errorf("rebuild product review stats: %w", err))
+		}
+		products, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return products, nil
+}
+
+// ensureExists returns an app.ErrNoRecords error with msg if table has no row with the given UUID.
+func (ds *DatabaseRepository) ensureExists(ctx context.Context, table string, uuid string, msg string) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select(goqu.L("1")).From(table).Where(goqu.C("uuid").Eq(uuid)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing querying for reviews", fmt.Errorf("get %s by uuid: %w", table, err))
+	}
+
+	var found int
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&found)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return app.NewError(msg, app.ErrNoRecords)
+		}
+		return app.NewError("Error while getting reviews", fmt.Errorf("get %s by uuid: %w", table, err))
+	}
+
+	return nil
+}
+
+// getReviews retrieves from storage the reviews matching subject and query, sorted by query.Sort and then by UUID,
+// so the listing continues right after query.After.
+func (ds *DatabaseRepository) getReviews(ctx context.Context, subject exp.Expression,
+	query app.ReviewQuery) ([]app.Review, error) {
+	where := []exp.Expression{subject}
+	switch query.Sentiment {
+	case app.SentimentPositive:
+		where = append(where, goqu.I("r.score").Gt(0))
+	case app.SentimentNeutral:
+		where = append(where, goqu.I("r.score").Eq(0))
+	case app.SentimentNegative:
+		where = append(where, goqu.I("r.score").Lt(0))
+	}
+	if !query.From.IsZero() {
+		where = append(where, goqu.I("r.created_at").Gte(query.From))
+	}
+	if !query.To.IsZero() {
+		where = append(where, goqu.I("r.created_at").Lt(query.To))
+	}
+
+	column, descending := sortColumn(query.Sort)
+	if query.After != nil {
+		var value any = query.After.CreatedAt
+		if column == "r.score" {
+			value = query.After.Score
+		}
+		if descending {
+			where = append(where, goqu.Or(goqu.I(column).Lt(value),
+				goqu.And(goqu.I(column).Eq(value), goqu.I("r.uuid").Lt(query.After.UUID))))
+		} else {
+			where = append(where, goqu.Or(goqu.I(column).Gt(value),
+				goqu.And(goqu.I(column).Eq(value), goqu.I("r.uuid").Gt(query.After.UUID))))
+		}
+	}
+	order := []exp.OrderedExpression{goqu.I(column).Asc(), goqu.I("r.uuid").Asc()}
+	if descending {
+		order = []exp.OrderedExpression{goqu.I(column).Desc(), goqu.I("r.uuid").Desc()}
+	}
+
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("r.uuid", "op.order_uuid", "r.order_product_uuid", "op.product_uuid",
+		"o.customer_uuid", "r.score", "r.text", "r.created_at").
+		From(goqu.T("order_product_reviews").As("r")).
+		Join(goqu.T("order_products").As("op"), goqu.On(goqu.I("op.uuid").Eq(goqu.I("r.order_product_uuid")))).
+		Join(goqu.T("orders").As("o"), goqu.On(goqu.I("o.uuid").Eq(goqu.I("op.order_uuid")))).
+		Where(where...).Order(order...).Limit(uint(query.Limit)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for reviews", fmt.Errorf("get reviews: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting reviews", fmt.Errorf("get reviews: %w", err))
+	}
+	defer rows.Close()
+	reviews := []app.Review{}
+	for rows.Next() {
+		var reviewStore ReviewStore
+		if err := rows.Scan(&reviewStore.UUID, &reviewStore.OrderUUID, &reviewStore.OrderProductUUID,
+			&reviewStore.ProductUUID, &reviewStore.CustomerUUID, &reviewStore.Score, &reviewStore.Text,
+			&reviewStore.CreatedAt); err != nil {
+			return nil, app.NewError("Error while reading reviews", fmt.Errorf("get reviews: %w", err))
+		}
+		reviews = append(reviews, ds.ReviewStoreToReview(reviewStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading reviews", fmt.Errorf("get reviews: %w", err))
+	}
+
+	return reviews, nil
+}
+
+// sortColumn returns the column reviews are sorted by and whether the order is descending.
+func sortColumn(sort app.ReviewSort) (string, bool) {
+	switch sort {
+	case app.ReviewSortOldest:
+		return "r.created_at", false
+	case app.ReviewSortHighest:
+		return "r.score", true
+	case app.ReviewSortLowest:
+		return "r.score", false
+	default:
+		return "r.created_at", true
+	}
+}
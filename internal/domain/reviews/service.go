@@ -0,0 +1,147 @@
+package reviews
+
+import (
+	"context"
+	"fmt"
+	"reviewbot/app"
+	"reviewbot/internal/pagination"
+	"time"
+)
+
+const (
+	// DefaultLimit is the number of reviews of a page when the query sets no limit.
+	DefaultLimit = 20
+	// MaxLimit is the largest number of reviews of a page.
+	MaxLimit = 100
+	// TrendDays is the number of days of the review trend of a product summary.
+	TrendDays = 30
+)
+
+// ErrInvalidReviewQuery is returned when a review listing query is not valid.
+var ErrInvalidReviewQuery = app.NewCodedError(app.CodeInvalid, "invalid review query", nil)
+
+// Service wraps the reviews repository.
+type Service struct {
+	repo app.ReviewsRepository
+}
+
+// NewService returns a new Service.
+func NewService(repo app.ReviewsRepository) *Service {
+	return &Service{repo: repo}
+}
+
+// OrderReviews gets a page of the reviews of an order's products. cursor is the NextCursor of the previous page,
+// empty for the first page.
+func (s *Service) OrderReviews(ctx context.Context, orderUUID string, query app.ReviewQuery,
+	cursor string) (*app.ReviewPage, error) {
+	return s.list(query, cursor, func(query app.ReviewQuery) ([]app.Review, error) {
+		return s.repo.GetReviewsByOrderUUID(ctx, orderUUID, query)
+	})
+}
+
+// ProductReviews gets a page of the reviews of a product. cursor is the NextCursor of the previous page, empty for
+// the first page.
+func (s *Service) ProductReviews(ctx context.Context, productUUID string, query app.ReviewQuery,
+	cursor string) (*app.ReviewPage, error) {
+	return s.list(query, cursor, func(query app.ReviewQuery) ([]app.Review, error) {
+		return s.repo.GetReviewsByProductUUID(ctx, productUUID, query)
+	})
+}
+
+// CustomerReviews gets a page of the reviews a customer gave. cursor is the NextCursor of the previous page, empty
+// for the first page.
+func (s *Service) CustomerReviews(ctx context.Context, customerUUID string, query app.ReviewQuery,
+	cursor string) (*app.ReviewPage, error) {
+	return s.list(query, cursor, func(query app.ReviewQuery) ([]app.Review, error) {
+		return s.repo.GetReviewsByCustomerUUID(ctx, customerUUID, query)
+	})
+}
+
+// ProductSummary gets the review totals of a product along with the trend of its last TrendDays days of reviews.
+func (s *Service) ProductSummary(ctx context.Context, productUUID string) (*app.ProductReviewSummary, error) {
+	stats, err := s.repo.GetProductReviewStats(ctx, productUUID)
+	if err != nil {
+		return nil, err
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, -(TrendDays - 1))
+	days, err := s.repo.GetProductDailyReviewStats(ctx, productUUID, start.AddDate(0, 0, -TrendDays))
+	if err != nil {
+		return nil, err
+	}
+	return &app.ProductReviewSummary{Stats: *stats, Trend: reviewTrend(days, start)}, nil
+}
+
+// RebuildStats recomputes the review totals of every product from the stored reviews and returns the number of
+// products with reviews. The totals are otherwise maintained as reviews are added.
+func (s *Service) RebuildStats(ctx context.Context) (int64, error) {
+	return s.repo.RebuildProductReviewStats(ctx)
+}
+
+// reviewTrend compares the daily totals of the TrendDays days from start with the ones of the TrendDays days
+// before. The daily totals of the trend include every day from start, with or without reviews.
+func reviewTrend(days []app.DailyReviewStats, start time.Time) app.ReviewTrend {
+	trend := app.ReviewTrend{Days: TrendDays, Daily: make([]app.DailyReviewStats, TrendDays)}
+	for i := range trend.Daily {
+		trend.Daily[i].Day = start.AddDate(0, 0, i)
+	}
+	var sum, previousSum int64
+	for _, day := range days {
+		index := int(day.Day.UTC().Sub(start).Hours() / 24)
+		if day.Day.Before(start) {
+			trend.PreviousReviewCount += day.ReviewCount
+			previousSum += day.ScoreSum
+			continue
+		}
+		if index >= TrendDays {
+			continue
+		}
+		trend.Daily[index].ReviewCount = day.ReviewCount
+		trend.Daily[index].ScoreSum = day.ScoreSum
+		trend.ReviewCount += day.ReviewCount
+		sum += day.ScoreSum
+	}
+	trend.MeanScore = app.MeanScore(sum, trend.ReviewCount)
+	trend.PreviousMeanScore = app.MeanScore(previousSum, trend.PreviousReviewCount)
+	return trend
+}
+
+// list validates query, fetches one review more than the page holds to learn whether another page follows, and
+// returns the page along with the cursor of the next one.
+func (s *Service) list(query app.ReviewQuery, cursor string,
+	get func(query app.ReviewQuery) ([]app.Review, error)) (*app.ReviewPage, error) {
+	if query.Sort == "" {
+		query.Sort = app.ReviewSortNewest
+	}
+	if !query.Sort.IsValid() {
+		return nil, app.NewError(fmt.Sprintf("Unknown review sort %q", query.Sort), ErrInvalidReviewQuery)
+	}
+	if query.Sentiment != "" && !query.Sentiment.IsValid() {
+		return nil, app.NewError(fmt.Sprintf("Unknown sentiment %q", query.Sentiment), ErrInvalidReviewQuery)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return nil, app.NewError("The from date must be before the to date", ErrInvalidReviewQuery)
+	}
+	limit, err := pagination.Limit(query.Limit, DefaultLimit, MaxLimit, ErrInvalidReviewQuery)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != "" {
+		var after app.ReviewCursor
+		if err := pagination.DecodeCursor(cursor, &after); err != nil || after.UUID == "" || after.Sort != query.Sort {
+			return nil, app.NewError("The cursor is invalid or belongs to another sort", ErrInvalidReviewQuery)
+		}
+		query.After = &after
+	}
+
+	reviews, next, err := pagination.Fetch(limit, func(limit int) ([]app.Review, error) {
+		query.Limit = limit
+		return get(query)
+	}, func(last app.Review) any {
+		return app.ReviewCursor{Sort: query.Sort, Score: last.Score, CreatedAt: last.CreatedAt, UUID: last.UUID}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &app.ReviewPage{Reviews: reviews, NextCursor: next}, nil
+}
@@ -0,0 +1,170 @@
+package reviews
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"reviewbot/app"
+	"reviewbot/internal/pagination"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestService(t *testing.T) (*sql.DB, *Service, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	return db, NewService(NewDatabaseRepository(sqlx.NewDb(db, "mysql"))), mock
+}
+
+var (
+	reviewColumns = []string{"uuid", "order_uuid", "order_product_uuid", "product_uuid", "customer_uuid", "score",
+		"text", "created_at"}
+	existsQuery = regexp.QuoteMeta("SELECT 1 FROM `products` WHERE (`uuid` = 'prod1')")
+	testTime    = time.Date(2023, 12, 12, 12, 0, 0, 0, time.UTC)
+)
+
+// TestProductReviewsPaginates tests that a full page returns a cursor that continues the listing after its last
+// review.
+func TestProductReviewsPaginates(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	mock.ExpectQuery(existsQuery).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `order_product_reviews` AS `r` INNER JOIN `order_products` AS `op`") +
+		".*" + regexp.QuoteMeta("WHERE ((`op`.`product_uuid` = 'prod1') AND (`r`.`score` < 0)) "+
+		"ORDER BY `r`.`created_at` DESC, `r`.`uuid` DESC LIMIT 3")).
+		WillReturnRows(sqlmock.NewRows(reviewColumns).
+			AddRow("rev3", "ord2", "op3", "prod1", "cus1", -1, "Broke at once", testTime).
+			AddRow("rev2", "ord1", "op2", "prod1", "cus2", -1, nil, testTime).
+			AddRow("rev1", "ord1", "op1", "prod1", "cus2", -1, "Meh", testTime.Add(-time.Hour)))
+	mock.ExpectQuery(existsQuery).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE ((`op`.`product_uuid` = 'prod1') AND (`r`.`score` < 0) AND " +
+		"((`r`.`created_at` < '2023-12-12 12:00:00') OR ((`r`.`created_at` = '2023-12-12 12:00:00') AND " +
+		"(`r`.`uuid` < 'rev2')))) ORDER BY `r`.`created_at` DESC, `r`.`uuid` DESC LIMIT 3")).
+		WillReturnRows(sqlmock.NewRows(reviewColumns).
+			AddRow("rev1", "ord1", "op1", "prod1", "cus2", -1, "Meh", testTime.Add(-time.Hour)))
+	query := app.ReviewQuery{Sentiment: app.SentimentNegative, Limit: 2}
+
+	// Act
+	first, err := service.ProductReviews(context.Background(), "prod1", query, "")
+	if err != nil {
+		t.Fatalf("Error listing reviews: %v", err)
+	}
+	second, err := service.ProductReviews(context.Background(), "prod1", query, first.NextCursor)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error listing reviews: %v", err)
+	}
+	if len(first.Reviews) != 2 || first.Reviews[0].Text != "Broke at once" || first.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %+v", first)
+	}
+	if len(second.Reviews) != 1 || second.Reviews[0].UUID != "rev1" || second.NextCursor != "" {
+		t.Fatalf("Unexpected second page: %+v", second)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestProductReviewsUnknownProduct tests that listing the reviews of a missing product is reported as not found.
+func TestProductReviewsUnknownProduct(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	mock.ExpectQuery(existsQuery).WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+	// Act
+	_, err := service.ProductReviews(context.Background(), "prod1", app.ReviewQuery{}, "")
+	// Assert
+	if !errors.Is(err, app.ErrNoRecords) {
+		t.Fatalf("Expected app.ErrNoRecords, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestReviewsValidatesQuery tests that invalid queries are rejected before reaching the database.
+func TestReviewsValidatesQuery(t *testing.T) {
+	cursor := pagination.EncodeCursor(app.ReviewCursor{Sort: app.ReviewSortNewest, UUID: "rev1"})
+	tests := []struct {
+		name   string
+		query  app.ReviewQuery
+		cursor string
+	}{
+		{name: "unknown sort", query: app.ReviewQuery{Sort: "text"}},
+		{name: "unknown sentiment", query: app.ReviewQuery{Sentiment: "angry"}},
+		{name: "empty date range", query: app.ReviewQuery{From: testTime, To: testTime}},
+		{name: "limit too large", query: app.ReviewQuery{Limit: MaxLimit + 1}},
+		{name: "malformed cursor", cursor: "not a cursor"},
+		{name: "cursor of another sort", query: app.ReviewQuery{Sort: app.ReviewSortLowest}, cursor: cursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, service, _ := newTestService(t)
+			defer db.Close()
+
+			// Act
+			_, err := service.OrderReviews(context.Background(), "ord1", tt.query, tt.cursor)
+			// Assert
+			if !errors.Is(err, ErrInvalidReviewQuery) {
+				t.Fatalf("Expected ErrInvalidReviewQuery, got %v", err)
+			}
+		})
+	}
+}
+
+// TestProductSummaryTrend tests that the trend compares the last TrendDays days with the TrendDays days before.
+func TestProductSummaryTrend(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	mock.ExpectQuery(existsQuery).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `product_review_stats` WHERE (`product_uuid` = 'prod1')")).
+		WillReturnRows(sqlmock.NewRows([]string{"review_count", "score_sum", "positive_count", "neutral_count",
+			"negative_count", "star_1", "star_2", "star_3", "star_4", "star_5", "last_review_at"}).
+			AddRow(4, 2, 2, 1, 1, 0, 1, 1, 1, 1, today))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `product_review_daily_stats` WHERE ((`product_uuid` = 'prod1') AND " +
+		"(`day` >= '" + today.AddDate(0, 0, -2*TrendDays+1).Format("2006-01-02 15:04:05") + "'))")).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "review_count", "score_sum"}).
+			AddRow(today.AddDate(0, 0, -TrendDays-3), 1, -1).
+			AddRow(today.AddDate(0, 0, -1), 1, 1).
+			AddRow(today, 2, 2))
+
+	// Act
+	summary, err := service.ProductSummary(context.Background(), "prod1")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error getting product summary: %v", err)
+	}
+	if summary.Stats.ReviewCount != 4 || summary.Stats.MeanScore() != 0.5 {
+		t.Fatalf("Stats mismatch: got %d reviews with mean %v, want %d with mean %v", summary.Stats.ReviewCount,
+			summary.Stats.MeanScore(), 4, 0.5)
+	}
+	trend := summary.Trend
+	if len(trend.Daily) != TrendDays || !trend.Daily[TrendDays-1].Day.Equal(today) {
+		t.Fatalf("Daily stats mismatch: got %d days, want %d ending today", len(trend.Daily), TrendDays)
+	}
+	if trend.ReviewCount != 3 || trend.MeanScore != 1 {
+		t.Fatalf("Trend mismatch: got %d reviews with mean %v, want %d with mean %v", trend.ReviewCount,
+			trend.MeanScore, 3, 1.0)
+	}
+	if trend.PreviousReviewCount != 1 || trend.PreviousMeanScore != -1 {
+		t.Fatalf("Previous trend mismatch: got %d reviews with mean %v, want %d with mean %v",
+			trend.PreviousReviewCount, trend.PreviousMeanScore, 1, -1.0)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,418 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+	"reviewbot/internal/database"
+	"strings"
+	"time"
+)
+
+// WebhookSubscriptionStore represents a webhook subscription entity at the Database.
+type WebhookSubscriptionStore struct {
+	UUID      string
+	URL       string
+	Secret    string
+	Events    string
+	CreatedAt time.Time
+}
+
+// WebhookDeliveryStore represents a webhook delivery or dead letter entity at the Database.
+type WebhookDeliveryStore struct {
+	UUID             string
+	SubscriptionUUID string
+	EventID          string
+	EventType        string
+	Payload          []byte
+	Status           string
+	Attempts         int
+	LastError        sql.NullString
+	NextAttemptAt    time.Time
+	CreatedAt        time.Time
+}
+
+// DatabaseRepository implements the WebhooksRepository interface.
+type DatabaseRepository struct {
+	db *sqlx.DB
+}
+
+// NewDatabaseRepository returns a new DatabaseRepository.
+func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
+	return &DatabaseRepository{
+		db: db,
+	}
+}
+
+// WebhookSubscriptionStoreToWebhookSubscription converts a WebhookSubscriptionStore object to an
+// app.WebhookSubscription
+func (ds *DatabaseRepository) WebhookSubscriptionStoreToWebhookSubscription(
+	subscriptionStore WebhookSubscriptionStore) app.WebhookSubscription {
+	return app.WebhookSubscription{
+		UUID:      subscriptionStore.UUID,
+		URL:       subscriptionStore.URL,
+		Secret:    subscriptionStore.Secret,
+		Events:    strings.Split(subscriptionStore.Events, ","),
+		CreatedAt: subscriptionStore.CreatedAt,
+	}
+}
+
+// WebhookDeliveryStoreToWebhookDelivery converts a WebhookDeliveryStore object to an app.WebhookDelivery
+func (ds *DatabaseRepository) WebhookDeliveryStoreToWebhookDelivery(
+	deliveryStore WebhookDeliveryStore) app.WebhookDelivery {
+	return app.WebhookDelivery{
+		UUID:             deliveryStore.UUID,
+		SubscriptionUUID: deliveryStore.SubscriptionUUID,
+		EventID:          deliveryStore.EventID,
+		EventType:        deliveryStore.EventType,
+		Payload:          deliveryStore.Payload,
+		Status:           app.WebhookDeliveryStatus(deliveryStore.Status),
+		Attempts:         deliveryStore.Attempts,
+		LastError:        deliveryStore.LastError.String,
+		NextAttemptAt:    deliveryStore.NextAttemptAt,
+		CreatedAt:        deliveryStore.CreatedAt,
+	}
+}
+
+// AddWebhookSubscription stores a webhook subscription.
+func (ds *DatabaseRepository) AddWebhookSubscription(ctx context.Context,
+	subscription app.WebhookSubscription) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("webhook_subscriptions").Cols("uuid", "url", "secret", "events",
+		"created_at").Vals(goqu.Vals{subscription.UUID, subscription.URL, subscription.Secret,
+		strings.Join(subscription.Events, ","), subscription.CreatedAt}).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for webhook subscription",
+			fmt.Errorf("insert webhook subscription: %w", err))
+	}
+	if _, err := ds.db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while inserting webhook subscription",
+			fmt.Errorf("insert webhook subscription: %w", err))
+	}
+
+	return nil
+}
+
+// GetWebhookSubscriptions retrieves from storage every webhook subscription, oldest first.
+func (ds *DatabaseRepository) GetWebhookSubscriptions(ctx context.Context) ([]app.WebhookSubscription, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "url", "secret", "events", "created_at").
+		From("webhook_subscriptions").Order(goqu.C("created_at").Asc()).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for webhook subscriptions",
+			fmt.Errorf("get webhook subscriptions: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting webhook subscriptions",
+			fmt.Errorf("get webhook subscriptions: %w", err))
+	}
+	defer rows.Close()
+	subscriptions := []app.WebhookSubscription{}
+	for rows.Next() {
+		var subscriptionStore WebhookSubscriptionStore
+		if err := rows.Scan(&subscriptionStore.UUID, &subscriptionStore.URL, &subscriptionStore.Secret,
+			&subscriptionStore.Events, &subscriptionStore.CreatedAt); err != nil {
+			return nil, app.NewError("Error while reading webhook subscriptions",
+				fmt.Errorf("get webhook subscriptions: %w", err))
+		}
+		subscriptions = append(subscriptions, ds.WebhookSubscriptionStoreToWebhookSubscription(subscriptionStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading webhook subscriptions",
+			fmt.Errorf("get webhook subscriptions: %w", err))
+	}
+
+	return subscriptions, nil
+}
+
+// GetWebhookSubscriptionByUUID retrieves from storage a webhook subscription by its UUID.
+func (ds *DatabaseRepository) GetWebhookSubscriptionByUUID(ctx context.Context,
+	subscriptionUUID string) (*app.WebhookSubscription, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "url", "secret", "events", "created_at").
+		From("webhook_subscriptions").Where(goqu.C("uuid").Eq(subscriptionUUID)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for webhook subscription",
+			fmt.Errorf("get webhook subscription: %w", err))
+	}
+
+	var subscriptionStore WebhookSubscriptionStore
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&subscriptionStore.UUID, &subscriptionStore.URL,
+		&subscriptionStore.Secret, &subscriptionStore.Events, &subscriptionStore.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, app.NewError("Webhook subscription not found", app.ErrNoRecords)
+	}
+	if err != nil {
+		return nil, app.NewError("Error while getting webhook subscription",
+			fmt.Errorf("get webhook subscription: %w", err))
+	}
+
+	subscription := ds.WebhookSubscriptionStoreToWebhookSubscription(subscriptionStore)
+	return &subscription, nil
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription along with its deliveries and dead letters.
+func (ds *DatabaseRepository) DeleteWebhookSubscription(ctx context.Context, subscriptionUUID string) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Delete("webhook_subscriptions").Where(goqu.C("uuid").Eq(subscriptionUUID)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing delete for webhook subscription",
+			fmt.Errorf("delete webhook subscription: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while deleting webhook subscription",
+			fmt.Errorf("delete webhook subscription: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Webhook subscription not found", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// AddWebhookDelivery stores a pending delivery, unless the event was already delivered to the subscription.
+func (ds *DatabaseRepository) AddWebhookDelivery(ctx context.Context, delivery app.WebhookDelivery) error {
+	return addWebhookDelivery(ctx, ds.db, delivery)
+}
+
+// GetDueWebhookDeliveries retrieves from storage the pending deliveries whose next attempt is due, earliest first.
+// Deliveries claimed before staleBefore are considered abandoned and are returned as well.
+func (ds *DatabaseRepository) GetDueWebhookDeliveries(ctx context.Context, now time.Time, staleBefore time.Time,
+	limit int) ([]app.WebhookDelivery, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "subscription_uuid", "event_id", "event_type", "payload", "status",
+		"attempts", "last_error", "next_attempt_at", "created_at").From("webhook_deliveries").
+		Where(claimableDelivery(now, staleBefore)).Order(goqu.C("next_attempt_at").Asc()).Limit(uint(limit)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for webhook deliveries",
+			fmt.Errorf("get due webhook deliveries: %w", err))
+	}
+
+	return ds.queryWebhookDeliveries(ctx, sqlQuery)
+}
+
+// ClaimWebhookDelivery marks a due delivery as being sent and counts the attempt.
+// The conditional update lets only one of several concurrent deliverers claim a delivery.
+func (ds *DatabaseRepository) ClaimWebhookDelivery(ctx context.Context, deliveryUUID string, now time.Time,
+	staleBefore time.Time) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("webhook_deliveries").Set(goqu.Record{
+		"status":     string(app.WebhookDeliveryStatusSending),
+		"claimed_at": now,
+		"attempts":   goqu.L("`attempts` + 1"),
+	}).Where(goqu.C("uuid").Eq(deliveryUUID), claimableDelivery(now, staleBefore)).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing update for webhook delivery",
+			fmt.Errorf("claim webhook delivery: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while updating webhook delivery",
+			fmt.Errorf("claim webhook delivery: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while updating webhook delivery",
+			fmt.Errorf("claim webhook delivery: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// MarkWebhookDeliveryDelivered marks a delivery as delivered.
+func (ds *DatabaseRepository) MarkWebhookDeliveryDelivered(ctx context.Context, deliveryUUID string,
+	deliveredAt time.Time) error {
+	return ds.updateWebhookDelivery(ctx, deliveryUUID, goqu.Record{
+		"status":       string(app.WebhookDeliveryStatusDelivered),
+		"delivered_at": deliveredAt,
+		"claimed_at":   nil,
+		"last_error":   nil,
+	})
+}
+
+// RescheduleWebhookDelivery records a failed delivery attempt and makes the delivery pending again.
+func (ds *DatabaseRepository) RescheduleWebhookDelivery(ctx context.Context, deliveryUUID string,
+	nextAttemptAt time.Time, lastError string) error {
+	return ds.updateWebhookDelivery(ctx, deliveryUUID, goqu.Record{
+		"status":          string(app.WebhookDeliveryStatusPending),
+		"next_attempt_at": nextAttemptAt,
+		"claimed_at":      nil,
+		"last_error":      lastError,
+	})
+}
+
+// DeadLetterWebhookDelivery moves a delivery to the dead letters in a single transaction.
+func (ds *DatabaseRepository) DeadLetterWebhookDelivery(ctx context.Context, delivery app.WebhookDelivery,
+	failedAt time.Time) error {
+	dialect := goqu.Dialect("mysql")
+	insertQuery, _, err := dialect.Insert("webhook_dead_letters").Cols("uuid", "subscription_uuid", "event_id",
+		"event_type", "payload", "attempts", "last_error", "created_at", "failed_at").Vals(goqu.Vals{delivery.UUID,
+		delivery.SubscriptionUUID, delivery.EventID, delivery.EventType, delivery.Payload, delivery.Attempts,
+		delivery.LastError, delivery.CreatedAt, failedAt}).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for webhook dead letter",
+			fmt.Errorf("dead letter webhook delivery: %w", err))
+	}
+	deleteQuery, _, err := dialect.Delete("webhook_deliveries").Where(goqu.C("uuid").Eq(delivery.UUID)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing delete for webhook delivery",
+			fmt.Errorf("dead letter webhook delivery: %w", err))
+	}
+
+	return database.WithinTransaction(ctx, ds.db, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, insertQuery); err != nil {
+			return app.NewError("Error while inserting webhook dead letter",
+				fmt.Errorf("dead letter webhook delivery: %w", err))
+		}
+		if _, err := tx.ExecContext(ctx, deleteQuery); err != nil {
+			return app.NewError("Error while deleting webhook delivery",
+				fmt.Errorf("dead letter webhook delivery: %w", err))
+		}
+		return nil
+	})
+}
+
+// GetWebhookDeadLetters retrieves from storage the dead letters of a webhook subscription, most recent first.
+func (ds *DatabaseRepository) GetWebhookDeadLetters(ctx context.Context,
+	subscriptionUUID string) ([]app.WebhookDelivery, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "subscription_uuid", "event_id", "event_type", "payload",
+		goqu.V(string(app.WebhookDeliveryStatusDead)).As("status"), "attempts", "last_error", goqu.C("failed_at").As("next_attempt_at"),
+		"created_at").From("webhook_dead_letters").Where(goqu.C("subscription_uuid").Eq(subscriptionUUID)).
+		Order(goqu.C("failed_at").Desc()).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for webhook dead letters",
+			fmt.Errorf("get webhook dead letters: %w", err))
+	}
+
+	return ds.queryWebhookDeliveries(ctx, sqlQuery)
+}
+
+// RedeliverWebhookDeadLetter moves a dead letter back to the pending deliveries in a single transaction, with its
+// attempts reset.
+func (ds *DatabaseRepository) RedeliverWebhookDeadLetter(ctx context.Context, subscriptionUUID string,
+	deadLetterUUID string, now time.Time) error {
+	dialect := goqu.Dialect("mysql")
+	selectQuery, _, err := dialect.Select("uuid", "subscription_uuid", "event_id", "event_type", "payload",
+		"created_at").From("webhook_dead_letters").Where(goqu.C("uuid").Eq(deadLetterUUID),
+		goqu.C("subscription_uuid").Eq(subscriptionUUID)).ForUpdate(goqu.Wait).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing querying for webhook dead letter",
+			fmt.Errorf("redeliver webhook dead letter: %w", err))
+	}
+	deleteQuery, _, err := dialect.Delete("webhook_dead_letters").Where(goqu.C("uuid").Eq(deadLetterUUID)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing delete for webhook dead letter",
+			fmt.Errorf("redeliver webhook dead letter: %w", err))
+	}
+
+	return database.WithinTransaction(ctx, ds.db, func(tx *sqlx.Tx) error {
+		var deliveryStore WebhookDeliveryStore
+		err := tx.QueryRowContext(ctx, selectQuery).Scan(&deliveryStore.UUID, &deliveryStore.SubscriptionUUID,
+			&deliveryStore.EventID, &deliveryStore.EventType, &deliveryStore.Payload, &deliveryStore.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return app.NewError("Webhook dead letter not found", app.ErrNoRecords)
+		}
+		if err != nil {
+			return app.NewError("Error while getting webhook dead letter",
+				fmt.Errorf("redeliver webhook dead letter: %w", err))
+		}
+
+		delivery := ds.WebhookDeliveryStoreToWebhookDelivery(deliveryStore)
+		delivery.NextAttemptAt = now
+		if err := addWebhookDelivery(ctx, tx, delivery); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, deleteQuery); err != nil {
+			return app.NewError("Error while deleting webhook dead letter",
+				fmt.Errorf("redeliver webhook dead letter: %w", err))
+		}
+		return nil
+	})
+}
+
+func (ds *DatabaseRepository) queryWebhookDeliveries(ctx context.Context,
+	sqlQuery string) ([]app.WebhookDelivery, error) {
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting webhook deliveries",
+			fmt.Errorf("get webhook deliveries: %w", err))
+	}
+	defer rows.Close()
+	deliveries := []app.WebhookDelivery{}
+	for rows.Next() {
+		var deliveryStore WebhookDeliveryStore
+		if err := rows.Scan(&deliveryStore.UUID, &deliveryStore.SubscriptionUUID, &deliveryStore.EventID,
+			&deliveryStore.EventType, &deliveryStore.Payload, &deliveryStore.Status, &deliveryStore.Attempts,
+			&deliveryStore.LastError, &deliveryStore.NextAttemptAt, &deliveryStore.CreatedAt); err != nil {
+			return nil, app.NewError("Error while reading webhook deliveries",
+				fmt.Errorf("get webhook deliveries: %w", err))
+		}
+		deliveries = append(deliveries, ds.WebhookDeliveryStoreToWebhookDelivery(deliveryStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading webhook deliveries",
+			fmt.Errorf("get webhook deliveries: %w", err))
+	}
+
+	return deliveries, nil
+}
+
+func (ds *DatabaseRepository) updateWebhookDelivery(ctx context.Context, deliveryUUID string,
+	record goqu.Record) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("webhook_deliveries").Set(record).Where(goqu.C("uuid").Eq(deliveryUUID)).
+		ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for webhook delivery",
+			fmt.Errorf("update webhook delivery: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while updating webhook delivery", fmt.Errorf("update webhook delivery: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while updating webhook delivery", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+func addWebhookDelivery(ctx context.Context, db sqlx.ExecerContext, delivery app.WebhookDelivery) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("webhook_deliveries").Cols("uuid", "subscription_uuid", "event_id",
+		"event_type", "payload", "status", "attempts", "next_attempt_at", "created_at").Vals(goqu.Vals{delivery.UUID,
+		delivery.SubscriptionUUID, delivery.EventID, delivery.EventType, delivery.Payload,
+		string(app.WebhookDeliveryStatusPending), 0, delivery.NextAttemptAt, delivery.CreatedAt}).
+		OnConflict(goqu.DoNothing()).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing insert for webhook delivery",
+			fmt.Errorf("insert webhook delivery: %w", err))
+	}
+	if _, err := db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while inserting webhook delivery", fmt.Errorf("insert webhook delivery: %w", err))
+	}
+
+	return nil
+}
+
+func claimableDelivery(now time.Time, staleBefore time.Time) goqu.Expression {
+	return goqu.Or(
+		goqu.And(
+			goqu.C("status").Eq(string(app.WebhookDeliveryStatusPending)),
+			goqu.C("next_attempt_at").Lte(now),
+		),
+		goqu.And(
+			goqu.C("status").Eq(string(app.WebhookDeliveryStatusSending)),
+			goqu.C("claimed_at").Lt(staleBefore),
+		),
+	)
+}
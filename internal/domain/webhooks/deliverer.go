@@ -0,0 +1,40 @@
+package webhooks
+
+import (
+	"context"
+	"golang.org/x/exp/slog"
+	"time"
+)
+
+// Deliverer sends the due webhook deliveries periodically.
+type Deliverer struct {
+	service  *Service
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewDeliverer returns a new Deliverer polling for due deliveries every interval.
+func NewDeliverer(service *Service, interval time.Duration, logger *slog.Logger) *Deliverer {
+	return &Deliverer{service: service, interval: interval, logger: logger}
+}
+
+// Run sends the due deliveries every interval until ctx is cancelled.
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		delivered, err := d.service.DeliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Error("could not deliver webhooks", "err", err)
+		}
+		if delivered > 0 {
+			d.logger.Info("delivered webhooks", "count", delivered)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
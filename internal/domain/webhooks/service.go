@@ -0,0 +1,263 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"io"
+	"net/http"
+	"net/url"
+	"reviewbot/app"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Headers of the webhook requests.
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEventType = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// maxAttempts is the number of failed attempts after which a delivery is moved to the dead letters.
+	maxAttempts = 8
+	// retryDelay is the delay before the first retry of a failed delivery. It doubles with every attempt.
+	retryDelay = 30 * time.Second
+	// claimTimeout is the time after which a delivery claimed by a deliverer that never finished is retried.
+	claimTimeout     = 10 * time.Minute
+	deliverBatchSize = 50
+	deliveryTimeout  = 10 * time.Second
+)
+
+// ErrInvalidSubscription is returned when a webhook subscription is not valid.
+var ErrInvalidSubscription = app.NewCodedError(app.CodeInvalid, "invalid webhook subscription", nil)
+
+// Service wraps the webhooks repository.
+type Service struct {
+	repo   app.WebhooksRepository
+	client *http.Client
+	// allowPrivateTargets lets webhooks target addresses which are not public.
+	allowPrivateTargets bool
+	logger              *slog.Logger
+}
+
+// NewService returns a new Service. Webhooks may only target public addresses.
+func NewService(repo app.WebhooksRepository, logger *slog.Logger) *Service {
+	s := &Service{repo: repo, logger: logger}
+	s.client = newDeliveryClient(func() bool { return s.allowPrivateTargets })
+	return s
+}
+
+// AllowPrivateTargets lets webhooks target the loopback interface and private networks, for receivers running
+// next to the service. Anyone able to subscribe webhooks can then make the service post to internal services.
+func (s *Service) AllowPrivateTargets() {
+	s.allowPrivateTargets = true
+}
+
+// Subscribe registers a webhook subscription to the given event types. A random secret is generated if secret is
+// empty.
+func (s *Service) Subscribe(ctx context.Context, endpoint string, events []string,
+	secret string) (*app.WebhookSubscription, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, app.NewError("The webhook url must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+	if !s.allowPrivateTargets && !hostIsPublic(u.Hostname()) {
+		return nil, app.NewError("The webhook url must target a public address", ErrInvalidSubscription)
+	}
+	if len(events) == 0 {
+		return nil, app.NewError("The webhook must subscribe to at least one event", ErrInvalidSubscription)
+	}
+	for _, event := range events {
+		if !app.IsEventType(event) {
+			return nil, app.NewError(fmt.Sprintf("Unknown webhook event %q", event), ErrInvalidSubscription)
+		}
+	}
+	if secret == "" {
+		secret = uuid.New().String()
+	}
+
+	subscription := app.WebhookSubscription{
+		UUID:      uuid.New().String(),
+		URL:       endpoint,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.repo.AddWebhookSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// Subscriptions gets every webhook subscription.
+func (s *Service) Subscriptions(ctx context.Context) ([]app.WebhookSubscription, error) {
+	return s.repo.GetWebhookSubscriptions(ctx)
+}
+
+// SubscriptionByUUID gets a webhook subscription by its UUID.
+func (s *Service) SubscriptionByUUID(ctx context.Context, subscriptionUUID string) (*app.WebhookSubscription,
+	error) {
+	return s.repo.GetWebhookSubscriptionByUUID(ctx, subscriptionUUID)
+}
+
+// Unsubscribe deletes a webhook subscription by its UUID.
+func (s *Service) Unsubscribe(ctx context.Context, subscriptionUUID string) error {
+	return s.repo.DeleteWebhookSubscription(ctx, subscriptionUUID)
+}
+
+// DeadLetters gets the deliveries of a webhook subscription that failed too many times.
+func (s *Service) DeadLetters(ctx context.Context, subscriptionUUID string) ([]app.WebhookDelivery, error) {
+	if _, err := s.repo.GetWebhookSubscriptionByUUID(ctx, subscriptionUUID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetWebhookDeadLetters(ctx, subscriptionUUID)
+}
+
+// Redeliver schedules a dead letter of a webhook subscription to be delivered again.
+func (s *Service) Redeliver(ctx context.Context, subscriptionUUID string, deliveryUUID string) error {
+	return s.repo.RedeliverWebhookDeadLetter(ctx, subscriptionUUID, deliveryUUID, time.Now().UTC())
+}
+
+// Publish enqueues the delivery of an event to every webhook subscribed to its type.
+func (s *Service) Publish(ctx context.Context, event app.Event) error {
+	subscriptions, err := s.repo.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribes(event.Type) {
+			continue
+		}
+		err := s.repo.AddWebhookDelivery(ctx, app.WebhookDelivery{
+			UUID:             uuid.New().String(),
+			SubscriptionUUID: subscription.UUID,
+			EventID:          event.ID,
+			EventType:        event.Type,
+			Payload:          payload,
+			NextAttemptAt:    now,
+			CreatedAt:        now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleEvent enqueues the delivery of an event relayed from the outbox. It is an inprocesssink.Subscriber.
+// Deliveries are unique per subscription and event, so an event relayed more than once is delivered once.
+func (s *Service) HandleEvent(ctx context.Context, event eventsinktypes.Event) error {
+	return s.Publish(ctx, app.Event{ID: event.ID, Type: event.Type, OccurredAt: event.OccurredAt, Data: event.Data})
+}
+
+// DeliverDue sends the deliveries that are due and returns how many of them succeeded.
+// Failed deliveries are retried with an exponential backoff and moved to the dead letters once their attempts run
+// out.
+func (s *Service) DeliverDue(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	deliveries, err := s.repo.GetDueWebhookDeliveries(ctx, now, now.Add(-claimTimeout), deliverBatchSize)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+	subscriptions, err := s.repo.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	subscriptionsByUUID := make(map[string]app.WebhookSubscription, len(subscriptions))
+	for _, subscription := range subscriptions {
+		subscriptionsByUUID[subscription.UUID] = subscription
+	}
+
+	delivered := 0
+	for _, delivery := range deliveries {
+		subscription, ok := subscriptionsByUUID[delivery.SubscriptionUUID]
+		if !ok {
+			// The subscription was deleted along with its deliveries after they were read.
+			continue
+		}
+		claimed, err := s.repo.ClaimWebhookDelivery(ctx, delivery.UUID, now, now.Add(-claimTimeout))
+		if err != nil {
+			return delivered, err
+		}
+		if !claimed {
+			continue
+		}
+		delivery.Attempts++
+
+		if err := s.deliver(ctx, subscription, delivery); err != nil {
+			delivery.LastError = err.Error()
+			logger := s.logger.With("delivery_uuid", delivery.UUID, "event_type", delivery.EventType,
+				"attempt", delivery.Attempts, "err", err)
+			if delivery.Attempts >= maxAttempts {
+				logger.Error("could not deliver webhook, moving it to the dead letters")
+				err = s.repo.DeadLetterWebhookDelivery(ctx, delivery, time.Now().UTC())
+			} else {
+				logger.Warn("could not deliver webhook, retrying")
+				err = s.repo.RescheduleWebhookDelivery(ctx, delivery.UUID,
+					time.Now().UTC().Add(retryDelay<<(delivery.Attempts-1)), delivery.LastError)
+			}
+			if err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := s.repo.MarkWebhookDeliveryDelivered(ctx, delivery.UUID, time.Now().UTC()); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// deliver posts the payload of a delivery to the subscription's URL. Any response other than 2xx is a failure.
+func (s *Service) deliver(ctx context.Context, subscription app.WebhookSubscription,
+	delivery app.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, delivery.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook endpoint responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the value of the signature header of a webhook request: "sha256=" followed by the hex encoded
+// HMAC-SHA256, keyed with the subscription secret, of the timestamp header, a dot and the body.
+// Receivers compute it again to verify that a request comes from this service and was not altered.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,274 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"reviewbot/app"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/exp/slog"
+)
+
+func newTestService(t *testing.T) (*sql.DB, *Service, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	repo := NewDatabaseRepository(sqlx.NewDb(db, "mysql"))
+	return db, NewService(repo, slog.New(slog.NewTextHandler(io.Discard, nil))), mock
+}
+
+var (
+	subscriptionColumns = []string{"uuid", "url", "secret", "events", "created_at"}
+	deliveryColumns     = []string{"uuid", "subscription_uuid", "event_id", "event_type", "payload", "status",
+		"attempts", "last_error", "next_attempt_at", "created_at"}
+	testPayload = []byte(`{"id":"evt1","type":"review.negative","data":{"order_uuid":"ord1"}}`)
+)
+
+// TestSubscribeValidates tests that subscriptions need a valid URL and known events.
+func TestSubscribeValidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		events []string
+	}{
+		{name: "relative url", url: "/hooks", events: []string{app.EventReviewCreated}},
+		{name: "unsupported scheme", url: "ftp://crm.example.com", events: []string{app.EventReviewCreated}},
+		{name: "no events", url: "https://crm.example.com/hooks"},
+		{name: "unknown event", url: "https://crm.example.com/hooks", events: []string{"order.deleted"}},
+		{name: "loopback address", url: "http://127.0.0.1:8080/hooks", events: []string{app.EventReviewCreated}},
+		{name: "localhost", url: "http://localhost/hooks", events: []string{app.EventReviewCreated}},
+		{name: "private address", url: "https://10.1.2.3/hooks", events: []string{app.EventReviewCreated}},
+		{name: "metadata service", url: "http://169.254.169.254/latest", events: []string{app.EventReviewCreated}},
+		{name: "ipv6 loopback", url: "http://[::1]/hooks", events: []string{app.EventReviewCreated}},
+		{name: "ipv4 mapped private address", url: "http://[::ffff:192.168.1.1]/hooks",
+			events: []string{app.EventReviewCreated}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, service, _ := newTestService(t)
+			defer db.Close()
+
+			// Act
+			_, err := service.Subscribe(context.Background(), tt.url, tt.events, "")
+			// Assert
+			if !errors.Is(err, ErrInvalidSubscription) {
+				t.Fatalf("Expected ErrInvalidSubscription, got %v", err)
+			}
+		})
+	}
+}
+
+// TestDeliverDueRefusesPrivateTargets tests that a delivery to a host name resolving to a private address is not
+// sent, unless private targets are allowed.
+func TestDeliverDueRefusesPrivateTargets(t *testing.T) {
+	// Arrange
+	received := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+	db, service, mock := newTestService(t)
+	defer db.Close()
+	target := strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_deliveries`")).WillReturnRows(sqlmock.NewRows(deliveryColumns).
+		AddRow("del1", "sub1", "evt1", "review.negative", testPayload, "pending", 0, nil, time.Now(), time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_subscriptions`")).WillReturnRows(
+		sqlmock.NewRows(subscriptionColumns).AddRow("sub1", target, "s3cr3t", "review.negative", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET") + ".*`status`='sending'.*'del1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET") + ".*is not a public address.*'del1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	delivered, err := service.DeliverDue(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error delivering webhooks: %v", err)
+	}
+	if delivered != 0 || received {
+		t.Fatalf("Delivery to a private address was sent")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestPublishEnqueuesSubscribedDeliveries tests that events are only delivered to the webhooks subscribed to them.
+func TestPublishEnqueuesSubscribedDeliveries(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_subscriptions`")).WillReturnRows(
+		sqlmock.NewRows(subscriptionColumns).
+			AddRow("sub1", "https://crm.example.com", "s1", "review.created,review.negative", time.Now()).
+			AddRow("sub2", "https://support.example.com", "s2", "order.reviewed", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `webhook_deliveries`") + ".*'sub1', 'evt1', 'review.negative'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	err := service.Publish(context.Background(), app.Event{ID: "evt1", Type: app.EventReviewNegative,
+		Data: []byte(`{}`)})
+	// Assert
+	if err != nil {
+		t.Fatalf("Error publishing event: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestDeliverDueSignsRequests tests that deliveries are posted with a verifiable signature.
+func TestDeliverDueSignsRequests(t *testing.T) {
+	// Arrange
+	var received *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	db, service, mock := newTestService(t)
+	defer db.Close()
+	service.AllowPrivateTargets()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_deliveries`")).WillReturnRows(sqlmock.NewRows(deliveryColumns).
+		AddRow("del1", "sub1", "evt1", "review.negative", testPayload, "pending", 0, nil, time.Now(), time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_subscriptions`")).WillReturnRows(
+		sqlmock.NewRows(subscriptionColumns).AddRow("sub1", receiver.URL, "s3cr3t", "review.negative", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET") + ".*`status`='sending'.*'del1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET") + ".*`status`='delivered'.*'del1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	delivered, err := service.DeliverDue(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error delivering webhooks: %v", err)
+	}
+	if delivered != 1 || received == nil {
+		t.Fatalf("Delivered count mismatch: got %d, want %d", delivered, 1)
+	}
+	if string(body) != string(testPayload) {
+		t.Fatalf("Body mismatch: got %s, want %s", body, testPayload)
+	}
+	if got := received.Header.Get(HeaderEventType); got != "review.negative" {
+		t.Fatalf("Event type header mismatch: got %s, want %s", got, "review.negative")
+	}
+	want := Sign("s3cr3t", received.Header.Get(HeaderTimestamp), body)
+	if got := received.Header.Get(HeaderSignature); got != want {
+		t.Fatalf("Signature mismatch: got %s, want %s", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestDeliverDueRetriesAndDeadLetters tests that failed deliveries are retried and then moved to the dead letters.
+func TestDeliverDueRetriesAndDeadLetters(t *testing.T) {
+	// Arrange
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+	db, service, mock := newTestService(t)
+	defer db.Close()
+	service.AllowPrivateTargets()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_deliveries`")).WillReturnRows(sqlmock.NewRows(deliveryColumns).
+		AddRow("del1", "sub1", "evt1", "review.negative", testPayload, "pending", 0, nil, time.Now(), time.Now()).
+		AddRow("del2", "sub1", "evt2", "review.negative", testPayload, "pending", maxAttempts-1, nil, time.Now(),
+			time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_subscriptions`")).WillReturnRows(
+		sqlmock.NewRows(subscriptionColumns).AddRow("sub1", receiver.URL, "s3cr3t", "review.negative", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET") + ".*'del1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET") +
+		".*`last_error`='webhook endpoint responded with status 503',`next_attempt_at`=.*`status`='pending'.*'del1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `webhook_deliveries` SET") + ".*'del2'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `webhook_dead_letters`") + ".*'del2', 'sub1', 'evt2'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE `webhook_deliveries` FROM `webhook_deliveries` WHERE (`uuid` = 'del2')")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Act
+	delivered, err := service.DeliverDue(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error delivering webhooks: %v", err)
+	}
+	if delivered != 0 {
+		t.Fatalf("Delivered count mismatch: got %d, want %d", delivered, 0)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRedeliverMovesDeadLetterBack tests that a dead letter becomes a pending delivery again.
+func TestRedeliverMovesDeadLetterBack(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_dead_letters` WHERE ((`uuid` = 'del1') AND " +
+		"(`subscription_uuid` = 'sub1')) FOR UPDATE")).WillReturnRows(
+		sqlmock.NewRows([]string{"uuid", "subscription_uuid", "event_id", "event_type", "payload", "created_at"}).
+			AddRow("del1", "sub1", "evt1", "review.negative", testPayload, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `webhook_deliveries`") + ".*'del1', 'sub1', 'evt1'.*'pending', 0").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE `webhook_dead_letters` FROM `webhook_dead_letters` WHERE (`uuid` = 'del1')")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// Act
+	err := service.Redeliver(context.Background(), "sub1", "del1")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error redelivering dead letter: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRedeliverUnknownDeadLetter tests that redelivering a missing dead letter is reported as not found.
+func TestRedeliverUnknownDeadLetter(t *testing.T) {
+	// Arrange
+	db, service, mock := newTestService(t)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `webhook_dead_letters`")).WillReturnRows(
+		sqlmock.NewRows([]string{"uuid", "subscription_uuid", "event_id", "event_type", "payload", "created_at"}))
+	mock.ExpectRollback()
+
+	// Act
+	err := service.Redeliver(context.Background(), "sub1", "del1")
+	// Assert
+	if !errors.Is(err, app.ErrNoRecords) {
+		t.Fatalf("Expected app.ErrNoRecords, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
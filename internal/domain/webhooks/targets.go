@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// nonPublicNetworks are the special purpose networks of RFC 6890 not covered by the net.IP predicates.
+var nonPublicNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4",
+		"64:ff9b::/96", "2001:db8::/32"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isPublicIP returns if ip is a public unicast address, so that webhooks cannot reach the loopback interface, the
+// private networks or the cloud metadata services of the server.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newDeliveryClient returns the client posting the webhooks. Unless allowPrivateTargets returns true, it refuses to
+// connect to addresses which are not public. The address is checked once resolved, so that neither a host name
+// resolving to a private address nor a redirect can reach one.
+func newDeliveryClient(allowPrivateTargets func() bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || (!isPublicIP(ip) && !allowPrivateTargets()) {
+				return fmt.Errorf("webhook target %s is not a public address", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: deliveryTimeout, Transport: transport}
+}
+
+// hostIsPublic returns if the host of a webhook URL may be public. IP addresses must be public, and host names other
+// than localhost are checked once resolved, at delivery time.
+func hostIsPublic(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || isPublicIP(ip)
+}
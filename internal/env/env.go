@@ -3,6 +3,7 @@ package env
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 func GetString(key, defaultValue string) string {
@@ -37,3 +38,15 @@ func GetBool(key string, defaultValue bool) bool {
 	}
 	return boolValue
 }
+
+func GetDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	durationValue, err := time.ParseDuration(value)
+	if err != nil {
+		panic(err)
+	}
+	return durationValue
+}
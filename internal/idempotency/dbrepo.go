@@ -0,0 +1,256 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+	"time"
+)
+
+// IdempotencyRecordStore represents an idempotency record entity at the Database.
+type IdempotencyRecordStore struct {
+	Actor           string
+	Key             string
+	Fingerprint     string
+	Status          string
+	ResponseStatus  sql.NullInt64
+	ResponseHeaders sql.NullString
+	ResponseBody    []byte
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+}
+
+// DatabaseRepository implements the IdempotencyRepository interface.
+type DatabaseRepository struct {
+	db *sqlx.DB
+}
+
+// NewDatabaseRepository returns a new DatabaseRepository.
+func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
+	return &DatabaseRepository{
+		db: db,
+	}
+}
+
+// IdempotencyRecordStoreToIdempotencyRecord converts an IdempotencyRecordStore object to an app.IdempotencyRecord
+func (ds *DatabaseRepository) IdempotencyRecordStoreToIdempotencyRecord(
+	recordStore IdempotencyRecordStore) app.IdempotencyRecord {
+	record := app.IdempotencyRecord{
+		Actor:          recordStore.Actor,
+		Key:            recordStore.Key,
+		Fingerprint:    recordStore.Fingerprint,
+		Status:         app.IdempotencyRecordStatus(recordStore.Status),
+		ResponseStatus: int(recordStore.ResponseStatus.Int64),
+		ResponseBody:   recordStore.ResponseBody,
+		CreatedAt:      recordStore.CreatedAt,
+		ExpiresAt:      recordStore.ExpiresAt,
+	}
+	if recordStore.ResponseHeaders.Valid {
+		// The headers are written by CompleteIdempotencyRecord, unreadable ones are replayed without headers.
+		json.Unmarshal([]byte(recordStore.ResponseHeaders.String), &record.ResponseHeaders)
+	}
+	return record
+}
+
+// AddIdempotencyRecord stores a processing record, unless the actor already has a record with the same key.
+func (ds *DatabaseRepository) AddIdempotencyRecord(ctx context.Context, record app.IdempotencyRecord) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("idempotency_keys").Cols("actor", "idempotency_key", "fingerprint", "status",
+		"created_at", "expires_at").Vals(goqu.Vals{record.Actor, record.Key, record.Fingerprint,
+		string(app.IdempotencyRecordStatusProcessing), record.CreatedAt, record.ExpiresAt}).
+		OnConflict(goqu.DoNothing()).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing insert for idempotency record",
+			fmt.Errorf("insert idempotency record: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while inserting idempotency record",
+			fmt.Errorf("insert idempotency record: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while inserting idempotency record",
+			fmt.Errorf("insert idempotency record: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// GetIdempotencyRecord retrieves from storage the record of an actor by its key.
+func (ds *DatabaseRepository) GetIdempotencyRecord(ctx context.Context, actor string,
+	key string) (*app.IdempotencyRecord, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("actor", "idempotency_key", "fingerprint", "status", "response_status",
+		"response_headers", "response_body", "created_at", "expires_at").From("idempotency_keys").
+		Where(goqu.C("actor").Eq(actor), goqu.C("idempotency_key").Eq(key)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for idempotency record",
+			fmt.Errorf("get idempotency record: %w", err))
+	}
+
+	var recordStore IdempotencyRecordStore
+	err = ds.db.QueryRowContext(ctx, sqlQuery).Scan(&recordStore.Actor, &recordStore.Key, &recordStore.Fingerprint,
+		&recordStore.Status, &recordStore.ResponseStatus, &recordStore.ResponseHeaders, &recordStore.ResponseBody,
+		&recordStore.CreatedAt, &recordStore.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, app.NewError("Idempotency record not found", app.ErrNoRecords)
+	}
+	if err != nil {
+		return nil, app.NewError("Error while getting idempotency record",
+			fmt.Errorf("get idempotency record: %w", err))
+	}
+
+	record := ds.IdempotencyRecordStoreToIdempotencyRecord(recordStore)
+	return &record, nil
+}
+
+// ClaimIdempotencyRecord replaces an expired record, or an abandoned record of the same request, with a processing
+// one.
+// The conditional update lets only one of several concurrent requests claim a record.
+func (ds *DatabaseRepository) ClaimIdempotencyRecord(ctx context.Context, record app.IdempotencyRecord,
+	now time.Time, staleBefore time.Time) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("idempotency_keys").Set(goqu.Record{
+		"fingerprint":      record.Fingerprint,
+		"status":           string(app.IdempotencyRecordStatusProcessing),
+		"response_status":  nil,
+		"response_headers": nil,
+		"response_body":    nil,
+		"created_at":       record.CreatedAt,
+		"expires_at":       record.ExpiresAt,
+	}).Where(
+		goqu.C("actor").Eq(record.Actor),
+		goqu.C("idempotency_key").Eq(record.Key),
+		goqu.Or(
+			goqu.C("expires_at").Lte(now),
+			goqu.And(
+				goqu.C("status").Eq(string(app.IdempotencyRecordStatusProcessing)),
+				goqu.C("created_at").Lt(staleBefore),
+				goqu.C("fingerprint").Eq(record.Fingerprint),
+			),
+		),
+	).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing update for idempotency record",
+			fmt.Errorf("claim idempotency record: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while updating idempotency record",
+			fmt.Errorf("claim idempotency record: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while updating idempotency record",
+			fmt.Errorf("claim idempotency record: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// CompleteIdempotencyRecord stores the response of a processing record.
+func (ds *DatabaseRepository) CompleteIdempotencyRecord(ctx context.Context, actor string, key string, status int,
+	headers map[string]string, body []byte) error {
+	encodedHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return app.NewError("Error while encoding idempotent response headers",
+			fmt.Errorf("complete idempotency record: %w", err))
+	}
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("idempotency_keys").Set(goqu.Record{
+		"status":           string(app.IdempotencyRecordStatusCompleted),
+		"response_status":  status,
+		"response_headers": string(encodedHeaders),
+		"response_body":    body,
+	}).Where(
+		goqu.C("actor").Eq(actor),
+		goqu.C("idempotency_key").Eq(key),
+		goqu.C("status").Eq(string(app.IdempotencyRecordStatusProcessing)),
+	).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for idempotency record",
+			fmt.Errorf("complete idempotency record: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while updating idempotency record",
+			fmt.Errorf("complete idempotency record: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Idempotency record not found", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+// LoseIdempotencyResponse marks a processing record as processed without a stored response.
+func (ds *DatabaseRepository) LoseIdempotencyResponse(ctx context.Context, actor string, key string) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("idempotency_keys").Set(goqu.Record{
+		"status": string(app.IdempotencyRecordStatusResponseLost),
+	}).Where(
+		goqu.C("actor").Eq(actor),
+		goqu.C("idempotency_key").Eq(key),
+		goqu.C("status").Eq(string(app.IdempotencyRecordStatusProcessing)),
+	).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for idempotency record",
+			fmt.Errorf("lose idempotency response: %w", err))
+	}
+	if _, err := ds.db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while updating idempotency record",
+			fmt.Errorf("lose idempotency response: %w", err))
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyRecord deletes a processing record.
+func (ds *DatabaseRepository) ReleaseIdempotencyRecord(ctx context.Context, actor string, key string) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Delete("idempotency_keys").Where(
+		goqu.C("actor").Eq(actor),
+		goqu.C("idempotency_key").Eq(key),
+		goqu.C("status").Eq(string(app.IdempotencyRecordStatusProcessing)),
+	).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing delete for idempotency record",
+			fmt.Errorf("release idempotency record: %w", err))
+	}
+	if _, err := ds.db.ExecContext(ctx, sqlQuery); err != nil {
+		return app.NewError("Error while deleting idempotency record",
+			fmt.Errorf("release idempotency record: %w", err))
+	}
+
+	return nil
+}
+
+// DeleteExpiredIdempotencyRecords deletes from storage the records expired before expiredBefore.
+func (ds *DatabaseRepository) DeleteExpiredIdempotencyRecords(ctx context.Context, expiredBefore time.Time) (int64,
+	error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Delete("idempotency_keys").Where(goqu.C("expires_at").Lt(expiredBefore)).ToSQL()
+	if err != nil {
+		return 0, app.NewError("Error while preparing delete for idempotency records",
+			fmt.Errorf("delete expired idempotency records: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return 0, app.NewError("Error while deleting idempotency records",
+			fmt.Errorf("delete expired idempotency records: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, app.NewError("Error while deleting idempotency records",
+			fmt.Errorf("delete expired idempotency records: %w", err))
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,155 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/exp/slog"
+	"reviewbot/app"
+	"time"
+)
+
+const (
+	// MaxKeyLength is the length of the longest idempotency key accepted.
+	MaxKeyLength = 255
+	// claimTimeout is the time after which a request that never completed can be retried with the same key.
+	claimTimeout = time.Minute
+	// purgeInterval is the interval between deletions of the expired records.
+	purgeInterval = 10 * time.Minute
+)
+
+var (
+	// ErrKeyReused is returned when an idempotency key is reused for a different request.
+	ErrKeyReused = app.NewCodedError(app.CodeUnprocessable, "idempotency key reused for a different request", nil)
+	// ErrRequestInProgress is returned when the request first sent with an idempotency key has not completed yet.
+	ErrRequestInProgress = app.NewCodedError(app.CodeConflict, "request with the same idempotency key in progress", nil)
+	// ErrResponseLost is returned when the request first sent with an idempotency key was processed but its response
+	// could not be stored.
+	ErrResponseLost = app.NewCodedError(app.CodeConflict, "response of the request with the same idempotency key lost",
+		nil)
+)
+
+// Store keeps the responses of the requests sent with an idempotency key for ttl, so that retries of a request are
+// answered with its first response instead of being processed again.
+type Store struct {
+	repo   app.IdempotencyRepository
+	ttl    time.Duration
+	logger *slog.Logger
+}
+
+// NewStore returns a new Store keeping the responses for ttl.
+func NewStore(repo app.IdempotencyRepository, ttl time.Duration, logger *slog.Logger) *Store {
+	return &Store{repo: repo, ttl: ttl, logger: logger}
+}
+
+// Fingerprint identifies a request by its method, its URI and its body.
+func Fingerprint(method string, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Begin starts a request of the actor sent with key. It returns the completed record of an earlier request with the
+// same key, whose response answers the request, or nil if the request is to be processed, in which case Complete or
+// Release must be called once it is.
+// It returns ErrKeyReused if the key was sent with a request with another fingerprint, ErrRequestInProgress if the
+// earlier request has not completed yet and ErrResponseLost if it was processed without storing its response.
+func (s *Store) Begin(ctx context.Context, actor string, key string, fingerprint string) (*app.IdempotencyRecord,
+	error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	record := app.IdempotencyRecord{
+		Actor:       actor,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      app.IdempotencyRecordStatusProcessing,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	added, err := s.repo.AddIdempotencyRecord(ctx, record)
+	if err != nil || added {
+		return nil, err
+	}
+
+	stored, err := s.repo.GetIdempotencyRecord(ctx, actor, key)
+	if errors.Is(err, app.ErrNoRecords) {
+		// The earlier request failed and released the key in the meantime.
+		return nil, app.NewError("The request sent with the same idempotency key is in progress",
+			ErrRequestInProgress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !stored.ExpiresAt.After(now) {
+		return nil, s.claim(ctx, record, now)
+	}
+	if stored.Fingerprint != fingerprint {
+		return nil, app.NewError("The idempotency key was already used for a different request", ErrKeyReused)
+	}
+	switch stored.Status {
+	case app.IdempotencyRecordStatusCompleted:
+		return stored, nil
+	case app.IdempotencyRecordStatusResponseLost:
+		return nil, app.NewError("The request sent with the same idempotency key was processed but its response "+
+			"could not be stored", ErrResponseLost)
+	}
+	if stored.CreatedAt.Before(now.Add(-claimTimeout)) {
+		// The earlier request never completed, as when the server stopped while processing it.
+		return nil, s.claim(ctx, record, now)
+	}
+	return nil, app.NewError("The request sent with the same idempotency key is in progress", ErrRequestInProgress)
+}
+
+// claim takes over the expired or abandoned record of a request, unless a concurrent request claimed it first.
+func (s *Store) claim(ctx context.Context, record app.IdempotencyRecord, now time.Time) error {
+	claimed, err := s.repo.ClaimIdempotencyRecord(ctx, record, now, now.Add(-claimTimeout))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return app.NewError("The request sent with the same idempotency key is in progress", ErrRequestInProgress)
+	}
+	return nil
+}
+
+// Complete stores the response of a request started by Begin, with the given headers. If the response cannot be
+// stored, the record is marked as processed so that the retries of the request are refused with ErrResponseLost
+// instead of processing it again once the record would have been abandoned.
+func (s *Store) Complete(ctx context.Context, actor string, key string, status int, headers map[string]string,
+	body []byte) error {
+	err := s.repo.CompleteIdempotencyRecord(ctx, actor, key, status, headers, body)
+	if err == nil {
+		return nil
+	}
+	if loseErr := s.repo.LoseIdempotencyResponse(ctx, actor, key); loseErr != nil {
+		return errors.Join(err, loseErr)
+	}
+	return err
+}
+
+// Release forgets a request started by Begin that failed, so that it can be retried with the same key.
+func (s *Store) Release(ctx context.Context, actor string, key string) error {
+	return s.repo.ReleaseIdempotencyRecord(ctx, actor, key)
+}
+
+// Run deletes the expired records every purgeInterval until ctx is cancelled.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		deleted, err := s.repo.DeleteExpiredIdempotencyRecords(ctx, time.Now().UTC())
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("could not delete expired idempotency records", "err", err)
+		}
+		if deleted > 0 {
+			s.logger.Info("deleted expired idempotency records", "count", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/exp/slog"
+)
+
+func newTestStore(t *testing.T) (*sql.DB, *Store, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	repo := NewDatabaseRepository(sqlx.NewDb(db, "mysql"))
+	return db, NewStore(repo, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))), mock
+}
+
+var recordColumns = []string{"actor", "idempotency_key", "fingerprint", "status", "response_status",
+	"response_headers", "response_body", "created_at", "expires_at"}
+
+// TestBeginReplaysCompletedRequest tests that a retry of a completed request gets the stored response.
+func TestBeginReplaysCompletedRequest(t *testing.T) {
+	// Arrange
+	db, store, mock := newTestStore(t)
+	defer db.Close()
+
+	fingerprint := Fingerprint("POST", "/api/orders", []byte(`{"customer_uuid":"cust1"}`))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `idempotency_keys`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `idempotency_keys` WHERE ((`actor` = 'anonymous') AND " +
+		"(`idempotency_key` = 'key1'))")).
+		WillReturnRows(sqlmock.NewRows(recordColumns).AddRow("anonymous", "key1", fingerprint, "completed", 201,
+			`{"Content-Type":"application/json"}`, []byte(`{"uuid":"order1"}`), time.Now().UTC(), time.Now().UTC().Add(time.Hour)))
+
+	// Act
+	record, err := store.Begin(context.Background(), "anonymous", "key1", fingerprint)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error beginning request: %v", err)
+	}
+	if record == nil || record.ResponseStatus != 201 || string(record.ResponseBody) != `{"uuid":"order1"}` ||
+		record.ResponseHeaders["Content-Type"] != "application/json" {
+		t.Fatalf("Stored response mismatch: got %+v, want the completed record", record)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBeginRefusesReusedKey tests that a key sent with a different request is refused.
+func TestBeginRefusesReusedKey(t *testing.T) {
+	// Arrange
+	db, store, mock := newTestStore(t)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `idempotency_keys`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `idempotency_keys`")).
+		WillReturnRows(sqlmock.NewRows(recordColumns).AddRow("anonymous", "key1",
+			Fingerprint("POST", "/api/orders", []byte(`{"customer_uuid":"cust1"}`)), "completed", 201,
+			`{"Content-Type":"application/json"}`, []byte(`{}`), time.Now().UTC(), time.Now().UTC().Add(time.Hour)))
+
+	// Act
+	_, err := store.Begin(context.Background(), "anonymous", "key1",
+		Fingerprint("POST", "/api/orders", []byte(`{"customer_uuid":"cust2"}`)))
+	// Assert
+	if !errors.Is(err, ErrKeyReused) {
+		t.Fatalf("Expected ErrKeyReused, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBeginClaimsExpiredKey tests that an expired key is processed again, whatever request it was sent with.
+func TestBeginClaimsExpiredKey(t *testing.T) {
+	// Arrange
+	db, store, mock := newTestStore(t)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `idempotency_keys`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `idempotency_keys`")).
+		WillReturnRows(sqlmock.NewRows(recordColumns).AddRow("anonymous", "key1", "other", "completed", 201,
+			`{"Content-Type":"application/json"}`, []byte(`{}`), time.Now().UTC().Add(-2*time.Hour), time.Now().UTC().Add(-time.Hour)))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `idempotency_keys` SET") + ".*`status`='processing'.*" +
+		regexp.QuoteMeta("`expires_at` <= ")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	record, err := store.Begin(context.Background(), "anonymous", "key1", "fingerprint")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error beginning request: %v", err)
+	}
+	if record != nil {
+		t.Fatalf("Stored response mismatch: got %+v, want none", record)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBeginRefusesProcessedKeys tests that the retries of a request processed without storing its response are
+// refused until the record expires, and that an abandoned record is only claimed by the same request.
+func TestBeginRefusesProcessedKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string
+		fingerprint string
+		wantErr     error
+	}{
+		{name: "response lost", status: "response_lost", fingerprint: "fingerprint", wantErr: ErrResponseLost},
+		{name: "abandoned by another request", status: "processing", fingerprint: "other", wantErr: ErrKeyReused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			db, store, mock := newTestStore(t)
+			defer db.Close()
+
+			mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `idempotency_keys`")).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(regexp.QuoteMeta("FROM `idempotency_keys`")).
+				WillReturnRows(sqlmock.NewRows(recordColumns).AddRow("anonymous", "key1", tt.fingerprint, tt.status,
+					nil, nil, nil, time.Now().UTC().Add(-time.Hour), time.Now().UTC().Add(time.Hour)))
+
+			// Act
+			_, err := store.Begin(context.Background(), "anonymous", "key1", "fingerprint")
+			// Assert
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Error mismatch: got %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+// TestCompleteMarksLostResponse tests that a request whose response cannot be stored is marked as processed.
+func TestCompleteMarksLostResponse(t *testing.T) {
+	// Arrange
+	db, store, mock := newTestStore(t)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `idempotency_keys` SET") + ".*`status`='completed'").
+		WillReturnError(errors.New("packet too large"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `idempotency_keys` SET `status`='response_lost' WHERE " +
+		"((`actor` = 'anonymous') AND (`idempotency_key` = 'key1') AND (`status` = 'processing'))")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	err := store.Complete(context.Background(), "anonymous", "key1", 201,
+		map[string]string{"Location": "/api/products/prod1"}, []byte(`{}`))
+	// Assert
+	if err == nil {
+		t.Fatalf("Expected an error storing the response")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
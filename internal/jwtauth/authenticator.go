@@ -0,0 +1,92 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"reviewbot/app"
+	"time"
+)
+
+// leeway is the clock skew tolerated when checking the validity period of a token.
+const leeway = time.Minute
+
+// signingMethods are the RS and ES algorithms of RFC 7518 tokens may be signed with. The key of a token must be of the
+// type of its algorithm, so that a token cannot choose how it is checked.
+var signingMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// ErrInvalidToken is returned when a bearer token is malformed, not validly signed, expired, issued for another
+// audience or for an unknown customer.
+var ErrInvalidToken = app.NewCodedError(app.CodeUnauthorized, "invalid bearer token", nil)
+
+// CustomersRepository is implemented by the repositories finding the customer a token was issued to.
+type CustomersRepository interface {
+	GetCustomerByUUID(ctx context.Context, uuid string) (*app.Customer, error)
+}
+
+// Config configures the checks of the claims of the tokens. An empty Issuer or Audience is not checked.
+type Config struct {
+	Issuer   string
+	Audience string
+}
+
+// Authenticator authenticates customers by the JWTs their identity provider issued them. The subject of a token is
+// the UUID of the customer.
+type Authenticator struct {
+	keys      *KeySet
+	customers CustomersRepository
+	parser    *jwt.Parser
+}
+
+// NewAuthenticator returns a new Authenticator verifying the tokens with the keys of keys.
+func NewAuthenticator(keys *KeySet, customers CustomersRepository, config Config) *Authenticator {
+	options := []jwt.ParserOption{jwt.WithValidMethods(signingMethods), jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway)}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+	return &Authenticator{keys: keys, customers: customers, parser: jwt.NewParser(options...)}
+}
+
+// Authenticate returns the customer a token was issued to, or ErrInvalidToken if the token is not valid.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*app.Customer, error) {
+	subject, err := a.verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := a.customers.GetCustomerByUUID(ctx, subject)
+	if app.IsNotFoundError(err) {
+		return nil, app.NewError("The token subject is not a customer", ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+// verify checks the signature and the claims of a token and returns its subject.
+func (a *Authenticator) verify(ctx context.Context, token string) (string, error) {
+	var keyErr error
+	var claims jwt.RegisteredClaims
+	_, err := a.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		var key crypto.PublicKey
+		key, keyErr = a.keys.Key(ctx, kid)
+		return key, keyErr
+	})
+	// The keys being unavailable does not make the token invalid.
+	switch {
+	case keyErr != nil && !errors.Is(keyErr, ErrUnknownKey):
+		return "", keyErr
+	case err != nil:
+		return "", app.NewError(fmt.Sprintf("The token is invalid: %v", err), ErrInvalidToken)
+	case claims.Subject == "":
+		return "", app.NewError("The token has no subject", ErrInvalidToken)
+	}
+	return claims.Subject, nil
+}
@@ -0,0 +1,230 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reviewbot/app"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	testIssuer   = "https://id.example.com"
+	testAudience = "reviewbot"
+)
+
+// jwksServer serves a JSON Web Key Set that tests can replace, and counts how often it is fetched.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	status  int
+	fetches int
+}
+
+func newJWKSServer(t *testing.T, keys map[string]crypto.PublicKey) *jwksServer {
+	server := &jwksServer{keys: keys, status: http.StatusOK}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		server.fetches++
+		if server.status != http.StatusOK {
+			w.WriteHeader(server.status)
+			return
+		}
+		set := jwkset.JWKSMarshal{Keys: []jwkset.JWKMarshal{}}
+		for kid, key := range server.keys {
+			set.Keys = append(set.Keys, toJSONWebKey(t, kid, key))
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *jwksServer) set(keys map[string]crypto.PublicKey, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	s.status = status
+}
+
+func (s *jwksServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func toJSONWebKey(t *testing.T, kid string, key crypto.PublicKey) jwkset.JWKMarshal {
+	jwk, err := jwkset.NewJWKFromKey(key, jwkset.JWKOptions{Metadata: jwkset.JWKMetadataOptions{KID: kid,
+		USE: jwkset.UseSig}})
+	if err != nil {
+		t.Errorf("Error encoding key: %v", err)
+	}
+	return jwk.Marshal()
+}
+
+// signToken returns a token with claims signed by key. An empty alg is taken from the type of key.
+func signToken(t *testing.T, key crypto.Signer, alg string, kid string, claims map[string]any) string {
+	t.Helper()
+	if alg == "" {
+		alg = "RS256"
+		if _, ok := key.(*ecdsa.PrivateKey); ok {
+			alg = "ES256"
+		}
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(alg), jwt.MapClaims(claims))
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Error signing token: %v", err)
+	}
+	return signed
+}
+
+// validClaims returns the claims of a token valid for the test issuer and audience, issued to subject.
+func validClaims(subject string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss": testIssuer,
+		"aud": []string{testAudience, "storefront"},
+		"sub": subject,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func generateKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Error generating RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating ECDSA key: %v", err)
+	}
+	return rsaKey, ecKey
+}
+
+// stubCustomersRepository is an in-memory CustomersRepository.
+type stubCustomersRepository map[string]*app.Customer
+
+func (repo stubCustomersRepository) GetCustomerByUUID(_ context.Context, uuid string) (*app.Customer, error) {
+	customer, ok := repo[uuid]
+	if !ok {
+		return nil, app.NewError("Customer does not exist", app.ErrNoRecords)
+	}
+	return customer, nil
+}
+
+func newTestKeySet(url string) *KeySet {
+	return NewKeySet(url, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func newTestAuthenticator(t *testing.T, keys map[string]crypto.PublicKey) *Authenticator {
+	keySet := newTestKeySet(newJWKSServer(t, keys).URL)
+	customers := stubCustomersRepository{"cust1": {UUID: "cust1", Email: "jane@example.com"}}
+	return NewAuthenticator(keySet, customers, Config{Issuer: testIssuer, Audience: testAudience})
+}
+
+// TestAuthenticateMapsSubjectToCustomer tests that a valid token authenticates the customer of its subject, whether
+// it is signed with an RSA or an ECDSA key.
+func TestAuthenticateMapsSubjectToCustomer(t *testing.T) {
+	rsaKey, ecKey := generateKeys(t)
+	authenticator := newTestAuthenticator(t, map[string]crypto.PublicKey{
+		"rsa": rsaKey.Public(), "ec": ecKey.Public()})
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		kid  string
+	}{
+		{name: "RS256", key: rsaKey, kid: "rsa"},
+		{name: "ES256", key: ecKey, kid: "ec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			token := signToken(t, tt.key, "", tt.kid, validClaims("cust1"))
+
+			// Act
+			customer, err := authenticator.Authenticate(context.Background(), token)
+			// Assert
+			if err != nil {
+				t.Fatalf("Error authenticating: %v", err)
+			}
+			if customer.UUID != "cust1" {
+				t.Fatalf("Customer mismatch: got %q, want %q", customer.UUID, "cust1")
+			}
+		})
+	}
+}
+
+// TestAuthenticateRejectsInvalidTokens tests that tokens not validly signed, or with claims not matching the
+// configuration, are rejected.
+func TestAuthenticateRejectsInvalidTokens(t *testing.T) {
+	rsaKey, ecKey := generateKeys(t)
+	otherKey, _ := generateKeys(t)
+	authenticator := newTestAuthenticator(t, map[string]crypto.PublicKey{
+		"rsa": rsaKey.Public(), "ec": ecKey.Public()})
+	withClaim := func(name string, value any) map[string]any {
+		claims := validClaims("cust1")
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims(validClaims("cust1"))).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("Error encoding unsigned token: %v", err)
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "malformed", token: "not.a-token"},
+		{name: "expired", token: signToken(t, rsaKey, "", "rsa",
+			withClaim("exp", time.Now().Add(-2*time.Minute).Unix()))},
+		{name: "without expiration", token: signToken(t, rsaKey, "", "rsa", withClaim("exp", nil))},
+		{name: "not valid yet", token: signToken(t, rsaKey, "", "rsa",
+			withClaim("nbf", time.Now().Add(time.Hour).Unix()))},
+		{name: "other issuer", token: signToken(t, rsaKey, "", "rsa", withClaim("iss", "https://evil.example.com"))},
+		{name: "other audience", token: signToken(t, rsaKey, "", "rsa", withClaim("aud", "storefront"))},
+		{name: "unknown customer", token: signToken(t, rsaKey, "", "rsa", withClaim("sub", "cust2"))},
+		{name: "signed by another key", token: signToken(t, otherKey, "", "rsa", validClaims("cust1"))},
+		{name: "unknown key", token: signToken(t, rsaKey, "", "rotated", validClaims("cust1"))},
+		{name: "algorithm of another key type", token: signToken(t, rsaKey, "RS256", "ec", validClaims("cust1"))},
+		{name: "unsigned", token: unsigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := authenticator.Authenticate(context.Background(), tt.token)
+			// Assert
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Expected ErrInvalidToken, got %v", err)
+			}
+			if code := app.ErrorCode(err); code != app.CodeUnauthorized {
+				t.Fatalf("Code mismatch: got %q, want %q", code, app.CodeUnauthorized)
+			}
+		})
+	}
+}
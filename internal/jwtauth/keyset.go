@@ -0,0 +1,162 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MicahParks/jwkset"
+	"io"
+	"net/http"
+	"reviewbot/app"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// minRefreshInterval is the shortest time between two fetches of the key set, so that tokens signed with unknown
+	// keys do not make the server hammer the identity provider.
+	minRefreshInterval = time.Minute
+	// fetchTimeout bounds a fetch of the key set.
+	fetchTimeout = 10 * time.Second
+	// maxKeySetSize is the size of the largest key set read.
+	maxKeySetSize = 1 << 20
+)
+
+// ErrUnknownKey is returned when a token is signed with a key missing from the key set.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet is the JSON Web Key Set of an identity provider. Keys are cached, and fetched again once refreshInterval
+// elapsed or when a token is signed with a key the cached set lacks, which happens after the provider rotates its
+// keys. A single fetch runs at a time, and the requests needing it wait for it without holding the lock.
+type KeySet struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+	logger          *slog.Logger
+	now             func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	err         error
+	refreshing  chan struct{} // Closed once the fetch in progress completes, nil when none is.
+}
+
+// NewKeySet returns a new KeySet fetching the keys served at url.
+func NewKeySet(url string, refreshInterval time.Duration, logger *slog.Logger) *KeySet {
+	return &KeySet{
+		url:             url,
+		client:          &http.Client{Timeout: fetchTimeout},
+		refreshInterval: refreshInterval,
+		logger:          logger,
+		now:             time.Now,
+	}
+}
+
+// Key returns the key identified by kid. When the key set cannot be fetched, the keys fetched last keep being used.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	now := ks.now()
+	_, known := ks.keys[kid]
+	if ks.keys == nil || now.Sub(ks.fetchedAt) >= ks.refreshInterval || !known {
+		if done := ks.startRefresh(now); done != nil {
+			ks.mu.Unlock()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return nil, app.NewCodedError(app.CodeUnavailable, "Error while waiting for the token signing keys",
+					ctx.Err())
+			}
+			ks.mu.Lock()
+			if _, ok := ks.keys[kid]; !ok && ks.err != nil {
+				err := ks.err
+				ks.mu.Unlock()
+				return nil, err
+			}
+		}
+	}
+	defer ks.mu.Unlock()
+
+	if ks.keys == nil {
+		return nil, ks.err
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// startRefresh returns a channel closed once the key set is fetched again, starting the fetch unless one is in
+// progress. It returns nil if the last fetch started less than minRefreshInterval ago. The caller must hold ks.mu.
+// The fetch is detached from the request which started it, so that a cancelled request does not fail the requests
+// waiting for the same fetch.
+func (ks *KeySet) startRefresh(now time.Time) <-chan struct{} {
+	if ks.refreshing != nil {
+		return ks.refreshing
+	}
+	if !ks.attemptedAt.IsZero() && now.Sub(ks.attemptedAt) < minRefreshInterval {
+		return nil
+	}
+	ks.attemptedAt = now
+	done := make(chan struct{})
+	ks.refreshing = done
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		defer cancel()
+		keys, err := ks.fetch(ctx)
+
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		if err != nil {
+			ks.logger.Warn("Could not fetch the JSON Web Key Set", "url", ks.url, "err", err)
+			ks.err = app.NewCodedError(app.CodeUnavailable, "Error while fetching the token signing keys", err)
+		} else {
+			ks.keys = keys
+			ks.fetchedAt = now
+			ks.err = nil
+		}
+		ks.refreshing = nil
+		close(done)
+	}()
+	return done
+}
+
+func (ks *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var set jwkset.JWKSMarshal
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxKeySetSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, marshal := range set.Keys {
+		if marshal.USE != "" && marshal.USE != jwkset.UseSig {
+			continue
+		}
+		jwk, err := jwkset.NewJWKFromMarshal(marshal, jwkset.JWKMarshalOptions{}, jwkset.JWKValidateOptions{})
+		if err != nil {
+			// A key of an unsupported type must not prevent the other keys from being used.
+			ks.logger.Warn("Skipping JSON Web Key", "kid", marshal.KID, "err", err)
+			continue
+		}
+		keys[marshal.KID] = jwk.Key()
+	}
+	return keys, nil
+}
@@ -0,0 +1,149 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reviewbot/app"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+)
+
+// TestKeySetCachesKeys tests that the key set is fetched once, until it is stale.
+func TestKeySetCachesKeys(t *testing.T) {
+	// Arrange
+	rsaKey, _ := generateKeys(t)
+	server := newJWKSServer(t, map[string]crypto.PublicKey{"rsa": rsaKey.Public()})
+	keySet := newTestKeySet(server.URL)
+	now := time.Now()
+	keySet.now = func() time.Time { return now }
+
+	// Act
+	for i := 0; i < 3; i++ {
+		if _, err := keySet.Key(context.Background(), "rsa"); err != nil {
+			t.Fatalf("Error getting key: %v", err)
+		}
+	}
+	fetchesWhileFresh := server.fetchCount()
+	now = now.Add(time.Hour)
+	_, err := keySet.Key(context.Background(), "rsa")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	if fetchesWhileFresh != 1 || server.fetchCount() != 2 {
+		t.Fatalf("Fetches mismatch: got %d then %d, want 1 then 2", fetchesWhileFresh, server.fetchCount())
+	}
+}
+
+// TestKeySetRefreshesOnUnknownKey tests that a key rotated in is found by fetching the key set again, at most once
+// every minRefreshInterval.
+func TestKeySetRefreshesOnUnknownKey(t *testing.T) {
+	// Arrange
+	oldKey, _ := generateKeys(t)
+	newKey, _ := generateKeys(t)
+	server := newJWKSServer(t, map[string]crypto.PublicKey{"old": oldKey.Public()})
+	keySet := newTestKeySet(server.URL)
+	now := time.Now()
+	keySet.now = func() time.Time { return now }
+	if _, err := keySet.Key(context.Background(), "old"); err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	server.set(map[string]crypto.PublicKey{"old": oldKey.Public(), "new": newKey.Public()}, http.StatusOK)
+
+	// Act
+	_, errTooSoon := keySet.Key(context.Background(), "new")
+	now = now.Add(minRefreshInterval)
+	key, err := keySet.Key(context.Background(), "new")
+	// Assert
+	if !errors.Is(errTooSoon, ErrUnknownKey) {
+		t.Fatalf("Expected ErrUnknownKey before minRefreshInterval, got %v", errTooSoon)
+	}
+	if err != nil {
+		t.Fatalf("Error getting rotated key: %v", err)
+	}
+	if !newKey.PublicKey.Equal(key) {
+		t.Fatalf("Key mismatch: got %v, want the rotated key", key)
+	}
+	if server.fetchCount() != 2 {
+		t.Fatalf("Fetches mismatch: got %d, want 2", server.fetchCount())
+	}
+}
+
+// TestKeySetKeepsKeysWhenRefreshFails tests that the keys fetched last keep being used while the key set cannot be
+// fetched, and that without them the failure is reported as unavailability.
+func TestKeySetKeepsKeysWhenRefreshFails(t *testing.T) {
+	// Arrange
+	rsaKey, _ := generateKeys(t)
+	server := newJWKSServer(t, map[string]crypto.PublicKey{"rsa": rsaKey.Public()})
+	keySet := newTestKeySet(server.URL)
+	now := time.Now()
+	keySet.now = func() time.Time { return now }
+	if _, err := keySet.Key(context.Background(), "rsa"); err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	server.set(nil, http.StatusInternalServerError)
+	unfetched := newTestKeySet(server.URL)
+
+	// Act
+	now = now.Add(2 * time.Hour)
+	_, err := keySet.Key(context.Background(), "rsa")
+	_, unfetchedErr := unfetched.Key(context.Background(), "rsa")
+	// Assert
+	if err != nil {
+		t.Fatalf("Error getting cached key: %v", err)
+	}
+	if server.fetchCount() != 3 {
+		t.Fatalf("Fetches mismatch: got %d, want 3", server.fetchCount())
+	}
+	if code := app.ErrorCode(unfetchedErr); code != app.CodeUnavailable {
+		t.Fatalf("Code mismatch: got %q, want %q", code, app.CodeUnavailable)
+	}
+}
+
+// TestKeySetSharesOneDetachedFetch tests that concurrent requests wait for a single fetch of the key set, without
+// holding the lock, and that a request cancelled while waiting neither blocks nor cancels the fetch.
+func TestKeySetSharesOneDetachedFetch(t *testing.T) {
+	// Arrange
+	rsaKey, _ := generateKeys(t)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(jwkset.JWKSMarshal{Keys: []jwkset.JWKMarshal{
+			toJSONWebKey(t, "rsa", rsaKey.Public())}})
+	}))
+	defer server.Close()
+	keySet := newTestKeySet(server.URL)
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+
+	// Act
+	for _, ctx := range []context.Context{cancelledCtx, context.Background()} {
+		go func(ctx context.Context) {
+			_, err := keySet.Key(ctx, "rsa")
+			errs <- err
+		}(ctx)
+	}
+	cancel()
+	cancelledErr := <-errs
+	close(release)
+	err := <-errs
+	// Assert
+	if !errors.Is(cancelledErr, context.Canceled) {
+		t.Fatalf("Expected the cancelled request to fail with context.Canceled, got %v", cancelledErr)
+	}
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("Fetches mismatch: got %d, want 1", fetches.Load())
+	}
+}
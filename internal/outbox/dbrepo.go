@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+	"time"
+)
+
+// OutboxEventStore represents an outbox event entity at the Database.
+type OutboxEventStore struct {
+	ID            int64
+	EventID       string
+	EventType     string
+	Payload       []byte
+	OccurredAt    time.Time
+	Status        string
+	Attempts      int
+	LastError     sql.NullString
+	NextAttemptAt time.Time
+}
+
+// DatabaseRepository implements the OutboxRepository interface.
+type DatabaseRepository struct {
+	db *sqlx.DB
+}
+
+// NewDatabaseRepository returns a new DatabaseRepository.
+func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
+	return &DatabaseRepository{
+		db: db,
+	}
+}
+
+// OutboxEventStoreToOutboxEvent converts an OutboxEventStore object to an app.OutboxEvent
+func (ds *DatabaseRepository) OutboxEventStoreToOutboxEvent(eventStore OutboxEventStore) app.OutboxEvent {
+	return app.OutboxEvent{
+		ID: eventStore.ID,
+		Event: app.Event{
+			ID:         eventStore.EventID,
+			Type:       eventStore.EventType,
+			OccurredAt: eventStore.OccurredAt,
+			Data:       eventStore.Payload,
+		},
+		Status:        app.OutboxEventStatus(eventStore.Status),
+		Attempts:      eventStore.Attempts,
+		LastError:     eventStore.LastError.String,
+		NextAttemptAt: eventStore.NextAttemptAt,
+	}
+}
+
+// GetPendingOutboxEvents retrieves from storage the events due for publication, in the order they were stored.
+// Events claimed before staleBefore are considered abandoned and are returned as well.
+func (ds *DatabaseRepository) GetPendingOutboxEvents(ctx context.Context, now time.Time, staleBefore time.Time,
+	limit int) ([]app.OutboxEvent, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("id", "event_id", "event_type", "payload", "occurred_at", "status",
+		"attempts", "last_error", "next_attempt_at").From("outbox_events").
+		Where(claimableEvent(now, staleBefore)).Order(goqu.C("id").Asc()).Limit(uint(limit)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for outbox events",
+			fmt.Errorf("get pending outbox events: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting outbox events", fmt.Errorf("get pending outbox events: %w", err))
+	}
+	defer rows.Close()
+	events := []app.OutboxEvent{}
+	for rows.Next() {
+		var eventStore OutboxEventStore
+		if err := rows.Scan(&eventStore.ID, &eventStore.EventID, &eventStore.EventType, &eventStore.Payload,
+			&eventStore.OccurredAt, &eventStore.Status, &eventStore.Attempts, &eventStore.LastError,
+			&eventStore.NextAttemptAt); err != nil {
+			return nil, app.NewError("Error while reading outbox events",
+				fmt.Errorf("get pending outbox events: %w", err))
+		}
+		events = append(events, ds.OutboxEventStoreToOutboxEvent(eventStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading outbox events", fmt.Errorf("get pending outbox events: %w", err))
+	}
+
+	return events, nil
+}
+
+// ClaimOutboxEvent marks a due event as publishing and counts the attempt.
+// The conditional update lets only one of several concurrent relays claim an event.
+func (ds *DatabaseRepository) ClaimOutboxEvent(ctx context.Context, id int64, now time.Time,
+	staleBefore time.Time) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("outbox_events").Set(goqu.Record{
+		"status":     string(app.OutboxEventStatusPublishing),
+		"claimed_at": now,
+		"attempts":   goqu.L("`attempts` + 1"),
+	}).Where(goqu.C("id").Eq(id), claimableEvent(now, staleBefore)).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing update for outbox event",
+			fmt.Errorf("claim outbox event: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while updating outbox event", fmt.Errorf("claim outbox event: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while updating outbox event", fmt.Errorf("claim outbox event: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// MarkOutboxEventPublished records that an event was published.
+func (ds *DatabaseRepository) MarkOutboxEventPublished(ctx context.Context, id int64, publishedAt time.Time) error {
+	return ds.updateOutboxEvent(ctx, id, goqu.Record{
+		"status":       string(app.OutboxEventStatusPublished),
+		"published_at": publishedAt,
+		"claimed_at":   nil,
+		"last_error":   nil,
+	})
+}
+
+// RescheduleOutboxEvent makes an event pending again, to be published at nextAttemptAt.
+func (ds *DatabaseRepository) RescheduleOutboxEvent(ctx context.Context, id int64, nextAttemptAt time.Time,
+	lastError string) error {
+	return ds.updateOutboxEvent(ctx, id, goqu.Record{
+		"status":          string(app.OutboxEventStatusPending),
+		"next_attempt_at": nextAttemptAt,
+		"claimed_at":      nil,
+		"last_error":      lastError,
+	})
+}
+
+// DeletePublishedOutboxEvents deletes from storage the events published before publishedBefore.
+func (ds *DatabaseRepository) DeletePublishedOutboxEvents(ctx context.Context, publishedBefore time.Time) (int64,
+	error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Delete("outbox_events").Where(
+		goqu.C("status").Eq(string(app.OutboxEventStatusPublished)),
+		goqu.C("published_at").Lt(publishedBefore),
+	).ToSQL()
+	if err != nil {
+		return 0, app.NewError("Error while preparing delete for outbox events",
+			fmt.Errorf("delete published outbox events: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return 0, app.NewError("Error while deleting outbox events",
+			fmt.Errorf("delete published outbox events: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, app.NewError("Error while deleting outbox events",
+			fmt.Errorf("delete published outbox events: %w", err))
+	}
+
+	return rows, nil
+}
+
+func (ds *DatabaseRepository) updateOutboxEvent(ctx context.Context, id int64, record goqu.Record) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("outbox_events").Set(record).Where(goqu.C("id").Eq(id)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for outbox event",
+			fmt.Errorf("update outbox event: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while updating outbox event", fmt.Errorf("update outbox event: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while updating outbox event", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+func claimableEvent(now time.Time, staleBefore time.Time) goqu.Expression {
+	return goqu.Or(
+		goqu.And(
+			goqu.C("status").Eq(string(app.OutboxEventStatusPending)),
+			goqu.C("next_attempt_at").Lte(now),
+		),
+		goqu.And(
+			goqu.C("status").Eq(string(app.OutboxEventStatusPublishing)),
+			goqu.C("claimed_at").Lt(staleBefore),
+		),
+	)
+}
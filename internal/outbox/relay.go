@@ -0,0 +1,121 @@
+package outbox
+
+import (
+	"context"
+	"golang.org/x/exp/slog"
+	"reviewbot/app"
+	"reviewbot/pkg/eventsink"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"time"
+)
+
+const (
+	// retryDelay is the delay before the first retry of an event the sink failed to publish. It doubles with every
+	// attempt, up to maxRetryDelay. Events are retried until they are published.
+	retryDelay    = 10 * time.Second
+	maxRetryDelay = time.Hour
+	// claimTimeout is the time after which an event claimed by a relay that never finished is published again.
+	claimTimeout = 5 * time.Minute
+	// retention is how long published events are kept before they are deleted.
+	retention = 7 * 24 * time.Hour
+	batchSize = 100
+)
+
+// Relay publishes the events stored in the outbox to a sink.
+// Events are claimed before they are published, so several relays sharing the outbox do not publish the same event
+// concurrently. An event is published again if the relay stops before recording that it was published.
+type Relay struct {
+	repo     app.OutboxRepository
+	sink     eventsink.EventSink
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewRelay returns a new Relay polling the outbox every interval.
+func NewRelay(repo app.OutboxRepository, sink eventsink.EventSink, interval time.Duration,
+	logger *slog.Logger) *Relay {
+	return &Relay{repo: repo, sink: sink, interval: interval, logger: logger}
+}
+
+// Run publishes the pending events every interval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		published, err := r.RelayPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("could not relay outbox events", "err", err)
+		}
+		if published > 0 {
+			r.logger.Info("relayed outbox events", "count", published)
+		}
+		if _, err := r.repo.DeletePublishedOutboxEvents(ctx, time.Now().UTC().Add(-retention)); err != nil &&
+			ctx.Err() == nil {
+			r.logger.Error("could not delete published outbox events", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes the events that are due and returns how many of them were published.
+// Events the sink fails to publish are retried with an exponential backoff.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	events, err := r.repo.GetPendingOutboxEvents(ctx, now, now.Add(-claimTimeout), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return published, ctx.Err()
+		}
+		claimed, err := r.repo.ClaimOutboxEvent(ctx, event.ID, now, now.Add(-claimTimeout))
+		if err != nil {
+			return published, err
+		}
+		if !claimed {
+			continue
+		}
+		event.Attempts++
+
+		if err := r.sink.Publish(ctx, toSinkEvent(event.Event)); err != nil {
+			r.logger.Warn("could not publish outbox event, retrying", "event_id", event.Event.ID,
+				"event_type", event.Event.Type, "attempt", event.Attempts, "err", err)
+			if err := r.repo.RescheduleOutboxEvent(ctx, event.ID, time.Now().UTC().Add(backoff(event.Attempts)),
+				err.Error()); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if err := r.repo.MarkOutboxEventPublished(ctx, event.ID, time.Now().UTC()); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// backoff returns the delay before the next attempt to publish an event that failed attempts times.
+func backoff(attempts int) time.Duration {
+	delay := retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func toSinkEvent(event app.Event) eventsinktypes.Event {
+	return eventsinktypes.Event{
+		ID:         event.ID,
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+		Data:       event.Data,
+	}
+}
@@ -0,0 +1,121 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"regexp"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"reviewbot/pkg/eventsink/inprocesssink"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/exp/slog"
+)
+
+func newTestRelay(t *testing.T, subscriber inprocesssink.Subscriber) (*sql.DB, *Relay, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	repo := NewDatabaseRepository(sqlx.NewDb(db, "mysql"))
+	return db, NewRelay(repo, inprocesssink.NewInProcessSink(subscriber), time.Minute,
+		slog.New(slog.NewTextHandler(io.Discard, nil))), mock
+}
+
+var eventColumns = []string{"id", "event_id", "event_type", "payload", "occurred_at", "status", "attempts",
+	"last_error", "next_attempt_at"}
+
+// TestRelayPendingPublishesClaimedEvents tests that only the events claimed by the relay are published, in order.
+func TestRelayPendingPublishesClaimedEvents(t *testing.T) {
+	// Arrange
+	var published []eventsinktypes.Event
+	db, relay, mock := newTestRelay(t, func(ctx context.Context, event eventsinktypes.Event) error {
+		published = append(published, event)
+		return nil
+	})
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `outbox_events`") + ".*ORDER BY `id` ASC").WillReturnRows(
+		sqlmock.NewRows(eventColumns).
+			AddRow(1, "evt1", "review.created", []byte(`{"score":1}`), time.Now(), "pending", 0, nil, time.Now()).
+			AddRow(2, "evt2", "order.reviewed", []byte(`{}`), time.Now(), "pending", 0, nil, time.Now()).
+			AddRow(3, "evt3", "review.created", []byte(`{}`), time.Now(), "pending", 0, nil, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET") + ".*`status`='publishing'.*`id` = 1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET") + ".*`status`='published'.*`id` = 1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET") + ".*`id` = 2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET") + ".*`status`='publishing'.*`id` = 3").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET") + ".*`status`='published'.*`id` = 3").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	count, err := relay.RelayPending(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error relaying events: %v", err)
+	}
+	if count != 2 || len(published) != 2 {
+		t.Fatalf("Published count mismatch: got %d, want %d", count, 2)
+	}
+	if published[0].ID != "evt1" || published[1].ID != "evt3" || string(published[0].Data) != `{"score":1}` {
+		t.Fatalf("Unexpected published events: %+v", published)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRelayPendingReschedulesFailedEvents tests that events the sink fails to publish are retried later.
+func TestRelayPendingReschedulesFailedEvents(t *testing.T) {
+	// Arrange
+	db, relay, mock := newTestRelay(t, func(ctx context.Context, event eventsinktypes.Event) error {
+		return errors.New("broker unavailable")
+	})
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `outbox_events`")).WillReturnRows(sqlmock.NewRows(eventColumns).
+		AddRow(1, "evt1", "review.created", []byte(`{}`), time.Now(), "pending", 2, "timeout", time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET") + ".*`id` = 1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `outbox_events` SET") +
+		".*`last_error`='broker unavailable',`next_attempt_at`=.*`status`='pending'.*`id` = 1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	count, err := relay.RelayPending(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error relaying events: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("Published count mismatch: got %d, want %d", count, 0)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBackoff tests that the retry delay doubles with every attempt up to its maximum.
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: retryDelay},
+		{attempts: 2, want: 2 * retryDelay},
+		{attempts: 4, want: 8 * retryDelay},
+		{attempts: 100, want: maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Fatalf("Backoff mismatch for %d attempts: got %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
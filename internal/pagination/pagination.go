@@ -0,0 +1,50 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reviewbot/app"
+)
+
+// EncodeCursor returns the opaque representation of the position of a listing handed to API clients.
+func EncodeCursor(cursor any) string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// DecodeCursor parses a cursor returned by EncodeCursor into cursor.
+func DecodeCursor(encoded string, cursor any) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, cursor)
+}
+
+// Limit returns the number of items of a page asked for with limit, defaultLimit when limit is 0. A limit out of
+// 0..maxLimit is reported as invalid.
+func Limit(limit int, defaultLimit int, maxLimit int, invalid error) (int, error) {
+	if limit < 0 || limit > maxLimit {
+		return 0, app.NewError(fmt.Sprintf("The limit must be between 1 and %d", maxLimit), invalid)
+	}
+	if limit == 0 {
+		return defaultLimit, nil
+	}
+	return limit, nil
+}
+
+// Fetch gets a page of limit items with fetch, asking for one item more than the page holds to learn whether another
+// page follows. It returns the items of the page along with the cursor of the next page, built by cursorOf from the
+// last item, or an empty cursor on the last page.
+func Fetch[T any](limit int, fetch func(limit int) ([]T, error), cursorOf func(last T) any) ([]T, string, error) {
+	items, err := fetch(limit + 1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(items) <= limit {
+		return items, "", nil
+	}
+	items = items[:limit]
+	return items, EncodeCursor(cursorOf(items[limit-1])), nil
+}
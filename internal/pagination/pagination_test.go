@@ -0,0 +1,73 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestFetchReturnsNextCursor tests that a page has the cursor of its last item only when another page follows.
+func TestFetchReturnsNextCursor(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     []string
+		wantItems  int
+		wantCursor string
+	}{
+		{name: "partial page", stored: []string{"a"}, wantItems: 1},
+		{name: "last full page", stored: []string{"a", "b"}, wantItems: 2},
+		{name: "page followed by another", stored: []string{"a", "b", "c"}, wantItems: 2,
+			wantCursor: EncodeCursor("b")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var fetched int
+			fetch := func(limit int) ([]string, error) {
+				fetched = limit
+				return tt.stored[:min(limit, len(tt.stored))], nil
+			}
+
+			// Act
+			items, cursor, err := Fetch(2, fetch, func(last string) any { return last })
+			// Assert
+			if err != nil {
+				t.Fatalf("Error fetching page: %v", err)
+			}
+			if fetched != 3 {
+				t.Fatalf("Fetched limit mismatch: got %d, want %d", fetched, 3)
+			}
+			if len(items) != tt.wantItems {
+				t.Fatalf("Items mismatch: got %d, want %d", len(items), tt.wantItems)
+			}
+			if cursor != tt.wantCursor {
+				t.Fatalf("Cursor mismatch: got %q, want %q", cursor, tt.wantCursor)
+			}
+		})
+	}
+}
+
+// TestLimit tests that a missing limit takes the default and that limits out of range are invalid.
+func TestLimit(t *testing.T) {
+	errInvalid := errors.New("invalid query")
+	tests := []struct {
+		limit     int
+		wantLimit int
+		wantErr   bool
+	}{
+		{limit: 0, wantLimit: 20},
+		{limit: 100, wantLimit: 100},
+		{limit: -1, wantErr: true},
+		{limit: 101, wantErr: true},
+	}
+	for _, tt := range tests {
+		// Act
+		limit, err := Limit(tt.limit, 20, 100, errInvalid)
+		// Assert
+		if errors.Is(err, errInvalid) != tt.wantErr {
+			t.Fatalf("Error mismatch for %d: got %v, want error %v", tt.limit, err, tt.wantErr)
+		}
+		if limit != tt.wantLimit {
+			t.Fatalf("Limit mismatch for %d: got %d, want %d", tt.limit, limit, tt.wantLimit)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows a number of events per period. The events of a period may be spent at once, in a burst.
+type Limit struct {
+	Events int
+	Per    time.Duration
+}
+
+// ParseLimit parses a limit written as events/period, e.g. "60/1m". An empty string or "0" is the zero Limit,
+// which limits nothing.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+	events, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("parse rate limit %q: expected events/period", value)
+	}
+	limit := Limit{}
+	var err error
+	if limit.Events, err = strconv.Atoi(events); err != nil || limit.Events <= 0 {
+		return Limit{}, fmt.Errorf("parse rate limit %q: events must be a positive integer", value)
+	}
+	if limit.Per, err = time.ParseDuration(period); err != nil || limit.Per <= 0 {
+		return Limit{}, fmt.Errorf("parse rate limit %q: period must be a positive duration", value)
+	}
+	return limit, nil
+}
+
+// IsZero returns if the limit limits nothing.
+func (l Limit) IsZero() bool {
+	return l.Events == 0
+}
+
+func (l Limit) String() string {
+	return strconv.Itoa(l.Events) + "/" + l.Per.String()
+}
+
+// Bucket is a token bucket holding up to Events tokens of its limit and refilled at the rate of the limit. It is
+// not safe for concurrent use.
+type Bucket struct {
+	limit     Limit
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewBucket returns a full Bucket.
+func NewBucket(limit Limit, now time.Time) *Bucket {
+	return &Bucket{limit: limit, tokens: float64(limit.Events), updatedAt: now}
+}
+
+// Take takes a token from the bucket. If it is empty, Take reports false along with how long it takes for a token
+// to be refilled.
+func (b *Bucket) Take(now time.Time) (bool, time.Duration) {
+	if wait := b.Wait(now); wait > 0 {
+		return false, wait
+	}
+	if !b.limit.IsZero() {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// Wait returns how long it takes for a token to be refilled if the bucket is empty, and 0 otherwise. It takes no
+// token.
+func (b *Bucket) Wait(now time.Time) time.Duration {
+	if b.limit.IsZero() {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(b.limit.Per) / float64(b.limit.Events))
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens += float64(b.limit.Events) * float64(elapsed) / float64(b.limit.Per)
+		if b.tokens > float64(b.limit.Events) {
+			b.tokens = float64(b.limit.Events)
+		}
+		b.updatedAt = now
+	}
+}
+
+// isFull returns if the bucket is full at now, and so no different from a new one.
+func (b *Bucket) isFull(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= float64(b.limit.Events)
+}
+
+// Limiter holds a Bucket per key, such as a client or an order. It is safe for concurrent use.
+type Limiter struct {
+	limit   Limit
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+}
+
+// NewLimiter returns a new Limiter allowing limit to every key.
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{limit: limit, buckets: map[string]*Bucket{}}
+}
+
+// Take takes a token from the bucket of key. If it is empty, Take reports false along with how long it takes for a
+// token to be refilled.
+func (l *Limiter) Take(key string, now time.Time) (bool, time.Duration) {
+	if l.limit.IsZero() {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(l.limit, now)
+		l.buckets[key] = bucket
+	}
+	return bucket.Take(now)
+}
+
+// Wait returns how long it takes for a token to be refilled if the bucket of key is empty, and 0 otherwise. It takes
+// no token, so that events can be checked against the limit before they are known to count.
+func (l *Limiter) Wait(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	return bucket.Wait(now)
+}
+
+// Prune forgets the full buckets, which hold no more than a new bucket would.
+func (l *Limiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, bucket := range l.buckets {
+		if bucket.isFull(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Run prunes the buckets every period of the limit, and at least every minute, until ctx is cancelled.
+func (l *Limiter) Run(ctx context.Context) {
+	if l.limit.IsZero() {
+		return
+	}
+	interval := l.limit.Per
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.Prune(now)
+		}
+	}
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds, as told to clients in Retry-After headers.
+func RetryAfterSeconds(wait time.Duration) int {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseLimit tests that limits are parsed from events/period, and that invalid limits are rejected.
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "60/1m", want: Limit{Events: 60, Per: time.Minute}},
+		{value: " 5/10s ", want: Limit{Events: 5, Per: 10 * time.Second}},
+		{value: "", want: Limit{}},
+		{value: "0", want: Limit{}},
+		{value: "60", wantErr: true},
+		{value: "0/1m", wantErr: true},
+		{value: "-1/1m", wantErr: true},
+		{value: "60/minute", wantErr: true},
+		{value: "60/0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			// Act
+			got, err := ParseLimit(tt.value)
+			// Assert
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Error mismatch: got %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Limit mismatch: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestBucketTake tests that a bucket allows a burst of its events, then refills at the rate of its limit and tells
+// how long to wait for the next token.
+func TestBucketTake(t *testing.T) {
+	// Arrange
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bucket := NewBucket(Limit{Events: 3, Per: 3 * time.Second}, now)
+
+	// Act
+	for i := 0; i < 3; i++ {
+		if ok, _ := bucket.Take(now); !ok {
+			t.Fatalf("Take %d was refused", i+1)
+		}
+	}
+	ok, retryAfter := bucket.Take(now)
+	// Assert
+	if ok {
+		t.Fatalf("Take on an empty bucket was allowed")
+	}
+	if retryAfter != time.Second {
+		t.Fatalf("Retry after mismatch: got %v, want %v", retryAfter, time.Second)
+	}
+	if ok, retryAfter := bucket.Take(now.Add(500 * time.Millisecond)); ok || retryAfter != 500*time.Millisecond {
+		t.Fatalf("Take mismatch: got %v after %v, want refused after %v", ok, retryAfter, 500*time.Millisecond)
+	}
+	if ok, _ := bucket.Take(now.Add(time.Second)); !ok {
+		t.Fatalf("Take after a refill was refused")
+	}
+}
+
+// TestLimiterTakeIsPerKey tests that each key has its own bucket, and that a zero limit allows everything.
+func TestLimiterTakeIsPerKey(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	limiter := NewLimiter(Limit{Events: 1, Per: time.Minute})
+	unlimited := NewLimiter(Limit{})
+
+	// Act
+	first, _ := limiter.Take("a", now)
+	second, _ := limiter.Take("a", now)
+	other, _ := limiter.Take("b", now)
+	// Assert
+	if !first || second || !other {
+		t.Fatalf("Take mismatch: got %v, %v, %v, want true, false, true", first, second, other)
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := unlimited.Take("a", now); !ok {
+			t.Fatalf("Take on a zero limit was refused")
+		}
+	}
+}
+
+// TestLimiterWaitTakesNoToken tests that Wait tells how long an empty bucket takes to refill without taking tokens.
+func TestLimiterWaitTakesNoToken(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	limiter := NewLimiter(Limit{Events: 1, Per: time.Minute})
+
+	// Act
+	unknown := limiter.Wait("a", now)
+	limiter.Take("a", now)
+	empty := limiter.Wait("a", now.Add(15*time.Second))
+	again := limiter.Wait("a", now.Add(15*time.Second))
+	refilled := limiter.Wait("a", now.Add(time.Minute))
+	// Assert
+	if unknown != 0 || refilled != 0 {
+		t.Fatalf("Wait mismatch: got %v and %v, want 0 for a new and a refilled bucket", unknown, refilled)
+	}
+	if empty != 45*time.Second || again != empty {
+		t.Fatalf("Wait mismatch: got %v then %v, want %v twice", empty, again, 45*time.Second)
+	}
+}
+
+// TestLimiterPruneForgetsFullBuckets tests that only the buckets refilled since they were used are forgotten.
+func TestLimiterPruneForgetsFullBuckets(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	limiter := NewLimiter(Limit{Events: 2, Per: time.Minute})
+	limiter.Take("a", now)
+	limiter.Take("b", now.Add(50*time.Second))
+
+	// Act
+	limiter.Prune(now.Add(time.Minute))
+	// Assert
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Fatalf("Full bucket was kept")
+	}
+	if _, ok := limiter.buckets["b"]; !ok {
+		t.Fatalf("Partially empty bucket was forgotten")
+	}
+}
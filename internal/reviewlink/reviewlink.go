@@ -0,0 +1,101 @@
+package reviewlink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid review link signature")
+	ErrExpired          = errors.New("review link expired")
+)
+
+const (
+	QueryParamExpires   = "expires"
+	QueryParamSignature = "signature"
+)
+
+// Signer creates and verifies signed links to the review chat of an order.
+type Signer struct {
+	baseURL string
+	secret  []byte
+	ttl     time.Duration
+}
+
+// NewSigner returns a new Signer. baseURL is the public URL of the server, e.g. "wss://reviews.example.com",
+// and links stay valid for ttl after they are created.
+func NewSigner(baseURL string, secret string, ttl time.Duration) *Signer {
+	return &Signer{baseURL: strings.TrimRight(baseURL, "/"), secret: []byte(secret), ttl: ttl}
+}
+
+// Link returns the signed review chat link of an order.
+func (s *Signer) Link(orderUUID string, now time.Time) string {
+	return s.baseURL + "/ws/orders/" + url.PathEscape(orderUUID) + "?" + s.signedQuery(orderUUID, now)
+}
+
+// Verify checks the expires and signature query parameters of a review chat link of an order.
+func (s *Signer) Verify(orderUUID string, query url.Values, now time.Time) error {
+	return s.verify(orderUUID, query, now)
+}
+
+// OptOutLink returns the signed link a customer follows to stop receiving review reminders. It points to the API
+// of the server, so a ws or wss base URL is turned into an http or https one.
+func (s *Signer) OptOutLink(customerUUID string, now time.Time) string {
+	baseURL := s.baseURL
+	if strings.HasPrefix(baseURL, "ws") {
+		baseURL = "http" + strings.TrimPrefix(baseURL, "ws")
+	}
+	return baseURL + "/api/customers/" + url.PathEscape(customerUUID) + "/review-opt-out?" +
+		s.signedQuery(optOutSubject(customerUUID), now)
+}
+
+// VerifyOptOut checks the expires and signature query parameters of a review reminders opt-out link of a customer.
+func (s *Signer) VerifyOptOut(customerUUID string, query url.Values, now time.Time) error {
+	return s.verify(optOutSubject(customerUUID), query, now)
+}
+
+func (s *Signer) signedQuery(subject string, now time.Time) string {
+	expires := strconv.FormatInt(now.Add(s.ttl).Unix(), 10)
+	query := url.Values{}
+	query.Set(QueryParamExpires, expires)
+	query.Set(QueryParamSignature, s.sign(subject, expires))
+	return query.Encode()
+}
+
+func (s *Signer) verify(subject string, query url.Values, now time.Time) error {
+	expires := query.Get(QueryParamExpires)
+	signature, err := hex.DecodeString(query.Get(QueryParamSignature))
+	if err != nil || expires == "" {
+		return ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(s.sign(subject, expires))
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if now.Unix() > expiresAt {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (s *Signer) sign(subject string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(subject + "." + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// optOutSubject keeps the signatures of opt-out links apart from the ones of review chat links.
+func optOutSubject(customerUUID string) string {
+	return "opt-out:" + customerUUID
+}
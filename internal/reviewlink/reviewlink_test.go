@@ -0,0 +1,79 @@
+package reviewlink
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseLink(t *testing.T, link string) url.Values {
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("Error parsing link %q: %v", link, err)
+	}
+	return u.Query()
+}
+
+func TestLinkVerifies(t *testing.T) {
+	signer := NewSigner("wss://reviews.example.com/", "secret", time.Hour)
+	now := time.Now()
+
+	link := signer.Link("ord1", now)
+	if !strings.HasPrefix(link, "wss://reviews.example.com/ws/orders/ord1?") {
+		t.Fatalf("Unexpected link %q", link)
+	}
+	if err := signer.Verify("ord1", parseLink(t, link), now.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected link to verify, got %v", err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	signer := NewSigner("wss://reviews.example.com", "secret", time.Hour)
+	now := time.Now()
+	query := parseLink(t, signer.Link("ord1", now))
+
+	if err := signer.Verify("ord2", query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another order, got %v", err)
+	}
+	if err := NewSigner("", "other", time.Hour).Verify("ord1", query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another secret, got %v", err)
+	}
+	extended := url.Values{}
+	extended.Set(QueryParamExpires, "99999999999")
+	extended.Set(QueryParamSignature, query.Get(QueryParamSignature))
+	if err := signer.Verify("ord1", extended, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a changed expiry, got %v", err)
+	}
+	if err := signer.Verify("ord1", url.Values{}, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for a missing signature, got %v", err)
+	}
+}
+
+func TestVerifyRejectsExpired(t *testing.T) {
+	signer := NewSigner("wss://reviews.example.com", "secret", time.Hour)
+	now := time.Now()
+	query := parseLink(t, signer.Link("ord1", now))
+
+	if err := signer.Verify("ord1", query, now.Add(2*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+}
+
+func TestOptOutLinkVerifies(t *testing.T) {
+	signer := NewSigner("wss://reviews.example.com", "secret", time.Hour)
+	now := time.Now()
+
+	link := signer.OptOutLink("cus1", now)
+	if !strings.HasPrefix(link, "https://reviews.example.com/api/customers/cus1/review-opt-out?") {
+		t.Fatalf("Unexpected link %q", link)
+	}
+	query := parseLink(t, link)
+	if err := signer.VerifyOptOut("cus1", query, now); err != nil {
+		t.Fatalf("Expected link to verify, got %v", err)
+	}
+	if err := signer.Verify("cus1", query, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for an opt-out signature used as a review link, got %v", err)
+	}
+}
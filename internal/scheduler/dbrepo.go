@@ -0,0 +1,219 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"reviewbot/app"
+	"time"
+)
+
+// ScheduledJobStore represents a scheduled job entity at the Database.
+type ScheduledJobStore struct {
+	UUID      string
+	Kind      string
+	JobKey    string
+	Subject   string
+	Payload   []byte
+	Status    string
+	Attempts  int
+	LastError sql.NullString
+	RunAt     time.Time
+	CreatedAt time.Time
+}
+
+// DatabaseRepository implements the ScheduledJobsRepository interface.
+type DatabaseRepository struct {
+	db *sqlx.DB
+}
+
+// NewDatabaseRepository returns a new DatabaseRepository.
+func NewDatabaseRepository(db *sqlx.DB) *DatabaseRepository {
+	return &DatabaseRepository{
+		db: db,
+	}
+}
+
+// ScheduledJobStoreToScheduledJob converts a ScheduledJobStore object to an app.ScheduledJob
+func (ds *DatabaseRepository) ScheduledJobStoreToScheduledJob(jobStore ScheduledJobStore) app.ScheduledJob {
+	return app.ScheduledJob{
+		UUID:      jobStore.UUID,
+		Kind:      jobStore.Kind,
+		Key:       jobStore.JobKey,
+		Subject:   jobStore.Subject,
+		Payload:   jobStore.Payload,
+		Status:    app.ScheduledJobStatus(jobStore.Status),
+		Attempts:  jobStore.Attempts,
+		LastError: jobStore.LastError.String,
+		RunAt:     jobStore.RunAt,
+		CreatedAt: jobStore.CreatedAt,
+	}
+}
+
+// AddScheduledJob stores a pending job, unless a job with the same key already exists.
+func (ds *DatabaseRepository) AddScheduledJob(ctx context.Context, job app.ScheduledJob) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Insert("scheduled_jobs").Cols("uuid", "kind", "job_key", "subject", "payload",
+		"status", "attempts", "run_at", "created_at").Vals(goqu.Vals{uuid.New().String(), job.Kind, job.Key,
+		job.Subject, job.Payload, string(app.ScheduledJobStatusPending), 0, job.RunAt, job.CreatedAt}).
+		OnConflict(goqu.DoNothing()).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing insert for scheduled job",
+			fmt.Errorf("insert scheduled job: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while inserting scheduled job", fmt.Errorf("insert scheduled job: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while inserting scheduled job", fmt.Errorf("insert scheduled job: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// GetDueScheduledJobs retrieves from storage the pending jobs whose time has come, earliest first.
+// Jobs claimed before staleBefore are considered abandoned and are returned as well.
+func (ds *DatabaseRepository) GetDueScheduledJobs(ctx context.Context, now time.Time, staleBefore time.Time,
+	limit int) ([]app.ScheduledJob, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Select("uuid", "kind", "job_key", "subject", "payload", "status", "attempts",
+		"last_error", "run_at", "created_at").From("scheduled_jobs").Where(claimableJob(now, staleBefore)).
+		Order(goqu.C("run_at").Asc()).Limit(uint(limit)).ToSQL()
+	if err != nil {
+		return nil, app.NewError("Error while preparing querying for scheduled jobs",
+			fmt.Errorf("get due scheduled jobs: %w", err))
+	}
+
+	rows, err := ds.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, app.NewError("Error while getting scheduled jobs", fmt.Errorf("get due scheduled jobs: %w", err))
+	}
+	defer rows.Close()
+	jobs := []app.ScheduledJob{}
+	for rows.Next() {
+		var jobStore ScheduledJobStore
+		if err := rows.Scan(&jobStore.UUID, &jobStore.Kind, &jobStore.JobKey, &jobStore.Subject, &jobStore.Payload,
+			&jobStore.Status, &jobStore.Attempts, &jobStore.LastError, &jobStore.RunAt,
+			&jobStore.CreatedAt); err != nil {
+			return nil, app.NewError("Error while reading scheduled jobs", fmt.Errorf("get due scheduled jobs: %w", err))
+		}
+		jobs = append(jobs, ds.ScheduledJobStoreToScheduledJob(jobStore))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, app.NewError("Error while reading scheduled jobs", fmt.Errorf("get due scheduled jobs: %w", err))
+	}
+
+	return jobs, nil
+}
+
+// ClaimScheduledJob marks a due job as running and counts the attempt.
+// The conditional update lets only one of several concurrent schedulers claim a job.
+func (ds *DatabaseRepository) ClaimScheduledJob(ctx context.Context, jobUUID string, now time.Time,
+	staleBefore time.Time) (bool, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("scheduled_jobs").Set(goqu.Record{
+		"status":     string(app.ScheduledJobStatusRunning),
+		"claimed_at": now,
+		"attempts":   goqu.L("`attempts` + 1"),
+	}).Where(goqu.C("uuid").Eq(jobUUID), claimableJob(now, staleBefore)).ToSQL()
+	if err != nil {
+		return false, app.NewError("Error while preparing update for scheduled job",
+			fmt.Errorf("claim scheduled job: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return false, app.NewError("Error while updating scheduled job", fmt.Errorf("claim scheduled job: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, app.NewError("Error while updating scheduled job", fmt.Errorf("claim scheduled job: %w", err))
+	}
+
+	return rows > 0, nil
+}
+
+// FinishScheduledJob records the final status of a job.
+func (ds *DatabaseRepository) FinishScheduledJob(ctx context.Context, jobUUID string, status app.ScheduledJobStatus,
+	lastError string, finishedAt time.Time) error {
+	record := goqu.Record{
+		"status":      string(status),
+		"finished_at": finishedAt,
+		"claimed_at":  nil,
+		"last_error":  nil,
+	}
+	if lastError != "" {
+		record["last_error"] = lastError
+	}
+	return ds.updateScheduledJob(ctx, jobUUID, record)
+}
+
+// RescheduleScheduledJob makes a job pending again, to be retried at runAt.
+func (ds *DatabaseRepository) RescheduleScheduledJob(ctx context.Context, jobUUID string, runAt time.Time,
+	lastError string) error {
+	return ds.updateScheduledJob(ctx, jobUUID, goqu.Record{
+		"status":     string(app.ScheduledJobStatusPending),
+		"run_at":     runAt,
+		"claimed_at": nil,
+		"last_error": lastError,
+	})
+}
+
+// CancelScheduledJobs cancels the pending jobs of a kind concerning subject.
+func (ds *DatabaseRepository) CancelScheduledJobs(ctx context.Context, kind string, subject string) (int64, error) {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("scheduled_jobs").Set(goqu.Record{
+		"status": string(app.ScheduledJobStatusCancelled),
+	}).Where(goqu.C("kind").Eq(kind), goqu.C("subject").Eq(subject),
+		goqu.C("status").Eq(string(app.ScheduledJobStatusPending))).ToSQL()
+	if err != nil {
+		return 0, app.NewError("Error while preparing update for scheduled jobs",
+			fmt.Errorf("cancel scheduled jobs: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return 0, app.NewError("Error while updating scheduled jobs", fmt.Errorf("cancel scheduled jobs: %w", err))
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, app.NewError("Error while updating scheduled jobs", fmt.Errorf("cancel scheduled jobs: %w", err))
+	}
+
+	return rows, nil
+}
+
+func (ds *DatabaseRepository) updateScheduledJob(ctx context.Context, jobUUID string, record goqu.Record) error {
+	dialect := goqu.Dialect("mysql")
+	sqlQuery, _, err := dialect.Update("scheduled_jobs").Set(record).Where(goqu.C("uuid").Eq(jobUUID)).ToSQL()
+	if err != nil {
+		return app.NewError("Error while preparing update for scheduled job",
+			fmt.Errorf("update scheduled job: %w", err))
+	}
+	res, err := ds.db.ExecContext(ctx, sqlQuery)
+	if err != nil {
+		return app.NewError("Error while updating scheduled job", fmt.Errorf("update scheduled job: %w", err))
+	}
+	if rows, err := res.RowsAffected(); rows == 0 || err != nil {
+		return app.NewError("Error while updating scheduled job", app.ErrNoRecords)
+	}
+
+	return nil
+}
+
+func claimableJob(now time.Time, staleBefore time.Time) goqu.Expression {
+	return goqu.Or(
+		goqu.And(
+			goqu.C("status").Eq(string(app.ScheduledJobStatusPending)),
+			goqu.C("run_at").Lte(now),
+		),
+		goqu.And(
+			goqu.C("status").Eq(string(app.ScheduledJobStatusRunning)),
+			goqu.C("claimed_at").Lt(staleBefore),
+		),
+	)
+}
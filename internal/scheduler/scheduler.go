@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"reviewbot/app"
+	"sync"
+	"time"
+)
+
+const (
+	// maxAttempts is the number of failed runs after which a job is given up.
+	maxAttempts = 5
+	// retryDelay is the delay before the first retry of a failed job. It doubles with every attempt.
+	retryDelay = time.Minute
+	// claimTimeout is the time after which a job claimed by a scheduler that never finished it is run again.
+	claimTimeout = 10 * time.Minute
+	batchSize    = 50
+)
+
+// Handler runs a job. Jobs whose handler returns an error are retried with an exponential backoff.
+type Handler func(ctx context.Context, job app.ScheduledJob) error
+
+// Scheduler runs the jobs stored in the scheduled jobs repository once they are due.
+// Jobs are claimed before they run, so several schedulers sharing the repository never run the same job twice.
+type Scheduler struct {
+	repo     app.ScheduledJobsRepository
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewScheduler returns a new Scheduler polling for due jobs every interval.
+func NewScheduler(repo app.ScheduledJobsRepository, interval time.Duration, logger *slog.Logger) *Scheduler {
+	return &Scheduler{repo: repo, interval: interval, logger: logger, handlers: map[string]Handler{}}
+}
+
+// Handle registers the handler of the jobs of a kind.
+func (s *Scheduler) Handle(kind string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[kind] = handler
+}
+
+// Schedule stores a job to run at runAt. It returns false if a job with the same key was already scheduled.
+func (s *Scheduler) Schedule(ctx context.Context, kind string, key string, subject string, payload []byte,
+	runAt time.Time) (bool, error) {
+	return s.repo.AddScheduledJob(ctx, app.ScheduledJob{
+		Kind:      kind,
+		Key:       key,
+		Subject:   subject,
+		Payload:   payload,
+		RunAt:     runAt.UTC(),
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// Cancel cancels the pending jobs of a kind concerning subject.
+func (s *Scheduler) Cancel(ctx context.Context, kind string, subject string) (int64, error) {
+	return s.repo.CancelScheduledJobs(ctx, kind, subject)
+}
+
+// Run runs the due jobs every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		ran, err := s.RunDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("could not run scheduled jobs", "err", err)
+		}
+		if ran > 0 {
+			s.logger.Info("ran scheduled jobs", "count", ran)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs the jobs that are due and returns how many of them ran successfully.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	jobs, err := s.repo.GetDueScheduledJobs(ctx, now, now.Add(-claimTimeout), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return ran, ctx.Err()
+		}
+		claimed, err := s.repo.ClaimScheduledJob(ctx, job.UUID, now, now.Add(-claimTimeout))
+		if err != nil {
+			return ran, err
+		}
+		if !claimed {
+			continue
+		}
+
+		job.Attempts++
+		succeeded, err := s.runJob(ctx, job)
+		if err != nil {
+			return ran, err
+		}
+		if succeeded {
+			ran++
+		}
+	}
+	return ran, nil
+}
+
+// runJob runs a claimed job, records its outcome and returns whether it succeeded.
+// The returned error concerns the recording of the outcome only.
+func (s *Scheduler) runJob(ctx context.Context, job app.ScheduledJob) (bool, error) {
+	s.mu.RLock()
+	handler, ok := s.handlers[job.Kind]
+	s.mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler for jobs of kind %q", job.Kind)
+	} else {
+		err = handler(ctx, job)
+	}
+	if err == nil {
+		return true, s.repo.FinishScheduledJob(ctx, job.UUID, app.ScheduledJobStatusDone, "", time.Now().UTC())
+	}
+
+	lastError := err.Error()
+	logger := s.logger.With("job_uuid", job.UUID, "kind", job.Kind, "attempt", job.Attempts, "err", err)
+	if !ok || job.Attempts >= maxAttempts {
+		logger.Error("scheduled job failed, giving up")
+		return false, s.repo.FinishScheduledJob(ctx, job.UUID, app.ScheduledJobStatusFailed, lastError,
+			time.Now().UTC())
+	}
+	logger.Warn("scheduled job failed, retrying")
+	return false, s.repo.RescheduleScheduledJob(ctx, job.UUID, time.Now().UTC().Add(retryDelay<<(job.Attempts-1)),
+		lastError)
+}
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"regexp"
+	"reviewbot/app"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/exp/slog"
+)
+
+func newTestScheduler(t *testing.T) (*sql.DB, *Scheduler, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+	repo := NewDatabaseRepository(sqlx.NewDb(db, "mysql"))
+	return db, NewScheduler(repo, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil))), mock
+}
+
+var jobColumns = []string{"uuid", "kind", "job_key", "subject", "payload", "status", "attempts", "last_error",
+	"run_at", "created_at"}
+
+// TestScheduleIsIdempotent tests that a job is stored once per key.
+func TestScheduleIsIdempotent(t *testing.T) {
+	// Arrange
+	db, scheduler, mock := newTestScheduler(t)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `scheduled_jobs`") + ".*'greet', 'greet:ord1', 'ord1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `scheduled_jobs`") + ".*'greet', 'greet:ord1', 'ord1'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Act
+	first, err := scheduler.Schedule(context.Background(), "greet", "greet:ord1", "ord1", nil, time.Now())
+	if err != nil {
+		t.Fatalf("Error scheduling job: %v", err)
+	}
+	second, err := scheduler.Schedule(context.Background(), "greet", "greet:ord1", "ord1", nil, time.Now())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error scheduling job: %v", err)
+	}
+	if !first || second {
+		t.Fatalf("Scheduled mismatch: got %t and %t, want %t and %t", first, second, true, false)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRunDueRunsClaimedJobs tests that only the jobs claimed by the scheduler run.
+func TestRunDueRunsClaimedJobs(t *testing.T) {
+	// Arrange
+	db, scheduler, mock := newTestScheduler(t)
+	defer db.Close()
+	var handled []string
+	scheduler.Handle("greet", func(ctx context.Context, job app.ScheduledJob) error {
+		handled = append(handled, string(job.Payload))
+		return nil
+	})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `scheduled_jobs`")).WillReturnRows(sqlmock.NewRows(jobColumns).
+		AddRow("job1", "greet", "greet:1", "ord1", []byte("hello"), "pending", 0, nil, time.Now(), time.Now()).
+		AddRow("job2", "greet", "greet:2", "ord2", []byte("hi"), "pending", 0, nil, time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='running'.*'job1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='done'.*'job1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Another replica claimed the second job first.
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='running'.*'job2'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Act
+	ran, err := scheduler.RunDue(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error running jobs: %v", err)
+	}
+	if ran != 1 || len(handled) != 1 || handled[0] != "hello" {
+		t.Fatalf("Ran jobs mismatch: got %d %v, want %d [hello]", ran, handled, 1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRunDueRetriesFailedJobs tests that failed jobs are retried until the attempts run out.
+func TestRunDueRetriesFailedJobs(t *testing.T) {
+	// Arrange
+	db, scheduler, mock := newTestScheduler(t)
+	defer db.Close()
+	scheduler.Handle("greet", func(ctx context.Context, job app.ScheduledJob) error {
+		return errors.New("mailbox unavailable")
+	})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM `scheduled_jobs`")).WillReturnRows(sqlmock.NewRows(jobColumns).
+		AddRow("job1", "greet", "greet:1", "ord1", nil, "pending", 0, nil, time.Now(), time.Now()).
+		AddRow("job2", "greet", "greet:2", "ord2", nil, "pending", maxAttempts-1, nil, time.Now(), time.Now()).
+		AddRow("job3", "unknown", "unknown:3", "ord3", nil, "pending", 0, nil, time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*'job1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") +
+		".*`last_error`='mailbox unavailable',`run_at`=.*`status`='pending'.*'job1'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*'job2'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") +
+		".*`last_error`='mailbox unavailable',`status`='failed'.*'job2'").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*'job3'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `scheduled_jobs` SET") + ".*`status`='failed'.*'job3'").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Act
+	ran, err := scheduler.RunDue(context.Background())
+	// Assert
+	if err != nil {
+		t.Fatalf("Error running jobs: %v", err)
+	}
+	if ran != 0 {
+		t.Fatalf("Ran count mismatch: got %d, want %d", ran, 0)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unfulfilled expectations: %v", err)
+	}
+}
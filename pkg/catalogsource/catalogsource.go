@@ -0,0 +1,153 @@
+package catalogsource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reviewbot/pkg/catalogsource/catalogsourcetypes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDisabled is returned by catalog sources that intentionally provide no catalog.
+// Consumers should skip the synchronization instead of treating every product as removed.
+var ErrDisabled = errors.New("catalog source disabled")
+
+// CatalogSource interface for fetching the product catalog from an external system
+type CatalogSource interface {
+	// Fetch returns all the products currently offered by the source
+	Fetch(ctx context.Context) ([]catalogsourcetypes.CatalogProduct, error)
+}
+
+// FieldMapping holds the record keys each CatalogProduct field is read from.
+// Keys of nested objects are separated by dots, e.g. "attributes.name".
+type FieldMapping struct {
+	ID           string
+	Name         string
+	Image        string
+	Manufacturer string
+	Vehicle      string
+	CreatedAt    string
+}
+
+// DefaultFieldMapping returns the mapping of the default product feed.
+func DefaultFieldMapping() FieldMapping {
+	return FieldMapping{
+		ID:           "id",
+		Name:         "productName",
+		Image:        "image",
+		Manufacturer: "manufacturer",
+		Vehicle:      "vehicle",
+		CreatedAt:    "createdAt",
+	}
+}
+
+// ParseFieldMapping parses a comma separated list of field=key pairs, e.g. "name=title,image=media.url".
+// Fields that are not listed keep their default key.
+func ParseFieldMapping(s string) (FieldMapping, error) {
+	mapping := DefaultFieldMapping()
+	if strings.TrimSpace(s) == "" {
+		return mapping, nil
+	}
+
+	fields := map[string]*string{
+		"id":           &mapping.ID,
+		"name":         &mapping.Name,
+		"image":        &mapping.Image,
+		"manufacturer": &mapping.Manufacturer,
+		"vehicle":      &mapping.Vehicle,
+		"created_at":   &mapping.CreatedAt,
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, key, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		target, known := fields[strings.TrimSpace(field)]
+		if !ok || !known || strings.TrimSpace(key) == "" {
+			return FieldMapping{}, fmt.Errorf("invalid field mapping %q", pair)
+		}
+		*target = strings.TrimSpace(key)
+	}
+	return mapping, nil
+}
+
+// MapRecord converts a decoded record to a CatalogProduct according to the mapping.
+func (m FieldMapping) MapRecord(record map[string]any) (catalogsourcetypes.CatalogProduct, error) {
+	product := catalogsourcetypes.CatalogProduct{
+		ID:           stringValue(Lookup(record, m.ID)),
+		Name:         stringValue(Lookup(record, m.Name)),
+		Image:        stringValue(Lookup(record, m.Image)),
+		Manufacturer: stringValue(Lookup(record, m.Manufacturer)),
+		Vehicle:      stringValue(Lookup(record, m.Vehicle)),
+	}
+	if product.ID == "" {
+		return product, fmt.Errorf("record has no value for id key %q", m.ID)
+	}
+
+	createdAt, err := timeValue(Lookup(record, m.CreatedAt))
+	if err != nil {
+		return product, fmt.Errorf("record %s: %w", product.ID, err)
+	}
+	product.CreatedAt = createdAt
+	return product, nil
+}
+
+// Lookup returns the value found at the dot separated path of a decoded JSON document, or nil.
+func Lookup(document any, path string) any {
+	if path == "" {
+		return document
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := document.(map[string]any)
+		if !ok {
+			return nil
+		}
+		document = object[key]
+	}
+	return document
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// timeValue accepts RFC 3339 strings and unix timestamps in seconds.
+func timeValue(value any) (time.Time, error) {
+	var seconds int64
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return time.Time{}, nil
+		}
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(v))
+		if err == nil {
+			return t.UTC(), nil
+		}
+		if seconds, err = strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", v)
+		}
+	case json.Number:
+		var err error
+		if seconds, err = v.Int64(); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q", v)
+		}
+	case float64:
+		seconds = int64(v)
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp %v", v)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
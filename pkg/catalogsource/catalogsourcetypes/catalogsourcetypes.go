@@ -0,0 +1,14 @@
+package catalogsourcetypes
+
+import "time"
+
+// CatalogProduct is a product as provided by a catalog source
+type CatalogProduct struct {
+	// ID is the identifier of the product at the source, used to match it with the stored products
+	ID           string
+	Name         string
+	Image        string
+	Manufacturer string
+	Vehicle      string
+	CreatedAt    time.Time
+}
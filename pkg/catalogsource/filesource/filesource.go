@@ -0,0 +1,96 @@
+package filesource
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reviewbot/pkg/catalogsource"
+	"reviewbot/pkg/catalogsource/catalogsourcetypes"
+	"strings"
+)
+
+// FileSource reads the product catalog from a local JSON or CSV file.
+// JSON files contain an array of product objects. CSV files have a header row naming the columns.
+// The file is read again on every fetch, so edits are picked up by the next synchronization.
+type FileSource struct {
+	path    string
+	mapping catalogsource.FieldMapping
+}
+
+func NewFileSource(path string, mapping catalogsource.FieldMapping) catalogsource.CatalogSource {
+	return &FileSource{path: path, mapping: mapping}
+}
+
+func (fs *FileSource) Fetch(ctx context.Context) ([]catalogsourcetypes.CatalogProduct, error) {
+	file, err := os.Open(fs.path)
+	if err != nil {
+		return nil, fmt.Errorf("file catalog source: %w", err)
+	}
+	defer file.Close()
+
+	var records []map[string]any
+	switch strings.ToLower(filepath.Ext(fs.path)) {
+	case ".json":
+		records, err = readJSON(file)
+	case ".csv":
+		records, err = readCSV(file)
+	default:
+		err = fmt.Errorf("unsupported file type %q", filepath.Ext(fs.path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file catalog source: %w", err)
+	}
+
+	products := make([]catalogsourcetypes.CatalogProduct, 0, len(records))
+	for i, record := range records {
+		product, err := fs.mapping.MapRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("file catalog source: product %d: %w", i, err)
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+func readJSON(r io.Reader) ([]map[string]any, error) {
+	var records []map[string]any
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&records); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	return records, nil
+}
+
+func readCSV(r io.Reader) ([]map[string]any, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	var records []map[string]any
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		record := make(map[string]any, len(header))
+		for i, column := range header {
+			record[column] = row[i]
+		}
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,79 @@
+package httpsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reviewbot/pkg/catalogsource"
+	"reviewbot/pkg/catalogsource/catalogsourcetypes"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Config configures an HTTP JSON catalog source.
+type Config struct {
+	// URL of the JSON feed.
+	URL string
+	// ItemsPath is the dot separated path of the products array in the feed. Empty when the feed is the array itself.
+	ItemsPath string
+	// Mapping maps the feed's keys to the catalog product fields.
+	Mapping catalogsource.FieldMapping
+	// Timeout of a single fetch. Defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+type HTTPSource struct {
+	config Config
+	client *http.Client
+}
+
+func NewHTTPSource(config Config) catalogsource.CatalogSource {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	return &HTTPSource{config: config, client: &http.Client{Timeout: config.Timeout}}
+}
+
+func (hs *HTTPSource) Fetch(ctx context.Context) ([]catalogsourcetypes.CatalogProduct, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.config.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http catalog source: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http catalog source: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("http catalog source: received status %d from remote server", resp.StatusCode)
+	}
+
+	var document any
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("http catalog source: decode feed: %w", err)
+	}
+
+	items, ok := catalogsource.Lookup(document, hs.config.ItemsPath).([]any)
+	if !ok {
+		return nil, fmt.Errorf("http catalog source: no products array at path %q", hs.config.ItemsPath)
+	}
+	products := make([]catalogsourcetypes.CatalogProduct, 0, len(items))
+	for i, item := range items {
+		record, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("http catalog source: product %d is not an object", i)
+		}
+		product, err := hs.config.Mapping.MapRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("http catalog source: product %d: %w", i, err)
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
@@ -0,0 +1,142 @@
+package httpsource_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reviewbot/pkg/catalogsource"
+	"reviewbot/pkg/catalogsource/httpsource"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, status int, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("Expected Accept header %q, got %q", "application/json", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchWithDefaultMapping(t *testing.T) {
+	server := newTestServer(t, http.StatusOK, `[
+		{"createdAt":"2023-07-22T09:41:13.123Z","productName":"Tyre","manufacturer":"Acme","vehicle":"Car",
+		 "image":"https://img/1","id":"1"},
+		{"createdAt":"2023-07-23T10:00:00Z","productName":"Seat","manufacturer":"Acme","vehicle":"Bus",
+		 "image":"https://img/2","id":"2"}
+	]`)
+	source := httpsource.NewHTTPSource(httpsource.Config{URL: server.URL, Mapping: catalogsource.DefaultFieldMapping()})
+
+	products, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Error fetching products: %v", err)
+	}
+	if len(products) != 2 {
+		t.Fatalf("Products count mismatch: got %d, want %d", len(products), 2)
+	}
+	if products[0].ID != "1" || products[0].Name != "Tyre" || products[0].Manufacturer != "Acme" ||
+		products[0].Vehicle != "Car" || products[0].Image != "https://img/1" {
+		t.Fatalf("Unexpected product: %+v", products[0])
+	}
+	want := time.Date(2023, 7, 22, 9, 41, 13, 123000000, time.UTC)
+	if !products[0].CreatedAt.Equal(want) {
+		t.Fatalf("Created at mismatch: got %s, want %s", products[0].CreatedAt, want)
+	}
+}
+
+func TestFetchWithCustomMappingAndItemsPath(t *testing.T) {
+	server := newTestServer(t, http.StatusOK, `{"data":{"items":[
+		{"sku":1042,"title":"Mirror","media":{"url":"https://img/3"},"brand":"Acme","created":1690000000}
+	]}}`)
+	mapping, err := catalogsource.ParseFieldMapping("id=sku,name=title,image=media.url,manufacturer=brand," +
+		"created_at=created")
+	if err != nil {
+		t.Fatalf("Error parsing field mapping: %v", err)
+	}
+	source := httpsource.NewHTTPSource(httpsource.Config{URL: server.URL, ItemsPath: "data.items", Mapping: mapping})
+
+	products, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Error fetching products: %v", err)
+	}
+	if len(products) != 1 {
+		t.Fatalf("Products count mismatch: got %d, want %d", len(products), 1)
+	}
+	product := products[0]
+	if product.ID != "1042" || product.Name != "Mirror" || product.Image != "https://img/3" ||
+		product.Manufacturer != "Acme" || product.Vehicle != "" {
+		t.Fatalf("Unexpected product: %+v", product)
+	}
+	if !product.CreatedAt.Equal(time.Unix(1690000000, 0)) {
+		t.Fatalf("Created at mismatch: got %s", product.CreatedAt)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		itemsPath string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: `{"error":"boom"}`},
+		{name: "not found", status: http.StatusNotFound, body: `Not found`},
+		{name: "malformed json", status: http.StatusOK, body: `[{"id":"1"`},
+		{name: "not an array", status: http.StatusOK, body: `{"id":"1"}`},
+		{name: "missing items path", status: http.StatusOK, body: `{"data":[]}`, itemsPath: "items"},
+		{name: "product not an object", status: http.StatusOK, body: `["1"]`},
+		{name: "product without id", status: http.StatusOK, body: `[{"productName":"Tyre"}]`},
+		{name: "invalid timestamp", status: http.StatusOK, body: `[{"id":"1","createdAt":"yesterday"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.status, tt.body)
+			source := httpsource.NewHTTPSource(httpsource.Config{URL: server.URL, ItemsPath: tt.itemsPath,
+				Mapping: catalogsource.DefaultFieldMapping()})
+
+			if _, err := source.Fetch(context.Background()); err == nil {
+				t.Fatalf("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestFetchUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	source := httpsource.NewHTTPSource(httpsource.Config{URL: url, Mapping: catalogsource.DefaultFieldMapping()})
+
+	if _, err := source.Fetch(context.Background()); err == nil {
+		t.Fatalf("Expected error, got nil")
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	source := httpsource.NewHTTPSource(httpsource.Config{URL: server.URL, Mapping: catalogsource.DefaultFieldMapping(),
+		Timeout: 50 * time.Millisecond})
+
+	if _, err := source.Fetch(context.Background()); err == nil {
+		t.Fatalf("Expected error, got nil")
+	}
+}
+
+func TestParseFieldMappingInvalid(t *testing.T) {
+	for _, mapping := range []string{"name", "color=paint", "name="} {
+		if _, err := catalogsource.ParseFieldMapping(mapping); err == nil {
+			t.Errorf("Expected error for mapping %q, got nil", mapping)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package noopsource
+
+import (
+	"context"
+	"reviewbot/pkg/catalogsource"
+	"reviewbot/pkg/catalogsource/catalogsourcetypes"
+)
+
+// NoopSource is used when the product catalog is managed without an external source.
+type NoopSource struct{}
+
+func NewNoopSource() catalogsource.CatalogSource {
+	return &NoopSource{}
+}
+
+func (ns *NoopSource) Fetch(ctx context.Context) ([]catalogsourcetypes.CatalogProduct, error) {
+	return nil, catalogsource.ErrDisabled
+}
@@ -0,0 +1,34 @@
+package eventsink
+
+import (
+	"context"
+	"errors"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+)
+
+// EventSink interface for publishing domain events to their consumers
+type EventSink interface {
+	// Publish hands the given event to the consumers. It returns nil once they have accepted it.
+	Publish(ctx context.Context, event eventsinktypes.Event) error
+}
+
+// MultiSink publishes every event to all of its sinks.
+type MultiSink struct {
+	sinks []EventSink
+}
+
+// NewMultiSink returns a sink publishing to every one of sinks. It fails if any of them fails, in which case the
+// event may have reached the other ones.
+func NewMultiSink(sinks ...EventSink) EventSink {
+	return &MultiSink{sinks: sinks}
+}
+
+func (ms *MultiSink) Publish(ctx context.Context, event eventsinktypes.Event) error {
+	var errs []error
+	for _, sink := range ms.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,16 @@
+package eventsinktypes
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is a domain event handed to a sink
+type Event struct {
+	// ID identifies the event. An event may be published more than once, so consumers should use it as an
+	// idempotency key and ignore the events they have already handled.
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
@@ -0,0 +1,32 @@
+package filesink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reviewbot/pkg/eventsink"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"sync"
+)
+
+// FileSink writes every event as a JSON line, e.g. to a file read by an analytics pipeline.
+type FileSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewFileSink(w io.Writer) eventsink.EventSink {
+	return &FileSink{w: w}
+}
+
+func (fs *FileSink) Publish(ctx context.Context, event eventsinktypes.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_, err = fs.w.Write(append(line, '\n'))
+	return err
+}
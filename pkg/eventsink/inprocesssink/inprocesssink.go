@@ -0,0 +1,32 @@
+package inprocesssink
+
+import (
+	"context"
+	"errors"
+	"reviewbot/pkg/eventsink"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+)
+
+// Subscriber handles the events published to an InProcessSink.
+type Subscriber func(ctx context.Context, event eventsinktypes.Event) error
+
+// InProcessSink hands every event to subscribers running in the same process.
+type InProcessSink struct {
+	subscribers []Subscriber
+}
+
+// NewInProcessSink returns a sink calling every subscriber, in order, with each event.
+// Publishing fails if any subscriber fails, so the event is published again to all of them later.
+func NewInProcessSink(subscribers ...Subscriber) eventsink.EventSink {
+	return &InProcessSink{subscribers: subscribers}
+}
+
+func (is *InProcessSink) Publish(ctx context.Context, event eventsinktypes.Event) error {
+	var errs []error
+	for _, subscriber := range is.subscribers {
+		if err := subscriber(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package natssink
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"reviewbot/pkg/eventsink"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"strings"
+	"time"
+)
+
+// ErrNoStream is returned when no JetStream stream captures the subject of a publication.
+var ErrNoStream = jetstream.ErrNoStreamResponse
+
+// Conn is the part of a NATS connection the sink needs.
+type Conn interface {
+	// PublishMsg publishes data to subject with msgID as the Nats-Msg-Id header, which JetStream uses to drop
+	// duplicates, and returns once the JetStream stream of the subject has stored the message.
+	PublishMsg(ctx context.Context, subject string, msgID string, data []byte) error
+}
+
+// NATSSink publishes every event to the "<prefix>.<event type>" subject of a NATS server. A JetStream stream must
+// capture the subjects, publications fail otherwise.
+type NATSSink struct {
+	conn          Conn
+	subjectPrefix string
+}
+
+func NewNATSSink(conn Conn, subjectPrefix string) eventsink.EventSink {
+	return &NATSSink{conn: conn, subjectPrefix: strings.TrimSuffix(subjectPrefix, ".")}
+}
+
+func (ns *NATSSink) Publish(ctx context.Context, event eventsinktypes.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return ns.conn.PublishMsg(ctx, ns.subjectPrefix+"."+event.Type, event.ID, data)
+}
+
+// Client implements Conn with a NATS connection and its JetStream context. The connection keeps reconnecting to
+// the servers in the background, so a server unavailable when the client is created or later only fails the
+// publications in the meantime.
+type Client struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	timeout time.Duration
+}
+
+// NewClient returns a Client for the servers of serverURL, a comma separated list of URLs such as
+// "nats://localhost:4222". The user and password, or the token, of the URLs authenticate the client and the tls
+// scheme requires TLS. timeout bounds connecting and every publication.
+func NewClient(serverURL string, timeout time.Duration) (*Client, error) {
+	conn, err := nats.Connect(serverURL, nats.Name("reviewbot"), nats.Timeout(timeout), nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Client{conn: conn, js: js, timeout: timeout}, nil
+}
+
+// PublishMsg publishes a message and waits for JetStream to acknowledge it.
+func (c *Client) PublishMsg(ctx context.Context, subject string, msgID string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	_, err := c.js.Publish(ctx, subject, data, jetstream.WithMsgID(msgID))
+	return err
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.conn.Close()
+	return nil
+}
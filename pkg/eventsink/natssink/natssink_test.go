@@ -0,0 +1,49 @@
+package natssink_test
+
+import (
+	"context"
+	"reviewbot/pkg/eventsink/eventsinktypes"
+	"reviewbot/pkg/eventsink/natssink"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingConn records the messages published through it.
+type recordingConn struct {
+	subject string
+	msgID   string
+	data    string
+}
+
+func (rc *recordingConn) PublishMsg(ctx context.Context, subject string, msgID string, data []byte) error {
+	rc.subject = subject
+	rc.msgID = msgID
+	rc.data = string(data)
+	return nil
+}
+
+// TestPublishSendsMessageWithMsgID tests that an event is published to the subject of its type, with its ID as the
+// message ID JetStream drops duplicates by.
+func TestPublishSendsMessageWithMsgID(t *testing.T) {
+	// Arrange
+	conn := &recordingConn{}
+	event := eventsinktypes.Event{ID: "evt1", Type: "review.created", OccurredAt: time.Now(),
+		Data: []byte(`{"score":1}`)}
+
+	// Act
+	err := natssink.NewNATSSink(conn, "reviewbot.").Publish(context.Background(), event)
+	// Assert
+	if err != nil {
+		t.Fatalf("Error publishing event: %v", err)
+	}
+	if conn.subject != "reviewbot.review.created" {
+		t.Fatalf("Subject mismatch: got %s, want %s", conn.subject, "reviewbot.review.created")
+	}
+	if conn.msgID != "evt1" {
+		t.Fatalf("Message ID mismatch: got %s, want %s", conn.msgID, "evt1")
+	}
+	if !strings.Contains(conn.data, `"id":"evt1"`) || !strings.Contains(conn.data, `"score":1`) {
+		t.Fatalf("Unexpected payload %q", conn.data)
+	}
+}
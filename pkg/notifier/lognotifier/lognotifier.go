@@ -0,0 +1,38 @@
+package lognotifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reviewbot/pkg/notifier"
+	"reviewbot/pkg/notifier/notifiertypes"
+	"sync"
+	"time"
+)
+
+// LogNotifier writes every message as a JSON line instead of delivering it. It is meant for local testing.
+type LogNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogNotifier(w io.Writer) notifier.Notifier {
+	return &LogNotifier{w: w}
+}
+
+func (ln *LogNotifier) Notify(ctx context.Context, message notifiertypes.Message) error {
+	line, err := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		To      string    `json:"to"`
+		Subject string    `json:"subject"`
+		Body    string    `json:"body"`
+	}{time.Now().UTC(), message.To, message.Subject, message.Body})
+	if err != nil {
+		return err
+	}
+
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	_, err = ln.w.Write(append(line, '\n'))
+	return err
+}
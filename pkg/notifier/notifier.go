@@ -0,0 +1,12 @@
+package notifier
+
+import (
+	"context"
+	"reviewbot/pkg/notifier/notifiertypes"
+)
+
+// Notifier interface for delivering messages to customers
+type Notifier interface {
+	// Notify delivers the given message to its recipient
+	Notify(ctx context.Context, message notifiertypes.Message) error
+}
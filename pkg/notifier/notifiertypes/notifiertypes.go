@@ -0,0 +1,11 @@
+package notifiertypes
+
+// Message is a message to be delivered to a customer
+type Message struct {
+	// To is the address of the recipient, e.g. an email address
+	To string
+	// Subject is a short summary of the message
+	Subject string
+	// Body is the plain text content of the message
+	Body string
+}
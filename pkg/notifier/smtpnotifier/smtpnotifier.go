@@ -0,0 +1,73 @@
+package smtpnotifier
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"reviewbot/pkg/notifier"
+	"reviewbot/pkg/notifier/notifiertypes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config configures an SMTP notifier.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender address of the emails.
+	From string
+}
+
+// SMTPNotifier delivers messages as plain text emails.
+type SMTPNotifier struct {
+	config Config
+}
+
+func NewSMTPNotifier(config Config) notifier.Notifier {
+	return &SMTPNotifier{config: config}
+}
+
+func (sn *SMTPNotifier) Notify(ctx context.Context, message notifiertypes.Message) error {
+	if strings.ContainsAny(message.To, "\r\n") {
+		return fmt.Errorf("smtp notifier: invalid recipient %q", message.To)
+	}
+
+	addr := net.JoinHostPort(sn.config.Host, strconv.Itoa(sn.config.Port))
+	var auth smtp.Auth
+	if sn.config.Username != "" {
+		auth = smtp.PlainAuth("", sn.config.Username, sn.config.Password, sn.config.Host)
+	}
+
+	// smtp.SendMail does not accept a context, so the delivery is abandoned, not aborted, on cancellation.
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- smtp.SendMail(addr, auth, sn.config.From, []string{message.To}, sn.buildEmail(message))
+	}()
+	select {
+	case err := <-errChan:
+		if err != nil {
+			return fmt.Errorf("smtp notifier: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("smtp notifier: %w", ctx.Err())
+	}
+}
+
+func (sn *SMTPNotifier) buildEmail(message notifiertypes.Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + sn.config.From + "\r\n")
+	b.WriteString("To: " + message.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
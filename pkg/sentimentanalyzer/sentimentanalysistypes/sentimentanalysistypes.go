@@ -2,7 +2,7 @@ package sentimentanalysistypes
 
 // SentimentAnalysisResult is the given result of the sentiment analysis of a sentence
 type SentimentAnalysisResult struct {
-	// SentimentScore provides the sentiment score of the given sentence
+	// SentimentScore provides the sentiment score of the given sentence, from -1 to 1
 	// positive values mean positive sentiment
 	// negative values mean negative sentiment
 	SentimentScore int64